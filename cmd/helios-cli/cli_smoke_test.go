@@ -32,9 +32,15 @@ func TestCLI_CommitAndStats_Smoke(t *testing.T) {
 		t.Fatalf("build failed: %v\n%s", err, string(out))
 	}
 
-	// Run `commit` on an empty work dir; CLI should not panic and must print JSON
-	work := t.TempDir()
-	outC, err := exec.Command(bin, "commit", "--work", work).CombinedOutput()
+	// Run `commit` on an empty work dir; CLI should not panic and must print JSON.
+	// The repository goes in its own directory, not next to the sources.
+	work, repoDir := t.TempDir(), t.TempDir()
+	run := func(args ...string) *exec.Cmd {
+		c := exec.Command(bin, args...)
+		c.Dir = repoDir
+		return c
+	}
+	outC, err := run("commit", "--work", work).CombinedOutput()
 	if err != nil {
 		t.Fatalf("commit failed: %v\n%s", err, string(outC))
 	}
@@ -47,7 +53,7 @@ func TestCLI_CommitAndStats_Smoke(t *testing.T) {
 	}
 
 	// `stats` should be valid JSON and contain a top-level "l1"
-	outS, err := exec.Command(bin, "stats").CombinedOutput()
+	outS, err := run("stats").CombinedOutput()
 	if err != nil {
 		t.Fatalf("stats failed: %v\n%s", err, string(outS))
 	}
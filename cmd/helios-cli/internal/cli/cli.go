@@ -16,17 +16,34 @@
 package cli
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
+	"net"
+	"net/http"
 	"os"
+	"path"
 	"path/filepath"
-	"strings"
+	"time"
 
+	"github.com/good-night-oppie/helios/internal/ignore"
+	"github.com/good-night-oppie/helios/internal/index"
+	"github.com/good-night-oppie/helios/internal/ingest"
 	"github.com/good-night-oppie/helios/internal/metrics"
+	"github.com/good-night-oppie/helios/internal/watch"
+	"github.com/good-night-oppie/helios/pkg/helios/archive"
+	"github.com/good-night-oppie/helios/pkg/helios/gitio"
 	"github.com/good-night-oppie/helios/pkg/helios/l1cache"
+	"github.com/good-night-oppie/helios/pkg/helios/mcp"
 	"github.com/good-night-oppie/helios/pkg/helios/objstore"
+	"github.com/good-night-oppie/helios/pkg/helios/remote"
+	"github.com/good-night-oppie/helios/pkg/helios/repo"
+	"github.com/good-night-oppie/helios/pkg/helios/server"
 	"github.com/good-night-oppie/helios/pkg/helios/types"
 	"github.com/good-night-oppie/helios/pkg/helios/vst"
 	"github.com/good-night-oppie/helios/pkg/cli"
@@ -36,10 +53,16 @@ import (
 type Engine interface {
 	AttachStores(l1cache.Cache, objstore.Store)
 	WriteFile(path string, content []byte) error
+	WriteFileMode(path string, content []byte, mode fs.FileMode) error
+	ReadFile(path string) ([]byte, error)
+	DeleteFile(path string)
+	Reset()
 	Commit(msg string) (types.SnapshotID, types.CommitMetrics, error)
 	Restore(id types.SnapshotID) error
 	Diff(from, to types.SnapshotID) (types.DiffStats, error)
 	Materialize(id types.SnapshotID, outDir string, opts types.MatOpts) (types.CommitMetrics, error)
+	FS(id types.SnapshotID) (*vst.TreeFS, error)
+	SetParents(id types.SnapshotID, parents []types.SnapshotID) error
 	L1Stats() l1cache.CacheStats
 	EngineMetricsSnapshot() metrics.Snapshot
 }
@@ -53,10 +76,24 @@ type Config struct {
 type MatOpts struct {
 	Include []string
 	Exclude []string
+	Sync    bool
+	// Prune lets Sync delete selected files no earlier sync wrote (see types.MatOpts)
+	Prune bool
+	// BlobCache and ReadOnly place files from a local blob cache (see types.MatOpts)
+	BlobCache string
+	ReadOnly  bool
+}
+
+// CommitOpts for commit command
+type CommitOpts struct {
+	// GitIgnore also applies .gitignore files, below .heliosignore at each level
+	GitIgnore bool
+	// Jobs is the number of files hashed in parallel; 0 means one per CPU
+	Jobs int
 }
 
 // HandleCommit processes commit command
-func HandleCommit(w io.Writer, cfg Config, workDir string) error {
+func HandleCommit(w io.Writer, cfg Config, workDir string, opts CommitOpts) error {
 	if workDir != "" {
 		if err := os.Chdir(workDir); err != nil {
 			return fmt.Errorf("work dir: %w", err)
@@ -68,59 +105,681 @@ func HandleCommit(w io.Writer, cfg Config, workDir string) error {
 		return err
 	}
 
+	id, err := commitWorkDir(eng, opts)
+	if err != nil {
+		return err
+	}
+
+	out := map[string]any{
+		"snapshot_id": id,
+	}
+	return json.NewEncoder(w).Encode(out)
+}
+
+// commitWorkDir ingests the current working directory into eng's working
+// set, commits it and advances HEAD.
+func commitWorkDir(eng Engine, opts CommitOpts) (types.SnapshotID, error) {
 	// Ingest current working directory into the engine before committing.
 	// This populates v.cur so that Commit() has real blobs to persist into L2.
-	if err := ingestCurrentDir(eng); err != nil {
-		return err
+	ix, err := ingestCurrentDir(eng, opts)
+	if err != nil {
+		return "", err
 	}
 
 	id, _, err := eng.Commit("")
+	if err != nil {
+		return "", err
+	}
+	// Only now are the indexed blobs known to be stored. The index is a
+	// cache, so failing to save it does not fail the commit.
+	if ix != nil {
+		if err := ix.Save(indexPath()); err != nil {
+			fmt.Fprintf(os.Stderr, "helios: save index: %v\n", err)
+		}
+	}
+	if err := advanceHead(eng, id); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// localRepo returns the repository of the current directory.
+func localRepo() (repo.Repo, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return repo.Repo{}, fmt.Errorf("get working directory: %w", err)
+	}
+	return cli.ResolveRepo(cwd)
+}
+
+// advanceHead points HEAD at id, recording the previous HEAD as its parent
+// so that pushes can tell a fast-forward.
+func advanceHead(eng Engine, id types.SnapshotID) error {
+	r, err := localRepo()
 	if err != nil {
 		return err
 	}
+	refs, err := r.Refs()
+	if err != nil {
+		return err
+	}
+	old := refs[repo.Head]
+	if old == id {
+		return nil
+	}
+	if old != "" {
+		if err := eng.SetParents(id, []types.SnapshotID{old}); err != nil {
+			return err
+		}
+	}
+	return r.UpdateRefs([]repo.RefUpdate{{Name: repo.Head, Old: old, New: id}})
+}
 
-	out := map[string]any{
-		"snapshot_id": id,
+// localEndpoint returns the repository of the current directory as a sync
+// endpoint sharing eng's object store.
+func localEndpoint(eng Engine) (*remote.Local, error) {
+	l2, ok := eng.(interface{ L2() objstore.Store })
+	if !ok || l2.L2() == nil {
+		return nil, fmt.Errorf("engine %T has no object store to sync", eng)
 	}
-	return json.NewEncoder(w).Encode(out)
+	r, err := localRepo()
+	if err != nil {
+		return nil, err
+	}
+	return remote.NewLocal(r, l2.L2()), nil
+}
+
+// hashWriter is implemented by engines that can take a file by the hash of
+// its already-stored content (see vst.VST.WriteFileHash) and store blobs
+// directly (vst.VST.StoreBlobs).
+type hashWriter interface {
+    WriteFileHash(path string, h types.Hash) error
+    StoreBlobs(batch []objstore.BatchEntry) error
+}
+
+// indexPath locates the stat cache of the working directory.
+func indexPath() string {
+    return filepath.Join(".helios", index.FileName)
+}
+
+// ignoreFilter returns the exclusion rule for working-directory paths below
+// root: .git and .helios at any depth, then the global ignore file and the
+// .heliosignore (and, with gitIgnore, .gitignore) files of each directory.
+func ignoreFilter(root string, gitIgnore bool) (func(rel string, isDir bool) (bool, error), error) {
+    skip := map[string]struct{}{".git": {}, ".helios": {}}
+
+    var global *ignore.Matcher
+    if gf := ignore.GlobalFile(); gf != "" {
+        ps, err := ignore.ReadFile(gf, "")
+        if err != nil { return nil, fmt.Errorf("global ignore file: %w", err) }
+        global = ignore.NewMatcher(ps)
+    }
+    files := []string{ignore.FileName}
+    if gitIgnore {
+        files = []string{".gitignore", ignore.FileName}
+    }
+    ign := ignore.NewTree(root, global, files...)
+
+    return func(rel string, isDir bool) (bool, error) {
+        if _, found := skip[filepath.Base(rel)]; found && isDir {
+            return true, nil
+        }
+        return ign.Ignored(rel, isDir)
+    }, nil
 }
 
 // ingestCurrentDir walks the current working dir and writes regular files
-// into the engine using relative, slash-normalized paths.
-// Skips internal folders like .git and .helios.
-func ingestCurrentDir(eng interface{ WriteFile(string, []byte) error }) error {
+// into the engine's working set using paths relative to the root. .git and
+// .helios are always skipped; anything else excluded by the global ignore
+// file or a .heliosignore (and, with opts.GitIgnore, .gitignore) is too.
+// Files are read and hashed in parallel (see internal/ingest).
+//
+// Engines that implement hashWriter get files by hash: blobs go straight to
+// the store in batches, and files whose stat data match the .helios/index
+// stat cache are not read at all. The returned index describes this walk and
+// should be saved once the commit has succeeded; it is nil for other engines.
+func ingestCurrentDir(eng interface{ WriteFile(string, []byte) error }, opts CommitOpts) (*index.Index, error) {
     root, err := os.Getwd()
-    if err != nil { return err }
-    skip := map[string]struct{}{".git": {}, ".helios": {}}
+    if err != nil { return nil, err }
+    excluded, err := ignoreFilter(root, opts.GitIgnore)
+    if err != nil { return nil, err }
+    iopts := ingest.Options{Workers: opts.Jobs, Ignore: excluded}
 
-    return filepath.WalkDir(root, func(path string, d fs.DirEntry, walkErr error) error {
-        if walkErr != nil { return walkErr }
-        name := d.Name()
-        if d.IsDir() {
-            if _, found := skip[name]; found {
-                return fs.SkipDir
+    hw, _ := eng.(hashWriter)
+    var next *index.Index
+    if hw != nil {
+        r, err := cli.ResolveRepo(root)
+        if err != nil { return nil, err }
+        // Blobs named by the index are only known to be in this store.
+        store, err := cli.StoreLocation(r)
+        if err != nil { return nil, err }
+        // Stamp before the first stat so that files modified during the
+        // walk count as racily clean next time.
+        next = index.New(time.Now(), store)
+        prev, err := index.Load(indexPath())
+        if err != nil || prev.Store != store {
+            if err != nil && os.Getenv("HELIOS_DEBUG") == "1" {
+                fmt.Fprintf(os.Stderr, "helios-debug: ignoring index: %v\n", err)
             }
-            return nil
-        }
-        // Only ingest regular files; skip symlinks, sockets, etc.
-        if !d.Type().IsRegular() { return nil }
-
-        rel, err := filepath.Rel(root, path)
-        if err != nil { return err }
-        rel = filepath.ToSlash(rel)
-        // Double safety: skip anything under .git/ or .helios/
-        if strings.HasPrefix(rel, ".git/") || strings.HasPrefix(rel, ".helios/") {
-            return nil
+            prev = index.New(time.Time{}, store)
         }
+        iopts.Cached = prev.Lookup
+        iopts.Store = hw.StoreBlobs
+    }
 
-        b, err := os.ReadFile(path)
-        if err != nil { return err }
-        if err := eng.WriteFile(rel, b); err != nil { return err }
-        if os.Getenv("HELIOS_DEBUG") == "1" {
-            fmt.Fprintf(os.Stderr, "helios-debug: ingest %s (%d bytes)\n", rel, len(b))
+    ingested, err := ingest.Dir(root, iopts)
+    if err != nil { return nil, err }
+    for _, f := range ingested {
+        if hw != nil {
+            next.Set(f.Path, f.Stat, f.Hash)
+            err = hw.WriteFileHash(f.Path, f.Hash)
+        } else {
+            err = eng.WriteFile(f.Path, f.Data)
+        }
+        if err != nil { return nil, err }
+        if os.Getenv("HELIOS_DEBUG") == "1" && !f.Cached {
+            fmt.Fprintf(os.Stderr, "helios-debug: ingest %s (%d bytes)\n", f.Path, f.Stat.Size)
         }
-        return nil
-    })
+    }
+    return next, nil
+}
+
+// WatchOpts for watch command
+type WatchOpts struct {
+	CommitOpts
+	// Quiet is how long the tree must be still before a checkpoint
+	Quiet time.Duration
+	// Every forces a checkpoint once this many paths changed; 0 disables it
+	Every int
+}
+
+// HandleWatch checkpoints the working directory whenever it changes: after
+// opts.Quiet without further changes, or once opts.Every paths changed. It
+// commits once at start and once more for pending changes when ctx ends, and
+// writes one JSON line per new snapshot.
+func HandleWatch(ctx context.Context, w io.Writer, cfg Config, workDir string, opts WatchOpts) error {
+	if workDir != "" {
+		if err := os.Chdir(workDir); err != nil {
+			return fmt.Errorf("work dir: %w", err)
+		}
+	}
+	if opts.Quiet <= 0 {
+		return fmt.Errorf("--quiet must be positive")
+	}
+	root, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	eng, err := cfg.EngineFactory()
+	if err != nil {
+		return err
+	}
+
+	excluded, err := ignoreFilter(root, opts.GitIgnore)
+	if err != nil {
+		return err
+	}
+	// Runs on the watcher goroutine. Edits to ignore files take effect by
+	// reloading the rules; commits load their own.
+	filter := func(rel string, isDir bool) bool {
+		if base := path.Base(rel); !isDir && (base == ignore.FileName || base == ".gitignore") {
+			if next, err := ignoreFilter(root, opts.GitIgnore); err == nil {
+				excluded = next
+			}
+			return false
+		}
+		ignored, err := excluded(rel, isDir)
+		return err == nil && ignored
+	}
+	wt, err := watch.New(root, filter)
+	if err != nil {
+		return err
+	}
+	defer wt.Close()
+
+	enc := json.NewEncoder(w)
+	var last types.SnapshotID
+	pending := make(map[string]struct{})
+	checkpoint := func() error {
+		eng.Reset()
+		id, err := commitWorkDir(eng, opts.CommitOpts)
+		if err != nil {
+			return err
+		}
+		changes := len(pending)
+		clear(pending)
+		if id == last {
+			return nil
+		}
+		last = id
+		return enc.Encode(map[string]any{
+			"snapshot_id": id,
+			"changes":     changes,
+			"time":        time.Now().UTC().Format(time.RFC3339Nano),
+		})
+	}
+	if err := checkpoint(); err != nil {
+		return err
+	}
+
+	timer := time.NewTimer(opts.Quiet)
+	stopTimer := func() {
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+	}
+	stopTimer()
+	for {
+		select {
+		case <-ctx.Done():
+			if len(pending) == 0 {
+				return nil
+			}
+			return checkpoint()
+		case err, ok := <-wt.Errors:
+			if ok {
+				return err
+			}
+		case ev, ok := <-wt.Events:
+			if !ok {
+				return nil
+			}
+			pending[ev.Path] = struct{}{}
+			stopTimer()
+			if opts.Every > 0 && len(pending) >= opts.Every {
+				if err := checkpoint(); err != nil {
+					return err
+				}
+				continue
+			}
+			timer.Reset(opts.Quiet)
+		case <-timer.C:
+			if len(pending) > 0 {
+				if err := checkpoint(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// ServeOpts for serve command
+type ServeOpts struct {
+	// Addr is the TCP address to listen on, used when Socket is empty
+	Addr string
+	// Socket is a Unix socket path; a stale socket there is replaced
+	Socket string
+	// Token is the bearer token TCP clients must send; empty means
+	// $HELIOS_TOKEN, or a random one when that is unset too
+	Token string
+}
+
+// HandleServe keeps one engine resident and serves it over HTTP/JSON (see
+// pkg/helios/server), along with the sync API for push and pull (see
+// pkg/helios/remote), until ctx ends. It first writes a JSON line with the
+// address it listens on and, for TCP, the token clients must send.
+func HandleServe(ctx context.Context, w io.Writer, cfg Config, opts ServeOpts) error {
+	eng, err := cfg.EngineFactory()
+	if err != nil {
+		return err
+	}
+
+	var ln net.Listener
+	if opts.Socket != "" {
+		if fi, err := os.Lstat(opts.Socket); err == nil && fi.Mode()&fs.ModeSocket != 0 {
+			if err := os.Remove(opts.Socket); err != nil {
+				return err
+			}
+		}
+		if ln, err = net.Listen("unix", opts.Socket); err != nil {
+			return err
+		}
+		// The API can rewrite the working set; keep it to this user.
+		if err := os.Chmod(opts.Socket, 0o600); err != nil {
+			ln.Close()
+			return err
+		}
+	} else {
+		if opts.Addr == "" {
+			return fmt.Errorf("--addr or --socket is required")
+		}
+		// Any local user can reach a TCP port, so require a token there.
+		if opts.Token == "" {
+			opts.Token = os.Getenv("HELIOS_TOKEN")
+		}
+		if opts.Token == "" {
+			b := make([]byte, 16)
+			if _, err := rand.Read(b); err != nil {
+				return err
+			}
+			opts.Token = hex.EncodeToString(b)
+		}
+		if ln, err = net.Listen("tcp", opts.Addr); err != nil {
+			return err
+		}
+	}
+
+	var h http.Handler = server.New(eng)
+	if local, err := localEndpoint(eng); err == nil {
+		// Let other repositories push to and pull from this one.
+		mux := http.NewServeMux()
+		mux.Handle("/v1/sync/", remote.Handler(local))
+		mux.Handle("/", h)
+		h = mux
+	}
+	out := map[string]any{"listening": ln.Addr().String(), "network": ln.Addr().Network()}
+	if opts.Socket == "" {
+		h = server.RequireToken(h, opts.Token)
+		out["token"] = opts.Token
+	}
+	srv := &http.Server{Handler: h, ReadHeaderTimeout: 10 * time.Second}
+	if err := json.NewEncoder(w).Encode(out); err != nil {
+		ln.Close()
+		return err
+	}
+
+	errc := make(chan error, 1)
+	go func() { errc <- srv.Serve(ln) }()
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdown); err != nil {
+		return err
+	}
+	if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// SyncOpts for push and pull commands
+type SyncOpts struct {
+	// Ref is the ref to send (push) or fetch (pull), HEAD when empty, or
+	// a snapshot id when As is set
+	Ref string
+	// As names the ref on the receiving side; Ref when empty
+	As string
+	// Force allows moving the receiving ref to a snapshot that does not
+	// descend from its current one
+	Force bool
+}
+
+func (o SyncOpts) names() (string, string) {
+	ref, as := o.Ref, o.As
+	if ref == "" {
+		ref = repo.Head
+	}
+	if as == "" {
+		as = ref
+	}
+	return ref, as
+}
+
+// pick returns the snapshot to send from the sending side's refs and the
+// ref it moves on the receiving side. Ref may also be a snapshot id, such
+// as one from import or serve, which no ref names yet; As is then required.
+func (o SyncOpts) pick(refs map[string]types.SnapshotID, side string) (types.SnapshotID, string, error) {
+	ref, as := o.names()
+	if id, ok := refs[ref]; ok {
+		return id, as, nil
+	}
+	if o.As == "" {
+		return "", "", fmt.Errorf("no ref %s in the %s repository (use --as to send a snapshot id)", ref, side)
+	}
+	return resolveSnapshot(refs, ref), as, nil
+}
+
+// HandlePush sends a ref or snapshot of the current repository, with the
+// snapshots and blobs the remote lacks, to a remote path or helios serve URL
+func HandlePush(w io.Writer, cfg Config, remoteSpec string, opts SyncOpts) error {
+	if remoteSpec == "" {
+		return fmt.Errorf("remote is required")
+	}
+	eng, err := cfg.EngineFactory()
+	if err != nil {
+		return err
+	}
+	local, err := localEndpoint(eng)
+	if err != nil {
+		return err
+	}
+	refs, err := local.Refs()
+	if err != nil {
+		return err
+	}
+	id, as, err := opts.pick(refs, "local")
+	if err != nil {
+		return err
+	}
+	rem, err := remote.Open(remoteSpec)
+	if err != nil {
+		return err
+	}
+	defer rem.Close()
+	res, err := remote.Transfer(local, rem, map[string]types.SnapshotID{as: id}, remote.Options{Force: opts.Force})
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(w).Encode(res)
+}
+
+// HandlePull fetches a ref or snapshot of a remote, with the snapshots and
+// blobs the current repository lacks, into the current repository
+func HandlePull(w io.Writer, cfg Config, remoteSpec string, opts SyncOpts) error {
+	if remoteSpec == "" {
+		return fmt.Errorf("remote is required")
+	}
+	eng, err := cfg.EngineFactory()
+	if err != nil {
+		return err
+	}
+	local, err := localEndpoint(eng)
+	if err != nil {
+		return err
+	}
+	rem, err := remote.Open(remoteSpec)
+	if err != nil {
+		return err
+	}
+	defer rem.Close()
+	refs, err := rem.Refs()
+	if err != nil {
+		return err
+	}
+	id, as, err := opts.pick(refs, "remote")
+	if err != nil {
+		return err
+	}
+	res, err := remote.Transfer(rem, local, map[string]types.SnapshotID{as: id}, remote.Options{Force: opts.Force})
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(w).Encode(res)
+}
+
+// CloneOpts for clone command
+type CloneOpts struct {
+	// NoCheckout skips writing HEAD's files into the new directory
+	NoCheckout bool
+}
+
+// HandleClone creates a repository in dir holding every ref of a remote,
+// then writes HEAD's files into dir
+func HandleClone(w io.Writer, remoteSpec, dir string, opts CloneOpts) error {
+	if remoteSpec == "" || dir == "" {
+		return fmt.Errorf("remote and directory are required")
+	}
+	if ents, err := os.ReadDir(dir); err == nil && len(ents) > 0 {
+		return fmt.Errorf("%s exists and is not empty", dir)
+	}
+	r := repo.Repo{Dir: filepath.Join(dir, ".helios"), ObjectsDir: filepath.Join(dir, ".helios", "objects")}
+	if _, err := r.Init(); err != nil {
+		return err
+	}
+	store, err := objstore.Open(r.ObjectsDir, nil)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	rem, err := remote.Open(remoteSpec)
+	if err != nil {
+		return err
+	}
+	defer rem.Close()
+	refs, err := rem.Refs()
+	if err != nil {
+		return err
+	}
+	res, err := remote.Transfer(rem, remote.NewLocal(r, store), refs, remote.Options{})
+	if err != nil {
+		return err
+	}
+
+	out := map[string]any{"snapshots": res.Snapshots, "blobs": res.Blobs, "bytes": res.Bytes, "refs": refs}
+	if head, ok := refs[repo.Head]; ok && !opts.NoCheckout {
+		eng := vst.New()
+		eng.AttachStores(nil, store)
+		mo := types.MatOpts{Sync: true, Exclude: []string{".helios/**"}}
+		if _, err := eng.Materialize(head, dir, mo); err != nil {
+			return fmt.Errorf("checkout %s: %w", head, err)
+		}
+		out["checkout"] = head
+	}
+	return json.NewEncoder(w).Encode(out)
+}
+
+// BundleOpts for bundle create command
+type BundleOpts struct {
+	// ID is the snapshot, or the name of a ref, to bundle
+	ID string
+	// Since is a snapshot the receiver has; the bundle leaves out it, its
+	// ancestors and its blobs
+	Since string
+}
+
+// resolveSnapshot returns the snapshot a ref names, or s itself.
+func resolveSnapshot(refs map[string]types.SnapshotID, s string) types.SnapshotID {
+	if id, ok := refs[s]; ok {
+		return id
+	}
+	return types.SnapshotID(s)
+}
+
+// HandleBundleCreate writes a snapshot closure to a bundle file, or to w
+// for "-"
+func HandleBundleCreate(w io.Writer, cfg Config, out string, opts BundleOpts) error {
+	if opts.ID == "" || out == "" {
+		return fmt.Errorf("--id and an output file are required")
+	}
+	eng, err := cfg.EngineFactory()
+	if err != nil {
+		return err
+	}
+	local, err := localEndpoint(eng)
+	if err != nil {
+		return err
+	}
+	refs, err := local.Refs()
+	if err != nil {
+		return err
+	}
+	id := resolveSnapshot(refs, opts.ID)
+	var since types.SnapshotID
+	if opts.Since != "" {
+		since = resolveSnapshot(refs, opts.Since)
+	}
+
+	if out == "-" {
+		_, err := remote.WriteBundle(w, local, id, since)
+		return err
+	}
+	// Write next to the destination and rename, so a failed bundle never
+	// leaves a truncated file behind.
+	tmp, err := os.CreateTemp(filepath.Dir(out), "."+filepath.Base(out)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	st, err := remote.WriteBundle(tmp, local, id, since)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), out); err != nil {
+		return err
+	}
+	return json.NewEncoder(w).Encode(st)
+}
+
+// UnbundleOpts for bundle unbundle command
+type UnbundleOpts struct {
+	// Ref, if set, is pointed at the bundle's snapshot
+	Ref string
+	// Force moves Ref even if the update is not a fast-forward
+	Force bool
+}
+
+// HandleUnbundle verifies a bundle file and stores its snapshots and blobs
+// in the current repository
+func HandleUnbundle(w io.Writer, cfg Config, in string, opts UnbundleOpts) error {
+	if in == "" {
+		return fmt.Errorf("a bundle file is required")
+	}
+	f, err := os.Open(in)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	eng, err := cfg.EngineFactory()
+	if err != nil {
+		return err
+	}
+	local, err := localEndpoint(eng)
+	if err != nil {
+		return err
+	}
+	st, err := remote.ReadBundle(f, local)
+	if err != nil {
+		return err
+	}
+	out := map[string]any{"tip": st.Tip, "snapshots": st.Snapshots, "blobs": st.Blobs, "bytes": st.Bytes}
+	if opts.Ref != "" {
+		res, err := remote.Transfer(local, local, map[string]types.SnapshotID{opts.Ref: st.Tip}, remote.Options{Force: opts.Force})
+		if err != nil {
+			return err
+		}
+		out["refs"] = res.Refs
+	}
+	return json.NewEncoder(w).Encode(out)
+}
+
+// HandleMCP keeps one engine resident and serves it to an agent as a Model
+// Context Protocol server on r and w (stdin and stdout) until r closes or
+// ctx is done. version is reported to the client.
+func HandleMCP(ctx context.Context, r io.Reader, w io.Writer, cfg Config, version string) error {
+	eng, err := cfg.EngineFactory()
+	if err != nil {
+		return err
+	}
+	me, ok := eng.(mcp.Engine)
+	if !ok {
+		return fmt.Errorf("engine %T does not support mcp", eng)
+	}
+	return mcp.New(me, version).Serve(ctx, r, w)
 }
 
 // HandleRestore processes restore command
@@ -175,6 +834,11 @@ func HandleMaterialize(w io.Writer, cfg Config, id, outDir string, opts MatOpts)
 	matOpts := types.MatOpts{
 		Include: opts.Include,
 		Exclude: opts.Exclude,
+		Sync:    opts.Sync,
+		Prune:   opts.Prune,
+
+		BlobCache: opts.BlobCache,
+		ReadOnly:  opts.ReadOnly,
 	}
 
 	_, err = eng.Materialize(types.SnapshotID(id), outDir, matOpts)
@@ -189,6 +853,169 @@ func HandleMaterialize(w io.Writer, cfg Config, id, outDir string, opts MatOpts)
 	return json.NewEncoder(w).Encode(out)
 }
 
+// HandleExport processes export command, writing a snapshot as an archive.
+// With out set to "-" the archive goes to w instead of a file.
+func HandleExport(w io.Writer, cfg Config, id, format, out string) error {
+	if id == "" || out == "" {
+		return fmt.Errorf("--id and -o are required")
+	}
+	var f archive.Format
+	if format != "" {
+		var err error
+		if f, err = archive.ParseFormat(format); err != nil {
+			return err
+		}
+	} else if guessed, ok := archive.FormatFromPath(out); ok {
+		f = guessed
+	} else {
+		return fmt.Errorf("--format is required when it cannot be inferred from %q", out)
+	}
+
+	eng, err := cfg.EngineFactory()
+	if err != nil {
+		return err
+	}
+	fsys, err := eng.FS(types.SnapshotID(id))
+	if err != nil {
+		return err
+	}
+
+	if out == "-" {
+		return archive.Write(w, fsys, f)
+	}
+	// Write next to the destination and rename, so a failed export never
+	// leaves a truncated archive behind.
+	tmp, err := os.CreateTemp(filepath.Dir(out), "."+filepath.Base(out)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := archive.Write(tmp, fsys, f); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), out); err != nil {
+		return err
+	}
+
+	return json.NewEncoder(w).Encode(map[string]any{
+		"exported": id,
+		"format":   f,
+		"out":      out,
+	})
+}
+
+// HandleImport processes import command, committing an archive's contents
+// as a new snapshot. The format is detected from the content; "-" reads stdin.
+func HandleImport(w io.Writer, cfg Config, path string) error {
+	if path == "" {
+		return fmt.Errorf("archive path is required")
+	}
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	eng, err := cfg.EngineFactory()
+	if err != nil {
+		return err
+	}
+	files := 0
+	err = archive.Read(r, func(name string, data []byte, mode fs.FileMode) error {
+		files++
+		return eng.WriteFileMode(name, data, mode)
+	})
+	if err != nil {
+		return fmt.Errorf("import %s: %w", path, err)
+	}
+	id, _, err := eng.Commit("")
+	if err != nil {
+		return err
+	}
+
+	return json.NewEncoder(w).Encode(map[string]any{
+		"snapshot_id": id,
+		"files":       files,
+	})
+}
+
+// GitExportOpts for export --to-git
+type GitExportOpts struct {
+	Branch  string
+	Message string
+	Author  string
+}
+
+// HandleGitImport processes import --from-git, turning rev and its history
+// into snapshots
+func HandleGitImport(w io.Writer, cfg Config, repoPath, rev string) error {
+	if repoPath == "" {
+		return fmt.Errorf("--from-git is required")
+	}
+	if rev == "" {
+		rev = "HEAD"
+	}
+	r, err := gitio.Open(repoPath)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	eng, err := cfg.EngineFactory()
+	if err != nil {
+		return err
+	}
+	res, err := gitio.Import(r, eng, rev)
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(w).Encode(res)
+}
+
+// HandleGitExport processes export --to-git, committing a snapshot on a git branch
+func HandleGitExport(w io.Writer, cfg Config, id, repoPath string, opts GitExportOpts) error {
+	if id == "" || repoPath == "" || opts.Branch == "" {
+		return fmt.Errorf("--id, --to-git and --branch are required")
+	}
+	r, err := gitio.Open(repoPath)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	eng, err := cfg.EngineFactory()
+	if err != nil {
+		return err
+	}
+	fsys, err := eng.FS(types.SnapshotID(id))
+	if err != nil {
+		return err
+	}
+	if opts.Message == "" {
+		opts.Message = "helios snapshot " + id
+	}
+	res, err := gitio.Export(r, fsys, gitio.ExportOptions{
+		Branch:  opts.Branch,
+		Message: opts.Message,
+		Author:  opts.Author,
+	})
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(w).Encode(res)
+}
+
 // HandleStats processes stats command
 func HandleStats(w io.Writer, cfg Config) error {
 	eng, err := cfg.EngineFactory()
@@ -201,11 +1028,15 @@ func HandleStats(w io.Writer, cfg Config) error {
 
 	out := map[string]any{
 		"l1": map[string]any{
-			"hits":      st.Hits,
-			"misses":    st.Misses,
-			"evictions": st.Evictions,
-			"size":      st.SizeBytes,
-			"items":     st.Items,
+			"hits":       st.Hits,
+			"misses":     st.Misses,
+			"evictions":  st.Evictions,
+			"size":       st.SizeBytes,
+			"items":      st.Items,
+			"raw_size":   st.RawBytes,
+			"ratio":      st.CompressionRatio,
+			"file_items": st.FileItems,
+			"file_size":  st.FileBytes,
 		},
 		"engine": map[string]any{
 			"commit_latency_us_p50": em.P50,
@@ -218,27 +1049,157 @@ func HandleStats(w io.Writer, cfg Config) error {
 	return json.NewEncoder(w).Encode(out)
 }
 
+// HandleMigrate processes migrate command, upgrading the repository format
+func HandleMigrate(w io.Writer, noBackup bool) error {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("get working directory: %w", err)
+	}
+	r, err := cli.ResolveRepo(cwd)
+	if err != nil {
+		return fmt.Errorf("resolve store directory: %w", err)
+	}
+	res, err := r.Migrate(repo.MigrateOptions{NoBackup: noBackup})
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(w).Encode(res)
+}
+
+// DictTrainOpts for dict train command
+type DictTrainOpts struct {
+	// ID is the snapshot, or the name of a ref, to sample; empty means HEAD
+	ID string
+	// Size is the dictionary size in bytes; 0 means l1cache.DefaultDictSize
+	Size int
+	// MaxSamples bounds the number of files read; 0 means 4000
+	MaxSamples int
+	// MaxFileSize skips larger files, which gain little from a dictionary;
+	// 0 means 64 KiB
+	MaxFileSize int64
+}
+
+// HandleDictTrain trains a compression dictionary from the small files of a
+// snapshot and stores it in the repository, where later commands use it
+// for the L1 cache
+func HandleDictTrain(w io.Writer, cfg Config, opts DictTrainOpts) error {
+	if opts.MaxSamples <= 0 {
+		opts.MaxSamples = 4000
+	}
+	if opts.MaxFileSize <= 0 {
+		opts.MaxFileSize = 64 << 10
+	}
+	eng, err := cfg.EngineFactory()
+	if err != nil {
+		return err
+	}
+	r, err := localRepo()
+	if err != nil {
+		return err
+	}
+	refs, err := r.Refs()
+	if err != nil {
+		return err
+	}
+	if opts.ID == "" {
+		opts.ID = repo.Head
+	}
+	id := resolveSnapshot(refs, opts.ID)
+	if id == repo.Head {
+		return fmt.Errorf("no HEAD to train from; commit first or pass --id")
+	}
+	tree, err := eng.FS(id)
+	if err != nil {
+		return err
+	}
+
+	var paths []string
+	err = fs.WalkDir(tree, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		paths = append(paths, p)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// Spread the samples evenly over the tree rather than taking its first
+	// directories. Sizes are checked only for the files picked, as learning
+	// one means loading its blob.
+	step := max(len(paths)/opts.MaxSamples, 1)
+	var samples [][]byte
+	for i := 0; i < len(paths) && len(samples) < opts.MaxSamples; i += step {
+		b, err := tree.ReadFile(paths[i])
+		if err != nil {
+			return err
+		}
+		if len(b) > 0 && int64(len(b)) <= opts.MaxFileSize {
+			samples = append(samples, b)
+		}
+	}
+
+	dictID, err := r.NextDictID()
+	if err != nil {
+		return err
+	}
+	dict, err := l1cache.TrainDict(dictID, samples, opts.Size)
+	if err != nil {
+		return err
+	}
+	if err := r.WriteDict(dictID, dict); err != nil {
+		return err
+	}
+	out := map[string]any{"id": dictID, "size": len(dict), "samples": len(samples), "snapshot": id}
+	return json.NewEncoder(w).Encode(out)
+}
+
 // DefaultEngineFactory creates a real engine with L1/L2 stores
 func DefaultEngineFactory() (Engine, error) {
 	eng := vst.New()
 
-	// Attach a small L1 cache for observable stats
-	l1, _ := l1cache.New(l1cache.Config{CapacityBytes: 8 << 20, CompressionThreshold: 256})
-
 	// Get store directory using the unified resolver
 	cwd, err := os.Getwd()
 	if err != nil {
 		return nil, fmt.Errorf("get working directory: %w", err)
 	}
-	objDir, err := cli.ResolveStore(cwd)
+	r, err := cli.ResolveRepo(cwd)
 	if err != nil {
 		return nil, fmt.Errorf("resolve store directory: %w", err)
 	}
 	if os.Getenv("HELIOS_DEBUG") == "1" {
-		fmt.Fprintf(os.Stderr, "helios-debug: cwd=%s store=%s\n", cwd, objDir)
+		fmt.Fprintf(os.Stderr, "helios-debug: cwd=%s store=%s\n", cwd, r.ObjectsDir)
+	}
+	if _, err := r.Open(); err != nil {
+		return nil, err
+	}
+
+	// Attach a small L1 cache for observable stats, compressing with the
+	// repository's dictionaries if it has any. It is backed by a file in the
+	// repository, so it stays warm and its stats accumulate across commands,
+	// unless HELIOS_L1_PERSIST=0.
+	dicts, err := r.Dicts()
+	if err != nil {
+		return nil, fmt.Errorf("load dictionaries: %w", err)
+	}
+	l1cfg := l1cache.Config{CapacityBytes: 8 << 20, CompressionThreshold: 256}
+	for _, d := range dicts {
+		l1cfg.Dicts = append(l1cfg.Dicts, d.Data)
+	}
+	if os.Getenv("HELIOS_L1_PERSIST") != "0" {
+		l1cfg.File = filepath.Join(r.Dir, repo.L1CacheFile)
+	}
+	l1, err := l1cache.New(l1cfg)
+	if err != nil && l1cfg.File != "" {
+		// Unsupported platform or unusable file: run with memory only.
+		l1cfg.File = ""
+		l1, err = l1cache.New(l1cfg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("create L1 cache: %w", err)
 	}
 
-	l2, err := objstore.Open(objDir, nil)
+	l2, err := cli.OpenStore(r)
 	if err != nil {
 		return nil, err
 	}
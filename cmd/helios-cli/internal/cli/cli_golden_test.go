@@ -39,8 +39,16 @@ func TestHandleCommit_Golden(t *testing.T) {
 	cfg := Config{
 		EngineFactory: func() (Engine, error) { return fake, nil },
 	}
+	// Commit in a scratch directory, since it records HEAD there, and come
+	// back for the golden files.
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
 	buf := &bytes.Buffer{}
-	if err := HandleCommit(buf, cfg, ""); err != nil {
+	err = HandleCommit(buf, cfg, t.TempDir(), CommitOpts{})
+	os.Chdir(cwd)
+	if err != nil {
 		t.Fatal(err)
 	}
 	assertJSONGolden(t, "commit_basic", buf.Bytes(), *updateGolden)
@@ -95,11 +103,13 @@ func TestHandleMaterialize_Golden(t *testing.T) {
 func TestHandleStats_Golden(t *testing.T) {
 	fake := &FakeEngine{
 		l1Stats: l1cache.CacheStats{
-			Hits:      42,
-			Misses:    13,
-			Evictions: 5,
-			SizeBytes: 2048,
-			Items:     37,
+			Hits:             42,
+			Misses:           13,
+			Evictions:        5,
+			SizeBytes:        2048,
+			Items:            37,
+			RawBytes:         6144,
+			CompressionRatio: 3,
 		},
 	}
 	cfg := Config{
@@ -12,20 +12,36 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-
 package cli
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/good-night-oppie/helios/internal/metrics"
+	"github.com/good-night-oppie/helios/internal/util"
+	"github.com/good-night-oppie/helios/pkg/helios/client"
 	"github.com/good-night-oppie/helios/pkg/helios/l1cache"
 	"github.com/good-night-oppie/helios/pkg/helios/objstore"
+	"github.com/good-night-oppie/helios/pkg/helios/repo"
+	"github.com/good-night-oppie/helios/pkg/helios/server"
 	"github.com/good-night-oppie/helios/pkg/helios/types"
+	"github.com/good-night-oppie/helios/pkg/helios/vst"
 )
 
 // FakeEngine implements Engine interface for testing
@@ -38,11 +54,34 @@ type FakeEngine struct {
 	diffError        error
 	materializeError error
 	l1Stats          l1cache.CacheStats
+	fs               *vst.TreeFS
+	written          []string
 }
 
+// A remote engine can stand in for the embedded one.
+var _ Engine = (*client.Client)(nil)
+
 func (f *FakeEngine) AttachStores(l1cache.Cache, objstore.Store) {}
 
 func (f *FakeEngine) WriteFile(path string, content []byte) error {
+	f.written = append(f.written, path)
+	return nil
+}
+
+func (f *FakeEngine) WriteFileMode(path string, content []byte, mode fs.FileMode) error {
+	f.written = append(f.written, path)
+	return nil
+}
+
+func (f *FakeEngine) ReadFile(path string) ([]byte, error) {
+	return nil, nil
+}
+
+func (f *FakeEngine) DeleteFile(path string) {}
+
+func (f *FakeEngine) Reset() {}
+
+func (f *FakeEngine) SetParents(id types.SnapshotID, parents []types.SnapshotID) error {
 	return nil
 }
 
@@ -62,6 +101,13 @@ func (f *FakeEngine) Materialize(id types.SnapshotID, outDir string, opts types.
 	return types.CommitMetrics{}, f.materializeError
 }
 
+func (f *FakeEngine) FS(id types.SnapshotID) (*vst.TreeFS, error) {
+	if f.fs == nil {
+		return nil, testError("unknown snapshot")
+	}
+	return f.fs, nil
+}
+
 func (f *FakeEngine) L1Stats() l1cache.CacheStats {
 	return f.l1Stats
 }
@@ -102,8 +148,18 @@ func TestHandleCommit(t *testing.T) {
 				EngineFactory: func() (Engine, error) { return tt.fake, nil },
 			}
 
+			// Commit records HEAD in the work dir's repository; keep it out
+			// of the source tree.
+			workDir := tt.workDir
+			if workDir == "" {
+				workDir = t.TempDir()
+				if cwd, err := os.Getwd(); err == nil {
+					defer os.Chdir(cwd)
+				}
+			}
+
 			buf := &bytes.Buffer{}
-			err := HandleCommit(buf, cfg, tt.workDir)
+			err := HandleCommit(buf, cfg, workDir, CommitOpts{})
 
 			if tt.wantErr {
 				if err == nil {
@@ -427,6 +483,44 @@ func TestDefaultEngineFactory(t *testing.T) {
 	_ = stats.Items
 }
 
+func TestDefaultEngineFactory_RefusesLegacyStore(t *testing.T) {
+	tmpDir := t.TempDir()
+	oldWd, _ := os.Getwd()
+	defer func() { _ = os.Chdir(oldWd) }()
+
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("failed to change to temp dir: %v", err)
+	}
+
+	// Simulate a store written before format versioning existed.
+	objDir := filepath.Join(tmpDir, ".helios", "objects")
+	if err := os.MkdirAll(objDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(objDir, "CURRENT"), []byte("MANIFEST-000001\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := DefaultEngineFactory(); !errors.Is(err, repo.ErrNeedsMigration) {
+		t.Fatalf("want ErrNeedsMigration, got %v", err)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := HandleMigrate(buf, true); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	var res repo.MigrateResult
+	if err := json.Unmarshal(buf.Bytes(), &res); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if res.From != 0 || res.To != repo.CurrentVersion {
+		t.Fatalf("unexpected migrate result: %+v", res)
+	}
+	if _, err := (repo.Repo{Dir: filepath.Join(tmpDir, ".helios"), ObjectsDir: objDir}).Open(); err != nil {
+		t.Fatalf("repository still not usable after migrate: %v", err)
+	}
+}
+
 func TestEngineFactoryError(t *testing.T) {
 	cfg := Config{
 		EngineFactory: func() (Engine, error) {
@@ -438,7 +532,7 @@ func TestEngineFactoryError(t *testing.T) {
 		name string
 		fn   func() error
 	}{
-		{"commit", func() error { return HandleCommit(&bytes.Buffer{}, cfg, "") }},
+		{"commit", func() error { return HandleCommit(&bytes.Buffer{}, cfg, "", CommitOpts{}) }},
 		{"restore", func() error { return HandleRestore(&bytes.Buffer{}, cfg, "test") }},
 		{"diff", func() error { return HandleDiff(&bytes.Buffer{}, cfg, "a", "b") }},
 		{"materialize", func() error { return HandleMaterialize(&bytes.Buffer{}, cfg, "test", "/tmp", MatOpts{}) }},
@@ -495,7 +589,7 @@ func TestHandleCommitWithWorkDir(t *testing.T) {
 	}
 
 	buf := &bytes.Buffer{}
-	err := HandleCommit(buf, cfg, tmpDir)
+	err := HandleCommit(buf, cfg, tmpDir, CommitOpts{})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -510,6 +604,692 @@ func TestHandleCommitWithWorkDir(t *testing.T) {
 	}
 }
 
+func TestHandleCommit_Ignore(t *testing.T) {
+	// HandleCommit changes directory; earlier tests may have left the
+	// process in a removed temp dir, so only restore a valid one.
+	if cwd, err := os.Getwd(); err == nil {
+		defer os.Chdir(cwd)
+	}
+
+	root := t.TempDir()
+	for rel, data := range map[string]string{
+		".heliosignore":     "*.log\nbuild/\n",
+		".gitignore":        "secret.txt\n",
+		"src/.heliosignore": "!keep.log\n",
+		"src/main.go":       "package main",
+		"src/keep.log":      "kept",
+		"src/debug.log":     "dropped",
+		"build/out.bin":     "dropped",
+		"secret.txt":        "only dropped with --gitignore",
+		"global.bak":        "dropped",
+	} {
+		p := filepath.Join(root, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	global := filepath.Join(t.TempDir(), "ignore")
+	if err := os.WriteFile(global, []byte("*.bak\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("HELIOS_IGNORE_FILE", global)
+
+	for _, tt := range []struct {
+		opts CommitOpts
+		want []string
+	}{
+		{CommitOpts{}, []string{".gitignore", ".heliosignore", "secret.txt", "src/.heliosignore", "src/keep.log", "src/main.go"}},
+		{CommitOpts{GitIgnore: true}, []string{".gitignore", ".heliosignore", "src/.heliosignore", "src/keep.log", "src/main.go"}},
+	} {
+		fake := &FakeEngine{commitResult: "ignored"}
+		cfg := Config{EngineFactory: func() (Engine, error) { return fake, nil }}
+		if err := HandleCommit(&bytes.Buffer{}, cfg, root, tt.opts); err != nil {
+			t.Fatal(err)
+		}
+		if len(fake.written) != len(tt.want) {
+			t.Fatalf("opts %+v: ingested %v, want %v", tt.opts, fake.written, tt.want)
+		}
+		for i := range tt.want {
+			if fake.written[i] != tt.want[i] {
+				t.Fatalf("opts %+v: ingested %v, want %v", tt.opts, fake.written, tt.want)
+			}
+		}
+	}
+}
+
+func TestHandleCommit_Index(t *testing.T) {
+	if cwd, err := os.Getwd(); err == nil {
+		defer os.Chdir(cwd)
+	}
+	t.Setenv("HELIOS_STORE_DIR", "")
+	t.Setenv("HELIOS_IGNORE_FILE", filepath.Join(t.TempDir(), "none"))
+
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "a.txt"), []byte("alpha"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// One store for all commits, as a fresh process would reopen it.
+	l2, err := objstore.Open(filepath.Join(root, ".helios", "objects"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l2.Close()
+	cfg := Config{EngineFactory: func() (Engine, error) {
+		eng := vst.New()
+		eng.AttachStores(nil, l2)
+		return eng, nil
+	}}
+	commit := func() string {
+		t.Helper()
+		buf := &bytes.Buffer{}
+		if err := HandleCommit(buf, cfg, root, CommitOpts{}); err != nil {
+			t.Fatal(err)
+		}
+		var out map[string]string
+		if err := json.Unmarshal(buf.Bytes(), &out); err != nil {
+			t.Fatal(err)
+		}
+		return out["snapshot_id"]
+	}
+
+	first := commit()
+	if _, err := os.Stat(filepath.Join(root, ".helios", "index")); err != nil {
+		t.Fatalf("index not written: %v", err)
+	}
+	if again := commit(); again != first {
+		t.Fatalf("unchanged tree committed as %s, want %s", again, first)
+	}
+	// Same size and, on coarse filesystems, the same mtime: the entry is racily
+	// clean and must be rehashed.
+	if err := os.WriteFile(filepath.Join(root, "a.txt"), []byte("ALPHA"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if changed := commit(); changed == first {
+		t.Fatal("modified file was taken from the index")
+	}
+}
+
+func TestHandleCommit_IndexFollowsStoreURL(t *testing.T) {
+	if cwd, err := os.Getwd(); err == nil {
+		defer os.Chdir(cwd)
+	}
+	t.Setenv("HELIOS_STORE_DIR", "")
+	t.Setenv("HELIOS_L1_PERSIST", "0")
+	t.Setenv("HELIOS_IGNORE_FILE", filepath.Join(t.TempDir(), "none"))
+
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "a.txt"), []byte("alpha"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// Wait out the index's racy window (ctime cannot be backdated), so that
+	// an index still trusted after the switch would skip a.txt.
+	time.Sleep(2100 * time.Millisecond)
+	cfg := Config{EngineFactory: DefaultEngineFactory}
+	first, second := t.TempDir(), t.TempDir()
+	for _, dir := range []string{first, second} {
+		t.Setenv("HELIOS_STORE_URL", "file://"+dir)
+		if err := HandleCommit(io.Discard, cfg, root, CommitOpts{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The index from the first store must not vouch for blobs in the second.
+	st, err := objstore.OpenLoose(second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	h, err := util.HashBlob([]byte("alpha"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := st.Get(h); err != nil || !ok {
+		t.Fatalf("a.txt not uploaded to the new store: %v, %v", ok, err)
+	}
+}
+
+func TestHandleWatch(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("watch needs inotify")
+	}
+	if cwd, err := os.Getwd(); err == nil {
+		defer os.Chdir(cwd)
+	}
+	t.Setenv("HELIOS_STORE_DIR", "")
+	t.Setenv("HELIOS_IGNORE_FILE", filepath.Join(t.TempDir(), "none"))
+
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, ".heliosignore"), []byte("*.log\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	l2, err := objstore.Open(filepath.Join(root, ".helios", "objects"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l2.Close()
+	eng := vst.New()
+	eng.AttachStores(nil, l2)
+	cfg := Config{EngineFactory: func() (Engine, error) { return eng, nil }}
+
+	pr, pw := io.Pipe()
+	lines := bufio.NewScanner(pr)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- HandleWatch(ctx, pw, cfg, root, WatchOpts{Quiet: 50 * time.Millisecond, Every: 1000})
+		pw.Close()
+	}()
+	next := func() map[string]any {
+		t.Helper()
+		got := make(chan map[string]any, 1)
+		go func() {
+			var m map[string]any
+			if lines.Scan() {
+				_ = json.Unmarshal(lines.Bytes(), &m)
+			}
+			got <- m
+		}()
+		select {
+		case m := <-got:
+			if m == nil {
+				t.Fatal("watch output ended")
+			}
+			return m
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for a checkpoint")
+		}
+		return nil
+	}
+
+	first := next()
+	if first["changes"] != float64(0) {
+		t.Fatalf("initial checkpoint = %v", first)
+	}
+	// Ignored files do not trigger a checkpoint; the next one is for a.txt.
+	if err := os.WriteFile(filepath.Join(root, "debug.log"), []byte("noise"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "a.txt"), []byte("alpha"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	second := next()
+	if second["snapshot_id"] == first["snapshot_id"] || second["changes"] != float64(1) {
+		t.Fatalf("checkpoint after change = %v (first %v)", second, first)
+	}
+
+	cancel()
+	go io.Copy(io.Discard, pr)
+	if err := <-done; err != nil {
+		t.Fatalf("HandleWatch: %v", err)
+	}
+	if err := eng.Restore(types.SnapshotID(second["snapshot_id"].(string))); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := eng.ReadFile("a.txt"); string(b) != "alpha" {
+		t.Fatalf("a.txt in checkpoint = %q", b)
+	}
+}
+
+func TestHandleServe_Socket(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix sockets")
+	}
+	sock := filepath.Join(t.TempDir(), "helios.sock")
+	cfg := Config{EngineFactory: func() (Engine, error) { return vst.New(), nil }}
+
+	pr, pw := io.Pipe()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- HandleServe(ctx, pw, cfg, ServeOpts{Socket: sock})
+		pw.Close()
+	}()
+	var hello map[string]string
+	if err := json.NewDecoder(pr).Decode(&hello); err != nil {
+		t.Fatal(err)
+	}
+	if hello["network"] != "unix" || hello["listening"] != sock {
+		t.Fatalf("listening line = %v", hello)
+	}
+	if fi, err := os.Stat(sock); err != nil || fi.Mode().Perm() != 0o600 {
+		t.Fatalf("socket mode = %v, %v", fi, err)
+	}
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", sock)
+		},
+	}}
+	resp, err := client.Post("http://helios/v1/commit", "application/json", bytes.NewReader([]byte(`{}`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out map[string]any
+	_ = json.NewDecoder(resp.Body).Decode(&out)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || out["snapshot_id"] == "" {
+		t.Fatalf("commit over socket: %d %v", resp.StatusCode, out)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("HandleServe: %v", err)
+	}
+}
+
+func TestHandleServe_TCPRequiresToken(t *testing.T) {
+	cfg := Config{EngineFactory: func() (Engine, error) { return vst.New(), nil }}
+
+	pr, pw := io.Pipe()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- HandleServe(ctx, pw, cfg, ServeOpts{Addr: "127.0.0.1:0"})
+		pw.Close()
+	}()
+	var hello map[string]string
+	if err := json.NewDecoder(pr).Decode(&hello); err != nil {
+		t.Fatal(err)
+	}
+	if hello["network"] != "tcp" || len(hello["token"]) < 32 {
+		t.Fatalf("listening line = %v", hello)
+	}
+
+	commit := func(token string) int {
+		req, _ := http.NewRequest("POST", "http://"+hello["listening"]+"/v1/commit", bytes.NewReader([]byte(`{}`)))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if got := commit(""); got != http.StatusUnauthorized {
+		t.Fatalf("commit without token: %d", got)
+	}
+	if got := commit("wrong"); got != http.StatusUnauthorized {
+		t.Fatalf("commit with wrong token: %d", got)
+	}
+	if got := commit(hello["token"]); got != http.StatusOK {
+		t.Fatalf("commit with token: %d", got)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("HandleServe: %v", err)
+	}
+}
+
+func TestHandleExportImport(t *testing.T) {
+	v := vst.New()
+	_ = v.WriteFile("a.txt", []byte("a"))
+	_ = v.WriteFileMode("bin/tool", []byte("#!/bin/sh\n"), 0o755)
+	id, _, _ := v.Commit("")
+	tree, err := v.FS(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake := &FakeEngine{fs: tree, commitResult: "imported-id"}
+	cfg := Config{
+		EngineFactory: func() (Engine, error) { return fake, nil },
+	}
+
+	out := filepath.Join(t.TempDir(), "snap.tar.zst")
+	buf := &bytes.Buffer{}
+	if err := HandleExport(buf, cfg, string(id), "", out); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	var result map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &result); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if result["format"] != "tar.zst" || result["out"] != out {
+		t.Errorf("unexpected export result %v", result)
+	}
+
+	buf.Reset()
+	if err := HandleImport(buf, cfg, out); err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if err := json.Unmarshal(buf.Bytes(), &result); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if result["snapshot_id"] != "imported-id" || result["files"] != float64(2) {
+		t.Errorf("unexpected import result %v", result)
+	}
+	if len(fake.written) != 2 {
+		t.Errorf("import wrote %v", fake.written)
+	}
+
+	if err := HandleExport(buf, cfg, string(id), "", filepath.Join(t.TempDir(), "snap.bin")); err == nil {
+		t.Error("expected an error when the format cannot be inferred")
+	}
+}
+
+func TestHandleGit_RequiredArgs(t *testing.T) {
+	cfg := Config{
+		EngineFactory: func() (Engine, error) { return &FakeEngine{}, nil },
+	}
+	buf := &bytes.Buffer{}
+	if err := HandleGitImport(buf, cfg, "", "HEAD"); err == nil {
+		t.Error("import without a repository should fail")
+	}
+	if err := HandleGitImport(buf, cfg, t.TempDir(), ""); err == nil {
+		t.Error("import from a directory that is not a git repository should fail")
+	}
+	if err := HandleGitExport(buf, cfg, "abc", t.TempDir(), GitExportOpts{}); err == nil {
+		t.Error("export without a branch should fail")
+	}
+}
+
+func TestHandleMCP(t *testing.T) {
+	cfg := Config{EngineFactory: func() (Engine, error) { return vst.New(), nil }}
+	in := strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18"}}
+{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"write_file","arguments":{"path":"a.txt","content":"alpha"}}}
+{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"snapshot_commit","arguments":{}}}
+`)
+	var out bytes.Buffer
+	if err := HandleMCP(context.Background(), in, &out, cfg, "test"); err != nil {
+		t.Fatalf("HandleMCP: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 || !strings.Contains(lines[2], "snapshot_id") {
+		t.Fatalf("output = %s", out.String())
+	}
+
+	cfg = Config{EngineFactory: func() (Engine, error) { return &FakeEngine{}, nil }}
+	if err := HandleMCP(context.Background(), strings.NewReader(""), &out, cfg, "test"); err == nil {
+		t.Fatal("an engine without WorkingFS should be rejected")
+	}
+}
+
+func TestHandlePushPullClone(t *testing.T) {
+	if cwd, err := os.Getwd(); err == nil {
+		defer os.Chdir(cwd)
+	}
+	t.Setenv("HELIOS_STORE_DIR", "")
+	t.Setenv("HELIOS_IGNORE_FILE", filepath.Join(t.TempDir(), "none"))
+
+	work := t.TempDir()
+	l2, err := objstore.Open(filepath.Join(work, ".helios", "objects"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l2.Close()
+	cfg := Config{EngineFactory: func() (Engine, error) {
+		eng := vst.New()
+		eng.AttachStores(nil, l2)
+		return eng, nil
+	}}
+	central := t.TempDir()
+	if _, err := (repo.Repo{Dir: central, ObjectsDir: central}).Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	commit := func(content string) types.SnapshotID {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(work, "a.txt"), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		var out struct {
+			SnapshotID types.SnapshotID `json:"snapshot_id"`
+		}
+		buf := &bytes.Buffer{}
+		if err := HandleCommit(buf, cfg, work, CommitOpts{}); err != nil {
+			t.Fatal(err)
+		}
+		_ = json.Unmarshal(buf.Bytes(), &out)
+		return out.SnapshotID
+	}
+
+	commit("one")
+	if err := HandlePush(&bytes.Buffer{}, cfg, central, SyncOpts{}); err != nil {
+		t.Fatalf("first push: %v", err)
+	}
+	// The second commit descends from the first through HEAD, so pushing
+	// it is a fast-forward.
+	second := commit("two")
+	buf := &bytes.Buffer{}
+	if err := HandlePush(buf, cfg, central, SyncOpts{}); err != nil {
+		t.Fatalf("second push: %v", err)
+	}
+	var res struct{ Snapshots, Blobs int }
+	if err := json.Unmarshal(buf.Bytes(), &res); err != nil || res.Snapshots != 1 || res.Blobs != 1 {
+		t.Fatalf("second push = %s", buf.String())
+	}
+	if err := HandlePush(&bytes.Buffer{}, cfg, central, SyncOpts{As: "ci/w1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	clone := filepath.Join(t.TempDir(), "clone")
+	if err := HandleClone(&bytes.Buffer{}, central, clone, CloneOpts{}); err != nil {
+		t.Fatalf("clone: %v", err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(clone, "a.txt")); string(b) != "two" {
+		t.Fatalf("cloned a.txt = %q", b)
+	}
+	refs, err := (repo.Repo{Dir: filepath.Join(clone, ".helios")}).Refs()
+	if err != nil || refs[repo.Head] != second || refs["ci/w1"] != second {
+		t.Fatalf("cloned refs = %v, %v", refs, err)
+	}
+	if err := HandleClone(&bytes.Buffer{}, central, clone, CloneOpts{}); err == nil {
+		t.Fatal("clone into a non-empty directory should fail")
+	}
+
+	// Pulling a HEAD that the local one already descends from changes nothing.
+	third := commit("three")
+	if err := HandlePull(&bytes.Buffer{}, cfg, central, SyncOpts{}); err != nil {
+		t.Fatalf("pull of an ancestor: %v", err)
+	}
+	if err := HandlePull(&bytes.Buffer{}, cfg, central, SyncOpts{As: "central/HEAD"}); err != nil {
+		t.Fatal(err)
+	}
+	local, _ := (repo.Repo{Dir: filepath.Join(work, ".helios")}).Refs()
+	if local[repo.Head] != third || local["central/HEAD"] != second {
+		t.Fatalf("local refs = %v", local)
+	}
+	if err := HandlePush(&bytes.Buffer{}, cfg, central, SyncOpts{Ref: "nope"}); err == nil {
+		t.Fatal("pushing a missing ref should fail")
+	}
+}
+
+func TestHandlePushPull_SnapshotID(t *testing.T) {
+	if cwd, err := os.Getwd(); err == nil {
+		defer os.Chdir(cwd)
+	}
+	t.Setenv("HELIOS_STORE_DIR", "")
+
+	work := t.TempDir()
+	l2, err := objstore.Open(filepath.Join(work, ".helios", "objects"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l2.Close()
+	eng := vst.New()
+	eng.AttachStores(nil, l2)
+	cfg := Config{EngineFactory: func() (Engine, error) { return eng, nil }}
+	if err := os.Chdir(work); err != nil {
+		t.Fatal(err)
+	}
+	central := t.TempDir()
+	if _, err := (repo.Repo{Dir: central, ObjectsDir: central}).Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Commits through serve move no ref.
+	srv := httptest.NewServer(server.New(eng))
+	defer srv.Close()
+	c, err := client.New(srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := c.WriteFile("a.txt", []byte("served")); err != nil {
+		t.Fatal(err)
+	}
+	id, _, err := c.Commit("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := HandlePush(&bytes.Buffer{}, cfg, central, SyncOpts{Ref: string(id)}); err == nil {
+		t.Fatal("pushing a snapshot id without --as should fail")
+	}
+	if err := HandlePush(&bytes.Buffer{}, cfg, central, SyncOpts{Ref: string(id), As: "ci/served"}); err != nil {
+		t.Fatalf("push by id: %v", err)
+	}
+	refs, err := (repo.Repo{Dir: central}).Refs()
+	if err != nil || refs["ci/served"] != id {
+		t.Fatalf("central refs = %v, %v", refs, err)
+	}
+
+	// And pulled by id into another repository.
+	other := t.TempDir()
+	if err := os.Chdir(other); err != nil {
+		t.Fatal(err)
+	}
+	l2b, err := objstore.Open(filepath.Join(other, ".helios", "objects"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l2b.Close()
+	cfg = Config{EngineFactory: func() (Engine, error) {
+		e := vst.New()
+		e.AttachStores(nil, l2b)
+		return e, nil
+	}}
+	if err := HandlePull(&bytes.Buffer{}, cfg, central, SyncOpts{Ref: string(id), As: "from-central"}); err != nil {
+		t.Fatalf("pull by id: %v", err)
+	}
+	if local, _ := (repo.Repo{Dir: filepath.Join(other, ".helios")}).Refs(); local["from-central"] != id {
+		t.Fatalf("local refs = %v", local)
+	}
+}
+
+func TestHandleBundle(t *testing.T) {
+	if cwd, err := os.Getwd(); err == nil {
+		defer os.Chdir(cwd)
+	}
+	t.Setenv("HELIOS_STORE_DIR", "")
+	t.Setenv("HELIOS_IGNORE_FILE", filepath.Join(t.TempDir(), "none"))
+
+	// engineIn returns a config whose engines share one store in dir.
+	engineIn := func(dir string) Config {
+		l2, err := objstore.Open(filepath.Join(dir, ".helios", "objects"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { l2.Close() })
+		return Config{EngineFactory: func() (Engine, error) {
+			eng := vst.New()
+			eng.AttachStores(nil, l2)
+			return eng, nil
+		}}
+	}
+	src, dst := t.TempDir(), t.TempDir()
+	srcCfg, dstCfg := engineIn(src), engineIn(dst)
+	if err := os.WriteFile(filepath.Join(src, "a.txt"), []byte("alpha"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := HandleCommit(&bytes.Buffer{}, srcCfg, src, CommitOpts{}); err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(t.TempDir(), "x.hbundle")
+	if err := HandleBundleCreate(&bytes.Buffer{}, srcCfg, out, BundleOpts{ID: "HEAD"}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if err := os.Chdir(dst); err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	if err := HandleUnbundle(buf, dstCfg, out, UnbundleOpts{Ref: "imported"}); err != nil {
+		t.Fatalf("unbundle: %v", err)
+	}
+	var res struct {
+		Tip   types.SnapshotID
+		Blobs int
+	}
+	if err := json.Unmarshal(buf.Bytes(), &res); err != nil || res.Blobs != 1 {
+		t.Fatalf("unbundle = %s", buf.String())
+	}
+	refs, _ := (repo.Repo{Dir: filepath.Join(dst, ".helios")}).Refs()
+	if refs["imported"] != res.Tip {
+		t.Fatalf("refs = %v, tip %s", refs, res.Tip)
+	}
+	if err := HandleBundleCreate(&bytes.Buffer{}, dstCfg, out, BundleOpts{}); err == nil {
+		t.Fatal("create without --id should fail")
+	}
+}
+
+func TestHandleDictTrain(t *testing.T) {
+	if cwd, err := os.Getwd(); err == nil {
+		defer os.Chdir(cwd)
+	}
+	t.Setenv("HELIOS_STORE_DIR", "")
+	t.Setenv("HELIOS_IGNORE_FILE", filepath.Join(t.TempDir(), "none"))
+
+	dir := t.TempDir()
+	l2, err := objstore.Open(filepath.Join(dir, ".helios", "objects"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l2.Close()
+	cfg := Config{EngineFactory: func() (Engine, error) {
+		eng := vst.New()
+		eng.AttachStores(nil, l2)
+		return eng, nil
+	}}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := HandleDictTrain(&bytes.Buffer{}, cfg, DictTrainOpts{}); err == nil {
+		t.Fatal("training without HEAD should fail")
+	}
+
+	for i := 0; i < 50; i++ {
+		src := fmt.Sprintf("package p%d\n\nimport \"fmt\"\n\n", i%5)
+		for j := 0; j < 8; j++ {
+			src += fmt.Sprintf("// Get%d_%d returns the value.\nfunc Get%d_%d() string {\n\treturn fmt.Sprint(%d)\n}\n\n", i, j, i, j, i*j)
+		}
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("f%02d.go", i)), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Too large to sample, and empty: both are left out.
+	if err := os.WriteFile(filepath.Join(dir, "big.bin"), bytes.Repeat([]byte{7}, 100<<10), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "empty"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := HandleCommit(&bytes.Buffer{}, cfg, dir, CommitOpts{}); err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	if err := HandleDictTrain(buf, cfg, DictTrainOpts{Size: 4 << 10}); err != nil {
+		t.Fatal(err)
+	}
+	var res struct {
+		ID      uint32
+		Samples int
+	}
+	if err := json.Unmarshal(buf.Bytes(), &res); err != nil || res.ID != repo.FirstDictID || res.Samples != 50 {
+		t.Fatalf("dict train = %s", buf.String())
+	}
+	dicts, err := (repo.Repo{Dir: filepath.Join(dir, ".helios")}).Dicts()
+	if err != nil || len(dicts) != 1 || l1cache.DictID(dicts[0].Data) != res.ID {
+		t.Fatalf("stored dicts = %v, %v", dicts, err)
+	}
+}
+
 type testError string
 
 func (e testError) Error() string {
@@ -15,9 +15,13 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/good-night-oppie/helios/cmd/helios-cli/internal/cli"
 )
@@ -37,14 +41,36 @@ func main() {
 	switch os.Args[1] {
 	case "commit":
 		handleCommit()
+	case "watch":
+		handleWatch()
 	case "restore":
 		handleRestore()
 	case "diff":
 		handleDiff()
 	case "materialize":
 		handleMaterialize()
+	case "export":
+		handleExport()
+	case "import":
+		handleImport()
 	case "stats":
 		handleStats()
+	case "serve":
+		handleServe()
+	case "mcp":
+		handleMCP()
+	case "push":
+		handlePush()
+	case "pull":
+		handlePull()
+	case "clone":
+		handleClone()
+	case "bundle":
+		handleBundle()
+	case "migrate":
+		handleMigrate()
+	case "dict":
+		handleDict()
 	case "version", "--version", "-v":
 		handleVersion()
 	case "-h", "--help", "help":
@@ -59,11 +85,26 @@ func main() {
 func usage() {
 	fmt.Println(`helios
 Commands:
-  commit       --work <path>
+  commit       --work <path> [--gitignore] [--jobs <n>]
+  watch        --work <path> [--quiet <dur>] [--every <n>] [--gitignore] [--jobs <n>]
   restore      --id <snapshotID>
   diff         --from <id> --to <id>
-  materialize  --id <snapshotID> --out <dir> [--include <glob>] [--exclude <glob>]
+  materialize  --id <snapshotID> --out <dir> [--include <glob>] [--exclude <glob>] [--sync [--prune]]
+               [--blob-cache <dir>] [--readonly]
+  export       --id <snapshotID> -o <file|-> [--format tar|tar.zst|zip]
+  export       --id <snapshotID> --to-git <repo> --branch <name> [-m <msg>] [--author "Name <email>"]
+  import       <archive|->
+  import       --from-git <repo> [--rev <rev>]
   stats
+  serve        [--addr <host:port>] [--socket <path>] [--token <t>]
+  mcp          (Model Context Protocol server on stdin/stdout)
+  push         [--ref <name|snapshotID>] [--as <name>] [--force] <remote>
+  pull         [--ref <name|snapshotID>] [--as <name>] [--force] <remote>
+  clone        [--no-checkout] <remote> <dir>
+  bundle       create --id <snapshotID|ref> [--since <snapshotID|ref>] <out.hbundle|->
+  bundle       unbundle [--ref <name>] [--force] <in.hbundle>
+  migrate      [--no-backup]
+  dict         train [--id <snapshotID|ref>] [--size <bytes>] [--max-samples <n>] [--max-file-size <bytes>]
   version      [-v|--version]`)
 }
 
@@ -80,10 +121,144 @@ func newConfig() cli.Config {
 func handleCommit() {
 	fs := flag.NewFlagSet("commit", flag.ExitOnError)
 	work := fs.String("work", ".", "working directory")
+	gitIgnore := fs.Bool("gitignore", false, "also honour .gitignore files")
+	jobs := fs.Int("jobs", 0, "files hashed in parallel (0 = one per CPU)")
 	_ = fs.Parse(os.Args[2:])
 
 	cfg := newConfig()
-	if err := cli.HandleCommit(os.Stdout, cfg, *work); err != nil {
+	if err := cli.HandleCommit(os.Stdout, cfg, *work, cli.CommitOpts{GitIgnore: *gitIgnore, Jobs: *jobs}); err != nil {
+		die(err)
+	}
+}
+
+func handleWatch() {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	work := fs.String("work", ".", "working directory")
+	quiet := fs.Duration("quiet", 2*time.Second, "checkpoint after the tree is still this long")
+	every := fs.Int("every", 100, "checkpoint after this many changed paths (0 = only when quiet)")
+	gitIgnore := fs.Bool("gitignore", false, "also honour .gitignore files")
+	jobs := fs.Int("jobs", 0, "files hashed in parallel (0 = one per CPU)")
+	_ = fs.Parse(os.Args[2:])
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	opts := cli.WatchOpts{
+		CommitOpts: cli.CommitOpts{GitIgnore: *gitIgnore, Jobs: *jobs},
+		Quiet:      *quiet,
+		Every:      *every,
+	}
+	if err := cli.HandleWatch(ctx, os.Stdout, newConfig(), *work, opts); err != nil {
+		die(err)
+	}
+}
+
+func handleServe() {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:7420", "TCP address to listen on")
+	socket := fs.String("socket", "", "Unix socket to listen on instead of --addr")
+	token := fs.String("token", "", "bearer token TCP clients must send (default $HELIOS_TOKEN, else random)")
+	_ = fs.Parse(os.Args[2:])
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := cli.HandleServe(ctx, os.Stdout, newConfig(), cli.ServeOpts{Addr: *addr, Socket: *socket, Token: *token}); err != nil {
+		die(err)
+	}
+}
+
+func handleMCP() {
+	fs := flag.NewFlagSet("mcp", flag.ExitOnError)
+	_ = fs.Parse(os.Args[2:])
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := cli.HandleMCP(ctx, os.Stdin, os.Stdout, newConfig(), version); err != nil {
+		die(err)
+	}
+}
+
+func handlePush() {
+	fs := flag.NewFlagSet("push", flag.ExitOnError)
+	opts := syncFlags(fs)
+	_ = fs.Parse(os.Args[2:])
+
+	if err := cli.HandlePush(os.Stdout, newConfig(), fs.Arg(0), *opts); err != nil {
+		die(err)
+	}
+}
+
+func handlePull() {
+	fs := flag.NewFlagSet("pull", flag.ExitOnError)
+	opts := syncFlags(fs)
+	_ = fs.Parse(os.Args[2:])
+
+	if err := cli.HandlePull(os.Stdout, newConfig(), fs.Arg(0), *opts); err != nil {
+		die(err)
+	}
+}
+
+// syncFlags defines the flags push and pull share. A remote is a repository
+// path or a helios serve URL (http://, https:// or unix://).
+func syncFlags(fs *flag.FlagSet) *cli.SyncOpts {
+	var opts cli.SyncOpts
+	fs.StringVar(&opts.Ref, "ref", "HEAD", "ref, or with --as a snapshot id, to send or fetch")
+	fs.StringVar(&opts.As, "as", "", "name of the ref on the receiving side (default: --ref; required for a snapshot id)")
+	fs.BoolVar(&opts.Force, "force", false, "move the receiving ref even if it is not a fast-forward")
+	return &opts
+}
+
+func handleClone() {
+	fs := flag.NewFlagSet("clone", flag.ExitOnError)
+	noCheckout := fs.Bool("no-checkout", false, "do not write HEAD's files into the directory")
+	_ = fs.Parse(os.Args[2:])
+
+	if err := cli.HandleClone(os.Stdout, fs.Arg(0), fs.Arg(1), cli.CloneOpts{NoCheckout: *noCheckout}); err != nil {
+		die(err)
+	}
+}
+
+func handleBundle() {
+	if len(os.Args) < 3 {
+		fmt.Fprintln(os.Stderr, "usage: helios bundle create|unbundle ...")
+		os.Exit(2)
+	}
+	switch os.Args[2] {
+	case "create":
+		fs := flag.NewFlagSet("bundle create", flag.ExitOnError)
+		id := fs.String("id", "", "snapshot id or ref to bundle")
+		since := fs.String("since", "", "snapshot id or ref the receiver already has")
+		_ = fs.Parse(os.Args[3:])
+		if err := cli.HandleBundleCreate(os.Stdout, newConfig(), fs.Arg(0), cli.BundleOpts{ID: *id, Since: *since}); err != nil {
+			die(err)
+		}
+	case "unbundle":
+		fs := flag.NewFlagSet("bundle unbundle", flag.ExitOnError)
+		ref := fs.String("ref", "", "point this ref at the bundled snapshot")
+		force := fs.Bool("force", false, "move --ref even if it is not a fast-forward")
+		_ = fs.Parse(os.Args[3:])
+		if err := cli.HandleUnbundle(os.Stdout, newConfig(), fs.Arg(0), cli.UnbundleOpts{Ref: *ref, Force: *force}); err != nil {
+			die(err)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "unknown bundle command: %s\n", os.Args[2])
+		os.Exit(2)
+	}
+}
+
+func handleDict() {
+	if len(os.Args) < 3 || os.Args[2] != "train" {
+		fmt.Fprintln(os.Stderr, "usage: helios dict train ...")
+		os.Exit(2)
+	}
+	fs := flag.NewFlagSet("dict train", flag.ExitOnError)
+	id := fs.String("id", "", "snapshot id or ref to sample (default HEAD)")
+	size := fs.Int("size", 0, "dictionary size in bytes (0 = 64 KiB)")
+	maxSamples := fs.Int("max-samples", 0, "files to sample (0 = 4000)")
+	maxFileSize := fs.Int64("max-file-size", 0, "skip larger files (0 = 64 KiB)")
+	_ = fs.Parse(os.Args[3:])
+
+	opts := cli.DictTrainOpts{ID: *id, Size: *size, MaxSamples: *maxSamples, MaxFileSize: *maxFileSize}
+	if err := cli.HandleDictTrain(os.Stdout, newConfig(), opts); err != nil {
 		die(err)
 	}
 }
@@ -117,9 +292,13 @@ func handleMaterialize() {
 	outDir := fs.String("out", "", "output directory")
 	include := fs.String("include", "", "include glob (optional)")
 	exclude := fs.String("exclude", "", "exclude glob (optional)")
+	syncDir := fs.Bool("sync", false, "update an existing output directory, writing only changed files")
+	prune := fs.Bool("prune", false, "with --sync, delete every selected file the snapshot lacks (never .git or .helios)")
+	blobCache := fs.String("blob-cache", "", "populate files by reflink or copy from this blob cache directory")
+	readOnly := fs.Bool("readonly", false, "read-only output; with --blob-cache, hardlink files from the cache")
 	_ = fs.Parse(os.Args[2:])
 
-	opts := cli.MatOpts{}
+	opts := cli.MatOpts{Sync: *syncDir, Prune: *prune, BlobCache: *blobCache, ReadOnly: *readOnly}
 	if *include != "" {
 		opts.Include = []string{*include}
 	}
@@ -133,6 +312,48 @@ func handleMaterialize() {
 	}
 }
 
+func handleExport() {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	id := fs.String("id", "", "snapshot id")
+	out := fs.String("o", "", "output archive path, or - for stdout")
+	format := fs.String("format", "", "tar, tar.zst or zip (default: from the -o extension)")
+	toGit := fs.String("to-git", "", "commit the snapshot into this git repository instead")
+	branch := fs.String("branch", "", "git branch to commit on (with --to-git)")
+	message := fs.String("m", "", "git commit message (with --to-git)")
+	author := fs.String("author", "", "git author as \"Name <email>\" (with --to-git)")
+	_ = fs.Parse(os.Args[2:])
+
+	cfg := newConfig()
+	if *toGit != "" {
+		opts := cli.GitExportOpts{Branch: *branch, Message: *message, Author: *author}
+		if err := cli.HandleGitExport(os.Stdout, cfg, *id, *toGit, opts); err != nil {
+			die(err)
+		}
+		return
+	}
+	if err := cli.HandleExport(os.Stdout, cfg, *id, *format, *out); err != nil {
+		die(err)
+	}
+}
+
+func handleImport() {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	fromGit := fs.String("from-git", "", "import history from this git repository instead")
+	rev := fs.String("rev", "HEAD", "git revision to import (with --from-git)")
+	_ = fs.Parse(os.Args[2:])
+
+	cfg := newConfig()
+	if *fromGit != "" {
+		if err := cli.HandleGitImport(os.Stdout, cfg, *fromGit, *rev); err != nil {
+			die(err)
+		}
+		return
+	}
+	if err := cli.HandleImport(os.Stdout, cfg, fs.Arg(0)); err != nil {
+		die(err)
+	}
+}
+
 func handleStats() {
 	cfg := newConfig()
 	if err := cli.HandleStats(os.Stdout, cfg); err != nil {
@@ -140,6 +361,17 @@ func handleStats() {
 	}
 }
 
+// handleMigrate upgrades the repository to the current format.
+func handleMigrate() {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	noBackup := fs.Bool("no-backup", false, "skip copying the repository before migrating")
+	_ = fs.Parse(os.Args[2:])
+
+	if err := cli.HandleMigrate(os.Stdout, *noBackup); err != nil {
+		die(err)
+	}
+}
+
 // handleVersion prints CLI version information.
 func handleVersion() {
 	fmt.Printf("helios %s (commit %s, built %s)\n", version, commit, date)
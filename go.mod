@@ -6,6 +6,7 @@ require (
 	github.com/cockroachdb/pebble v1.1.2
 	github.com/klauspost/compress v1.17.0
 	github.com/stretchr/testify v1.11.1
+	golang.org/x/sys v0.18.0
 	lukechampine.com/blake3 v1.4.1
 )
 
@@ -35,7 +36,6 @@ require (
 	github.com/prometheus/procfs v0.7.3 // indirect
 	github.com/rogpeppe/go-internal v1.9.0 // indirect
 	golang.org/x/exp v0.0.0-20230626212559-97b1e661b5df // indirect
-	golang.org/x/sys v0.18.0 // indirect
 	golang.org/x/text v0.14.0 // indirect
 	google.golang.org/protobuf v1.33.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
@@ -0,0 +1,291 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ignore implements gitignore-style path exclusion for .heliosignore
+// (and, optionally, .gitignore) files.
+//
+// Patterns follow gitignore(5): blank lines and lines starting with "#" are
+// skipped; a leading "!" re-includes a path excluded by an earlier pattern;
+// a trailing "/" matches directories only; a pattern containing a "/" other
+// than a trailing one is anchored to the directory of the file it comes
+// from, while any other pattern matches a name at any depth below it; "*",
+// "?" and "[...]" match within one path component and "**" matches across
+// components. The last matching pattern wins, and patterns from deeper
+// directories take precedence over shallower ones. As in git, a file cannot
+// be re-included if one of its parent directories is excluded.
+package ignore
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// FileName is the per-directory ignore file.
+const FileName = ".heliosignore"
+
+// Pattern is one parsed ignore rule.
+type Pattern struct {
+	base     string   // directory of the ignore file, slash-separated; "" for the root
+	segs     []string // path components of the pattern
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+// Parse reads patterns from the contents of an ignore file located in base,
+// a slash-separated directory relative to the walk root ("" for the root).
+// Invalid patterns are skipped, as git does.
+func Parse(data []byte, base string) []Pattern {
+	base = strings.Trim(path.Clean("/"+base), "/")
+	var out []Pattern
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		if p, ok := parseLine(sc.Text(), base); ok {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func parseLine(line, base string) (Pattern, bool) {
+	line = strings.TrimSuffix(line, "\r")
+	// Trailing spaces are dropped unless escaped with a backslash.
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = line[:len(line)-1]
+	}
+	if line == "" || line[0] == '#' {
+		return Pattern{}, false
+	}
+	p := Pattern{base: base}
+	if line[0] == '!' {
+		p.negate = true
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if strings.HasPrefix(line, "/") {
+		p.anchored = true
+		line = line[1:]
+	} else if strings.Contains(line, "/") {
+		p.anchored = true
+	}
+	if line == "" {
+		return Pattern{}, false
+	}
+	for _, s := range strings.Split(line, "/") {
+		if s == "" {
+			continue
+		}
+		// gitignore negates bracket expressions with "!", path.Match with "^".
+		s = strings.ReplaceAll(s, "[!", "[^")
+		if _, err := path.Match(s, ""); err != nil {
+			return Pattern{}, false
+		}
+		p.segs = append(p.segs, s)
+	}
+	return p, len(p.segs) > 0
+}
+
+// match reports whether the pattern matches name, a slash-separated path
+// relative to the walk root.
+func (p Pattern) match(name string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	rel := name
+	if p.base != "" {
+		var ok bool
+		if rel, ok = strings.CutPrefix(name, p.base+"/"); !ok {
+			return false
+		}
+	}
+	parts := strings.Split(rel, "/")
+	if !p.anchored {
+		ok, _ := path.Match(p.segs[0], parts[len(parts)-1])
+		return ok
+	}
+	return matchSegs(p.segs, parts)
+}
+
+func matchSegs(pat, name []string) bool {
+	for len(pat) > 0 {
+		if pat[0] == "**" {
+			rest := pat[1:]
+			if len(rest) == 0 {
+				// A trailing "/**" matches everything inside, not the directory itself.
+				return len(name) > 0
+			}
+			for i := 0; i <= len(name); i++ {
+				if matchSegs(rest, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pat[0], name[0]); !ok {
+			return false
+		}
+		pat, name = pat[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// Matcher is an ordered set of patterns, lowest precedence first.
+type Matcher struct {
+	patterns []Pattern
+}
+
+// NewMatcher returns a matcher for patterns, later ones taking precedence.
+func NewMatcher(patterns ...[]Pattern) *Matcher {
+	return (*Matcher)(nil).Append(patterns...)
+}
+
+// Append returns a matcher in which patterns take precedence over m's.
+// m itself is not modified.
+func (m *Matcher) Append(patterns ...[]Pattern) *Matcher {
+	out := &Matcher{}
+	if m != nil {
+		out.patterns = append(out.patterns, m.patterns...)
+	}
+	for _, ps := range patterns {
+		out.patterns = append(out.patterns, ps...)
+	}
+	return out
+}
+
+// Match reports whether name (slash-separated, relative to the walk root)
+// is excluded by the patterns. It does not look at name's parent
+// directories; walkers skip excluded directories instead.
+func (m *Matcher) Match(name string, isDir bool) bool {
+	if m == nil {
+		return false
+	}
+	for i := len(m.patterns) - 1; i >= 0; i-- {
+		if m.patterns[i].match(name, isDir) {
+			return !m.patterns[i].negate
+		}
+	}
+	return false
+}
+
+// ReadFile parses the ignore file at file, whose patterns are relative to
+// base. A missing file yields no patterns.
+func ReadFile(file, base string) ([]Pattern, error) {
+	b, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return Parse(b, base), nil
+}
+
+// GlobalFile returns the path of the user's global ignore file:
+// $HELIOS_IGNORE_FILE if set, else $XDG_CONFIG_HOME/helios/ignore (by
+// default ~/.config/helios/ignore). It returns "" if neither can be
+// determined.
+func GlobalFile() string {
+	if p := os.Getenv("HELIOS_IGNORE_FILE"); p != "" {
+		return p
+	}
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "helios", "ignore")
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".config", "helios", "ignore")
+	}
+	return ""
+}
+
+// Tree answers ignore queries during a walk of root, loading the ignore
+// files of each directory the first time it is needed. Within a directory
+// the listed files are applied in order, so later names take precedence.
+type Tree struct {
+	root  string
+	files []string
+
+	mu       sync.Mutex
+	matchers map[string]*Matcher // by slash-separated dir: "." is the root, "" the global patterns
+}
+
+// NewTree returns a Tree for root whose base patterns (e.g. from the global
+// file) come from global, which may be nil. files are the per-directory
+// ignore file names, lowest precedence first, e.g. ".gitignore",
+// ".heliosignore".
+func NewTree(root string, global *Matcher, files ...string) *Tree {
+	if global == nil {
+		global = &Matcher{}
+	}
+	return &Tree{root: root, files: files, matchers: map[string]*Matcher{"": global}}
+}
+
+// Ignored reports whether name, slash-separated and relative to the root, is
+// excluded. The caller must not ask about entries of excluded directories.
+func (t *Tree) Ignored(name string, isDir bool) (bool, error) {
+	m, err := t.matcher(path.Dir(name))
+	if err != nil {
+		return false, err
+	}
+	return m.Match(name, isDir), nil
+}
+
+// matcher returns the patterns in effect inside dir.
+func (t *Tree) matcher(dir string) (*Matcher, error) {
+	t.mu.Lock()
+	m, ok := t.matchers[dir]
+	t.mu.Unlock()
+	if ok {
+		return m, nil
+	}
+
+	parentKey := path.Dir(dir)
+	if dir == "." {
+		parentKey = ""
+	}
+	parent, err := t.matcher(parentKey)
+	if err != nil {
+		return nil, err
+	}
+
+	base := dir
+	if dir == "." {
+		base = ""
+	}
+	var layers [][]Pattern
+	for _, f := range t.files {
+		ps, err := ReadFile(filepath.Join(t.root, filepath.FromSlash(dir), f), base)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, ps)
+	}
+	m = parent.Append(layers...)
+
+	t.mu.Lock()
+	t.matchers[dir] = m
+	t.mu.Unlock()
+	return m, nil
+}
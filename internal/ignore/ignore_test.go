@@ -0,0 +1,123 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ignore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns string
+		path     string
+		isDir    bool
+		want     bool
+	}{
+		{"basename any depth", "*.o", "a/b/c.o", false, true},
+		{"basename no match", "*.o", "a/b/c.c", false, false},
+		{"comment", "#foo", "#foo", false, false},
+		{"escaped hash", `\#foo`, "#foo", false, true},
+		{"escaped bang", `\!foo`, "!foo", false, true},
+		{"trailing space trimmed", "foo  ", "foo", false, true},
+		{"escaped trailing space", `foo\ `, "foo ", false, true},
+		{"dir only matches dir", "build/", "x/build", true, true},
+		{"dir only skips file", "build/", "x/build", false, false},
+		{"leading slash anchors", "/foo", "foo", false, true},
+		{"leading slash not deep", "/foo", "a/foo", false, false},
+		{"middle slash anchors", "doc/*.txt", "doc/a.txt", false, true},
+		{"middle slash not deep", "doc/*.txt", "x/doc/a.txt", false, false},
+		{"star stays in segment", "doc/*.txt", "doc/sub/a.txt", false, false},
+		{"leading double star", "**/logs", "a/b/logs", true, true},
+		{"leading double star root", "**/logs", "logs", true, true},
+		{"trailing double star", "logs/**", "logs/a/b", false, true},
+		{"trailing double star not dir itself", "logs/**", "logs", true, false},
+		{"middle double star", "a/**/b", "a/x/y/b", false, true},
+		{"middle double star zero", "a/**/b", "a/b", false, true},
+		{"question mark", "fo?", "foo", false, true},
+		{"bracket", "[ab].txt", "b.txt", false, true},
+		{"bracket negation", "[!ab].txt", "c.txt", false, true},
+		{"bracket negation excludes", "[!ab].txt", "a.txt", false, false},
+		{"negation re-includes", "*.log\n!keep.log", "keep.log", false, false},
+		{"last match wins", "!keep.log\n*.log", "keep.log", false, true},
+		{"blank lines", "\n\n*.tmp\n", "x.tmp", false, true},
+		{"crlf", "*.tmp\r\n", "x.tmp", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMatcher(Parse([]byte(tt.patterns), ""))
+			if got := m.Match(tt.path, tt.isDir); got != tt.want {
+				t.Errorf("Match(%q, %v) with %q = %v, want %v", tt.path, tt.isDir, tt.patterns, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatch_Base(t *testing.T) {
+	m := NewMatcher(Parse([]byte("/gen\n*.out"), "sub"))
+	for path, want := range map[string]bool{
+		"sub/gen":     true,
+		"sub/x/gen":   false,
+		"gen":         false,
+		"sub/a/b.out": true,
+		"b.out":       false,
+	} {
+		if got := m.Match(path, false); got != want {
+			t.Errorf("Match(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestTree(t *testing.T) {
+	root := t.TempDir()
+	write := func(rel, data string) {
+		p := filepath.Join(root, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(".gitignore", "*.tmp\n")
+	write(FileName, "*.log\n!*.tmp\n")
+	write("a/"+FileName, "!keep.log\n/local\n")
+	write("a/b/"+FileName, "*.txt\n")
+
+	global := NewMatcher(Parse([]byte("*.bak\nkeep.log\n"), ""))
+	tree := NewTree(root, global, ".gitignore", FileName)
+	for path, want := range map[string]bool{
+		"x.bak":        true,  // global
+		"x.log":        true,  // root .heliosignore
+		"x.tmp":        false, // .heliosignore overrides .gitignore
+		"keep.log":     true,
+		"a/keep.log":   false, // deeper file re-includes
+		"a/local":      true,
+		"a/b/local":    false, // anchored to a/
+		"a/b/x.txt":    true,
+		"a/x.txt":      false,
+		"a/b/keep.log": false,
+	} {
+		got, err := tree.Ignored(path, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("Ignored(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
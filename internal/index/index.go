@@ -0,0 +1,292 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package index implements the stat cache that lets working-directory
+// ingestion skip files that have not changed since the last commit.
+//
+// For every ingested file the index records its size, modification and
+// change times, inode and device along with the hash of its content. A file
+// whose current stat data match its entry is taken to be unchanged and is
+// not read again. As in git, entries whose modification time is too close to
+// the time the index was built are "racily clean": the file may have been
+// modified again within the same timestamp tick, so such entries are always
+// rehashed.
+package index
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/good-night-oppie/helios/pkg/helios/types"
+)
+
+// FileName is the name of the index inside a repository's .helios directory.
+const FileName = "index"
+
+// racyWindow covers the coarsest timestamp granularity in common use (FAT
+// has two-second mtimes). An entry is only trusted once its mtime and ctime
+// are this much older than the index build time.
+const racyWindow = 2 * time.Second
+
+var magic = [4]byte{'H', 'I', 'D', 'X'}
+
+const version = 1
+
+// ErrCorrupt is returned by Load when the index cannot be decoded.
+var ErrCorrupt = errors.New("index: corrupt")
+
+// Stat is the subset of file metadata the index compares.
+type Stat struct {
+	Size  int64
+	Mtime int64 // nanoseconds since the Unix epoch
+	Ctime int64 // nanoseconds since the Unix epoch; 0 where unavailable
+	Ino   uint64
+	Dev   uint64
+}
+
+// StatOf extracts the compared metadata from info.
+func StatOf(info fs.FileInfo) Stat {
+	st := Stat{Size: info.Size(), Mtime: info.ModTime().UnixNano()}
+	sysStat(info, &st)
+	return st
+}
+
+// Entry is the cached state of one file.
+type Entry struct {
+	Stat
+	Hash types.Hash
+}
+
+// Index maps slash-separated paths to entries. It is not safe for
+// concurrent use.
+type Index struct {
+	// Stamp is when the scan that produced the entries started; entries
+	// modified within racyWindow of it are not trusted.
+	Stamp time.Time
+	// Store identifies the object store holding the hashed blobs. An index
+	// built against a different store must not be trusted.
+	Store   string
+	entries map[string]Entry
+}
+
+// New returns an empty index for a scan starting at stamp whose blobs go to
+// store.
+func New(stamp time.Time, store string) *Index {
+	return &Index{Stamp: stamp, Store: store, entries: make(map[string]Entry)}
+}
+
+// Len returns the number of entries.
+func (ix *Index) Len() int { return len(ix.entries) }
+
+// Lookup returns the cached hash of path if st matches its entry and the
+// entry is not racily clean. Callers check Store first.
+func (ix *Index) Lookup(path string, st Stat) (types.Hash, bool) {
+	e, ok := ix.entries[path]
+	if !ok || e.Stat != st {
+		return types.Hash{}, false
+	}
+	cutoff := ix.Stamp.Add(-racyWindow).UnixNano()
+	if e.Mtime >= cutoff || e.Ctime >= cutoff {
+		return types.Hash{}, false
+	}
+	return e.Hash, true
+}
+
+// Set records the hash of path as read after st was taken.
+func (ix *Index) Set(path string, st Stat, h types.Hash) {
+	ix.entries[path] = Entry{Stat: st, Hash: h}
+}
+
+// Load reads the index at path. A missing file yields an empty index with a
+// zero Stamp; an undecodable one yields an error wrapping ErrCorrupt.
+func Load(path string) (*Index, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return New(time.Time{}, ""), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	ix, err := decode(b)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrCorrupt, path, err)
+	}
+	return ix, nil
+}
+
+// Save atomically writes the index to path, creating its directory.
+func (ix *Index) Save(path string) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(ix.encode()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// encode lays out the index as
+//
+//	magic "HIDX" | version u32 | stamp i64 | store_len uvarint | store |
+//	count u32 | entry* | sha256
+//	entry = path_len uvarint | path | size i64 | mtime i64 | ctime i64 |
+//	        ino u64 | dev u64 | algo_len u8 | algo | digest_len u8 | digest
+//
+// with entries sorted by path and integers big-endian.
+func (ix *Index) encode() []byte {
+	paths := make([]string, 0, len(ix.entries))
+	for p := range ix.entries {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	var buf bytes.Buffer
+	buf.Write(magic[:])
+	be := binary.BigEndian
+	var scratch [binary.MaxVarintLen64]byte
+	put32 := func(x uint32) { buf.Write(be.AppendUint32(scratch[:0], x)) }
+	put64 := func(x uint64) { buf.Write(be.AppendUint64(scratch[:0], x)) }
+	put32(version)
+	put64(uint64(ix.Stamp.UnixNano()))
+	buf.Write(binary.AppendUvarint(scratch[:0], uint64(len(ix.Store))))
+	buf.WriteString(ix.Store)
+	put32(uint32(len(paths)))
+	for _, p := range paths {
+		e := ix.entries[p]
+		buf.Write(binary.AppendUvarint(scratch[:0], uint64(len(p))))
+		buf.WriteString(p)
+		put64(uint64(e.Size))
+		put64(uint64(e.Mtime))
+		put64(uint64(e.Ctime))
+		put64(e.Ino)
+		put64(e.Dev)
+		buf.WriteByte(byte(len(e.Hash.Algorithm)))
+		buf.WriteString(string(e.Hash.Algorithm))
+		buf.WriteByte(byte(len(e.Hash.Digest)))
+		buf.Write(e.Hash.Digest)
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	buf.Write(sum[:])
+	return buf.Bytes()
+}
+
+func decode(b []byte) (*Index, error) {
+	if len(b) < len(magic)+4+8+4+sha256.Size {
+		return nil, errors.New("short file")
+	}
+	body, sum := b[:len(b)-sha256.Size], b[len(b)-sha256.Size:]
+	if want := sha256.Sum256(body); !bytes.Equal(sum, want[:]) {
+		return nil, errors.New("checksum mismatch")
+	}
+	if !bytes.Equal(body[:4], magic[:]) {
+		return nil, errors.New("bad magic")
+	}
+	r := bufio.NewReader(bytes.NewReader(body[4:]))
+	be := binary.BigEndian
+	var hdr struct {
+		Version uint32
+		Stamp   int64
+	}
+	if err := binary.Read(r, be, &hdr); err != nil {
+		return nil, err
+	}
+	if hdr.Version != version {
+		return nil, fmt.Errorf("unsupported version %d", hdr.Version)
+	}
+	store, err := readString(r, len(body))
+	if err != nil {
+		return nil, err
+	}
+	var count uint32
+	if err := binary.Read(r, be, &count); err != nil {
+		return nil, err
+	}
+	ix := &Index{Stamp: time.Unix(0, hdr.Stamp), Store: string(store), entries: make(map[string]Entry, count)}
+	for i := uint32(0); i < count; i++ {
+		p, err := readString(r, len(body))
+		if err != nil {
+			return nil, err
+		}
+		var st Stat
+		if err := binary.Read(r, be, &st); err != nil {
+			return nil, err
+		}
+		algo, err := readShort(r)
+		if err != nil {
+			return nil, err
+		}
+		digest, err := readShort(r)
+		if err != nil {
+			return nil, err
+		}
+		ix.entries[string(p)] = Entry{
+			Stat: st,
+			Hash: types.Hash{Algorithm: types.HashAlgorithm(algo), Digest: digest},
+		}
+	}
+	if _, err := r.ReadByte(); err != io.EOF {
+		return nil, errors.New("trailing data")
+	}
+	return ix, nil
+}
+
+// readString reads a uvarint length no larger than limit followed by that
+// many bytes.
+func readString(r *bufio.Reader, limit int) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(limit) {
+		return nil, errors.New("length out of range")
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// readShort reads a u8 length followed by that many bytes.
+func readShort(r *bufio.Reader) ([]byte, error) {
+	n, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
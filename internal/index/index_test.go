@@ -0,0 +1,124 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/good-night-oppie/helios/pkg/helios/types"
+)
+
+func TestIndex_RoundTrip(t *testing.T) {
+	stamp := time.Unix(1_700_000_000, 0)
+	ix := New(stamp, "/store")
+	old := stamp.Add(-time.Hour).UnixNano()
+	a := Stat{Size: 5, Mtime: old, Ctime: old, Ino: 42, Dev: 7}
+	h := types.Hash{Algorithm: types.BLAKE3, Digest: []byte{1, 2, 3}}
+	ix.Set("dir/a.txt", a, h)
+	ix.Set("b", Stat{Size: 1, Mtime: old}, types.Hash{Algorithm: types.SHA256, Digest: []byte{9}})
+
+	path := filepath.Join(t.TempDir(), ".helios", FileName)
+	if err := ix.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Len() != 2 || got.Store != "/store" || !got.Stamp.Equal(stamp) {
+		t.Fatalf("loaded %d entries, store %q, stamp %v", got.Len(), got.Store, got.Stamp)
+	}
+	if gh, ok := got.Lookup("dir/a.txt", a); !ok || gh.String() != h.String() {
+		t.Fatalf("Lookup = %v, %v", gh, ok)
+	}
+}
+
+func TestIndex_Lookup(t *testing.T) {
+	stamp := time.Unix(1_700_000_000, 0)
+	old := stamp.Add(-time.Minute).UnixNano()
+	recent := stamp.Add(-time.Second).UnixNano()
+	base := Stat{Size: 5, Mtime: old, Ctime: old, Ino: 42, Dev: 7}
+	h := types.Hash{Algorithm: types.BLAKE3, Digest: []byte{1}}
+
+	tests := []struct {
+		name  string
+		entry Stat
+		now   Stat
+		want  bool
+	}{
+		{"unchanged", base, base, true},
+		{"size", base, Stat{Size: 6, Mtime: old, Ctime: old, Ino: 42, Dev: 7}, false},
+		{"mtime", base, Stat{Size: 5, Mtime: old + 1, Ctime: old, Ino: 42, Dev: 7}, false},
+		{"ctime", base, Stat{Size: 5, Mtime: old, Ctime: old + 1, Ino: 42, Dev: 7}, false},
+		{"inode", base, Stat{Size: 5, Mtime: old, Ctime: old, Ino: 43, Dev: 7}, false},
+		{"racy mtime", Stat{Size: 5, Mtime: recent, Ctime: old}, Stat{Size: 5, Mtime: recent, Ctime: old}, false},
+		{"racy ctime", Stat{Size: 5, Mtime: old, Ctime: recent}, Stat{Size: 5, Mtime: old, Ctime: recent}, false},
+		{"after stamp", Stat{Size: 5, Mtime: stamp.Add(time.Second).UnixNano()}, Stat{Size: 5, Mtime: stamp.Add(time.Second).UnixNano()}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ix := New(stamp, "")
+			ix.Set("f", tt.entry, h)
+			if _, ok := ix.Lookup("f", tt.now); ok != tt.want {
+				t.Fatalf("Lookup = %v, want %v", ok, tt.want)
+			}
+		})
+	}
+	if _, ok := New(stamp, "").Lookup("missing", base); ok {
+		t.Fatal("Lookup of a missing path should miss")
+	}
+}
+
+func TestIndex_Load(t *testing.T) {
+	dir := t.TempDir()
+	ix, err := Load(filepath.Join(dir, "absent"))
+	if err != nil || ix.Len() != 0 {
+		t.Fatalf("Load(absent) = %v entries, %v", ix, err)
+	}
+
+	path := filepath.Join(dir, FileName)
+	full := New(time.Now(), "s")
+	full.Set("a", Stat{Size: 1}, types.Hash{Algorithm: types.BLAKE3, Digest: []byte{1}})
+	if err := full.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := os.ReadFile(path)
+	b[len(b)/2] ^= 0xff
+	if err := os.WriteFile(path, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("Load(corrupt) error = %v, want ErrCorrupt", err)
+	}
+}
+
+func TestStatOf(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "f")
+	if err := os.WriteFile(path, []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := StatOf(info)
+	if st.Size != 5 || st.Mtime != info.ModTime().UnixNano() {
+		t.Fatalf("StatOf = %+v", st)
+	}
+}
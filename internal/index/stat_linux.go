@@ -0,0 +1,30 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+
+package index
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+func sysStat(info fs.FileInfo, st *Stat) {
+	if sys, ok := info.Sys().(*syscall.Stat_t); ok {
+		st.Ctime = sys.Ctim.Nano()
+		st.Ino = uint64(sys.Ino)
+		st.Dev = uint64(sys.Dev)
+	}
+}
@@ -0,0 +1,313 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ingest reads a directory tree into content-addressed blobs with a
+// pipelined, parallel walk:
+//
+//	walkers --files--> hash workers --blobs--> batch writers
+//
+// Directories are listed concurrently, a bounded pool of workers reads and
+// BLAKE3-hashes regular files, and, when a store is configured, writers
+// group blobs into PutBatch calls. Every stage hands off through a bounded
+// channel, so a slow store throttles hashing and slow hashing throttles the
+// walk. Results are sorted by path, so they do not depend on scheduling.
+package ingest
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+
+	"github.com/good-night-oppie/helios/internal/index"
+	"github.com/good-night-oppie/helios/internal/util"
+	"github.com/good-night-oppie/helios/pkg/helios/objstore"
+	"github.com/good-night-oppie/helios/pkg/helios/types"
+)
+
+const (
+	// DefaultBatchBytes bounds the payload of one PutBatch call.
+	DefaultBatchBytes = 8 << 20
+	// DefaultBatchCount bounds the number of entries in one PutBatch call.
+	DefaultBatchCount = 1024
+)
+
+// File is one ingested regular file.
+type File struct {
+	Path   string // slash-separated, relative to the root
+	Stat   index.Stat
+	Hash   types.Hash
+	Data   []byte // content; nil when Options.Store took it or Cached is set
+	Cached bool   // hash came from Options.Cached; the file was not read
+}
+
+// Options configures Dir. The zero value hashes with GOMAXPROCS workers and
+// returns content with every file.
+type Options struct {
+	// Workers is the number of hashing goroutines; <= 0 means GOMAXPROCS.
+	// Directory listing uses as many concurrent readers.
+	Workers int
+
+	// Ignore, if set, reports whether a path (slash-separated, relative to
+	// the root) is excluded. Excluded directories are not entered. It is
+	// called concurrently.
+	Ignore func(rel string, isDir bool) (bool, error)
+
+	// Cached, if set, returns the known hash of a file whose stat data are
+	// st; such files are not read. It is called concurrently.
+	Cached func(rel string, st index.Stat) (types.Hash, bool)
+
+	// Store, if set, receives the blobs of files that were read, in batches
+	// of at most BatchBytes/BatchCount, from Writers goroutines, and File.Data
+	// is left nil. Each distinct blob is stored once per call to Dir.
+	Store      func(batch []objstore.BatchEntry) error
+	Writers    int // <= 0 means 2
+	BatchBytes int // <= 0 means DefaultBatchBytes
+	BatchCount int // <= 0 means DefaultBatchCount
+}
+
+type job struct {
+	abs, rel string
+	d        fs.DirEntry
+}
+
+// pipeline carries the shared state of one Dir call.
+type pipeline struct {
+	root string
+	opts Options
+
+	dirSem chan struct{} // bounds concurrent directory reads
+	files  chan job
+	blobs  chan objstore.BatchEntry
+	done   chan struct{} // closed on the first error
+
+	errOnce sync.Once
+	err     error
+
+	mu  sync.Mutex
+	out []File
+}
+
+// Dir ingests the regular files below root. Symlinks and other special
+// files are skipped. On error the pipeline stops early and the first error
+// is returned.
+func Dir(root string, opts Options) ([]File, error) {
+	if opts.Workers <= 0 {
+		opts.Workers = runtime.GOMAXPROCS(0)
+	}
+	if opts.Writers <= 0 {
+		opts.Writers = 2
+	}
+	if opts.BatchBytes <= 0 {
+		opts.BatchBytes = DefaultBatchBytes
+	}
+	if opts.BatchCount <= 0 {
+		opts.BatchCount = DefaultBatchCount
+	}
+	p := &pipeline{
+		root:   root,
+		opts:   opts,
+		dirSem: make(chan struct{}, opts.Workers),
+		files:  make(chan job, 4*opts.Workers),
+		blobs:  make(chan objstore.BatchEntry, 4*opts.Workers),
+		done:   make(chan struct{}),
+	}
+
+	var walkers sync.WaitGroup
+	walkers.Add(1)
+	go p.walk(&walkers, root, "")
+	go func() {
+		walkers.Wait()
+		close(p.files)
+	}()
+
+	var hashers sync.WaitGroup
+	for i := 0; i < opts.Workers; i++ {
+		hashers.Add(1)
+		go func() {
+			defer hashers.Done()
+			p.hash()
+		}()
+	}
+	go func() {
+		hashers.Wait()
+		close(p.blobs)
+	}()
+
+	var writers sync.WaitGroup
+	if opts.Store != nil {
+		var seen sync.Map
+		for i := 0; i < opts.Writers; i++ {
+			writers.Add(1)
+			go func() {
+				defer writers.Done()
+				p.write(&seen)
+			}()
+		}
+	}
+	hashers.Wait()
+	writers.Wait()
+	if p.err != nil {
+		return nil, p.err
+	}
+	sort.Slice(p.out, func(i, j int) bool { return p.out[i].Path < p.out[j].Path })
+	return p.out, nil
+}
+
+func (p *pipeline) fail(err error) {
+	p.errOnce.Do(func() {
+		p.err = err
+		close(p.done)
+	})
+}
+
+func (p *pipeline) stopped() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// walk lists dir and queues its files, starting a walker per subdirectory.
+// Only the directory read holds a dirSem slot, so walkers blocked on a full
+// files channel never starve the listing of other directories.
+func (p *pipeline) walk(wg *sync.WaitGroup, abs, rel string) {
+	defer wg.Done()
+	if p.stopped() {
+		return
+	}
+	p.dirSem <- struct{}{}
+	ents, err := os.ReadDir(abs)
+	<-p.dirSem
+	if err != nil {
+		p.fail(err)
+		return
+	}
+	for _, d := range ents {
+		r := d.Name()
+		if rel != "" {
+			r = path.Join(rel, r)
+		}
+		if p.opts.Ignore != nil {
+			ignored, err := p.opts.Ignore(r, d.IsDir())
+			if err != nil {
+				p.fail(err)
+				return
+			}
+			if ignored {
+				continue
+			}
+		}
+		a := filepath.Join(abs, d.Name())
+		if d.IsDir() {
+			wg.Add(1)
+			go p.walk(wg, a, r)
+			continue
+		}
+		// Only ingest regular files; skip symlinks, sockets, etc.
+		if !d.Type().IsRegular() {
+			continue
+		}
+		select {
+		case p.files <- job{abs: a, rel: r, d: d}:
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// hash reads and hashes queued files until the walk is done.
+func (p *pipeline) hash() {
+	for j := range p.files {
+		if p.stopped() {
+			continue // drain so walkers can exit
+		}
+		f, err := p.hashOne(j)
+		if err != nil {
+			p.fail(err)
+			continue
+		}
+		p.mu.Lock()
+		p.out = append(p.out, f)
+		p.mu.Unlock()
+	}
+}
+
+func (p *pipeline) hashOne(j job) (File, error) {
+	// Stat before reading: a change in between then shows up as a stat
+	// mismatch next time rather than as stale content.
+	info, err := j.d.Info()
+	if err != nil {
+		return File{}, err
+	}
+	f := File{Path: j.rel, Stat: index.StatOf(info)}
+	if p.opts.Cached != nil {
+		if h, ok := p.opts.Cached(j.rel, f.Stat); ok {
+			f.Hash, f.Cached = h, true
+			return f, nil
+		}
+	}
+	b, err := os.ReadFile(j.abs)
+	if err != nil {
+		return File{}, err
+	}
+	if f.Hash, err = util.HashBlob(b); err != nil {
+		return File{}, fmt.Errorf("hash %s: %w", j.rel, err)
+	}
+	if p.opts.Store == nil {
+		f.Data = b
+		return f, nil
+	}
+	select {
+	case p.blobs <- objstore.BatchEntry{Hash: f.Hash, Value: b}:
+	case <-p.done:
+		return File{}, errors.New("ingest: stopped")
+	}
+	return f, nil
+}
+
+// write groups blobs into batches for Options.Store, skipping blobs another
+// writer has already taken.
+func (p *pipeline) write(seen *sync.Map) {
+	var batch []objstore.BatchEntry
+	size := 0
+	flush := func() {
+		if len(batch) == 0 || p.stopped() {
+			batch, size = batch[:0], 0
+			return
+		}
+		if err := p.opts.Store(batch); err != nil {
+			p.fail(fmt.Errorf("store blobs: %w", err))
+		}
+		batch, size = nil, 0
+	}
+	for e := range p.blobs {
+		if _, dup := seen.LoadOrStore(e.Hash.String(), struct{}{}); dup {
+			continue
+		}
+		batch = append(batch, e)
+		size += len(e.Value)
+		if size >= p.opts.BatchBytes || len(batch) >= p.opts.BatchCount {
+			flush()
+		}
+	}
+	flush()
+}
@@ -0,0 +1,213 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ingest
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/good-night-oppie/helios/internal/index"
+	"github.com/good-night-oppie/helios/internal/util"
+	"github.com/good-night-oppie/helios/pkg/helios/objstore"
+	"github.com/good-night-oppie/helios/pkg/helios/types"
+)
+
+// makeTree writes n files spread over nested directories, with every tenth
+// file sharing content.
+func makeTree(t testing.TB, n int) string {
+	t.Helper()
+	root := t.TempDir()
+	for i := 0; i < n; i++ {
+		rel := filepath.Join(fmt.Sprintf("d%d", i%7), fmt.Sprintf("s%d", i%3), fmt.Sprintf("f%03d.txt", i))
+		data := fmt.Sprintf("file %d\n%s", i, strings.Repeat("x", i))
+		if i%10 == 0 {
+			data = "shared"
+		}
+		p := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func paths(files []File) []string {
+	out := make([]string, len(files))
+	for i, f := range files {
+		out[i] = f.Path
+	}
+	return out
+}
+
+func TestDir_Deterministic(t *testing.T) {
+	root := makeTree(t, 200)
+	if err := os.Symlink("d0", filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+	var want []File
+	for _, workers := range []int{1, 3, 16} {
+		got, err := Dir(root, Options{Workers: workers})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 200 {
+			t.Fatalf("workers=%d: %d files, want 200", workers, len(got))
+		}
+		for _, f := range got {
+			b, _ := os.ReadFile(filepath.Join(root, filepath.FromSlash(f.Path)))
+			h, _ := util.HashBlob(b)
+			if string(f.Data) != string(b) || f.Hash.String() != h.String() {
+				t.Fatalf("workers=%d: %s has wrong data or hash", workers, f.Path)
+			}
+		}
+		if want == nil {
+			want = got
+		} else if !reflect.DeepEqual(got, want) {
+			t.Fatalf("workers=%d: result differs from workers=1", workers)
+		}
+	}
+}
+
+func TestDir_IgnoreAndCached(t *testing.T) {
+	root := makeTree(t, 50)
+	var mu sync.Mutex
+	var asked []string
+	files, err := Dir(root, Options{
+		Ignore: func(rel string, isDir bool) (bool, error) {
+			mu.Lock()
+			asked = append(asked, rel)
+			mu.Unlock()
+			return rel == "d1" || strings.HasSuffix(rel, "5.txt"), nil
+		},
+		Cached: func(rel string, st index.Stat) (types.Hash, bool) {
+			if rel == "d0/s0/f021.txt" {
+				return types.Hash{Algorithm: types.BLAKE3, Digest: []byte("cached")}, true
+			}
+			return types.Hash{}, false
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range asked {
+		if strings.HasPrefix(a, "d1/") {
+			t.Fatalf("walked into ignored dir: %s", a)
+		}
+	}
+	for _, f := range files {
+		if strings.HasPrefix(f.Path, "d1/") || strings.HasSuffix(f.Path, "5.txt") {
+			t.Fatalf("ignored file ingested: %s", f.Path)
+		}
+		if f.Path == "d0/s0/f021.txt" {
+			if !f.Cached || f.Data != nil || string(f.Hash.Digest) != "cached" {
+				t.Fatalf("cached file = %+v", f)
+			}
+		} else if f.Cached {
+			t.Fatalf("%s reported cached", f.Path)
+		}
+	}
+}
+
+func TestDir_Store(t *testing.T) {
+	root := makeTree(t, 100)
+	var mu sync.Mutex
+	stored := map[string]int{}
+	var batches int
+	files, err := Dir(root, Options{
+		Workers:    4,
+		BatchCount: 7,
+		Store: func(batch []objstore.BatchEntry) error {
+			if len(batch) > 7 {
+				return fmt.Errorf("batch of %d", len(batch))
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			batches++
+			for _, e := range batch {
+				stored[e.Hash.String()]++
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	distinct := map[string]bool{}
+	for _, f := range files {
+		if f.Data != nil {
+			t.Fatalf("%s kept its data with a store", f.Path)
+		}
+		distinct[f.Hash.String()] = true
+	}
+	if len(stored) != len(distinct) {
+		t.Fatalf("stored %d blobs, want %d", len(stored), len(distinct))
+	}
+	for h, n := range stored {
+		if n != 1 {
+			t.Fatalf("blob %s stored %d times", h, n)
+		}
+	}
+	if batches < len(distinct)/7 {
+		t.Fatalf("%d batches for %d blobs", batches, len(distinct))
+	}
+	if got := paths(files); !reflect.DeepEqual(got, paths(mustDir(t, root))) {
+		t.Fatal("store changed the file list")
+	}
+}
+
+func TestDir_Errors(t *testing.T) {
+	root := makeTree(t, 100)
+	boom := errors.New("boom")
+	if _, err := Dir(root, Options{Workers: 2, BatchCount: 1, Store: func([]objstore.BatchEntry) error { return boom }}); !errors.Is(err, boom) {
+		t.Fatalf("store error = %v", err)
+	}
+	if _, err := Dir(root, Options{Ignore: func(string, bool) (bool, error) { return false, boom }}); !errors.Is(err, boom) {
+		t.Fatalf("ignore error = %v", err)
+	}
+	if _, err := Dir(filepath.Join(root, "missing"), Options{}); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("missing root error = %v", err)
+	}
+}
+
+func mustDir(t *testing.T, root string) []File {
+	t.Helper()
+	files, err := Dir(root, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func BenchmarkDir(b *testing.B) {
+	root := makeTree(b, 2000)
+	for _, workers := range []int{1, 0} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := Dir(root, Options{Workers: workers, Store: func([]objstore.BatchEntry) error { return nil }}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
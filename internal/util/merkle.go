@@ -30,6 +30,10 @@ func HashBlob(content []byte) (types.Hash, error) {
 // HashTree computes a deterministic Merkle hash for a directory.
 // entries: list of "name:type:hexChildHash" (already stable & normalized).
 // We hash the joined string to get the tree hash.
+//
+// Deprecated: names are not escaped, so a name containing ':' or '\n' can
+// collide with other trees. Use HashTreeEntries, which hashes the canonical
+// encoding described in spec/tree-encoding.md.
 func HashTree(entries []string) (types.Hash, error) {
 	sort.Strings(entries)                            // deterministic order
 	joined := strings.Join(entries, "\n")            // stable join
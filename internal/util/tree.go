@@ -0,0 +1,169 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/good-night-oppie/helios/pkg/helios/types"
+)
+
+// EntryKind identifies what a tree entry refers to.
+// Values are part of the canonical encoding (spec/tree-encoding.md) and must never change.
+type EntryKind uint8
+
+const (
+	KindBlob    EntryKind = 1 // regular file
+	KindExec    EntryKind = 2 // executable regular file
+	KindSymlink EntryKind = 3 // symbolic link; the blob holds the link target
+	KindTree    EntryKind = 4 // subdirectory
+)
+
+// TreeMagic prefixes every canonical tree encoding.
+var TreeMagic = []byte("htree\x01")
+
+// TreeEntry is one named child of a directory.
+type TreeEntry struct {
+	Name string
+	Kind EntryKind
+	Hash types.Hash
+}
+
+var algorithmCodes = map[types.HashAlgorithm]byte{
+	types.BLAKE3: 1,
+	types.SHA256: 2,
+}
+
+// EncodeTree returns the canonical binary encoding of a directory.
+// Entries are sorted bytewise by name; the input slice is not modified.
+// Empty names, names containing '/' or NUL, duplicate names and unknown
+// kinds or hash algorithms are rejected.
+func EncodeTree(entries []TreeEntry) ([]byte, error) {
+	sorted := make([]TreeEntry, len(entries))
+	copy(sorted, entries)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+
+	var buf bytes.Buffer
+	buf.Write(TreeMagic)
+	var u32 [4]byte
+	binary.BigEndian.PutUint32(u32[:], uint32(len(sorted)))
+	buf.Write(u32[:])
+
+	for i, e := range sorted {
+		if err := validateEntry(e); err != nil {
+			return nil, err
+		}
+		if i > 0 && sorted[i-1].Name == e.Name {
+			return nil, fmt.Errorf("duplicate tree entry %q", e.Name)
+		}
+		buf.WriteByte(byte(e.Kind))
+		binary.BigEndian.PutUint32(u32[:], uint32(len(e.Name)))
+		buf.Write(u32[:])
+		buf.WriteString(e.Name)
+		buf.WriteByte(algorithmCodes[e.Hash.Algorithm])
+		buf.WriteByte(byte(len(e.Hash.Digest)))
+		buf.Write(e.Hash.Digest)
+	}
+	return buf.Bytes(), nil
+}
+
+func validateEntry(e TreeEntry) error {
+	if e.Name == "" {
+		return errors.New("empty tree entry name")
+	}
+	if strings.ContainsAny(e.Name, "/\x00") {
+		return fmt.Errorf("tree entry name %q contains '/' or NUL", e.Name)
+	}
+	if e.Kind < KindBlob || e.Kind > KindTree {
+		return fmt.Errorf("tree entry %q has unknown kind %d", e.Name, e.Kind)
+	}
+	if _, ok := algorithmCodes[e.Hash.Algorithm]; !ok {
+		return fmt.Errorf("tree entry %q has unsupported hash algorithm %q", e.Name, e.Hash.Algorithm)
+	}
+	if len(e.Hash.Digest) == 0 || len(e.Hash.Digest) > math.MaxUint8 {
+		return fmt.Errorf("tree entry %q has invalid digest length %d", e.Name, len(e.Hash.Digest))
+	}
+	return nil
+}
+
+// DecodeTree parses a canonical tree encoding. It rejects trailing data,
+// unsorted or duplicate names and anything EncodeTree would refuse to write.
+func DecodeTree(b []byte) ([]TreeEntry, error) {
+	if !bytes.HasPrefix(b, TreeMagic) {
+		return nil, errors.New("not a canonical tree encoding")
+	}
+	b = b[len(TreeMagic):]
+	if len(b) < 4 {
+		return nil, errors.New("truncated tree header")
+	}
+	n := binary.BigEndian.Uint32(b)
+	b = b[4:]
+
+	codes := make(map[byte]types.HashAlgorithm, len(algorithmCodes))
+	for a, c := range algorithmCodes {
+		codes[c] = a
+	}
+	entries := make([]TreeEntry, 0, min(int(n), len(b)/8))
+	for i := uint32(0); i < n; i++ {
+		if len(b) < 5 {
+			return nil, fmt.Errorf("truncated tree entry %d", i)
+		}
+		kind := EntryKind(b[0])
+		nameLen := binary.BigEndian.Uint32(b[1:5])
+		b = b[5:]
+		if uint64(len(b)) < uint64(nameLen)+2 {
+			return nil, fmt.Errorf("truncated tree entry %d", i)
+		}
+		name := string(b[:nameLen])
+		b = b[nameLen:]
+		algo, ok := codes[b[0]]
+		if !ok {
+			return nil, fmt.Errorf("tree entry %q has unknown algorithm code %d", name, b[0])
+		}
+		dlen := int(b[1])
+		b = b[2:]
+		if len(b) < dlen {
+			return nil, fmt.Errorf("truncated digest in tree entry %q", name)
+		}
+		e := TreeEntry{Name: name, Kind: kind, Hash: types.Hash{Algorithm: algo, Digest: append([]byte(nil), b[:dlen]...)}}
+		b = b[dlen:]
+		if err := validateEntry(e); err != nil {
+			return nil, err
+		}
+		if len(entries) > 0 && entries[len(entries)-1].Name >= name {
+			return nil, fmt.Errorf("tree entry %q is out of order or duplicated", name)
+		}
+		entries = append(entries, e)
+	}
+	if len(b) != 0 {
+		return nil, fmt.Errorf("%d trailing bytes after tree", len(b))
+	}
+	return entries, nil
+}
+
+// HashTreeEntries returns the BLAKE3 hash of the canonical tree encoding.
+func HashTreeEntries(entries []TreeEntry) (types.Hash, error) {
+	enc, err := EncodeTree(entries)
+	if err != nil {
+		return types.Hash{}, err
+	}
+	return HashContent(enc, types.BLAKE3)
+}
@@ -0,0 +1,221 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/good-night-oppie/helios/pkg/helios/types"
+)
+
+var updateGolden = flag.Bool("update", false, "update golden files")
+
+const treeVectorsPath = "../../spec/golden/tree/tree_vectors.golden.json"
+
+type vectorEntry struct {
+	Name      string `json:"name"`
+	Kind      uint8  `json:"kind"`
+	Algorithm string `json:"algorithm"`
+	Digest    string `json:"digest"`
+}
+
+type treeVector struct {
+	Name     string        `json:"name"`
+	Entries  []vectorEntry `json:"entries"`
+	Encoding string        `json:"encoding"`
+	Hash     string        `json:"hash"`
+}
+
+func digestOf(s string) string {
+	h, _ := HashBlob([]byte(s))
+	return hex.EncodeToString(h.Digest)
+}
+
+// vectorInputs defines the golden tree inputs; outputs are recorded with -update.
+func vectorInputs() []treeVector {
+	hello, world := digestOf("hello"), digestOf("world")
+	return []treeVector{
+		{Name: "empty", Entries: []vectorEntry{}},
+		{Name: "single-blob", Entries: []vectorEntry{
+			{Name: "hello.txt", Kind: 1, Algorithm: "blake3", Digest: hello},
+		}},
+		{Name: "all-kinds-unsorted-input", Entries: []vectorEntry{
+			{Name: "src", Kind: 4, Algorithm: "blake3", Digest: world},
+			{Name: "run.sh", Kind: 2, Algorithm: "blake3", Digest: hello},
+			{Name: "latest", Kind: 3, Algorithm: "blake3", Digest: world},
+			{Name: "README", Kind: 1, Algorithm: "blake3", Digest: hello},
+		}},
+		{Name: "bytewise-order-non-ascii", Entries: []vectorEntry{
+			{Name: "é.txt", Kind: 1, Algorithm: "blake3", Digest: hello},
+			{Name: "z.txt", Kind: 1, Algorithm: "blake3", Digest: hello},
+			{Name: "Z.txt", Kind: 1, Algorithm: "blake3", Digest: hello},
+		}},
+		// Under the legacy "name:type:hex" joined with "\n" scheme these two
+		// trees produce identical preimages.
+		{Name: "legacy-collision-two-entries", Entries: []vectorEntry{
+			{Name: "a", Kind: 1, Algorithm: "blake3", Digest: hello},
+			{Name: "b", Kind: 1, Algorithm: "blake3", Digest: world},
+		}},
+		{Name: "legacy-collision-one-entry", Entries: []vectorEntry{
+			{Name: "a:blob:" + hello + "\nb", Kind: 1, Algorithm: "blake3", Digest: world},
+		}},
+		{Name: "sha256-child", Entries: []vectorEntry{
+			{Name: "data.bin", Kind: 1, Algorithm: "sha256", Digest: "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+		}},
+	}
+}
+
+func toEntries(t *testing.T, in []vectorEntry) []TreeEntry {
+	t.Helper()
+	out := make([]TreeEntry, 0, len(in))
+	for _, e := range in {
+		d, err := hex.DecodeString(e.Digest)
+		if err != nil {
+			t.Fatalf("bad digest %q: %v", e.Digest, err)
+		}
+		out = append(out, TreeEntry{Name: e.Name, Kind: EntryKind(e.Kind), Hash: types.Hash{Algorithm: types.HashAlgorithm(e.Algorithm), Digest: d}})
+	}
+	return out
+}
+
+func TestTreeEncoding_GoldenVectors(t *testing.T) {
+	if *updateGolden {
+		vecs := vectorInputs()
+		for i := range vecs {
+			entries := toEntries(t, vecs[i].Entries)
+			enc, err := EncodeTree(entries)
+			if err != nil {
+				t.Fatalf("%s: %v", vecs[i].Name, err)
+			}
+			h, _ := HashTreeEntries(entries)
+			vecs[i].Encoding = hex.EncodeToString(enc)
+			vecs[i].Hash = h.String()
+		}
+		b, _ := json.MarshalIndent(vecs, "", "  ")
+		if err := os.MkdirAll(filepath.Dir(treeVectorsPath), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(treeVectorsPath, append(b, '\n'), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	b, err := os.ReadFile(treeVectorsPath)
+	if err != nil {
+		t.Fatalf("read vectors: %v", err)
+	}
+	var vecs []treeVector
+	if err := json.Unmarshal(b, &vecs); err != nil {
+		t.Fatalf("parse vectors: %v", err)
+	}
+	if len(vecs) == 0 {
+		t.Fatal("no vectors")
+	}
+	seen := map[string]string{}
+	for _, v := range vecs {
+		t.Run(v.Name, func(t *testing.T) {
+			entries := toEntries(t, v.Entries)
+			enc, err := EncodeTree(entries)
+			if err != nil {
+				t.Fatalf("encode: %v", err)
+			}
+			if got := hex.EncodeToString(enc); got != v.Encoding {
+				t.Fatalf("encoding mismatch\n got=%s\nwant=%s", got, v.Encoding)
+			}
+			h, err := HashTreeEntries(entries)
+			if err != nil {
+				t.Fatalf("hash: %v", err)
+			}
+			if h.String() != v.Hash {
+				t.Fatalf("hash mismatch: got=%s want=%s", h.String(), v.Hash)
+			}
+			if other, dup := seen[v.Hash]; dup {
+				t.Fatalf("vectors %q and %q collide", other, v.Name)
+			}
+			seen[v.Hash] = v.Name
+		})
+	}
+}
+
+func TestEncodeTree_Rejects(t *testing.T) {
+	h, _ := HashBlob([]byte("x"))
+	tests := []struct {
+		name    string
+		entries []TreeEntry
+	}{
+		{"empty name", []TreeEntry{{Name: "", Kind: KindBlob, Hash: h}}},
+		{"slash in name", []TreeEntry{{Name: "a/b", Kind: KindBlob, Hash: h}}},
+		{"nul in name", []TreeEntry{{Name: "a\x00", Kind: KindBlob, Hash: h}}},
+		{"duplicate", []TreeEntry{{Name: "a", Kind: KindBlob, Hash: h}, {Name: "a", Kind: KindTree, Hash: h}}},
+		{"unknown kind", []TreeEntry{{Name: "a", Kind: 9, Hash: h}}},
+		{"unknown algorithm", []TreeEntry{{Name: "a", Kind: KindBlob, Hash: types.Hash{Algorithm: "md5", Digest: []byte{1}}}}},
+		{"empty digest", []TreeEntry{{Name: "a", Kind: KindBlob, Hash: types.Hash{Algorithm: types.BLAKE3}}}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := EncodeTree(tc.entries); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestEncodeTree_DoesNotReorderInput(t *testing.T) {
+	h, _ := HashBlob([]byte("x"))
+	in := []TreeEntry{{Name: "b", Kind: KindBlob, Hash: h}, {Name: "a", Kind: KindBlob, Hash: h}}
+	if _, err := EncodeTree(in); err != nil {
+		t.Fatal(err)
+	}
+	if in[0].Name != "b" {
+		t.Fatal("EncodeTree must not mutate its input")
+	}
+}
+
+func TestDecodeTree_RoundTripAndRejects(t *testing.T) {
+	h, _ := HashBlob([]byte("x"))
+	in := []TreeEntry{{Name: "b:c\nd", Kind: KindExec, Hash: h}, {Name: "a", Kind: KindTree, Hash: h}}
+	enc, err := EncodeTree(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := DecodeTree(enc)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(out) != 2 || out[0].Name != "a" || out[1].Name != "b:c\nd" || out[1].Kind != KindExec {
+		t.Fatalf("unexpected round trip: %+v", out)
+	}
+
+	if _, err := DecodeTree(append(enc, 0)); err == nil {
+		t.Fatal("expected error for trailing bytes")
+	}
+	if _, err := DecodeTree(enc[:len(enc)-1]); err == nil {
+		t.Fatal("expected error for truncated input")
+	}
+	// Swap the two entries to produce unsorted input.
+	one, _ := EncodeTree(in[:1])
+	two, _ := EncodeTree(in[1:])
+	hdr := len(TreeMagic) + 4
+	unsorted := append(append(append([]byte{}, enc[:hdr]...), one[hdr:]...), two[hdr:]...)
+	if _, err := DecodeTree(unsorted); err == nil {
+		t.Fatal("expected error for unsorted entries")
+	}
+}
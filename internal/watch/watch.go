@@ -0,0 +1,29 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package watch reports changes below a directory tree as they happen.
+package watch
+
+import "errors"
+
+// Event reports a change at Path, slash-separated and relative to the
+// watched root. Overflow events mean the kernel dropped events; anything
+// may have changed and Path is empty.
+type Event struct {
+	Path     string
+	Overflow bool
+}
+
+// ErrUnsupported is returned by New on platforms without a watch backend.
+var ErrUnsupported = errors.New("watch: not supported on this platform")
@@ -0,0 +1,239 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+
+package watch
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+const watchMask = unix.IN_CREATE | unix.IN_DELETE | unix.IN_MODIFY | unix.IN_CLOSE_WRITE |
+	unix.IN_ATTRIB | unix.IN_MOVED_FROM | unix.IN_MOVED_TO |
+	unix.IN_ONLYDIR | unix.IN_DONT_FOLLOW | unix.IN_EXCL_UNLINK
+
+// Watcher follows a directory tree with inotify, adding watches for
+// directories as they appear. Events are delivered on Events and fatal read
+// errors on Errors; both are closed by Close.
+type Watcher struct {
+	Events chan Event
+	Errors chan error
+
+	root   string
+	ignore func(rel string, isDir bool) bool
+	fd     int // raw descriptor for add/remove; f.Fd() would make it blocking
+	f      *os.File
+
+	mu   sync.Mutex
+	dirs map[int]string // watch descriptor -> directory, "" for the root
+	wds  map[string]int
+
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// New watches root and every directory below it for which ignore (if not
+// nil) returns false. ignore is called with slash-separated paths relative
+// to root, from one goroutine at a time.
+func New(root string, ignore func(rel string, isDir bool) bool) (*Watcher, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("inotify: %w", err)
+	}
+	w := &Watcher{
+		Events: make(chan Event, 256),
+		Errors: make(chan error, 1),
+		root:   root,
+		ignore: ignore,
+		fd:     fd,
+		// A non-blocking descriptor lets Close interrupt a pending Read.
+		f:    os.NewFile(uintptr(fd), "inotify"),
+		dirs: make(map[int]string),
+		wds:  make(map[string]int),
+		done: make(chan struct{}),
+	}
+	if err := w.addTree(""); err != nil {
+		w.f.Close()
+		return nil, err
+	}
+	w.wg.Add(1)
+	go w.read()
+	return w, nil
+}
+
+// Close stops watching and closes Events and Errors.
+func (w *Watcher) Close() error {
+	var err error
+	w.closeOnce.Do(func() {
+		close(w.done)
+		err = w.f.Close()
+		w.wg.Wait()
+	})
+	return err
+}
+
+func (w *Watcher) ignored(rel string, isDir bool) bool {
+	return rel != "" && w.ignore != nil && w.ignore(rel, isDir)
+}
+
+// addTree watches dir and the directories below it. Directories that vanish
+// while being added are skipped.
+func (w *Watcher) addTree(dir string) error {
+	abs := filepath.Join(w.root, filepath.FromSlash(dir))
+	return filepath.WalkDir(abs, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && p != w.root {
+				return nil
+			}
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(w.root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == "." {
+			rel = ""
+		}
+		if w.ignored(rel, true) {
+			return fs.SkipDir
+		}
+		wd, err := unix.InotifyAddWatch(w.fd, p, watchMask)
+		if err != nil {
+			if errors.Is(err, unix.ENOENT) || errors.Is(err, unix.ENOTDIR) {
+				return fs.SkipDir
+			}
+			return fmt.Errorf("watch %s: %w", p, err)
+		}
+		w.mu.Lock()
+		w.dirs[wd] = rel
+		w.wds[rel] = wd
+		w.mu.Unlock()
+		return nil
+	})
+}
+
+// removeTree drops the watches of dir and the directories below it.
+func (w *Watcher) removeTree(dir string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for rel, wd := range w.wds {
+		if rel == dir || strings.HasPrefix(rel, dir+"/") {
+			// The kernel may already have dropped it; the error is moot.
+			_, _ = unix.InotifyRmWatch(w.fd, uint32(wd))
+			delete(w.wds, rel)
+			delete(w.dirs, wd)
+		}
+	}
+}
+
+func (w *Watcher) read() {
+	defer w.wg.Done()
+	defer close(w.Errors)
+	defer close(w.Events)
+	buf := make([]byte, 64<<10)
+	for {
+		n, err := w.f.Read(buf)
+		if err != nil {
+			select {
+			case <-w.done:
+			default:
+				w.Errors <- fmt.Errorf("inotify read: %w", err)
+			}
+			return
+		}
+		for off := 0; off+unix.SizeofInotifyEvent <= n; {
+			wd := int(int32(binary.NativeEndian.Uint32(buf[off:])))
+			mask := binary.NativeEndian.Uint32(buf[off+4:])
+			nameLen := int(binary.NativeEndian.Uint32(buf[off+12:]))
+			name := buf[off+unix.SizeofInotifyEvent : off+unix.SizeofInotifyEvent+nameLen]
+			if i := bytes.IndexByte(name, 0); i >= 0 {
+				name = name[:i]
+			}
+			off += unix.SizeofInotifyEvent + nameLen
+			if !w.handle(wd, mask, string(name)) {
+				return
+			}
+		}
+	}
+}
+
+// handle turns one inotify event into an Event. It returns false once the
+// watcher is closing.
+func (w *Watcher) handle(wd int, mask uint32, name string) bool {
+	if mask&unix.IN_Q_OVERFLOW != 0 {
+		return w.send(Event{Overflow: true})
+	}
+	w.mu.Lock()
+	dir, ok := w.dirs[wd]
+	if mask&unix.IN_IGNORED != 0 {
+		delete(w.dirs, wd)
+		if ok && w.wds[dir] == wd {
+			delete(w.wds, dir)
+		}
+		ok = false
+	}
+	w.mu.Unlock()
+	if !ok || name == "" {
+		// Changes to a directory itself are reported by its parent.
+		return true
+	}
+
+	rel := path.Join(dir, name)
+	isDir := mask&unix.IN_ISDIR != 0
+	if w.ignored(rel, isDir) {
+		return true
+	}
+	if isDir {
+		if mask&(unix.IN_MOVED_FROM|unix.IN_DELETE) != 0 {
+			w.removeTree(rel)
+		}
+		if mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0 {
+			// Files created before the watch was added are covered by this
+			// event: consumers rescan rather than replay.
+			if err := w.addTree(rel); err != nil {
+				select {
+				case w.Errors <- err:
+				default:
+				}
+			}
+		}
+	}
+	return w.send(Event{Path: rel})
+}
+
+func (w *Watcher) send(ev Event) bool {
+	select {
+	case w.Events <- ev:
+		return true
+	case <-w.done:
+		return false
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// await returns the first event for which match is true, failing after a
+// timeout.
+func await(t *testing.T, w *Watcher, match func(Event) bool) Event {
+	t.Helper()
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case ev := <-w.Events:
+			if match(ev) {
+				return ev
+			}
+		case err := <-w.Errors:
+			t.Fatalf("watch error: %v", err)
+		case <-deadline:
+			t.Fatal("timed out waiting for event")
+		}
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "skip", "deep"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	w, err := New(root, func(rel string, isDir bool) bool {
+		return rel == "skip" || strings.HasSuffix(rel, ".tmp")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	write := func(rel string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(root, filepath.FromSlash(rel)), []byte(rel), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	is := func(p string) func(Event) bool { return func(ev Event) bool { return ev.Path == p } }
+
+	write("skip/deep/x")
+	write("a.tmp")
+	write("a.txt")
+	// Ignored paths produce nothing, so the first event is a.txt.
+	if ev := await(t, w, func(Event) bool { return true }); ev.Path != "a.txt" {
+		t.Fatalf("first event %+v, want a.txt", ev)
+	}
+
+	// New directories are watched as they appear.
+	if err := os.MkdirAll(filepath.Join(root, "new", "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	await(t, w, is("new"))
+	// Give the watcher a moment to add new/sub if the mkdir raced it.
+	time.Sleep(50 * time.Millisecond)
+	write("new/sub/b.txt")
+	await(t, w, is("new/sub/b.txt"))
+
+	// A directory moved within the tree is watched under its new name.
+	if err := os.Rename(filepath.Join(root, "new"), filepath.Join(root, "moved")); err != nil {
+		t.Fatal(err)
+	}
+	await(t, w, is("moved"))
+	time.Sleep(50 * time.Millisecond)
+	write("moved/sub/c.txt")
+	await(t, w, is("moved/sub/c.txt"))
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for range w.Events {
+	}
+	if _, ok := <-w.Errors; ok {
+		t.Fatal("Errors not closed")
+	}
+}
@@ -0,0 +1,31 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux
+
+package watch
+
+// Watcher is unavailable on this platform.
+type Watcher struct {
+	Events chan Event
+	Errors chan error
+}
+
+// New returns ErrUnsupported.
+func New(root string, ignore func(rel string, isDir bool) bool) (*Watcher, error) {
+	return nil, ErrUnsupported
+}
+
+// Close does nothing.
+func (w *Watcher) Close() error { return nil }
@@ -19,6 +19,10 @@ import (
   "fmt"
   "os"
   "path/filepath"
+  "strings"
+
+  "github.com/good-night-oppie/helios/pkg/helios/objstore"
+  "github.com/good-night-oppie/helios/pkg/helios/repo"
 )
 
 func ResolveStore(cwd string) (string, error) {
@@ -33,4 +37,45 @@ func ResolveStore(cwd string) (string, error) {
     return "", fmt.Errorf("create default store: %w", err)
   }
   return p, nil
-}
\ No newline at end of file
+}
+
+// ResolveRepo returns the repository layout for cwd. By default metadata lives
+// in cwd/.helios with objects under .helios/objects; when HELIOS_STORE_DIR is
+// set that directory holds both.
+func ResolveRepo(cwd string) (repo.Repo, error) {
+  objDir, err := ResolveStore(cwd)
+  if err != nil {
+    return repo.Repo{}, err
+  }
+  if os.Getenv("HELIOS_STORE_DIR") != "" {
+    return repo.Repo{Dir: objDir, ObjectsDir: objDir}, nil
+  }
+  return repo.Repo{Dir: filepath.Dir(objDir), ObjectsDir: objDir}, nil
+}
+
+// StoreLocation names the object store OpenStore would open for r: the
+// HELIOS_STORE_URL value when set, else the absolute objects directory.
+// Caches of what a store holds are keyed by it.
+func StoreLocation(r repo.Repo) (string, error) {
+  if u := os.Getenv("HELIOS_STORE_URL"); u != "" {
+    return u, nil
+  }
+  return filepath.Abs(r.ObjectsDir)
+}
+
+// OpenStore opens the L2 object store for r. When HELIOS_STORE_URL names an
+// s3:// location or a file:// directory of loose objects, objects live there
+// and only metadata stays in r.Dir.
+func OpenStore(r repo.Repo) (objstore.Store, error) {
+  if u := os.Getenv("HELIOS_STORE_URL"); u != "" {
+    if dir, ok := strings.CutPrefix(u, "file://"); ok {
+      return objstore.OpenLoose(dir, nil)
+    }
+    opts, err := objstore.ParseS3URL(u)
+    if err != nil {
+      return nil, fmt.Errorf("HELIOS_STORE_URL: %w", err)
+    }
+    return objstore.OpenS3(opts)
+  }
+  return objstore.Open(r.ObjectsDir, nil)
+}
@@ -0,0 +1,359 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package archive streams file trees to and from tar, zstd-compressed tar
+// and zip archives, keeping executable bits and symlinks.
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Format names an archive format.
+type Format string
+
+const (
+	Tar    Format = "tar"
+	TarZst Format = "tar.zst"
+	Zip    Format = "zip"
+)
+
+// ParseFormat validates a format name as given on the command line.
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(s)); f {
+	case Tar, TarZst, Zip:
+		return f, nil
+	case "tzst":
+		return TarZst, nil
+	}
+	return "", fmt.Errorf("unknown archive format %q (want tar, tar.zst or zip)", s)
+}
+
+// FormatFromPath guesses the format from a file name's extension.
+func FormatFromPath(name string) (Format, bool) {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".tar.zst"), strings.HasSuffix(lower, ".tzst"):
+		return TarZst, true
+	case strings.HasSuffix(lower, ".tar"):
+		return Tar, true
+	case strings.HasSuffix(lower, ".zip"):
+		return Zip, true
+	}
+	return "", false
+}
+
+// linkFS is implemented by file systems that expose symlinks, such as
+// vst.TreeFS. Without it, symlinks are archived as the files they point to.
+type linkFS interface {
+	ReadLink(name string) (string, error)
+	Lstat(name string) (fs.FileInfo, error)
+}
+
+// epoch is the modification time recorded for every entry, so archives of
+// the same tree are byte-for-byte identical.
+var epoch = time.Unix(0, 0).UTC()
+
+// Write streams every file under fsys's root to w in the given format.
+// Entries are written in lexical order. Regular files are recorded as 0644
+// or, if executable, 0755.
+func Write(w io.Writer, fsys fs.FS, format Format) error {
+	switch format {
+	case Tar:
+		return writeTar(w, fsys)
+	case TarZst:
+		zw, err := zstd.NewWriter(w)
+		if err != nil {
+			return err
+		}
+		if err := writeTar(zw, fsys); err != nil {
+			zw.Close()
+			return err
+		}
+		return zw.Close()
+	case Zip:
+		return writeZip(w, fsys)
+	}
+	return fmt.Errorf("unknown archive format %q", format)
+}
+
+// entry is one file found while walking a tree for writing.
+type entry struct {
+	name   string
+	mode   fs.FileMode // fs.ModeDir, fs.ModeSymlink or a regular permission
+	target string      // symlink target
+}
+
+// walk calls fn for each directory, file and symlink under fsys in lexical order.
+func walk(fsys fs.FS, fn func(e entry) error) error {
+	links, _ := fsys.(linkFS)
+	return fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if name == "." {
+			return nil
+		}
+		switch {
+		case d.IsDir():
+			return fn(entry{name: name, mode: fs.ModeDir | 0o755})
+		case d.Type() == fs.ModeSymlink && links != nil:
+			target, err := links.ReadLink(name)
+			if err != nil {
+				return err
+			}
+			return fn(entry{name: name, mode: fs.ModeSymlink | 0o777, target: target})
+		}
+		info, err := fs.Stat(fsys, name)
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return fmt.Errorf("%s: unsupported file type %v", name, info.Mode().Type())
+		}
+		mode := fs.FileMode(0o644)
+		if info.Mode().Perm()&0o111 != 0 {
+			mode = 0o755
+		}
+		return fn(entry{name: name, mode: mode})
+	})
+}
+
+func writeTar(w io.Writer, fsys fs.FS) error {
+	tw := tar.NewWriter(w)
+	err := walk(fsys, func(e entry) error {
+		hdr := &tar.Header{
+			Name:    e.name,
+			Mode:    int64(e.mode.Perm()),
+			ModTime: epoch,
+			Format:  tar.FormatPAX,
+		}
+		switch {
+		case e.mode.IsDir():
+			hdr.Typeflag = tar.TypeDir
+			hdr.Name += "/"
+			return tw.WriteHeader(hdr)
+		case e.mode.Type() == fs.ModeSymlink:
+			hdr.Typeflag = tar.TypeSymlink
+			hdr.Linkname = e.target
+			return tw.WriteHeader(hdr)
+		}
+		data, err := fs.ReadFile(fsys, e.name)
+		if err != nil {
+			return err
+		}
+		hdr.Typeflag = tar.TypeReg
+		hdr.Size = int64(len(data))
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err = tw.Write(data)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+func writeZip(w io.Writer, fsys fs.FS) error {
+	zw := zip.NewWriter(w)
+	err := walk(fsys, func(e entry) error {
+		hdr := &zip.FileHeader{Name: e.name, Method: zip.Deflate, Modified: epoch}
+		hdr.SetMode(e.mode)
+		switch {
+		case e.mode.IsDir():
+			hdr.Name += "/"
+			hdr.Method = zip.Store
+			_, err := zw.CreateHeader(hdr)
+			return err
+		case e.mode.Type() == fs.ModeSymlink:
+			// Info-ZIP convention: the entry's content is the link target.
+			hdr.Method = zip.Store
+			fw, err := zw.CreateHeader(hdr)
+			if err != nil {
+				return err
+			}
+			_, err = io.WriteString(fw, e.target)
+			return err
+		}
+		data, err := fs.ReadFile(fsys, e.name)
+		if err != nil {
+			return err
+		}
+		fw, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+		_, err = fw.Write(data)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// ErrUnsafePath is returned by Read for entries that would land outside the tree.
+var ErrUnsafePath = errors.New("archive entry escapes the tree")
+
+// Read extracts the archive in r, calling fn for every file and symlink in
+// archive order. The format is detected from the content. Names are
+// slash-separated and relative; mode is the entry's permission bits, or
+// fs.ModeSymlink with data holding the link target. Directory entries are
+// skipped, and hard links in tar archives are delivered as copies of the
+// file they link to. Zip archives are buffered in memory, since the zip
+// directory sits at the end of the stream.
+func Read(r io.Reader, fn func(name string, data []byte, mode fs.FileMode) error) error {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(4)
+	switch {
+	case bytes.Equal(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		return readTar(zr, fn)
+	case bytes.Equal(magic, []byte("PK\x03\x04")), bytes.Equal(magic, []byte("PK\x05\x06")):
+		b, err := io.ReadAll(br)
+		if err != nil {
+			return err
+		}
+		return readZip(bytes.NewReader(b), int64(len(b)), fn)
+	}
+	return readTar(br, fn)
+}
+
+// cleanName turns an archive entry name into a tree path. It returns "" for
+// the root directory.
+func cleanName(name string) (string, error) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if path.IsAbs(name) {
+		return "", fmt.Errorf("%w: %s", ErrUnsafePath, name)
+	}
+	clean := path.Clean(name)
+	if clean == "." {
+		return "", nil
+	}
+	if clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("%w: %s", ErrUnsafePath, name)
+	}
+	return clean, nil
+}
+
+func readTar(r io.Reader, fn func(string, []byte, fs.FileMode) error) error {
+	type file struct {
+		data []byte
+		mode fs.FileMode
+	}
+	seen := make(map[string]file)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag == tar.TypeXGlobalHeader {
+			continue // pax metadata, e.g. the commit id git archive records
+		}
+		name, err := cleanName(hdr.Name)
+		if err != nil {
+			return err
+		}
+		var f file
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			continue
+		case tar.TypeReg:
+			if f.data, err = io.ReadAll(tr); err != nil {
+				return err
+			}
+			f.mode = fs.FileMode(hdr.Mode).Perm()
+		case tar.TypeSymlink:
+			f = file{data: []byte(hdr.Linkname), mode: fs.ModeSymlink | 0o777}
+		case tar.TypeLink:
+			target, err := cleanName(hdr.Linkname)
+			if err != nil {
+				return err
+			}
+			var ok bool
+			if f, ok = seen[target]; !ok {
+				return fmt.Errorf("%s: hard link to unknown file %s", hdr.Name, hdr.Linkname)
+			}
+		default:
+			return fmt.Errorf("%s: unsupported tar entry type %q", hdr.Name, hdr.Typeflag)
+		}
+		if name == "" {
+			return fmt.Errorf("%w: %s", ErrUnsafePath, hdr.Name)
+		}
+		seen[name] = f
+		if err := fn(name, f.data, f.mode); err != nil {
+			return err
+		}
+	}
+}
+
+func readZip(r io.ReaderAt, size int64, fn func(string, []byte, fs.FileMode) error) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+	for _, zf := range zr.File {
+		name, err := cleanName(zf.Name)
+		if err != nil {
+			return err
+		}
+		mode := zf.Mode()
+		if mode.IsDir() || name == "" {
+			continue
+		}
+		switch {
+		case mode.Type() == fs.ModeSymlink:
+			mode = fs.ModeSymlink | 0o777
+		case mode.IsRegular():
+			mode = mode.Perm()
+		default:
+			return fmt.Errorf("%s: unsupported zip entry type %v", zf.Name, mode.Type())
+		}
+		rc, err := zf.Open()
+		if err != nil {
+			return err
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+		if err := fn(name, data, mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/good-night-oppie/helios/pkg/helios/types"
+	"github.com/good-night-oppie/helios/pkg/helios/vst"
+)
+
+func sampleTree(t *testing.T) (*vst.VST, types.SnapshotID) {
+	t.Helper()
+	v := vst.New()
+	_ = v.WriteFile("README.md", []byte("# data drop\n"))
+	_ = v.WriteFile("data/rows.csv", []byte("a,b\n1,2\n"))
+	_ = v.WriteFile("data/empty", nil)
+	if err := v.WriteFileMode("bin/run", []byte("#!/bin/sh\necho hi\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.WriteFileMode("latest", []byte("data/rows.csv"), fs.ModeSymlink|0o777); err != nil {
+		t.Fatal(err)
+	}
+	id, _, err := v.Commit("sample")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v, id
+}
+
+func TestRoundTrip(t *testing.T) {
+	v, id := sampleTree(t)
+	fsys, err := v.FS(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []Format{Tar, TarZst, Zip} {
+		t.Run(string(format), func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Write(&buf, fsys, format); err != nil {
+				t.Fatalf("write: %v", err)
+			}
+			var again bytes.Buffer
+			if err := Write(&again, fsys, format); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf.Bytes(), again.Bytes()) {
+				t.Fatal("archives of the same snapshot should be identical")
+			}
+
+			imported := vst.New()
+			err := Read(&buf, func(name string, data []byte, mode fs.FileMode) error {
+				return imported.WriteFileMode(name, data, mode)
+			})
+			if err != nil {
+				t.Fatalf("read: %v", err)
+			}
+			got, _, err := imported.Commit("import")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != id {
+				t.Fatalf("import changed the tree: %s != %s", got, id)
+			}
+		})
+	}
+}
+
+func TestRead_TarHardLinkAndUnsafePaths(t *testing.T) {
+	build := func(hdrs ...*tar.Header) *bytes.Buffer {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		for _, h := range hdrs {
+			if err := tw.WriteHeader(h); err != nil {
+				t.Fatal(err)
+			}
+			if h.Size > 0 {
+				_, _ = tw.Write(bytes.Repeat([]byte("x"), int(h.Size)))
+			}
+		}
+		_ = tw.Close()
+		return &buf
+	}
+
+	got := map[string]string{}
+	collect := func(name string, data []byte, mode fs.FileMode) error {
+		got[name] = string(data)
+		return nil
+	}
+	ok := build(
+		&tar.Header{Name: "./", Typeflag: tar.TypeDir, Mode: 0o755},
+		&tar.Header{Name: "./a", Typeflag: tar.TypeReg, Mode: 0o644, Size: 3},
+		&tar.Header{Name: "b", Typeflag: tar.TypeLink, Linkname: "a"},
+	)
+	if err := Read(ok, collect); err != nil {
+		t.Fatal(err)
+	}
+	if got["a"] != "xxx" || got["b"] != "xxx" {
+		t.Fatalf("hard link not resolved: %v", got)
+	}
+
+	for _, name := range []string{"../evil", "/etc/passwd", "a/../../evil"} {
+		bad := build(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0o644, Size: 1})
+		if err := Read(bad, collect); !errors.Is(err, ErrUnsafePath) {
+			t.Fatalf("%s: want ErrUnsafePath, got %v", name, err)
+		}
+	}
+}
+
+func TestRead_GitArchive(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	git := func(args ...string) []byte {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=t", "GIT_AUTHOR_EMAIL=t@example.com",
+			"GIT_COMMITTER_NAME=t", "GIT_COMMITTER_EMAIL=t@example.com",
+			"GIT_CONFIG_GLOBAL=/dev/null", "GIT_CONFIG_NOSYSTEM=1")
+		out, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("git %v: %v", args, err)
+		}
+		return out
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "src"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "src", "main.go"), []byte("package main\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	git("init", "-q")
+	git("add", ".")
+	git("commit", "-q", "-m", "init")
+	// git archive starts with a pax global header recording the commit.
+	tarball := git("archive", "--format=tar", "HEAD")
+
+	got := map[string]string{}
+	err := Read(bytes.NewReader(tarball), func(name string, data []byte, mode fs.FileMode) error {
+		got[name] = string(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got["src/main.go"] != "package main\n" {
+		t.Fatalf("read %v", got)
+	}
+}
+
+func TestFormats(t *testing.T) {
+	for name, want := range map[string]Format{"out.tar": Tar, "OUT.TAR.ZST": TarZst, "x.tzst": TarZst, "a.zip": Zip} {
+		if got, ok := FormatFromPath(name); !ok || got != want {
+			t.Errorf("FormatFromPath(%q) = %q, %v", name, got, ok)
+		}
+	}
+	if _, ok := FormatFromPath("out.tgz"); ok {
+		t.Error("tgz is not supported")
+	}
+	if _, err := ParseFormat("rar"); err == nil {
+		t.Error("ParseFormat should reject unknown formats")
+	}
+}
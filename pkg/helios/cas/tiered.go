@@ -0,0 +1,378 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// SPDX-License-Identifier: Apache-2.0
+
+package cas
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/good-night-oppie/helios/internal/util"
+	"github.com/good-night-oppie/helios/pkg/helios/l1cache"
+	"github.com/good-night-oppie/helios/pkg/helios/objstore"
+	"github.com/good-night-oppie/helios/pkg/helios/types"
+)
+
+// Policy selects when writes reach L2.
+type Policy int
+
+const (
+	// WriteThrough returns from a write once L2 has stored it.
+	WriteThrough Policy = iota
+	// WriteBack holds writes in memory and persists them in the background,
+	// on Flush and on Close. Reads see writes that are not yet flushed.
+	WriteBack
+)
+
+func (p Policy) String() string {
+	switch p {
+	case WriteThrough:
+		return "write-through"
+	case WriteBack:
+		return "write-back"
+	default:
+		return fmt.Sprintf("Policy(%d)", int(p))
+	}
+}
+
+// DefaultMaxDirtyBytes is the write-back backlog that starts a flush
+const DefaultMaxDirtyBytes = 64 << 20
+
+// Config describes the tiers of a Tiered store. Both tiers are optional:
+// without L1 nothing is cached, and without L2 all data stays in memory.
+type Config struct {
+	L1     l1cache.Cache
+	L2     objstore.Store
+	Policy Policy
+	// MaxDirtyBytes starts a background flush once this much unflushed data
+	// is held; writers flush synchronously beyond twice this. Write-back only.
+	MaxDirtyBytes int64
+	// FlushInterval also flushes on a timer; 0 disables. Write-back only.
+	FlushInterval time.Duration
+}
+
+// TierStats reports the state of a Tiered store
+type TierStats struct {
+	Policy       Policy
+	DirtyEntries int
+	DirtyBytes   int64
+	Flushes      uint64
+	FlushErrors  uint64
+	L1           l1cache.CacheStats
+}
+
+type dirtyEntry struct {
+	hash  types.Hash
+	value []byte
+	seq   uint64
+}
+
+// Tiered is the storage path shared by the engine and BLAKE3Store: BLAKE3
+// hashing, an L1 cache of decoded blobs in front of an L2 object store, and
+// a write policy deciding when L2 sees new data.
+//
+// Content-addressed blobs are read with GetBlob, which fills L1. Get reads
+// any key, mutable records included, and never consults L1.
+type Tiered struct {
+	l1            l1cache.Cache
+	policy        Policy
+	maxDirtyBytes int64
+
+	life   sync.RWMutex // held shared by operations, exclusively by Close
+	closed bool
+
+	mu         sync.RWMutex
+	l2         objstore.Store
+	dirty      map[string]dirtyEntry // digest -> write not yet in L2
+	dirtyBytes int64
+	seq        uint64
+
+	flushMu     sync.Mutex // serializes flushes
+	flushes     atomic.Uint64
+	flushErrors atomic.Uint64
+
+	kick chan struct{}
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+var _ objstore.Store = (*Tiered)(nil)
+
+// NewTiered returns a store over cfg's tiers. Close flushes pending writes
+// and closes L2.
+func NewTiered(cfg Config) (*Tiered, error) {
+	if cfg.Policy != WriteThrough && cfg.Policy != WriteBack {
+		return nil, fmt.Errorf("unknown write policy %d", int(cfg.Policy))
+	}
+	if cfg.MaxDirtyBytes <= 0 {
+		cfg.MaxDirtyBytes = DefaultMaxDirtyBytes
+	}
+	t := &Tiered{
+		l1:            cfg.L1,
+		l2:            cfg.L2,
+		policy:        cfg.Policy,
+		maxDirtyBytes: cfg.MaxDirtyBytes,
+		dirty:         make(map[string]dirtyEntry),
+	}
+	if cfg.Policy == WriteBack && cfg.L2 != nil {
+		t.kick = make(chan struct{}, 1)
+		t.done = make(chan struct{})
+		t.wg.Add(1)
+		go t.flusher(cfg.FlushInterval)
+	}
+	return t, nil
+}
+
+// L1 returns the cache tier, or nil
+func (t *Tiered) L1() l1cache.Cache { return t.l1 }
+
+// L2 returns the persistent tier, or nil
+func (t *Tiered) L2() objstore.Store {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.l2
+}
+
+// Policy returns the write policy
+func (t *Tiered) Policy() Policy { return t.policy }
+
+// Put hashes content, stores it and returns its hash
+func (t *Tiered) Put(content []byte) (types.Hash, error) {
+	h, err := util.HashBlob(content)
+	if err != nil {
+		return types.Hash{}, err
+	}
+	t.mu.RLock()
+	_, pending := t.dirty[string(h.Digest)]
+	t.mu.RUnlock()
+	if pending {
+		return h, nil
+	}
+	return h, t.PutBatch([]objstore.BatchEntry{{Hash: h, Value: content}})
+}
+
+// PutBatch stores entries according to the write policy. Preflight rejects
+// any nil value.
+func (t *Tiered) PutBatch(batch []objstore.BatchEntry) error {
+	for _, entry := range batch {
+		if entry.Value == nil {
+			return errors.New("nil value in batch")
+		}
+	}
+	t.life.RLock()
+	defer t.life.RUnlock()
+	if t.closed {
+		return objstore.ErrClosed
+	}
+	l2 := t.L2()
+	if t.policy == WriteThrough && l2 != nil {
+		return l2.PutBatch(batch)
+	}
+
+	t.mu.Lock()
+	for _, entry := range batch {
+		k := string(entry.Hash.Digest)
+		if old, ok := t.dirty[k]; ok {
+			t.dirtyBytes -= int64(len(old.value))
+		}
+		t.seq++
+		t.dirty[k] = dirtyEntry{hash: entry.Hash, value: append([]byte{}, entry.Value...), seq: t.seq}
+		t.dirtyBytes += int64(len(entry.Value))
+	}
+	backlog := t.dirtyBytes
+	t.mu.Unlock()
+
+	if l2 == nil || backlog < t.maxDirtyBytes {
+		return nil
+	}
+	if backlog >= 2*t.maxDirtyBytes {
+		return t.Flush()
+	}
+	select {
+	case t.kick <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Get returns (value, ok, err) from unflushed writes or L2, bypassing L1
+func (t *Tiered) Get(h types.Hash) ([]byte, bool, error) {
+	t.life.RLock()
+	defer t.life.RUnlock()
+	if t.closed {
+		return nil, false, objstore.ErrClosed
+	}
+	b, pending, l2 := t.pending(h)
+	if pending || l2 == nil {
+		return b, pending, nil
+	}
+	return l2.Get(h)
+}
+
+// GetBlob returns content-addressed data, trying L1 first and promoting L2
+// hits into it. Keys whose value can change must be read with Get.
+func (t *Tiered) GetBlob(h types.Hash) ([]byte, bool, error) {
+	t.life.RLock()
+	defer t.life.RUnlock()
+	if t.closed {
+		return nil, false, objstore.ErrClosed
+	}
+	if t.l1 != nil {
+		if b, ok := t.l1.Get(h); ok {
+			return b, true, nil
+		}
+	}
+	b, pending, l2 := t.pending(h)
+	if pending || l2 == nil {
+		return b, pending, nil
+	}
+	b, ok, err := l2.Get(h)
+	if err != nil || !ok {
+		return nil, ok, err
+	}
+	if t.l1 != nil {
+		t.l1.Put(h, b)
+	}
+	return b, true, nil
+}
+
+// Has reports whether h is stored, without touching L1
+func (t *Tiered) Has(h types.Hash) (bool, error) {
+	_, ok, err := t.Get(h)
+	return ok, err
+}
+
+// pending returns a copy of h's unflushed write, if any, and the current L2
+func (t *Tiered) pending(h types.Hash) ([]byte, bool, objstore.Store) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	e, ok := t.dirty[string(h.Digest)]
+	if !ok {
+		return nil, false, t.l2
+	}
+	return append([]byte{}, e.value...), true, t.l2
+}
+
+// Flush writes all pending write-back data to L2 in one batch. Entries
+// rewritten while the flush runs stay pending.
+func (t *Tiered) Flush() error {
+	t.flushMu.Lock()
+	defer t.flushMu.Unlock()
+
+	t.mu.RLock()
+	l2 := t.l2
+	if l2 == nil || len(t.dirty) == 0 {
+		t.mu.RUnlock()
+		return nil
+	}
+	pending := make([]dirtyEntry, 0, len(t.dirty))
+	batch := make([]objstore.BatchEntry, 0, len(t.dirty))
+	for _, e := range t.dirty {
+		pending = append(pending, e)
+		batch = append(batch, objstore.BatchEntry{Hash: e.hash, Value: e.value})
+	}
+	t.mu.RUnlock()
+
+	if err := l2.PutBatch(batch); err != nil {
+		t.flushErrors.Add(1)
+		return fmt.Errorf("flush %d entries to L2: %w", len(batch), err)
+	}
+	t.mu.Lock()
+	for _, e := range pending {
+		k := string(e.hash.Digest)
+		if cur, ok := t.dirty[k]; ok && cur.seq == e.seq {
+			delete(t.dirty, k)
+			t.dirtyBytes -= int64(len(e.value))
+		}
+	}
+	t.mu.Unlock()
+	t.flushes.Add(1)
+	return nil
+}
+
+// flusher runs write-back flushes when kicked and on the optional interval.
+// A failed flush leaves its entries pending for the next attempt.
+func (t *Tiered) flusher(interval time.Duration) {
+	defer t.wg.Done()
+	var tick <-chan time.Time
+	if interval > 0 {
+		tk := time.NewTicker(interval)
+		defer tk.Stop()
+		tick = tk.C
+	}
+	for {
+		select {
+		case <-t.done:
+			return
+		case <-t.kick:
+		case <-tick:
+		}
+		t.Flush()
+	}
+}
+
+// Stats reports pending write-back data, flush counts and L1 statistics
+func (t *Tiered) Stats() TierStats {
+	t.mu.RLock()
+	st := TierStats{
+		Policy:       t.policy,
+		DirtyEntries: len(t.dirty),
+		DirtyBytes:   t.dirtyBytes,
+	}
+	t.mu.RUnlock()
+	st.Flushes = t.flushes.Load()
+	st.FlushErrors = t.flushErrors.Load()
+	if t.l1 != nil {
+		st.L1 = t.l1.Stats()
+	}
+	return st
+}
+
+// Close waits for in-flight operations, flushes pending writes and closes
+// L2. Later calls are no-ops.
+func (t *Tiered) Close() error {
+	t.life.Lock()
+	if t.closed {
+		t.life.Unlock()
+		return nil
+	}
+	t.closed = true
+	t.life.Unlock()
+
+	if t.done != nil {
+		close(t.done)
+		t.wg.Wait()
+	}
+	err := t.Flush()
+	if l2 := t.L2(); l2 != nil {
+		if cerr := l2.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// detachL2 drops the persistent tier, keeping every later write in memory
+func (t *Tiered) detachL2() objstore.Store {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	l2 := t.l2
+	t.l2 = nil
+	return l2
+}
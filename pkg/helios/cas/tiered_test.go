@@ -0,0 +1,191 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// SPDX-License-Identifier: Apache-2.0
+
+package cas
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/good-night-oppie/helios/internal/util"
+	"github.com/good-night-oppie/helios/pkg/helios/l1cache"
+	"github.com/good-night-oppie/helios/pkg/helios/objstore"
+	"github.com/good-night-oppie/helios/pkg/helios/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingStore counts PutBatch calls and can be made to fail
+type countingStore struct {
+	objstore.Store
+	puts int
+	fail error
+}
+
+func (c *countingStore) PutBatch(b []objstore.BatchEntry) error {
+	if c.fail != nil {
+		return c.fail
+	}
+	c.puts++
+	return c.Store.PutBatch(b)
+}
+
+func newTiered(t *testing.T, policy Policy, maxDirty int64) (*Tiered, *countingStore) {
+	t.Helper()
+	l1, err := l1cache.New(l1cache.Config{CapacityBytes: 1 << 20})
+	require.NoError(t, err)
+	l2 := &countingStore{Store: objstore.NewMemory()}
+	tt, err := NewTiered(Config{L1: l1, L2: l2, Policy: policy, MaxDirtyBytes: maxDirty})
+	require.NoError(t, err)
+	t.Cleanup(func() { tt.Close() })
+	return tt, l2
+}
+
+func TestTiered_WriteThrough(t *testing.T) {
+	tt, l2 := newTiered(t, WriteThrough, 0)
+
+	h, err := tt.Put([]byte("hello"))
+	require.NoError(t, err)
+	want, _ := util.HashBlob([]byte("hello"))
+	assert.Equal(t, want, h, "Put must hash exactly like the engine")
+
+	// Stored in L2 before Put returns; L1 fills on the first read.
+	v, ok, err := l2.Get(h)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "hello", string(v))
+	assert.Zero(t, tt.Stats().L1.Items)
+
+	v, ok, err = tt.GetBlob(h)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "hello", string(v))
+	_, _, _ = tt.GetBlob(h)
+	st := tt.Stats()
+	assert.Equal(t, uint64(1), st.L1.Misses)
+	assert.Equal(t, uint64(1), st.L1.Hits)
+	assert.Zero(t, st.DirtyEntries)
+}
+
+func TestTiered_WriteBack(t *testing.T) {
+	tt, l2 := newTiered(t, WriteBack, 1<<20)
+
+	h, err := tt.Put([]byte("pending"))
+	require.NoError(t, err)
+	_, ok, _ := l2.Get(h)
+	assert.False(t, ok, "write-back reached L2 before a flush")
+
+	v, ok, err := tt.Get(h)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "pending", string(v))
+	assert.Equal(t, 1, tt.Stats().DirtyEntries)
+
+	require.NoError(t, tt.Flush())
+	_, ok, _ = l2.Get(h)
+	assert.True(t, ok)
+	st := tt.Stats()
+	assert.Zero(t, st.DirtyEntries)
+	assert.Zero(t, st.DirtyBytes)
+	assert.Equal(t, uint64(1), st.Flushes)
+
+	// A failed flush keeps the data pending and readable.
+	h2, _ := tt.Put([]byte("retry me"))
+	l2.fail = errors.New("disk full")
+	assert.Error(t, tt.Flush())
+	v, ok, _ = tt.Get(h2)
+	assert.True(t, ok)
+	assert.Equal(t, "retry me", string(v))
+	assert.Equal(t, uint64(1), tt.Stats().FlushErrors)
+	l2.fail = nil
+	require.NoError(t, tt.Flush())
+	_, ok, _ = l2.Get(h2)
+	assert.True(t, ok)
+}
+
+func TestTiered_WriteBackBacklog(t *testing.T) {
+	tt, l2 := newTiered(t, WriteBack, 64)
+
+	// Past the threshold a background flush starts.
+	_, err := tt.Put(bytes.Repeat([]byte("a"), 80))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return tt.Stats().DirtyEntries == 0 }, time.Second, time.Millisecond)
+
+	// Past twice the threshold the writer flushes itself.
+	before := l2.puts
+	_, err = tt.Put(bytes.Repeat([]byte("b"), 200))
+	require.NoError(t, err)
+	assert.Greater(t, l2.puts, before)
+}
+
+func TestTiered_RecordsBypassL1(t *testing.T) {
+	tt, _ := newTiered(t, WriteThrough, 0)
+	key := types.Hash{Algorithm: types.BLAKE3, Digest: []byte("parents:x")}
+
+	require.NoError(t, tt.PutBatch([]objstore.BatchEntry{{Hash: key, Value: []byte(`["a"]`)}}))
+	v, _, _ := tt.Get(key)
+	assert.Equal(t, `["a"]`, string(v))
+	require.NoError(t, tt.PutBatch([]objstore.BatchEntry{{Hash: key, Value: []byte(`["a","b"]`)}}))
+	v, _, _ = tt.Get(key)
+	assert.Equal(t, `["a","b"]`, string(v))
+	assert.Zero(t, tt.Stats().L1.Items)
+}
+
+func TestTiered_CloseFlushes(t *testing.T) {
+	dir := t.TempDir()
+	l2, err := objstore.OpenLoose(dir, nil)
+	require.NoError(t, err)
+	tt, err := NewTiered(Config{L2: l2, Policy: WriteBack})
+	require.NoError(t, err)
+	h, err := tt.Put([]byte("durable"))
+	require.NoError(t, err)
+	require.NoError(t, tt.Close())
+	require.NoError(t, tt.Close())
+
+	_, err = tt.Put([]byte("late"))
+	assert.ErrorIs(t, err, objstore.ErrClosed)
+
+	reopened, err := objstore.OpenLoose(dir, nil)
+	require.NoError(t, err)
+	v, ok, err := reopened.Get(h)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "durable", string(v))
+}
+
+func BenchmarkTiered_Put(b *testing.B) {
+	for _, policy := range []Policy{WriteThrough, WriteBack} {
+		b.Run(policy.String(), func(b *testing.B) {
+			l2, err := objstore.OpenLoose(b.TempDir(), nil)
+			require.NoError(b, err)
+			tt, err := NewTiered(Config{L2: l2, Policy: policy})
+			require.NoError(b, err)
+			buf := make([]byte, 4096)
+			b.SetBytes(int64(len(buf)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				buf[0], buf[1], buf[2] = byte(i), byte(i>>8), byte(i>>16)
+				if _, err := tt.Put(buf); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.StopTimer()
+			require.NoError(b, tt.Close())
+		})
+	}
+}
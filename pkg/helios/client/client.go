@@ -0,0 +1,503 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package client talks to a `helios serve` engine. A *Client offers the
+// operations of an embedded *vst.VST, so code written against the engine
+// interfaces can switch between a local and a shared remote engine by
+// swapping the constructor:
+//
+//	eng, err := client.New("unix:///run/helios.sock", nil)
+//
+// Each operation also has a ...Context variant. Connections are pooled, and
+// idempotent calls are retried on transport errors and on 502/503/504
+// responses with exponential backoff.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/good-night-oppie/helios/internal/metrics"
+	"github.com/good-night-oppie/helios/pkg/helios/archive"
+	"github.com/good-night-oppie/helios/pkg/helios/l1cache"
+	"github.com/good-night-oppie/helios/pkg/helios/objstore"
+	"github.com/good-night-oppie/helios/pkg/helios/server"
+	"github.com/good-night-oppie/helios/pkg/helios/types"
+	"github.com/good-night-oppie/helios/pkg/helios/vst"
+)
+
+// Ensure Client implements the StateManager interface at compile time.
+var _ types.StateManager = (*Client)(nil)
+
+// Options tunes a Client. The zero value is usable.
+type Options struct {
+	// MaxConns bounds the pooled connections to the server; <= 0 means 16.
+	MaxConns int
+	// Timeout bounds each call made without an explicit context; 0 means none.
+	Timeout time.Duration
+	// Retries is how many times an idempotent call is retried; < 0 disables
+	// retries and 0 means 3.
+	Retries int
+	// Backoff is the delay before the first retry, doubling each time;
+	// <= 0 means 50ms.
+	Backoff time.Duration
+	// Token is sent as a bearer token, which TCP servers require; empty
+	// means $HELIOS_TOKEN.
+	Token string
+}
+
+// Error is an error response from the server.
+type Error struct {
+	Status  int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("helios server: %s (HTTP %d)", e.Message, e.Status)
+}
+
+// Client is a remote engine. It is safe for concurrent use; the server
+// applies calls one at a time.
+type Client struct {
+	base string
+	http *http.Client
+	opts Options
+
+	mu      sync.Mutex
+	pending error // failure of a call that cannot return one, see Commit
+}
+
+// New returns a client for the server at addr: "unix:///path/to/socket",
+// "http://host:port" or a bare "host:port".
+func New(addr string, opts *Options) (*Client, error) {
+	var o Options
+	if opts != nil {
+		o = *opts
+	}
+	if o.MaxConns <= 0 {
+		o.MaxConns = 16
+	}
+	if o.Retries == 0 {
+		o.Retries = 3
+	}
+	if o.Token == "" {
+		o.Token = os.Getenv("HELIOS_TOKEN")
+	}
+	if o.Backoff <= 0 {
+		o.Backoff = 50 * time.Millisecond
+	}
+
+	tr := &http.Transport{
+		MaxIdleConns:        o.MaxConns,
+		MaxIdleConnsPerHost: o.MaxConns,
+		MaxConnsPerHost:     o.MaxConns,
+		IdleConnTimeout:     90 * time.Second,
+	}
+	base := addr
+	switch {
+	case strings.HasPrefix(addr, "unix://"):
+		sock := strings.TrimPrefix(addr, "unix://")
+		if sock == "" {
+			return nil, fmt.Errorf("client: empty socket path in %q", addr)
+		}
+		var d net.Dialer
+		tr.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return d.DialContext(ctx, "unix", sock)
+		}
+		base = "http://helios"
+	case strings.HasPrefix(addr, "http://"), strings.HasPrefix(addr, "https://"):
+	case addr == "":
+		return nil, errors.New("client: empty address")
+	default:
+		base = "http://" + addr
+	}
+	return &Client{base: strings.TrimRight(base, "/"), http: &http.Client{Transport: tr}, opts: o}, nil
+}
+
+// Close releases pooled connections.
+func (c *Client) Close() error {
+	c.http.CloseIdleConnections()
+	return nil
+}
+
+// ctx returns the context for a call made without one.
+func (c *Client) ctx() (context.Context, context.CancelFunc) {
+	if c.opts.Timeout > 0 {
+		return context.WithTimeout(context.Background(), c.opts.Timeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// Do sends a JSON request to path and decodes the JSON response into out
+// (if not nil), retrying idempotent requests. It reaches endpoints without
+// a dedicated method, such as the sync API used by package remote.
+func (c *Client) Do(ctx context.Context, method, path string, in, out any, idempotent bool) error {
+	return c.do(ctx, method, path, in, out, idempotent)
+}
+
+// do sends a request and decodes a JSON response into out (if not nil).
+// Idempotent requests are retried.
+func (c *Client) do(ctx context.Context, method, path string, in, out any, idempotent bool) error {
+	resp, err := c.send(ctx, method, path, in, idempotent)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		_, err = io.Copy(io.Discard, resp.Body)
+		return err
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode %s response: %w", path, err)
+	}
+	return nil
+}
+
+// send performs the request and returns a 200 response, whose body the
+// caller must close.
+func (c *Client) send(ctx context.Context, method, path string, in any, idempotent bool) (*http.Response, error) {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return nil, err
+		}
+	}
+	attempts := 1
+	if idempotent && c.opts.Retries > 0 {
+		attempts += c.opts.Retries
+	}
+	delay := c.opts.Backoff
+	var lastErr error
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			t := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return nil, errors.Join(ctx.Err(), lastErr)
+			case <-t.C:
+			}
+			delay *= 2
+		}
+		req, err := http.NewRequestWithContext(ctx, method, c.base+path, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		if in != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if c.opts.Token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.opts.Token)
+		}
+		resp, err := c.http.Do(req)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			lastErr = err
+			continue
+		}
+		if resp.StatusCode == http.StatusOK {
+			return resp, nil
+		}
+		lastErr = decodeError(resp)
+		resp.Body.Close()
+		switch resp.StatusCode {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			continue
+		}
+		return nil, lastErr
+	}
+	return nil, lastErr
+}
+
+func decodeError(resp *http.Response) error {
+	var e server.Error
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if json.Unmarshal(b, &e) != nil || e.Error == "" {
+		e.Error = strings.TrimSpace(string(b))
+		if e.Error == "" {
+			e.Error = http.StatusText(resp.StatusCode)
+		}
+	}
+	return &Error{Status: resp.StatusCode, Message: e.Error}
+}
+
+// setPending records the error of a call that cannot return one.
+func (c *Client) setPending(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pending == nil {
+		c.pending = err
+	}
+}
+
+// AttachStores is a no-op: the server owns the stores.
+func (c *Client) AttachStores(l1cache.Cache, objstore.Store) {}
+
+// WriteFile writes a file into the server's working set.
+func (c *Client) WriteFile(path string, content []byte) error {
+	ctx, cancel := c.ctx()
+	defer cancel()
+	return c.WriteFileContext(ctx, path, content)
+}
+
+// WriteFileContext is WriteFile with a context.
+func (c *Client) WriteFileContext(ctx context.Context, path string, content []byte) error {
+	return c.WriteFileModeContext(ctx, path, content, 0)
+}
+
+// WriteFileMode writes a file with the given entry kind (see vst.WriteFileMode).
+func (c *Client) WriteFileMode(path string, content []byte, mode fs.FileMode) error {
+	ctx, cancel := c.ctx()
+	defer cancel()
+	return c.WriteFileModeContext(ctx, path, content, mode)
+}
+
+// WriteFileModeContext is WriteFileMode with a context.
+func (c *Client) WriteFileModeContext(ctx context.Context, path string, content []byte, mode fs.FileMode) error {
+	if content == nil {
+		content = []byte{}
+	}
+	return c.do(ctx, "POST", "/v1/files/write", server.FileRequest{Path: path, Content: content, Mode: mode}, nil, true)
+}
+
+// ReadFile reads a file from the server's working set. Like the embedded
+// engine it returns nil, nil for a missing file.
+func (c *Client) ReadFile(path string) ([]byte, error) {
+	ctx, cancel := c.ctx()
+	defer cancel()
+	return c.ReadFileContext(ctx, path)
+}
+
+// ReadFileContext is ReadFile with a context.
+func (c *Client) ReadFileContext(ctx context.Context, path string) ([]byte, error) {
+	var resp server.ReadFileResponse
+	if err := c.do(ctx, "POST", "/v1/files/read", server.FileRequest{Path: path}, &resp, true); err != nil {
+		return nil, err
+	}
+	if !resp.Found {
+		return nil, nil
+	}
+	if resp.Content == nil {
+		return []byte{}, nil
+	}
+	return resp.Content, nil
+}
+
+// DeleteFile removes a file from the server's working set. A failure is
+// reported by the next Commit.
+func (c *Client) DeleteFile(path string) {
+	ctx, cancel := c.ctx()
+	defer cancel()
+	if err := c.DeleteFileContext(ctx, path); err != nil {
+		c.setPending(fmt.Errorf("delete %s: %w", path, err))
+	}
+}
+
+// DeleteFileContext is DeleteFile with a context, reporting failure.
+func (c *Client) DeleteFileContext(ctx context.Context, path string) error {
+	return c.do(ctx, "POST", "/v1/files/delete", server.FileRequest{Path: path}, nil, true)
+}
+
+// Reset empties the server's working set. A failure is reported by the
+// next Commit.
+func (c *Client) Reset() {
+	ctx, cancel := c.ctx()
+	defer cancel()
+	if err := c.ResetContext(ctx); err != nil {
+		c.setPending(fmt.Errorf("reset: %w", err))
+	}
+}
+
+// ResetContext is Reset with a context, reporting failure.
+func (c *Client) ResetContext(ctx context.Context) error {
+	return c.do(ctx, "POST", "/v1/reset", struct{}{}, nil, true)
+}
+
+// Commit snapshots the server's working set. If an earlier DeleteFile or
+// Reset failed, Commit returns that error instead, since the working set
+// is not what the caller expects.
+func (c *Client) Commit(msg string) (types.SnapshotID, types.CommitMetrics, error) {
+	ctx, cancel := c.ctx()
+	defer cancel()
+	return c.CommitContext(ctx, msg)
+}
+
+// CommitContext is Commit with a context. It is not retried: a commit whose
+// response was lost may have happened.
+func (c *Client) CommitContext(ctx context.Context, msg string) (types.SnapshotID, types.CommitMetrics, error) {
+	c.mu.Lock()
+	pending := c.pending
+	c.pending = nil
+	c.mu.Unlock()
+	if pending != nil {
+		return "", types.CommitMetrics{}, pending
+	}
+	var resp server.CommitResponse
+	if err := c.do(ctx, "POST", "/v1/commit", server.CommitRequest{Message: msg}, &resp, false); err != nil {
+		return "", types.CommitMetrics{}, err
+	}
+	return resp.SnapshotID, resp.Metrics.CommitMetrics(), nil
+}
+
+// Restore replaces the server's working set with a snapshot.
+func (c *Client) Restore(id types.SnapshotID) error {
+	ctx, cancel := c.ctx()
+	defer cancel()
+	return c.RestoreContext(ctx, id)
+}
+
+// RestoreContext is Restore with a context.
+func (c *Client) RestoreContext(ctx context.Context, id types.SnapshotID) error {
+	return c.do(ctx, "POST", "/v1/restore", server.RestoreRequest{SnapshotID: id}, nil, true)
+}
+
+// Diff compares two snapshots.
+func (c *Client) Diff(from, to types.SnapshotID) (types.DiffStats, error) {
+	ctx, cancel := c.ctx()
+	defer cancel()
+	return c.DiffContext(ctx, from, to)
+}
+
+// DiffContext is Diff with a context.
+func (c *Client) DiffContext(ctx context.Context, from, to types.SnapshotID) (types.DiffStats, error) {
+	var resp server.DiffResponse
+	if err := c.do(ctx, "POST", "/v1/diff", server.DiffRequest{From: from, To: to}, &resp, true); err != nil {
+		return types.DiffStats{}, err
+	}
+	return types.DiffStats{Added: resp.Added, Changed: resp.Changed, Deleted: resp.Deleted}, nil
+}
+
+// Materialize writes a snapshot to outDir on the server's filesystem.
+func (c *Client) Materialize(id types.SnapshotID, outDir string, opts types.MatOpts) (types.CommitMetrics, error) {
+	ctx, cancel := c.ctx()
+	defer cancel()
+	return c.MaterializeContext(ctx, id, outDir, opts)
+}
+
+// MaterializeContext is Materialize with a context. Only sync-mode calls
+// are retried, since a plain materialize refuses an existing outDir.
+func (c *Client) MaterializeContext(ctx context.Context, id types.SnapshotID, outDir string, opts types.MatOpts) (types.CommitMetrics, error) {
+	req := server.MaterializeRequest{
+		SnapshotID: id,
+		Out:        outDir,
+		Include:    opts.Include,
+		Exclude:    opts.Exclude,
+		Sync:       opts.Sync,
+		Prune:      opts.Prune,
+		BlobCache:  opts.BlobCache,
+		ReadOnly:   opts.ReadOnly,
+	}
+	var resp server.MaterializeResponse
+	if err := c.do(ctx, "POST", "/v1/materialize", req, &resp, opts.Sync); err != nil {
+		return types.CommitMetrics{}, err
+	}
+	return resp.Metrics.CommitMetrics(), nil
+}
+
+// SetParents records the lineage of a snapshot.
+func (c *Client) SetParents(id types.SnapshotID, parents []types.SnapshotID) error {
+	ctx, cancel := c.ctx()
+	defer cancel()
+	return c.SetParentsContext(ctx, id, parents)
+}
+
+// SetParentsContext is SetParents with a context.
+func (c *Client) SetParentsContext(ctx context.Context, id types.SnapshotID, parents []types.SnapshotID) error {
+	return c.do(ctx, "POST", "/v1/parents", server.ParentsRequest{SnapshotID: id, Parents: parents}, nil, true)
+}
+
+// Export streams a snapshot as an archive in the given format.
+func (c *Client) Export(ctx context.Context, id types.SnapshotID, format archive.Format, w io.Writer) error {
+	resp, err := c.send(ctx, "POST", "/v1/export", server.ExportRequest{SnapshotID: id, Format: string(format)}, true)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// FS returns a read-only view of a snapshot. The snapshot is fetched once
+// and held in memory.
+func (c *Client) FS(id types.SnapshotID) (*vst.TreeFS, error) {
+	ctx, cancel := c.ctx()
+	defer cancel()
+	return c.FSContext(ctx, id)
+}
+
+// FSContext is FS with a context.
+func (c *Client) FSContext(ctx context.Context, id types.SnapshotID) (*vst.TreeFS, error) {
+	var buf bytes.Buffer
+	if err := c.Export(ctx, id, archive.Tar, &buf); err != nil {
+		return nil, err
+	}
+	local := vst.New()
+	if err := archive.Read(&buf, local.WriteFileMode); err != nil {
+		return nil, err
+	}
+	got, _, err := local.Commit("")
+	if err != nil {
+		return nil, err
+	}
+	if got != id {
+		return nil, fmt.Errorf("snapshot %s arrived as %s", id, got)
+	}
+	return local.FS(got)
+}
+
+// Stats returns the server's cache and engine statistics.
+func (c *Client) Stats(ctx context.Context) (l1cache.CacheStats, metrics.Snapshot, error) {
+	var resp server.StatsResponse
+	if err := c.do(ctx, "GET", "/v1/stats", nil, &resp, true); err != nil {
+		return l1cache.CacheStats{}, metrics.Snapshot{}, err
+	}
+	return resp.L1.CacheStats(), resp.Engine, nil
+}
+
+// L1Stats returns the server's L1 statistics, or zero values if the server
+// cannot be reached.
+func (c *Client) L1Stats() l1cache.CacheStats {
+	ctx, cancel := c.ctx()
+	defer cancel()
+	st, _, _ := c.Stats(ctx)
+	return st
+}
+
+// EngineMetricsSnapshot returns the server's engine metrics, or zero values
+// if the server cannot be reached.
+func (c *Client) EngineMetricsSnapshot() metrics.Snapshot {
+	ctx, cancel := c.ctx()
+	defer cancel()
+	_, em, _ := c.Stats(ctx)
+	return em
+}
+
+// Ping checks that the server is up.
+func (c *Client) Ping(ctx context.Context) error {
+	return c.do(ctx, "GET", "/v1/health", nil, nil, true)
+}
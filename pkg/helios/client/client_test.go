@@ -0,0 +1,229 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/good-night-oppie/helios/pkg/helios/server"
+	"github.com/good-night-oppie/helios/pkg/helios/types"
+	"github.com/good-night-oppie/helios/pkg/helios/vst"
+)
+
+func TestClient_Workflow(t *testing.T) {
+	srv := httptest.NewServer(server.New(vst.New()))
+	defer srv.Close()
+	c, err := New(srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if err := c.WriteFile("a.txt", []byte("alpha")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.WriteFileMode("bin/run", []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.WriteFile("empty", nil); err != nil {
+		t.Fatal(err)
+	}
+	id1, m, err := c.Commit("one")
+	if err != nil || m.NewObjects != 3 {
+		t.Fatalf("commit = %s, %+v, %v", id1, m, err)
+	}
+
+	c.DeleteFile("a.txt")
+	_ = c.WriteFile("c.txt", []byte("gamma"))
+	id2, _, err := c.Commit("two")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := c.Diff(id1, id2)
+	if err != nil || d != (types.DiffStats{Added: 1, Deleted: 1}) {
+		t.Fatalf("diff = %+v, %v", d, err)
+	}
+
+	if err := c.Restore(id1); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := c.ReadFile("a.txt"); err != nil || string(b) != "alpha" {
+		t.Fatalf("read a.txt = %q, %v", b, err)
+	}
+	if b, err := c.ReadFile("empty"); err != nil || b == nil || len(b) != 0 {
+		t.Fatalf("read empty = %#v, %v", b, err)
+	}
+	if b, err := c.ReadFile("c.txt"); err != nil || b != nil {
+		t.Fatalf("read c.txt after restore = %q, %v", b, err)
+	}
+
+	fsys, err := c.FS(id1)
+	if err != nil {
+		t.Fatalf("fs: %v", err)
+	}
+	if b, err := fs.ReadFile(fsys, "a.txt"); err != nil || string(b) != "alpha" {
+		t.Fatalf("fs a.txt = %q, %v", b, err)
+	}
+	if fi, err := fs.Stat(fsys, "bin/run"); err != nil || fi.Mode()&0o111 == 0 {
+		t.Fatalf("fs bin/run = %v, %v", fi, err)
+	}
+
+	if err := c.SetParents(id2, []types.SnapshotID{id1}); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(t.TempDir(), "out")
+	if _, err := c.Materialize(id2, out, types.MatOpts{}); err != nil {
+		t.Fatal(err)
+	}
+	if st := c.EngineMetricsSnapshot(); st.NewObjects == 0 {
+		t.Fatalf("metrics = %+v", st)
+	}
+
+	var apiErr *Error
+	if err := c.Restore("nope"); !errors.As(err, &apiErr) || apiErr.Status != http.StatusUnprocessableEntity {
+		t.Fatalf("restore unknown = %v", err)
+	}
+}
+
+func TestClient_PendingErrorFailsCommit(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+	c, _ := New(srv.URL, &Options{Retries: -1})
+	defer c.Close()
+
+	c.DeleteFile("a.txt")
+	if _, _, err := c.Commit(""); err == nil {
+		t.Fatal("commit should report the failed delete")
+	}
+	if _, _, err := c.Commit(""); err == nil {
+		t.Fatal("commit against a 404 server should fail")
+	}
+}
+
+func TestClient_RetriesIdempotentCalls(t *testing.T) {
+	var calls atomic.Int32
+	inner := server.New(vst.New())
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1)%2 == 1 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		inner.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	c, _ := New(srv.URL, &Options{Backoff: time.Millisecond})
+	defer c.Close()
+
+	if err := c.WriteFile("a.txt", []byte("alpha")); err != nil {
+		t.Fatalf("write should be retried: %v", err)
+	}
+	if calls.Load() != 2 {
+		t.Fatalf("calls = %d, want 2", calls.Load())
+	}
+
+	// Commit is not idempotent, so the 503 is returned as is.
+	_, _, err := c.Commit("")
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusServiceUnavailable {
+		t.Fatalf("commit = %v, want a 503", err)
+	}
+	if calls.Load() != 3 {
+		t.Fatalf("commit was retried: calls = %d", calls.Load())
+	}
+}
+
+func TestClient_Token(t *testing.T) {
+	srv := httptest.NewServer(server.RequireToken(server.New(vst.New()), "s3cret"))
+	defer srv.Close()
+
+	anon, _ := New(srv.URL, &Options{Retries: -1})
+	defer anon.Close()
+	var apiErr *Error
+	if err := anon.WriteFile("a.txt", []byte("alpha")); !errors.As(err, &apiErr) || apiErr.Status != http.StatusUnauthorized {
+		t.Fatalf("write without token = %v, want a 401", err)
+	}
+
+	t.Setenv("HELIOS_TOKEN", "s3cret")
+	c, _ := New(srv.URL, nil)
+	defer c.Close()
+	if err := c.WriteFile("a.txt", []byte("alpha")); err != nil {
+		t.Fatalf("write with $HELIOS_TOKEN: %v", err)
+	}
+}
+
+func TestClient_ContextCancel(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "busy", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	c, _ := New(srv.URL, &Options{Retries: 100, Backoff: 10 * time.Millisecond})
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := c.RestoreContext(ctx, "x")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want deadline exceeded", err)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Fatal("retries ignored the context")
+	}
+}
+
+func TestClient_UnixSocket(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "helios.sock")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	hs := &http.Server{Handler: server.New(vst.New())}
+	go hs.Serve(ln)
+	defer hs.Close()
+
+	c, err := New("unix://"+sock, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := c.Ping(context.Background()); err != nil {
+		t.Fatalf("ping: %v", err)
+	}
+	_ = c.WriteFile("a.txt", []byte("alpha"))
+	if id, _, err := c.Commit(""); err != nil || id == "" {
+		t.Fatalf("commit = %q, %v", id, err)
+	}
+}
+
+func TestNew_Address(t *testing.T) {
+	for _, addr := range []string{"", "unix://"} {
+		if _, err := New(addr, nil); err == nil {
+			t.Errorf("New(%q) should fail", addr)
+		}
+	}
+	c, err := New("127.0.0.1:7420", nil)
+	if err != nil || c.base != "http://127.0.0.1:7420" {
+		t.Fatalf("base = %q, %v", c.base, err)
+	}
+}
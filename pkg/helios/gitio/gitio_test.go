@@ -0,0 +1,288 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitio
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/good-night-oppie/helios/pkg/helios/vst"
+)
+
+// git runs the git binary in dir, skipping the test when it is unavailable.
+func git(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=t", "GIT_AUTHOR_EMAIL=t@example.com",
+		"GIT_COMMITTER_NAME=t", "GIT_COMMITTER_EMAIL=t@example.com",
+		"GIT_CONFIG_GLOBAL=/dev/null", "GIT_CONFIG_NOSYSTEM=1")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func write(t *testing.T, dir, name, content string, mode os.FileMode) {
+	t.Helper()
+	p := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, []byte(content), mode); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(p, mode); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// fixture builds a small history with a merge, an executable and a symlink.
+func fixture(t *testing.T) string {
+	dir := t.TempDir()
+	git(t, dir, "init", "-q", "-b", "main")
+	big := strings.Repeat("line of text that deltas well\n", 200)
+	write(t, dir, "README.md", "hello\n", 0o644)
+	write(t, dir, "big.txt", big, 0o644)
+	write(t, dir, "bin/run", "#!/bin/sh\necho run\n", 0o755)
+	if err := os.Symlink("README.md", filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	git(t, dir, "add", "-A")
+	git(t, dir, "commit", "-q", "-m", "first")
+
+	git(t, dir, "checkout", "-q", "-b", "side")
+	write(t, dir, "side/notes.txt", "side work\n", 0o644)
+	git(t, dir, "add", "-A")
+	git(t, dir, "commit", "-q", "-m", "side")
+
+	git(t, dir, "checkout", "-q", "main")
+	write(t, dir, "big.txt", big+"one more line\n", 0o644)
+	if err := os.RemoveAll(filepath.Join(dir, "bin")); err != nil {
+		t.Fatal(err)
+	}
+	write(t, dir, "bin", "now a file\n", 0o644)
+	git(t, dir, "add", "-A")
+	git(t, dir, "commit", "-q", "-m", "second")
+	git(t, dir, "merge", "-q", "--no-ff", "-m", "merge side", "side")
+	return dir
+}
+
+func importHead(t *testing.T, dir string) (*vst.VST, *ImportResult) {
+	t.Helper()
+	r, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	v := vst.New()
+	res, err := Import(r, v, "HEAD")
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	return v, res
+}
+
+func TestImportExport_RoundTrip(t *testing.T) {
+	dir := fixture(t)
+	v, res := importHead(t, dir)
+
+	if res.Commits != 4 {
+		t.Fatalf("want 4 commits, got %d", res.Commits)
+	}
+	if res.Commit != git(t, dir, "rev-parse", "HEAD") {
+		t.Fatalf("head commit %s", res.Commit)
+	}
+	parents, err := v.Parents(res.Head)
+	if err != nil || len(parents) != 2 {
+		t.Fatalf("merge snapshot parents = %v, %v", parents, err)
+	}
+
+	fsys, err := v.FS(res.Head)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := fsys.ReadFile("bin"); string(b) != "now a file\n" {
+		t.Fatalf("bin = %q", b)
+	}
+	if b, _ := fsys.ReadFile("side/notes.txt"); string(b) != "side work\n" {
+		t.Fatalf("side/notes.txt = %q", b)
+	}
+	if target, err := fsys.ReadLink("link"); err != nil || target != "README.md" {
+		t.Fatalf("link -> %q, %v", target, err)
+	}
+
+	// The first commit kept its executable bit.
+	first, _ := ParseHash(git(t, dir, "rev-list", "--max-parents=0", "HEAD"))
+	firstFS, err := v.FS(res.Snapshots[first])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, err := firstFS.Stat("bin/run"); err != nil || info.Mode().Perm()&0o111 == 0 {
+		t.Fatalf("bin/run should be executable: %v, %v", info, err)
+	}
+
+	// Exporting the snapshot reproduces git's own tree exactly.
+	r, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	when := time.Unix(1700000000, 0).UTC()
+	out, err := Export(r, fsys, ExportOptions{Branch: "helios", Message: "from helios", When: when})
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	if out.Tree != git(t, dir, "rev-parse", "HEAD^{tree}") {
+		t.Fatalf("exported tree %s differs from git's", out.Tree)
+	}
+	if git(t, dir, "rev-parse", "helios") != out.Commit || out.Parent != "" {
+		t.Fatalf("branch not created at %s: %+v", out.Commit, out)
+	}
+	git(t, dir, "fsck", "--strict")
+
+	again, err := Export(r, fsys, ExportOptions{Branch: "helios", Message: "again", When: when})
+	if err != nil || !again.Unchanged || again.Commit != out.Commit {
+		t.Fatalf("re-export of the same tree should be a no-op: %+v, %v", again, err)
+	}
+
+	// A different snapshot goes on top of the branch tip.
+	next, err := Export(r, firstFS, ExportOptions{Branch: "refs/heads/helios", Message: "older tree", When: when})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.Parent != out.Commit || git(t, dir, "rev-parse", "helios^") != out.Commit {
+		t.Fatalf("export should build on the branch tip: %+v", next)
+	}
+}
+
+func TestImport_Packfiles(t *testing.T) {
+	dir := fixture(t)
+	_, loose := importHead(t, dir)
+
+	git(t, dir, "repack", "-adq", "--depth=50", "--window=50")
+	git(t, dir, "prune-packed")
+	git(t, dir, "pack-refs", "--all")
+	if matches, _ := filepath.Glob(filepath.Join(dir, ".git", "objects", "??", "*")); len(matches) != 0 {
+		t.Fatalf("loose objects left after repack: %v", matches)
+	}
+
+	_, packed := importHead(t, dir)
+	if packed.Head != loose.Head {
+		t.Fatalf("packed import %s != loose import %s", packed.Head, loose.Head)
+	}
+
+	r, _ := Open(dir)
+	defer r.Close()
+	if _, err := r.Resolve("side"); err != nil {
+		t.Fatalf("packed ref: %v", err)
+	}
+}
+
+func TestImport_MergeOntoEmptyTree(t *testing.T) {
+	dir := fixture(t)
+	git(t, dir, "checkout", "-q", "--orphan", "empty")
+	git(t, dir, "rm", "-rqf", ".")
+	git(t, dir, "commit", "-q", "--allow-empty", "-m", "empty")
+	// Importing main's history in between leaves its files in the working
+	// set; the merge must start again from the empty first parent.
+	git(t, dir, "merge", "-q", "-s", "ours", "--allow-unrelated-histories", "-m", "keep empty", "main")
+
+	r, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	v := vst.New()
+	res, err := Import(r, v, "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	empty, _ := ParseHash(git(t, dir, "rev-parse", "HEAD~1"))
+	emptyID, ok := res.Snapshots[empty]
+	if !ok {
+		t.Fatalf("HEAD~1 %s was not imported", empty)
+	}
+	if res.Head != emptyID {
+		t.Fatalf("merge snapshot %s, want the empty tree's %s", res.Head, emptyID)
+	}
+}
+
+func TestOpen_LinkedWorktree(t *testing.T) {
+	dir := fixture(t)
+	wt := filepath.Join(t.TempDir(), "wt")
+	git(t, dir, "worktree", "add", "-q", wt, "side")
+
+	r, err := Open(wt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	head, err := r.Resolve("HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := git(t, wt, "rev-parse", "HEAD"); head.String() != want {
+		t.Fatalf("HEAD = %s, want the work tree's %s", head, want)
+	}
+	// Shared refs and objects still come from the main repository.
+	if main, err := r.Resolve("main"); err != nil || main.String() != git(t, dir, "rev-parse", "main") {
+		t.Fatalf("main = %s, %v", main, err)
+	}
+	if _, res := importHead(t, wt); res.Commit != head.String() {
+		t.Fatalf("imported %s from the work tree, want %s", res.Commit, head)
+	}
+}
+
+func TestUpdateRef_CompareAndSwap(t *testing.T) {
+	dir := t.TempDir()
+	git(t, dir, "init", "-q", "-b", "main")
+	r, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, _ := r.WriteObject(TypeBlob, []byte("a"))
+	b, _ := r.WriteObject(TypeBlob, []byte("b"))
+
+	if err := r.UpdateRef("refs/heads/x", a, Hash{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.UpdateRef("refs/heads/x", b, Hash{}); !errors.Is(err, ErrRefChanged) {
+		t.Fatalf("want ErrRefChanged, got %v", err)
+	}
+	if err := r.UpdateRef("refs/heads/x", b, a); err != nil {
+		t.Fatal(err)
+	}
+	if h, _ := r.ReadRef("refs/heads/x"); h != b {
+		t.Fatalf("ref = %s", h)
+	}
+	for _, bad := range []string{"refs/heads/a..b", "refs/heads/x.lock", "heads/x", "refs/heads/a b"} {
+		if err := r.UpdateRef(bad, a, Hash{}); err == nil {
+			t.Errorf("%q should be rejected", bad)
+		}
+	}
+}
+
+var _ Engine = (*vst.VST)(nil)
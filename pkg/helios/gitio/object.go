@@ -0,0 +1,224 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitio
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Tree entry modes as git records them.
+const (
+	ModeFile    = 0o100644
+	ModeExec    = 0o100755
+	ModeSymlink = 0o120000
+	ModeTree    = 0o040000
+	ModeGitlink = 0o160000 // submodule commit
+)
+
+// TreeEntry is one entry of a tree object.
+type TreeEntry struct {
+	Mode uint32
+	Name string
+	Hash Hash
+}
+
+// Commit is a parsed commit object. Author and Committer are kept verbatim
+// ("Name <email> unix-seconds tz").
+type Commit struct {
+	Tree      Hash
+	Parents   []Hash
+	Author    string
+	Committer string
+	Message   string
+}
+
+// ReadCommit reads and parses the commit h, peeling annotated tags.
+func (r *Repo) ReadCommit(h Hash) (*Commit, error) {
+	for depth := 0; depth < 10; depth++ {
+		typ, data, err := r.ReadObject(h)
+		if err != nil {
+			return nil, err
+		}
+		switch typ {
+		case TypeCommit:
+			return parseCommit(data)
+		case TypeTag:
+			if h, err = tagTarget(data); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		return nil, fmt.Errorf("object %s is a %s, not a commit", h, typ)
+	}
+	return nil, fmt.Errorf("object %s: too many nested tags", h)
+}
+
+// ReadTree reads and parses the tree h.
+func (r *Repo) ReadTree(h Hash) ([]TreeEntry, error) {
+	typ, data, err := r.ReadObject(h)
+	if err != nil {
+		return nil, err
+	}
+	if typ != TypeTree {
+		return nil, fmt.Errorf("object %s is a %s, not a tree", h, typ)
+	}
+	return parseTree(data)
+}
+
+func tagTarget(data []byte) (Hash, error) {
+	line, _, _ := bytes.Cut(data, []byte{'\n'})
+	v, ok := bytes.CutPrefix(line, []byte("object "))
+	if !ok {
+		return Hash{}, errors.New("malformed tag object")
+	}
+	return ParseHash(string(v))
+}
+
+func parseCommit(data []byte) (*Commit, error) {
+	c := &Commit{}
+	headers, msg, _ := bytes.Cut(data, []byte("\n\n"))
+	c.Message = string(msg)
+	sawTree := false
+	for _, line := range strings.Split(string(headers), "\n") {
+		if strings.HasPrefix(line, " ") {
+			continue // continuation of a multi-line header such as gpgsig
+		}
+		k, v, _ := strings.Cut(line, " ")
+		var err error
+		switch k {
+		case "tree":
+			c.Tree, err = ParseHash(v)
+			sawTree = true
+		case "parent":
+			var p Hash
+			p, err = ParseHash(v)
+			c.Parents = append(c.Parents, p)
+		case "author":
+			c.Author = v
+		case "committer":
+			c.Committer = v
+		}
+		if err != nil {
+			return nil, fmt.Errorf("malformed commit: %w", err)
+		}
+	}
+	if !sawTree {
+		return nil, errors.New("malformed commit: no tree")
+	}
+	return c, nil
+}
+
+func parseTree(data []byte) ([]TreeEntry, error) {
+	var out []TreeEntry
+	for len(data) > 0 {
+		sp := bytes.IndexByte(data, ' ')
+		nul := bytes.IndexByte(data, 0)
+		if sp < 0 || nul < sp || nul+21 > len(data) {
+			return nil, errors.New("malformed tree object")
+		}
+		mode, err := strconv.ParseUint(string(data[:sp]), 8, 32)
+		if err != nil {
+			return nil, fmt.Errorf("malformed tree mode %q", data[:sp])
+		}
+		e := TreeEntry{Mode: uint32(mode), Name: string(data[sp+1 : nul])}
+		copy(e.Hash[:], data[nul+1:nul+21])
+		out = append(out, e)
+		data = data[nul+21:]
+	}
+	return out, nil
+}
+
+// EncodeTree serialises entries as a tree object, sorting them the way git
+// does: by name, with subtrees compared as if their name ended in "/".
+func EncodeTree(entries []TreeEntry) []byte {
+	sorted := append([]TreeEntry(nil), entries...)
+	key := func(e TreeEntry) string {
+		if e.Mode == ModeTree {
+			return e.Name + "/"
+		}
+		return e.Name
+	}
+	sort.Slice(sorted, func(i, j int) bool { return key(sorted[i]) < key(sorted[j]) })
+	var buf bytes.Buffer
+	for _, e := range sorted {
+		fmt.Fprintf(&buf, "%o %s\x00", e.Mode, e.Name)
+		buf.Write(e.Hash[:])
+	}
+	return buf.Bytes()
+}
+
+// EncodeCommit serialises c as a commit object.
+func EncodeCommit(c *Commit) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "tree %s\n", c.Tree)
+	for _, p := range c.Parents {
+		fmt.Fprintf(&buf, "parent %s\n", p)
+	}
+	fmt.Fprintf(&buf, "author %s\ncommitter %s\n\n%s", c.Author, c.Committer, c.Message)
+	return buf.Bytes()
+}
+
+// HashObject returns the name git gives an object of this type and content.
+func HashObject(typ ObjectType, data []byte) Hash {
+	h := sha1.New()
+	fmt.Fprintf(h, "%s %d\x00", typ, len(data))
+	h.Write(data)
+	var out Hash
+	h.Sum(out[:0])
+	return out
+}
+
+// WriteObject stores an object as a loose object unless it already exists.
+func (r *Repo) WriteObject(typ ObjectType, data []byte) (Hash, error) {
+	h := HashObject(typ, data)
+	if ok, err := r.HasObject(h); err != nil || ok {
+		return h, err
+	}
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	fmt.Fprintf(zw, "%s %d\x00", typ, len(data))
+	zw.Write(data)
+	if err := zw.Close(); err != nil {
+		return h, err
+	}
+
+	dst := r.loosePath(h)
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return h, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dst), "tmp_obj_*")
+	if err != nil {
+		return h, err
+	}
+	_, werr := tmp.Write(buf.Bytes())
+	if err := errors.Join(werr, tmp.Close(), os.Chmod(tmp.Name(), 0o444)); err != nil {
+		os.Remove(tmp.Name())
+		return h, err
+	}
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		os.Remove(tmp.Name())
+		return h, err
+	}
+	return h, nil
+}
@@ -0,0 +1,323 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitio
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Packed object types (pack format, not the names used in headers).
+const (
+	packCommit   = 1
+	packTree     = 2
+	packBlob     = 3
+	packTag      = 4
+	packOfsDelta = 6
+	packRefDelta = 7
+)
+
+// maxDeltaDepth guards against corrupt packs whose delta chains loop.
+const maxDeltaDepth = 10000
+
+// pack is an opened packfile with its version 2 index loaded in memory.
+type pack struct {
+	f       *os.File
+	names   []Hash
+	offsets []int64
+
+	mu    sync.Mutex
+	cache map[int64]cachedObject // resolved delta bases
+}
+
+type cachedObject struct {
+	typ  ObjectType
+	data []byte
+}
+
+// maxCachedBases bounds the delta base cache; it is simply reset when full.
+const maxCachedBases = 256
+
+func openPack(idxPath string) (*pack, error) {
+	idx, err := os.ReadFile(idxPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(idx) < 8+256*4 || !bytes.Equal(idx[:4], []byte("\xfftOc")) || binary.BigEndian.Uint32(idx[4:]) != 2 {
+		return nil, fmt.Errorf("%s: unsupported pack index version", idxPath)
+	}
+	fanout := idx[8 : 8+256*4]
+	n := int(binary.BigEndian.Uint32(fanout[255*4:]))
+	namesAt := 8 + 256*4
+	offsAt := namesAt + n*20 + n*4 // skip CRC32s
+	largeAt := offsAt + n*4
+	if len(idx) < largeAt+40 {
+		return nil, fmt.Errorf("%s: truncated pack index", idxPath)
+	}
+
+	p := &pack{names: make([]Hash, n), offsets: make([]int64, n), cache: make(map[int64]cachedObject)}
+	for i := 0; i < n; i++ {
+		copy(p.names[i][:], idx[namesAt+i*20:])
+		off := binary.BigEndian.Uint32(idx[offsAt+i*4:])
+		if off&0x80000000 == 0 {
+			p.offsets[i] = int64(off)
+			continue
+		}
+		at := largeAt + int(off&0x7fffffff)*8
+		if at+8 > len(idx) {
+			return nil, fmt.Errorf("%s: bad large offset", idxPath)
+		}
+		p.offsets[i] = int64(binary.BigEndian.Uint64(idx[at:]))
+	}
+
+	packPath := strings.TrimSuffix(idxPath, ".idx") + ".pack"
+	if p.f, err = os.Open(packPath); err != nil {
+		return nil, err
+	}
+	var hdr [12]byte
+	if _, err := p.f.ReadAt(hdr[:], 0); err != nil || !bytes.Equal(hdr[:4], []byte("PACK")) {
+		p.f.Close()
+		return nil, fmt.Errorf("%s: not a packfile", packPath)
+	}
+	return p, nil
+}
+
+func (p *pack) close() error { return p.f.Close() }
+
+// find returns the pack offset of h.
+func (p *pack) find(h Hash) (int64, bool) {
+	i := sort.Search(len(p.names), func(i int) bool { return bytes.Compare(p.names[i][:], h[:]) >= 0 })
+	if i < len(p.names) && p.names[i] == h {
+		return p.offsets[i], true
+	}
+	return 0, false
+}
+
+// readAt resolves the object at off, applying any delta chain.
+func (p *pack) readAt(r *Repo, off int64) (ObjectType, []byte, error) {
+	var deltas [][]byte
+	for depth := 0; ; depth++ {
+		if depth > maxDeltaDepth {
+			return "", nil, fmt.Errorf("pack offset %d: delta chain too deep", off)
+		}
+		p.mu.Lock()
+		c, hit := p.cache[off]
+		p.mu.Unlock()
+		var (
+			typ  ObjectType
+			data []byte
+		)
+		if hit {
+			typ, data = c.typ, c.data
+		} else {
+			kind, body, base, baseName, err := p.entry(off)
+			if err != nil {
+				return "", nil, err
+			}
+			switch kind {
+			case packOfsDelta:
+				deltas = append(deltas, body)
+				off = base
+				continue
+			case packRefDelta:
+				deltas = append(deltas, body)
+				if bo, ok := p.find(baseName); ok {
+					off = bo
+					continue
+				}
+				// Thin packs may delta against objects stored elsewhere.
+				t, d, err := r.ReadObject(baseName)
+				if err != nil {
+					return "", nil, err
+				}
+				typ, data = t, d
+			default:
+				typ, data = packTypeName(kind), body
+				if typ == "" {
+					return "", nil, fmt.Errorf("pack offset %d: unknown object type %d", off, kind)
+				}
+				if len(deltas) > 0 {
+					p.remember(off, typ, data)
+				}
+			}
+		}
+		for i := len(deltas) - 1; i >= 0; i-- {
+			var err error
+			if data, err = applyDelta(data, deltas[i]); err != nil {
+				return "", nil, err
+			}
+		}
+		return typ, data, nil
+	}
+}
+
+func (p *pack) remember(off int64, typ ObjectType, data []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.cache) >= maxCachedBases {
+		p.cache = make(map[int64]cachedObject)
+	}
+	p.cache[off] = cachedObject{typ: typ, data: data}
+}
+
+func packTypeName(kind int) ObjectType {
+	switch kind {
+	case packCommit:
+		return TypeCommit
+	case packTree:
+		return TypeTree
+	case packBlob:
+		return TypeBlob
+	case packTag:
+		return TypeTag
+	}
+	return ""
+}
+
+// entry reads the raw entry at off: its pack type, inflated body and, for
+// deltas, the base offset or base object name.
+func (p *pack) entry(off int64) (kind int, body []byte, baseOff int64, baseName Hash, err error) {
+	br := bufio.NewReader(io.NewSectionReader(p.f, off, 1<<62))
+	b, err := br.ReadByte()
+	if err != nil {
+		return 0, nil, 0, baseName, err
+	}
+	kind = int(b>>4) & 7
+	size := uint64(b & 0x0f)
+	for shift := 4; b&0x80 != 0; shift += 7 {
+		if b, err = br.ReadByte(); err != nil {
+			return 0, nil, 0, baseName, err
+		}
+		size |= uint64(b&0x7f) << shift
+	}
+
+	switch kind {
+	case packOfsDelta:
+		b, err := br.ReadByte()
+		if err != nil {
+			return 0, nil, 0, baseName, err
+		}
+		rel := int64(b & 0x7f)
+		for b&0x80 != 0 {
+			if b, err = br.ReadByte(); err != nil {
+				return 0, nil, 0, baseName, err
+			}
+			rel = ((rel + 1) << 7) | int64(b&0x7f)
+		}
+		if rel <= 0 || rel > off {
+			return 0, nil, 0, baseName, fmt.Errorf("pack offset %d: bad delta base", off)
+		}
+		baseOff = off - rel
+	case packRefDelta:
+		if _, err := io.ReadFull(br, baseName[:]); err != nil {
+			return 0, nil, 0, baseName, err
+		}
+	}
+
+	zr, err := zlib.NewReader(br)
+	if err != nil {
+		return 0, nil, 0, baseName, fmt.Errorf("pack offset %d: %w", off, err)
+	}
+	defer zr.Close()
+	body = make([]byte, 0, size)
+	buf := bytes.NewBuffer(body)
+	if _, err := io.Copy(buf, io.LimitReader(zr, int64(size)+1)); err != nil {
+		return 0, nil, 0, baseName, fmt.Errorf("pack offset %d: %w", off, err)
+	}
+	if uint64(buf.Len()) != size {
+		return 0, nil, 0, baseName, fmt.Errorf("pack offset %d: size mismatch", off)
+	}
+	return kind, buf.Bytes(), baseOff, baseName, nil
+}
+
+var errBadDelta = errors.New("corrupt delta")
+
+// applyDelta rebuilds an object from its base and a git delta.
+func applyDelta(base, delta []byte) ([]byte, error) {
+	srcSize, delta, err := deltaVarint(delta)
+	if err != nil || srcSize != uint64(len(base)) {
+		return nil, errBadDelta
+	}
+	dstSize, delta, err := deltaVarint(delta)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, dstSize)
+	for len(delta) > 0 {
+		op := delta[0]
+		delta = delta[1:]
+		switch {
+		case op&0x80 != 0: // copy from base
+			var off, n uint64
+			for i := uint(0); i < 4; i++ {
+				if op&(1<<i) != 0 {
+					if len(delta) == 0 {
+						return nil, errBadDelta
+					}
+					off |= uint64(delta[0]) << (8 * i)
+					delta = delta[1:]
+				}
+			}
+			for i := uint(0); i < 3; i++ {
+				if op&(0x10<<i) != 0 {
+					if len(delta) == 0 {
+						return nil, errBadDelta
+					}
+					n |= uint64(delta[0]) << (8 * i)
+					delta = delta[1:]
+				}
+			}
+			if n == 0 {
+				n = 0x10000
+			}
+			if off+n > uint64(len(base)) {
+				return nil, errBadDelta
+			}
+			out = append(out, base[off:off+n]...)
+		case op != 0: // insert literal
+			if int(op) > len(delta) {
+				return nil, errBadDelta
+			}
+			out = append(out, delta[:op]...)
+			delta = delta[op:]
+		default:
+			return nil, errBadDelta
+		}
+	}
+	if uint64(len(out)) != dstSize {
+		return nil, errBadDelta
+	}
+	return out, nil
+}
+
+func deltaVarint(b []byte) (uint64, []byte, error) {
+	var v uint64
+	for i, shift := 0, uint(0); i < len(b) && shift < 64; i, shift = i+1, shift+7 {
+		v |= uint64(b[i]&0x7f) << shift
+		if b[i]&0x80 == 0 {
+			return v, b[i+1:], nil
+		}
+	}
+	return 0, nil, errBadDelta
+}
@@ -0,0 +1,182 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitio
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrRefChanged is returned by UpdateRef when the ref no longer has the
+// expected old value.
+var ErrRefChanged = errors.New("ref changed concurrently")
+
+// ReadRef returns the object a full ref name such as "refs/heads/main" or
+// "HEAD" points to, following symbolic refs.
+func (r *Repo) ReadRef(name string) (Hash, error) {
+	for depth := 0; depth < 10; depth++ {
+		path := r.refPath(name)
+		if info, err := os.Stat(path); errors.Is(err, os.ErrNotExist) || (err == nil && info.IsDir()) {
+			return r.packedRef(name)
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return Hash{}, err
+		}
+		v := strings.TrimSpace(string(b))
+		if target, ok := strings.CutPrefix(v, "ref: "); ok {
+			name = target
+			continue
+		}
+		return ParseHash(v)
+	}
+	return Hash{}, fmt.Errorf("ref %s: too many symbolic refs", name)
+}
+
+// refPath returns the file of ref name. A linked work tree has its own HEAD,
+// pseudo-refs such as ORIG_HEAD and refs/worktree/, refs/bisect/ and
+// refs/rewritten/; every other ref is shared.
+func (r *Repo) refPath(name string) string {
+	dir := r.GitDir
+	if r.worktreeDir != "" && (!strings.HasPrefix(name, "refs/") ||
+		strings.HasPrefix(name, "refs/worktree/") ||
+		strings.HasPrefix(name, "refs/bisect/") ||
+		strings.HasPrefix(name, "refs/rewritten/")) {
+		dir = r.worktreeDir
+	}
+	return filepath.Join(dir, filepath.FromSlash(name))
+}
+
+func (r *Repo) packedRef(name string) (Hash, error) {
+	f, err := os.Open(filepath.Join(r.GitDir, "packed-refs"))
+	if errors.Is(err, os.ErrNotExist) {
+		return Hash{}, fmt.Errorf("ref %s: %w", name, ErrNotFound)
+	}
+	if err != nil {
+		return Hash{}, err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := sc.Text()
+		if line == "" || line[0] == '#' || line[0] == '^' {
+			continue
+		}
+		if h, ref, ok := strings.Cut(line, " "); ok && ref == name {
+			return ParseHash(h)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return Hash{}, err
+	}
+	return Hash{}, fmt.Errorf("ref %s: %w", name, ErrNotFound)
+}
+
+// Resolve turns a revision (a full object name, "HEAD", or a ref name in
+// git's lookup order: refs/, refs/tags/, refs/heads/, refs/remotes/) into an
+// object name.
+func (r *Repo) Resolve(rev string) (Hash, error) {
+	if h, err := ParseHash(rev); err == nil {
+		return h, nil
+	}
+	candidates := []string{"refs/" + rev, "refs/tags/" + rev, "refs/heads/" + rev, "refs/remotes/" + rev, "refs/remotes/" + rev + "/HEAD"}
+	if rev == "HEAD" || strings.HasPrefix(rev, "refs/") {
+		candidates = append([]string{rev}, candidates...)
+	}
+	for _, name := range candidates {
+		h, err := r.ReadRef(name)
+		if err == nil {
+			return h, nil
+		}
+		if !errors.Is(err, ErrNotFound) {
+			return Hash{}, err
+		}
+	}
+	return Hash{}, fmt.Errorf("revision %s: %w", rev, ErrNotFound)
+}
+
+// UpdateRef atomically points the ref name (e.g. "refs/heads/agent") at h,
+// provided it still points at old; a zero old means the ref must not exist.
+// It takes git's "<ref>.lock" file, so it is safe against concurrent git
+// commands.
+func (r *Repo) UpdateRef(name string, h, old Hash) error {
+	if err := checkRefName(name); err != nil {
+		return err
+	}
+	path := r.refPath(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	lock, err := os.OpenFile(path+".lock", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return fmt.Errorf("lock %s: %w", name, err)
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			lock.Close()
+			os.Remove(lock.Name())
+		}
+	}()
+
+	cur, err := r.ReadRef(name)
+	if errors.Is(err, ErrNotFound) {
+		cur, err = Hash{}, nil
+	}
+	if err != nil {
+		return err
+	}
+	if cur != old {
+		return fmt.Errorf("%w: %s is %s, expected %s", ErrRefChanged, name, cur, old)
+	}
+	if _, err := fmt.Fprintf(lock, "%s\n", h); err != nil {
+		return err
+	}
+	if err := lock.Sync(); err != nil {
+		return err
+	}
+	if err := lock.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(lock.Name(), path); err != nil {
+		return err
+	}
+	committed = true
+	return nil
+}
+
+// checkRefName applies the main rules of git check-ref-format.
+func checkRefName(name string) error {
+	bad := func() error { return fmt.Errorf("invalid ref name %q", name) }
+	if !strings.HasPrefix(name, "refs/") || strings.HasSuffix(name, "/") || strings.HasSuffix(name, ".") ||
+		strings.Contains(name, "..") || strings.Contains(name, "@{") || strings.Contains(name, "//") {
+		return bad()
+	}
+	for _, c := range name {
+		if c < 0x20 || c == 0x7f || strings.ContainsRune(" ~^:?*[\\", c) {
+			return bad()
+		}
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == "" || strings.HasPrefix(part, ".") || strings.HasSuffix(part, ".lock") {
+			return bad()
+		}
+	}
+	return nil
+}
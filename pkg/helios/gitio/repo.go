@@ -0,0 +1,229 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package gitio reads commits and trees from a local git repository (loose
+// objects and packfiles) and writes trees and commits back as loose objects.
+// Only SHA-1 repositories are supported. The git binary is not required.
+package gitio
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ObjectType is the type of a git object.
+type ObjectType string
+
+const (
+	TypeCommit ObjectType = "commit"
+	TypeTree   ObjectType = "tree"
+	TypeBlob   ObjectType = "blob"
+	TypeTag    ObjectType = "tag"
+)
+
+// ErrNotFound is returned for objects and refs that do not exist.
+var ErrNotFound = errors.New("not found")
+
+// Hash is a SHA-1 object name.
+type Hash [20]byte
+
+// ParseHash parses a 40-digit hex object name.
+func ParseHash(s string) (Hash, error) {
+	var h Hash
+	if len(s) != 40 {
+		return h, fmt.Errorf("invalid object name %q", s)
+	}
+	if _, err := hex.Decode(h[:], []byte(s)); err != nil {
+		return h, fmt.Errorf("invalid object name %q", s)
+	}
+	return h, nil
+}
+
+func (h Hash) String() string { return hex.EncodeToString(h[:]) }
+
+// IsZero reports whether h is the all-zero name git uses for "no object".
+func (h Hash) IsZero() bool { return h == Hash{} }
+
+// Repo is a git repository on disk.
+type Repo struct {
+	// GitDir holds the objects and shared refs; for a linked work tree it
+	// is the main repository's git directory.
+	GitDir string
+	// worktreeDir is a linked work tree's own git directory, which holds
+	// its HEAD and other per-worktree refs; empty otherwise.
+	worktreeDir string
+
+	mu    sync.Mutex
+	packs []*pack // loaded lazily
+	pErr  error
+	pOnce bool
+}
+
+// Open locates the git directory for path, which may be a work tree (with a
+// .git directory or a "gitdir:" file) or a bare repository.
+func Open(path string) (*Repo, error) {
+	dir := path
+	if info, err := os.Stat(filepath.Join(path, ".git")); err == nil {
+		dir = filepath.Join(path, ".git")
+		if !info.IsDir() {
+			b, err := os.ReadFile(dir)
+			if err != nil {
+				return nil, err
+			}
+			line := strings.TrimSpace(string(b))
+			if !strings.HasPrefix(line, "gitdir:") {
+				return nil, fmt.Errorf("%s: unrecognised .git file", path)
+			}
+			dir = strings.TrimSpace(strings.TrimPrefix(line, "gitdir:"))
+			if !filepath.IsAbs(dir) {
+				dir = filepath.Join(path, dir)
+			}
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "HEAD")); err != nil {
+		return nil, fmt.Errorf("%s: not a git repository", path)
+	}
+	// Linked work trees keep objects and shared refs in the common
+	// directory, but HEAD in their own.
+	var worktree string
+	if b, err := os.ReadFile(filepath.Join(dir, "commondir")); err == nil {
+		common := strings.TrimSpace(string(b))
+		if !filepath.IsAbs(common) {
+			common = filepath.Join(dir, common)
+		}
+		worktree, dir = dir, common
+	}
+	if cfg, err := os.ReadFile(filepath.Join(dir, "config")); err == nil {
+		for _, line := range strings.Split(string(cfg), "\n") {
+			k, v, ok := strings.Cut(strings.TrimSpace(line), "=")
+			if ok && strings.EqualFold(strings.TrimSpace(k), "objectformat") && strings.TrimSpace(v) != "sha1" {
+				return nil, fmt.Errorf("%s: object format %s is not supported", path, strings.TrimSpace(v))
+			}
+		}
+	}
+	return &Repo{GitDir: dir, worktreeDir: worktree}, nil
+}
+
+// ReadObject returns the type and content of the object h.
+func (r *Repo) ReadObject(h Hash) (ObjectType, []byte, error) {
+	t, data, err := r.readLoose(h)
+	if !errors.Is(err, ErrNotFound) {
+		return t, data, err
+	}
+	packs, err := r.loadPacks()
+	if err != nil {
+		return "", nil, err
+	}
+	for _, p := range packs {
+		if off, ok := p.find(h); ok {
+			return p.readAt(r, off)
+		}
+	}
+	return "", nil, fmt.Errorf("object %s: %w", h, ErrNotFound)
+}
+
+// HasObject reports whether h is present, loose or packed.
+func (r *Repo) HasObject(h Hash) (bool, error) {
+	if _, err := os.Stat(r.loosePath(h)); err == nil {
+		return true, nil
+	}
+	packs, err := r.loadPacks()
+	if err != nil {
+		return false, err
+	}
+	for _, p := range packs {
+		if _, ok := p.find(h); ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *Repo) loosePath(h Hash) string {
+	s := h.String()
+	return filepath.Join(r.GitDir, "objects", s[:2], s[2:])
+}
+
+func (r *Repo) readLoose(h Hash) (ObjectType, []byte, error) {
+	f, err := os.Open(r.loosePath(h))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil, ErrNotFound
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+	zr, err := zlib.NewReader(bufio.NewReader(f))
+	if err != nil {
+		return "", nil, fmt.Errorf("object %s: %w", h, err)
+	}
+	defer zr.Close()
+	raw, err := io.ReadAll(zr)
+	if err != nil {
+		return "", nil, fmt.Errorf("object %s: %w", h, err)
+	}
+	hdr, body, ok := bytes.Cut(raw, []byte{0})
+	if !ok {
+		return "", nil, fmt.Errorf("object %s: missing header", h)
+	}
+	typ, size, ok := strings.Cut(string(hdr), " ")
+	if !ok || size != fmt.Sprint(len(body)) {
+		return "", nil, fmt.Errorf("object %s: malformed header %q", h, hdr)
+	}
+	return ObjectType(typ), body, nil
+}
+
+func (r *Repo) loadPacks() ([]*pack, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.pOnce {
+		return r.packs, r.pErr
+	}
+	r.pOnce = true
+	idxs, err := filepath.Glob(filepath.Join(r.GitDir, "objects", "pack", "pack-*.idx"))
+	if err != nil {
+		r.pErr = err
+		return nil, err
+	}
+	for _, idx := range idxs {
+		p, err := openPack(idx)
+		if err != nil {
+			r.pErr = err
+			return nil, err
+		}
+		r.packs = append(r.packs, p)
+	}
+	return r.packs, nil
+}
+
+// Close releases open packfiles.
+func (r *Repo) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var errs []error
+	for _, p := range r.packs {
+		errs = append(errs, p.close())
+	}
+	r.packs, r.pOnce = nil, false
+	return errors.Join(errs...)
+}
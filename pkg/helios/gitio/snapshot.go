@@ -0,0 +1,396 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitio
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/good-night-oppie/helios/pkg/helios/types"
+)
+
+// Engine is the part of the Helios engine that Import drives.
+type Engine interface {
+	Reset()
+	Restore(id types.SnapshotID) error
+	WriteFileMode(path string, content []byte, mode fs.FileMode) error
+	DeleteFile(path string)
+	Commit(msg string) (types.SnapshotID, types.CommitMetrics, error)
+	SetParents(id types.SnapshotID, parents []types.SnapshotID) error
+}
+
+// ImportResult describes a finished import.
+type ImportResult struct {
+	Head      types.SnapshotID          `json:"snapshot_id"`
+	Commit    string                    `json:"commit"`
+	Commits   int                       `json:"commits"`
+	Snapshots map[Hash]types.SnapshotID `json:"-"` // git commit -> snapshot
+}
+
+// Import turns rev and all of its ancestors into snapshots, parents first,
+// and records each commit's parents as the snapshot's lineage. Each commit is
+// applied to the engine as a diff against its first parent, so unchanged
+// subtrees are never read. Submodules (gitlinks) are skipped.
+func Import(r *Repo, eng Engine, rev string) (*ImportResult, error) {
+	head, err := r.Resolve(rev)
+	if err != nil {
+		return nil, err
+	}
+	head, err = r.peelToCommit(head)
+	if err != nil {
+		return nil, err
+	}
+	order, commits, err := r.ancestors(head)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &ImportResult{Commit: head.String(), Snapshots: make(map[Hash]types.SnapshotID, len(order))}
+	var last Hash // commit the working set currently holds
+	for _, h := range order {
+		c := commits[h]
+		var base Hash // tree to diff against
+		switch {
+		case len(c.Parents) == 0:
+			eng.Reset()
+		case last != c.Parents[0]:
+			if err := eng.Restore(res.Snapshots[c.Parents[0]]); err != nil {
+				return nil, err
+			}
+			fallthrough
+		default:
+			base = commits[c.Parents[0]].Tree
+		}
+		if err := r.applyDiff(eng, "", base, c.Tree); err != nil {
+			return nil, fmt.Errorf("commit %s: %w", h, err)
+		}
+		id, _, err := eng.Commit(c.Message)
+		if err != nil {
+			return nil, err
+		}
+		parents := make([]types.SnapshotID, 0, len(c.Parents))
+		for _, p := range c.Parents {
+			parents = append(parents, res.Snapshots[p])
+		}
+		if err := eng.SetParents(id, parents); err != nil {
+			return nil, err
+		}
+		res.Snapshots[h] = id
+		last = h
+	}
+	res.Head = res.Snapshots[head]
+	res.Commits = len(order)
+	return res, nil
+}
+
+func (r *Repo) peelToCommit(h Hash) (Hash, error) {
+	for depth := 0; depth < 10; depth++ {
+		typ, data, err := r.ReadObject(h)
+		if err != nil {
+			return h, err
+		}
+		switch typ {
+		case TypeCommit:
+			return h, nil
+		case TypeTag:
+			if h, err = tagTarget(data); err != nil {
+				return h, err
+			}
+			continue
+		}
+		return h, fmt.Errorf("object %s is a %s, not a commit", h, typ)
+	}
+	return h, fmt.Errorf("object %s: too many nested tags", h)
+}
+
+// ancestors returns head and its ancestors with every parent before its
+// children, plus the parsed commits.
+func (r *Repo) ancestors(head Hash) ([]Hash, map[Hash]*Commit, error) {
+	commits := make(map[Hash]*Commit)
+	done := make(map[Hash]bool)
+	var order []Hash
+	type frame struct {
+		h    Hash
+		next int // index of the next parent to visit
+	}
+	stack := []frame{{h: head}}
+	for len(stack) > 0 {
+		top := &stack[len(stack)-1]
+		c, ok := commits[top.h]
+		if !ok {
+			var err error
+			if c, err = r.ReadCommit(top.h); err != nil {
+				return nil, nil, err
+			}
+			commits[top.h] = c
+		}
+		if top.next < len(c.Parents) {
+			p := c.Parents[top.next]
+			top.next++
+			if !done[p] {
+				stack = append(stack, frame{h: p})
+			}
+			continue
+		}
+		stack = stack[:len(stack)-1]
+		if !done[top.h] {
+			done[top.h] = true
+			order = append(order, top.h)
+		}
+	}
+	return order, commits, nil
+}
+
+// applyDiff updates the working set from tree old to tree cur under prefix.
+// A zero hash is the empty tree.
+func (r *Repo) applyDiff(eng Engine, prefix string, old, cur Hash) error {
+	if old == cur {
+		return nil
+	}
+	oldEntries, err := r.readTreeOrEmpty(old)
+	if err != nil {
+		return err
+	}
+	curEntries, err := r.readTreeOrEmpty(cur)
+	if err != nil {
+		return err
+	}
+	before := make(map[string]TreeEntry, len(oldEntries))
+	for _, e := range oldEntries {
+		before[e.Name] = e
+	}
+
+	for _, e := range curEntries {
+		p := path.Join(prefix, e.Name)
+		o, existed := before[e.Name]
+		delete(before, e.Name)
+		if existed && o.Mode == e.Mode && o.Hash == e.Hash {
+			continue
+		}
+		oldTree := Hash{}
+		if existed && o.Mode == ModeTree {
+			oldTree = o.Hash
+		} else if existed {
+			eng.DeleteFile(p)
+		}
+		switch {
+		case e.Mode == ModeTree:
+			if err := r.applyDiff(eng, p, oldTree, e.Hash); err != nil {
+				return err
+			}
+		case e.Mode == ModeGitlink:
+			if err := r.applyDiff(eng, p, oldTree, Hash{}); err != nil {
+				return err
+			}
+		default:
+			if err := r.applyDiff(eng, p, oldTree, Hash{}); err != nil {
+				return err
+			}
+			if err := r.writeBlob(eng, p, e); err != nil {
+				return err
+			}
+		}
+	}
+	for _, o := range before {
+		p := path.Join(prefix, o.Name)
+		if o.Mode == ModeTree {
+			if err := r.applyDiff(eng, p, o.Hash, Hash{}); err != nil {
+				return err
+			}
+		} else {
+			eng.DeleteFile(p)
+		}
+	}
+	return nil
+}
+
+func (r *Repo) readTreeOrEmpty(h Hash) ([]TreeEntry, error) {
+	if h.IsZero() {
+		return nil, nil
+	}
+	return r.ReadTree(h)
+}
+
+func (r *Repo) writeBlob(eng Engine, p string, e TreeEntry) error {
+	typ, data, err := r.ReadObject(e.Hash)
+	if err != nil {
+		return err
+	}
+	if typ != TypeBlob {
+		return fmt.Errorf("%s: object %s is a %s, not a blob", p, e.Hash, typ)
+	}
+	var mode fs.FileMode
+	switch {
+	case e.Mode == ModeSymlink:
+		mode = fs.ModeSymlink | 0o777
+	case e.Mode&0o170000 == 0o100000:
+		mode = fs.FileMode(e.Mode & 0o777)
+	default:
+		return fmt.Errorf("%s: unsupported tree entry mode %o", p, e.Mode)
+	}
+	return eng.WriteFileMode(p, data, mode)
+}
+
+// ExportOptions controls Export.
+type ExportOptions struct {
+	Branch  string    // branch name, or a full ref such as refs/heads/x
+	Message string    // commit message
+	Author  string    // "Name <email>"; defaults to Helios <helios@localhost>
+	When    time.Time // commit time; defaults to now
+}
+
+// ExportResult describes a finished export.
+type ExportResult struct {
+	Ref       string `json:"ref"`
+	Commit    string `json:"commit"`
+	Tree      string `json:"tree"`
+	Parent    string `json:"parent,omitempty"`
+	Unchanged bool   `json:"unchanged,omitempty"`
+}
+
+// linkFS is implemented by file systems that expose symlinks, such as
+// vst.TreeFS.
+type linkFS interface {
+	ReadLink(name string) (string, error)
+}
+
+// Export writes the tree in fsys to the repository and commits it on
+// opts.Branch, on top of the branch's current tip. The ref is moved with a
+// compare-and-swap, so a concurrent update fails with ErrRefChanged instead
+// of being lost. If the tip already has the same tree, nothing is written.
+func Export(r *Repo, fsys fs.FS, opts ExportOptions) (*ExportResult, error) {
+	if opts.Branch == "" {
+		return nil, errors.New("branch is required")
+	}
+	ref := opts.Branch
+	if !strings.HasPrefix(ref, "refs/") {
+		ref = "refs/heads/" + ref
+	}
+	if err := checkRefName(ref); err != nil {
+		return nil, err
+	}
+
+	tree, err := r.writeTree(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	res := &ExportResult{Ref: ref, Tree: tree.String()}
+
+	tip, err := r.ReadRef(ref)
+	if errors.Is(err, ErrNotFound) {
+		tip, err = Hash{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := &Commit{Tree: tree}
+	if !tip.IsZero() {
+		res.Parent = tip.String()
+		prev, err := r.ReadCommit(tip)
+		if err != nil {
+			return nil, err
+		}
+		if prev.Tree == tree {
+			res.Commit, res.Unchanged = tip.String(), true
+			return res, nil
+		}
+		c.Parents = []Hash{tip}
+	}
+
+	author := opts.Author
+	if author == "" {
+		author = "Helios <helios@localhost>"
+	}
+	when := opts.When
+	if when.IsZero() {
+		when = time.Now()
+	}
+	c.Author = fmt.Sprintf("%s %d %s", author, when.Unix(), when.Format("-0700"))
+	c.Committer = c.Author
+	c.Message = opts.Message
+	if !strings.HasSuffix(c.Message, "\n") {
+		c.Message += "\n"
+	}
+
+	h, err := r.WriteObject(TypeCommit, EncodeCommit(c))
+	if err != nil {
+		return nil, err
+	}
+	if err := r.UpdateRef(ref, h, tip); err != nil {
+		return nil, err
+	}
+	res.Commit = h.String()
+	return res, nil
+}
+
+// writeTree stores dir of fsys and everything under it, returning the tree's
+// name. Git cannot record empty directories, so they are left out.
+func (r *Repo) writeTree(fsys fs.FS, dir string) (Hash, error) {
+	ents, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return Hash{}, err
+	}
+	links, _ := fsys.(linkFS)
+	var entries []TreeEntry
+	for _, d := range ents {
+		name := path.Join(dir, d.Name())
+		var (
+			e    = TreeEntry{Name: d.Name()}
+			data []byte
+		)
+		switch {
+		case d.IsDir():
+			if e.Hash, err = r.writeTree(fsys, name); err != nil {
+				return Hash{}, err
+			}
+			if e.Hash == emptyTree {
+				continue
+			}
+			e.Mode = ModeTree
+			entries = append(entries, e)
+			continue
+		case d.Type() == fs.ModeSymlink && links != nil:
+			target, err := links.ReadLink(name)
+			if err != nil {
+				return Hash{}, err
+			}
+			e.Mode, data = ModeSymlink, []byte(target)
+		default:
+			info, err := fs.Stat(fsys, name)
+			if err != nil {
+				return Hash{}, err
+			}
+			e.Mode = ModeFile
+			if info.Mode().Perm()&0o111 != 0 {
+				e.Mode = ModeExec
+			}
+			if data, err = fs.ReadFile(fsys, name); err != nil {
+				return Hash{}, err
+			}
+		}
+		if e.Hash, err = r.WriteObject(TypeBlob, data); err != nil {
+			return Hash{}, err
+		}
+		entries = append(entries, e)
+	}
+	return r.WriteObject(TypeTree, EncodeTree(entries))
+}
+
+// emptyTree is the name of the tree object with no entries.
+var emptyTree = HashObject(TypeTree, nil)
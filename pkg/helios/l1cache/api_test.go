@@ -0,0 +1,180 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package l1cache_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/good-night-oppie/helios/pkg/helios/l1cache"
+)
+
+func TestCache_DeleteAndContains(t *testing.T) {
+	c := newPolicyCache(t, l1cache.ARC, 1000)
+	c.Put(keyN(1), bytes.Repeat([]byte{1}, 100))
+
+	if !c.Contains(keyN(1)) || c.Contains(keyN(2)) {
+		t.Fatal("Contains disagrees with cache contents")
+	}
+	if st := c.Stats(); st.Hits != 0 || st.Misses != 0 {
+		t.Fatalf("Contains counted lookups: %+v", st)
+	}
+	if !c.Delete(keyN(1)) {
+		t.Fatal("Delete of cached entry reported false")
+	}
+	if c.Delete(keyN(1)) || c.Contains(keyN(1)) {
+		t.Fatal("entry still present after Delete")
+	}
+	if st := c.Stats(); st.Items != 0 || st.SizeBytes != 0 || st.Evictions != 0 {
+		t.Fatalf("stats after Delete: %+v", st)
+	}
+}
+
+func TestCache_PinSurvivesEviction(t *testing.T) {
+	for _, p := range []l1cache.Policy{l1cache.ARC, l1cache.LRU, l1cache.FIFO} {
+		t.Run(p.String(), func(t *testing.T) {
+			c := newPolicyCache(t, p, 1000)
+			access(c, 0)
+			if !c.Pin(keyN(0)) || !c.Pin(keyN(0)) {
+				t.Fatal("Pin of cached entry reported false")
+			}
+			if c.Pin(keyN(99)) {
+				t.Fatal("Pin of missing entry reported true")
+			}
+			for i := 1; i < 100; i++ {
+				access(c, i)
+			}
+			if !c.Contains(keyN(0)) {
+				t.Fatal("pinned entry was evicted")
+			}
+			if st := c.Stats(); st.Pinned != 1 || st.SizeBytes > 1000 {
+				t.Fatalf("stats: %+v", st)
+			}
+
+			// Pins nest: one Unpin leaves the entry protected.
+			c.Unpin(keyN(0))
+			for i := 100; i < 200; i++ {
+				access(c, i)
+			}
+			if !c.Contains(keyN(0)) {
+				t.Fatal("entry evicted while still pinned once")
+			}
+			c.Unpin(keyN(0))
+			if c.Unpin(keyN(0)) {
+				t.Fatal("Unpin of unpinned entry reported true")
+			}
+			for i := 200; i < 300; i++ {
+				access(c, i)
+			}
+			if c.Contains(keyN(0)) {
+				t.Fatal("unpinned entry was never evicted")
+			}
+			if st := c.Stats(); st.Pinned != 0 {
+				t.Fatalf("Pinned = %d after Unpin", st.Pinned)
+			}
+		})
+	}
+}
+
+func TestCache_PinnedCapacityRejectsPut(t *testing.T) {
+	c := newPolicyCache(t, l1cache.LRU, 300)
+	for i := 0; i < 3; i++ {
+		access(c, i)
+		c.Pin(keyN(i))
+	}
+	if n, _ := c.Put(keyN(3), bytes.Repeat([]byte{3}, 100)); n != 0 {
+		t.Fatalf("Put stored %d bytes with every entry pinned", n)
+	}
+	if st := c.Stats(); st.Items != 3 || st.Evictions != 0 {
+		t.Fatalf("stats: %+v", st)
+	}
+
+	// Replacing a pinned entry keeps it pinned.
+	c.Put(keyN(0), bytes.Repeat([]byte{9}, 50))
+	if st := c.Stats(); st.Pinned != 3 {
+		t.Fatalf("Pinned = %d after replacing a pinned entry", st.Pinned)
+	}
+	if !c.Delete(keyN(0)) {
+		t.Fatal("Delete of pinned entry reported false")
+	}
+	if st := c.Stats(); st.Pinned != 2 || st.Items != 2 {
+		t.Fatalf("stats after deleting pinned entry: %+v", st)
+	}
+}
+
+func TestCache_ReplacingPinnedEntryThatNoLongerFits(t *testing.T) {
+	c := newPolicyCache(t, l1cache.LRU, 100)
+	c.Put(keyN(1), bytes.Repeat([]byte{1}, 40))
+	c.Put(keyN(2), bytes.Repeat([]byte{2}, 40))
+	c.Pin(keyN(1))
+	c.Pin(keyN(2))
+
+	if n, _ := c.Put(keyN(1), bytes.Repeat([]byte{9}, 70)); n != 0 {
+		t.Fatalf("Put stored %d bytes past pinned capacity", n)
+	}
+	if st := c.Stats(); st.Pinned != 2 || st.Items != 2 || st.SizeBytes != 80 {
+		t.Fatalf("stats after rejected replacement: %+v", st)
+	}
+	if got, ok := c.Get(keyN(1)); !ok || !bytes.Equal(got, bytes.Repeat([]byte{1}, 40)) {
+		t.Fatal("pinned entry lost by a rejected replacement")
+	}
+	c.Unpin(keyN(2))
+	if st := c.Stats(); st.Pinned != 1 {
+		t.Fatalf("Pinned = %d after Unpin", st.Pinned)
+	}
+
+	// With B unpinned there is room: A is replaced and stays pinned.
+	if n, _ := c.Put(keyN(1), bytes.Repeat([]byte{9}, 70)); n != 70 {
+		t.Fatalf("Put stored %d bytes", n)
+	}
+	if st := c.Stats(); st.Pinned != 1 || st.SizeBytes != 70 || c.Contains(keyN(2)) {
+		t.Fatalf("stats after replacement: %+v", st)
+	}
+}
+
+func TestCache_TTL(t *testing.T) {
+	c := newPolicyCache(t, l1cache.ARC, 1000)
+	c.PutTTL(keyN(1), []byte("short"), 20*time.Millisecond)
+	c.PutTTL(keyN(2), []byte("forever"), 0)
+	c.Pin(keyN(1))
+
+	if _, ok := c.Get(keyN(1)); !ok {
+		t.Fatal("entry missing before its TTL")
+	}
+	time.Sleep(40 * time.Millisecond)
+
+	if c.Contains(keyN(1)) {
+		t.Fatal("expired entry still reported by Contains")
+	}
+	if _, ok := c.Get(keyN(1)); ok {
+		t.Fatal("expired entry returned by Get")
+	}
+	if _, ok := c.Get(keyN(2)); !ok {
+		t.Fatal("entry without TTL expired")
+	}
+	st := c.Stats()
+	if st.Expirations != 1 || st.Items != 1 || st.Pinned != 0 || st.Misses != 1 {
+		t.Fatalf("stats: %+v", st)
+	}
+
+	// A plain Put clears an earlier TTL.
+	c.PutTTL(keyN(3), []byte("x"), 20*time.Millisecond)
+	c.Put(keyN(3), []byte("x"))
+	time.Sleep(40 * time.Millisecond)
+	if !c.Contains(keyN(3)) {
+		t.Fatal("Put did not clear the TTL")
+	}
+}
@@ -0,0 +1,201 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package l1cache
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"runtime"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// DefaultDictSize is the dictionary size TrainDict aims for when size ≤ 0.
+const DefaultDictSize = 64 << 10
+
+// Training parameters: content is picked in segments of segLen bytes, scored
+// by how many samples share each of their dmerLen-byte substrings.
+const (
+	dmerLen   = 8
+	segLen    = 256
+	segStride = segLen / 2
+	freqBits  = 20
+)
+
+// TrainDict builds a zstd dictionary with the given ID from samples, which
+// should be representative blobs such as the small source files of a
+// repository. The result can be passed in Config.Dicts and is understood by
+// any zstd decoder given the same dictionary. ID must be non-zero.
+func TrainDict(id uint32, samples [][]byte, size int) (d []byte, err error) {
+	if id == 0 {
+		return nil, errors.New("l1cache: dictionary ID must be non-zero")
+	}
+	if size <= 0 {
+		size = DefaultDictSize
+	}
+	var contents [][]byte
+	for _, s := range samples {
+		if len(s) >= dmerLen {
+			contents = append(contents, s)
+		}
+	}
+	if len(contents) < 2 {
+		return nil, errors.New("l1cache: need at least two samples to train a dictionary")
+	}
+	hist := selectSegments(contents, size)
+	if len(hist) < dmerLen {
+		return nil, errors.New("l1cache: samples share no content to build a dictionary from")
+	}
+	// BuildDict divides by zero when the samples yield under 512 sequences;
+	// any other panic is a bug and is left alone.
+	defer func() {
+		if r := recover(); r != nil {
+			if re, ok := r.(runtime.Error); !ok || re.Error() != "runtime error: integer divide by zero" {
+				panic(r)
+			}
+			d, err = nil, errors.New("l1cache: too little sample content to build a dictionary")
+		}
+	}()
+	d, err = zstd.BuildDict(zstd.BuildDictOptions{
+		ID:       id,
+		Contents: contents,
+		History:  hist,
+		Offsets:  [3]int{1, 4, 8},
+		Level:    zstd.SpeedDefault,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("l1cache: build dictionary: %w", err)
+	}
+	return d, nil
+}
+
+// DictID returns the ID of a zstd dictionary, or 0 if d is not one.
+func DictID(d []byte) uint32 {
+	info, err := zstd.InspectDictionary(d)
+	if err != nil {
+		return 0
+	}
+	return info.ID()
+}
+
+type segment struct {
+	sample, off int
+	score       int
+}
+
+type segHeap []segment
+
+func (h segHeap) Len() int           { return len(h) }
+func (h segHeap) Less(i, j int) bool { return h[i].score > h[j].score }
+func (h segHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *segHeap) Push(x any)        { *h = append(*h, x.(segment)) }
+func (h *segHeap) Pop() any {
+	old := *h
+	s := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return s
+}
+
+// selectSegments greedily picks the segments covering the most substrings
+// shared between samples, in the manner of zstd's COVER trainer, and lays
+// them out best-last so the most useful content sits at the smallest offsets.
+func selectSegments(samples [][]byte, size int) []byte {
+	// freq[h] counts samples containing a dmer hashing to h.
+	freq := make([]uint32, 1<<freqBits)
+	seen := make([]int32, 1<<freqBits)
+	for i := range seen {
+		seen[i] = -1
+	}
+	for i, s := range samples {
+		for p := 0; p+dmerLen <= len(s); p++ {
+			h := dmerHash(s[p:])
+			if seen[h] != int32(i) {
+				seen[h] = int32(i)
+				freq[h]++
+			}
+		}
+	}
+
+	stamp := int32(0)
+	for i := range seen {
+		seen[i] = -1
+	}
+	score := func(sg segment) int {
+		s := samples[sg.sample]
+		end := min(sg.off+segLen, len(s))
+		stamp++
+		n := 0
+		for p := sg.off; p+dmerLen <= end; p++ {
+			h := dmerHash(s[p:])
+			if seen[h] == stamp {
+				continue
+			}
+			seen[h] = stamp
+			if f := freq[h]; f > 1 {
+				n += int(f)
+			}
+		}
+		return n
+	}
+
+	var h segHeap
+	for i, s := range samples {
+		for off := 0; off+dmerLen <= len(s); off += segStride {
+			sg := segment{sample: i, off: off}
+			if sg.score = score(sg); sg.score > 0 {
+				h = append(h, sg)
+			}
+		}
+	}
+	heap.Init(&h)
+
+	var picked []segment
+	total := 0
+	for h.Len() > 0 && total < size {
+		sg := heap.Pop(&h).(segment)
+		// Scores only fall as content is covered; re-check lazily.
+		if sg.score = score(sg); sg.score == 0 {
+			continue
+		}
+		if h.Len() > 0 && sg.score < h[0].score {
+			heap.Push(&h, sg)
+			continue
+		}
+		s := samples[sg.sample]
+		end := min(sg.off+segLen, len(s))
+		for p := sg.off; p+dmerLen <= end; p++ {
+			freq[dmerHash(s[p:])] = 0
+		}
+		picked = append(picked, sg)
+		total += end - sg.off
+	}
+
+	out := make([]byte, 0, total)
+	for i := len(picked) - 1; i >= 0; i-- {
+		sg := picked[i]
+		s := samples[sg.sample]
+		out = append(out, s[sg.off:min(sg.off+segLen, len(s))]...)
+	}
+	if len(out) > size {
+		out = out[len(out)-size:]
+	}
+	return out
+}
+
+func dmerHash(b []byte) uint32 {
+	return uint32((binary.LittleEndian.Uint64(b) * 0x9E3779B97F4A7C15) >> (64 - freqBits))
+}
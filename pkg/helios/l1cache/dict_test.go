@@ -0,0 +1,113 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package l1cache_test
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/good-night-oppie/helios/pkg/helios/l1cache"
+)
+
+// sourceFiles returns n small Go-like files sharing boilerplate but not
+// contents, the case dictionaries are meant for.
+func sourceFiles(rng *rand.Rand, n int) [][]byte {
+	words := []string{"snapshot", "blob", "tree", "commit", "ref", "index", "store", "cache", "entry", "path"}
+	out := make([][]byte, n)
+	for i := range out {
+		var b bytes.Buffer
+		b.WriteString("// Copyright 2025 Oppie Thunder Contributors\n//\n// Licensed under the Apache License, Version 2.0 (the \"License\");\n// you may not use this file except in compliance with the License.\n\n")
+		fmt.Fprintf(&b, "package %s\n\nimport (\n\t\"errors\"\n\t\"fmt\"\n)\n\n", words[rng.Intn(len(words))])
+		for j := 0; j < 2+rng.Intn(3); j++ {
+			w := words[rng.Intn(len(words))]
+			fmt.Fprintf(&b, "func (s *%sStore) Get%s%d(id string) (*%s, error) {\n\tif id == \"\" {\n\t\treturn nil, errors.New(\"empty id\")\n\t}\n\treturn nil, fmt.Errorf(\"%s %%s: %d\", id)\n}\n\n", w, w, rng.Intn(1000), w, w, rng.Int())
+		}
+		out[i] = b.Bytes()
+	}
+	return out
+}
+
+func TestTrainDict_ImprovesSmallBlobRatio(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	train, files := sourceFiles(rng, 300), sourceFiles(rng, 200)
+
+	dict, err := l1cache.TrainDict(40000, train, 16<<10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := l1cache.DictID(dict); id != 40000 {
+		t.Fatalf("DictID = %d", id)
+	}
+
+	ratio := func(dicts [][]byte) float64 {
+		c, err := l1cache.New(l1cache.Config{CapacityBytes: 64 << 20, Dicts: dicts})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, f := range files {
+			c.Put(keyN(i), f)
+		}
+		for i, f := range files {
+			got, ok := c.Get(keyN(i))
+			if !ok || !bytes.Equal(got, f) {
+				t.Fatalf("file %d did not round-trip", i)
+			}
+		}
+		return c.Stats().CompressionRatio
+	}
+	plain, trained := ratio(nil), ratio([][]byte{dict})
+	t.Logf("compression ratio: plain %.2f, dictionary %.2f", plain, trained)
+	if trained < 1.5*plain {
+		t.Fatalf("dictionary ratio %.2f not well above plain %.2f", trained, plain)
+	}
+}
+
+func TestCache_SeveralDicts(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	d1, err := l1cache.TrainDict(40000, sourceFiles(rng, 100), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d2, err := l1cache.TrainDict(40001, sourceFiles(rng, 100), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := l1cache.New(l1cache.Config{CapacityBytes: 1 << 20, Dicts: [][]byte{d2, d1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := sourceFiles(rng, 1)[0]
+	c.Put(keyN(1), f)
+	if got, ok := c.Get(keyN(1)); !ok || !bytes.Equal(got, f) {
+		t.Fatal("entry did not round-trip")
+	}
+}
+
+func TestTrainDict_Errors(t *testing.T) {
+	if _, err := l1cache.TrainDict(0, sourceFiles(rand.New(rand.NewSource(3)), 10), 0); err == nil {
+		t.Fatal("ID 0 accepted")
+	}
+	if _, err := l1cache.TrainDict(40000, [][]byte{[]byte("only one sample")}, 0); err == nil {
+		t.Fatal("single sample accepted")
+	}
+	if _, err := l1cache.TrainDict(40000, [][]byte{[]byte("tiny sample one"), []byte("tiny sample two")}, 0); err == nil {
+		t.Fatal("trained from too little content")
+	}
+	if _, err := l1cache.New(l1cache.Config{CapacityBytes: 1 << 20, Dicts: [][]byte{[]byte("not a dictionary")}}); err == nil {
+		t.Fatal("New accepted an invalid dictionary")
+	}
+}
@@ -0,0 +1,535 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package l1cache
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// DefaultFileBytes is the data size of a file-backed tier when
+// Config.FileBytes is 0.
+const DefaultFileBytes = 64 << 20
+
+// File layout: a header page, a bucketed index, then the data region, which
+// is a ring of records written at head and evicted at tail. head and tail
+// are logical offsets that only grow; a record's place in the region is its
+// offset modulo the region size.
+const (
+	fileMagic   = "HELIOSL1"
+	fileVersion = 1
+	headerSize  = 4096
+
+	// Header fields, each a native-endian uint64 accessed atomically.
+	hVersion     = 8
+	hDirty       = 16 // set while a writer is mid-update; a crash leaves it set
+	hDataSize    = 24
+	hBuckets     = 32
+	hHead        = 40
+	hTail        = 48
+	hItems       = 56
+	hBytes       = 64
+	hRawBytes    = 72
+	hHits        = 80
+	hMisses      = 88
+	hExpirations = 96
+
+	// Each bucket holds slotsPerBucket slots of {key hash, offset+1}.
+	slotsPerBucket = 8
+	slotSize       = 16
+	bytesPerSlot   = 512 // data bytes per index slot when sizing the index
+
+	// Record header: magic u32, key length u16, flags u8, pad u8, data
+	// length u32, raw length u32, expiry i64, CRC-32C of key and data u32,
+	// reserved u32. Records are 8-byte aligned.
+	recHeader     = 32
+	recMagic      = 0x31524c48 // "HLR1"
+	recCompressed = 1
+	recPad        = 2 // filler up to the end of the region
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// fileTier is the persistent part of a file-backed cache. Processes sharing
+// the file coordinate with flock: lookups hold it shared, updates exclusive.
+type fileTier struct {
+	mu sync.RWMutex // updates hold it exclusively, lookups shared
+
+	lk      sync.Mutex // guards readers
+	readers int        // lookups sharing this process's flock
+
+	f       *os.File
+	m       []byte
+	idx     []byte
+	data    []byte
+	size    uint64 // len(data)
+	buckets uint64
+}
+
+type record struct {
+	off        uint64 // logical offset
+	key        []byte
+	data       []byte
+	rawSize    int
+	compressed bool
+	expires    int64
+	crc        uint32
+	size       uint64 // including header and alignment
+	pad        bool
+}
+
+func openFileTier(path string, dataSize int64) (*fileTier, error) {
+	if dataSize <= 0 {
+		dataSize = DefaultFileBytes
+	}
+	dataSize = (dataSize + 7) &^ 7
+	slots := max(dataSize/bytesPerSlot, slotsPerBucket)
+	buckets := uint64(slots / slotsPerBucket)
+	total := headerSize + int64(buckets)*slotsPerBucket*slotSize + dataSize
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	t, err := mapTier(f, total, uint64(dataSize), buckets)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("l1cache: open %s: %w", path, err)
+	}
+	return t, nil
+}
+
+// errGeometry reports a file that holds a tier of another size or version.
+var errGeometry = errors.New("file holds a cache of another size or version; remove it to start over")
+
+// mapTier maps f, formatting it first if it is empty or was left mid-format.
+// A file of any other size or geometry is refused rather than resized, as
+// other processes may have it mapped and would fault on a shrunk mapping.
+func mapTier(f *os.File, total int64, dataSize, buckets uint64) (*fileTier, error) {
+	if err := lockFile(f, true); err != nil {
+		return nil, err
+	}
+	defer unlockFile(f)
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	fresh := fi.Size() == 0
+	switch {
+	case fresh:
+		// Growing is safe for other mappings; the file is sparse until written.
+		if err := f.Truncate(total); err != nil {
+			return nil, err
+		}
+	case fi.Size() != total:
+		return nil, errGeometry
+	default:
+		hdr := make([]byte, headerSize)
+		if _, err := f.ReadAt(hdr, 0); err != nil {
+			return nil, err
+		}
+		if string(hdr[:len(fileMagic)]) != fileMagic {
+			fresh = true // a torn format, since the magic is written last
+		} else if nativeU64(hdr, hVersion) != fileVersion ||
+			nativeU64(hdr, hDataSize) != dataSize ||
+			nativeU64(hdr, hBuckets) != buckets {
+			return nil, errGeometry
+		}
+	}
+	m, err := mapFile(f, int(total))
+	if err != nil {
+		return nil, err
+	}
+	idxEnd := headerSize + buckets*slotsPerBucket*slotSize
+	t := &fileTier{
+		f:       f,
+		m:       m,
+		idx:     m[headerSize:idxEnd],
+		data:    m[idxEnd:],
+		size:    dataSize,
+		buckets: buckets,
+	}
+	if fresh {
+		clear(m[:idxEnd])
+		t.store(hVersion, fileVersion)
+		t.store(hDataSize, dataSize)
+		t.store(hBuckets, buckets)
+		copy(m, fileMagic) // last, so a torn format is reformatted
+	}
+	return t, nil
+}
+
+func nativeU64(b []byte, off int) uint64 { return *(*uint64)(unsafe.Pointer(&b[off])) }
+
+func (t *fileTier) field(off int) *uint64 { return (*uint64)(unsafe.Pointer(&t.m[off])) }
+func (t *fileTier) load(off int) uint64   { return atomic.LoadUint64(t.field(off)) }
+func (t *fileTier) store(off int, v uint64) {
+	atomic.StoreUint64(t.field(off), v)
+}
+func (t *fileTier) add(off int, d int64) { atomic.AddUint64(t.field(off), uint64(d)) }
+
+func (t *fileTier) close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.m == nil {
+		return nil
+	}
+	err := unmapFile(t.m)
+	t.m, t.idx, t.data = nil, nil, nil
+	if cerr := t.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// rlock takes the tier for a lookup. Goroutines share one flock, taken by
+// the first and released by the last, since flock is per open file.
+func (t *fileTier) rlock() error {
+	t.mu.RLock()
+	if t.m == nil {
+		t.mu.RUnlock()
+		return errors.New("l1cache: file-backed cache is closed")
+	}
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	if t.readers == 0 {
+		if err := lockFile(t.f, false); err != nil {
+			t.mu.RUnlock()
+			return err
+		}
+	}
+	t.readers++
+	return nil
+}
+
+func (t *fileTier) runlock() {
+	t.lk.Lock()
+	t.readers--
+	if t.readers == 0 {
+		unlockFile(t.f)
+	}
+	t.lk.Unlock()
+	t.mu.RUnlock()
+}
+
+// lock takes the tier for an update, resetting it if an earlier writer died
+// mid-update, and marks it dirty until unlock.
+func (t *fileTier) lock() error {
+	t.mu.Lock()
+	if t.m == nil {
+		t.mu.Unlock()
+		return errors.New("l1cache: file-backed cache is closed")
+	}
+	if err := lockFile(t.f, true); err != nil {
+		t.mu.Unlock()
+		return err
+	}
+	if t.load(hDirty) != 0 {
+		t.reset()
+	}
+	t.store(hDirty, 1)
+	return nil
+}
+
+func (t *fileTier) unlock() {
+	t.store(hDirty, 0)
+	unlockFile(t.f)
+	t.mu.Unlock()
+}
+
+// reset empties the tier, keeping its hit and miss history.
+func (t *fileTier) reset() {
+	clear(t.idx)
+	for _, f := range []int{hHead, hTail, hItems, hBytes, hRawBytes} {
+		t.store(f, 0)
+	}
+}
+
+func keyHash(k []byte) uint64 {
+	x := uint64(14695981039346656037)
+	for _, b := range k {
+		x ^= uint64(b)
+		x *= 1099511628211
+	}
+	return x
+}
+
+func (t *fileTier) slot(h uint64, i int) []byte {
+	b := (h % t.buckets) * slotsPerBucket
+	off := (b + uint64(i)) * slotSize
+	return t.idx[off : off+slotSize]
+}
+
+// live reports whether the record at logical offset off has not been
+// overwritten.
+func (t *fileTier) live(off uint64) bool {
+	return off >= t.load(hTail) && off < t.load(hHead)
+}
+
+// read parses the record at logical offset off, or reports false if the
+// bytes there are not a well-formed record.
+func (t *fileTier) read(off uint64) (record, bool) {
+	p := off % t.size
+	if t.size-p < recHeader {
+		return record{}, false
+	}
+	h := t.data[p : p+recHeader]
+	if binary.LittleEndian.Uint32(h) != recMagic {
+		return record{}, false
+	}
+	r := record{off: off}
+	flags := h[6]
+	if flags&recPad != 0 {
+		r.size, r.pad = t.size-p, true
+		return r, true
+	}
+	kl := uint64(binary.LittleEndian.Uint16(h[4:]))
+	dl := uint64(binary.LittleEndian.Uint32(h[8:]))
+	r.size = (recHeader + kl + dl + 7) &^ 7
+	if r.size > t.size-p {
+		return record{}, false
+	}
+	body := t.data[p+recHeader : p+recHeader+kl+dl]
+	r.key, r.data = body[:kl], body[kl:]
+	r.rawSize = int(binary.LittleEndian.Uint32(h[12:]))
+	r.compressed = flags&recCompressed != 0
+	r.expires = int64(binary.LittleEndian.Uint64(h[16:]))
+	r.crc = binary.LittleEndian.Uint32(h[24:])
+	return r, true
+}
+
+// find returns the live record for key k and its slot.
+func (t *fileTier) find(k []byte) (record, []byte, bool) {
+	h := keyHash(k)
+	for i := 0; i < slotsPerBucket; i++ {
+		s := t.slot(h, i)
+		loc := binary.LittleEndian.Uint64(s[8:])
+		if loc == 0 || binary.LittleEndian.Uint64(s) != h || !t.live(loc-1) {
+			continue
+		}
+		r, ok := t.read(loc - 1)
+		if ok && string(r.key) == string(k) {
+			return r, s, true
+		}
+	}
+	return record{}, nil, false
+}
+
+// get copies out the record for k. Expired records are reported absent.
+func (t *fileTier) get(k string, now int64) (record, bool) {
+	if t.rlock() != nil {
+		return record{}, false
+	}
+	defer t.runlock()
+	if t.load(hDirty) != 0 {
+		return record{}, false
+	}
+	r, _, ok := t.find([]byte(k))
+	if !ok || (r.expires != 0 && now >= r.expires) {
+		return record{}, false
+	}
+	if crc32.Update(crc32.Checksum(r.key, crcTable), crcTable, r.data) != r.crc {
+		return record{}, false
+	}
+	r.data = append([]byte(nil), r.data...)
+	r.key = nil
+	return r, true
+}
+
+func (t *fileTier) contains(k string, now int64) bool {
+	if t.rlock() != nil {
+		return false
+	}
+	defer t.runlock()
+	if t.load(hDirty) != 0 {
+		return false
+	}
+	r, _, ok := t.find([]byte(k))
+	return ok && (r.expires == 0 || now < r.expires)
+}
+
+func (t *fileTier) delete(k string) bool {
+	if t.lock() != nil {
+		return false
+	}
+	defer t.unlock()
+	r, s, ok := t.find([]byte(k))
+	if ok {
+		t.drop(r, s)
+	}
+	return ok
+}
+
+// drop forgets r, whose index slot is s.
+func (t *fileTier) drop(r record, s []byte) {
+	clear(s)
+	t.add(hItems, -1)
+	t.add(hBytes, -int64(len(r.data)))
+	t.add(hRawBytes, -int64(r.rawSize))
+}
+
+// put appends a record for k, evicting the oldest records to make room.
+func (t *fileTier) put(k string, data []byte, rawSize int, compressed bool, expires int64) bool {
+	need := uint64(recHeader+len(k)+len(data)+7) &^ 7
+	if need > t.size || len(k) > 0xffff {
+		return false
+	}
+	if t.lock() != nil {
+		return false
+	}
+	defer t.unlock()
+
+	kb := []byte(k)
+	if r, s, ok := t.find(kb); ok {
+		t.drop(r, s)
+	}
+
+	head := t.load(hHead)
+	at := head
+	if rem := t.size - head%t.size; rem < need {
+		at += rem // wrap, leaving a pad record if there is room for one
+	}
+	if end := at + need; end-t.load(hTail) > t.size {
+		if !t.evictTo(end - t.size) {
+			t.reset()
+			head, at = 0, 0
+		}
+	}
+	if at != head && t.size-head%t.size >= recHeader {
+		p := head % t.size
+		clear(t.data[p : p+recHeader])
+		binary.LittleEndian.PutUint32(t.data[p:], recMagic)
+		t.data[p+6] = recPad
+	}
+
+	p := at % t.size
+	h := t.data[p : p+recHeader]
+	binary.LittleEndian.PutUint32(h, recMagic)
+	binary.LittleEndian.PutUint16(h[4:], uint16(len(k)))
+	h[6], h[7] = 0, 0
+	if compressed {
+		h[6] = recCompressed
+	}
+	binary.LittleEndian.PutUint32(h[8:], uint32(len(data)))
+	binary.LittleEndian.PutUint32(h[12:], uint32(rawSize))
+	binary.LittleEndian.PutUint64(h[16:], uint64(expires))
+	binary.LittleEndian.PutUint32(h[24:], crc32.Update(crc32.Checksum(kb, crcTable), crcTable, data))
+	binary.LittleEndian.PutUint32(h[28:], 0)
+	copy(t.data[p+recHeader:], kb)
+	copy(t.data[p+recHeader+uint64(len(k)):], data)
+	t.store(hHead, at+need)
+
+	// Claim a slot: a free or stale one, else the bucket's oldest entry.
+	kh := keyHash(kb)
+	var s []byte
+	oldest := uint64(1<<64 - 1)
+	for i := 0; i < slotsPerBucket; i++ {
+		c := t.slot(kh, i)
+		loc := binary.LittleEndian.Uint64(c[8:])
+		if loc == 0 || !t.live(loc-1) {
+			s = c
+			break
+		}
+		if loc < oldest {
+			oldest, s = loc, c
+		}
+	}
+	if loc := binary.LittleEndian.Uint64(s[8:]); loc != 0 && t.live(loc-1) {
+		if r, ok := t.read(loc - 1); ok {
+			t.drop(r, s)
+		}
+	}
+	binary.LittleEndian.PutUint64(s, kh)
+	binary.LittleEndian.PutUint64(s[8:], at+1)
+	t.add(hItems, 1)
+	t.add(hBytes, int64(len(data)))
+	t.add(hRawBytes, int64(rawSize))
+	return true
+}
+
+// evictTo advances tail to at least to, dropping the records it passes.
+// It reports false if it meets a malformed record.
+func (t *fileTier) evictTo(to uint64) bool {
+	tail, head := t.load(hTail), t.load(hHead)
+	for tail < to {
+		if tail >= head {
+			tail = to
+			break
+		}
+		if rem := t.size - tail%t.size; rem < recHeader {
+			tail += rem
+			continue
+		}
+		r, ok := t.read(tail)
+		if !ok {
+			return false
+		}
+		if !r.pad {
+			h := keyHash(r.key)
+			for i := 0; i < slotsPerBucket; i++ {
+				s := t.slot(h, i)
+				if binary.LittleEndian.Uint64(s[8:]) == tail+1 {
+					t.drop(r, s)
+					break
+				}
+			}
+		}
+		tail += r.size
+	}
+	t.store(hTail, tail)
+	return true
+}
+
+// fileStats are the tier's persisted counters.
+type fileStats struct {
+	hits, misses, expirations uint64
+	items, bytes, rawBytes    uint64
+}
+
+func (t *fileTier) stats() fileStats {
+	if t.rlock() != nil {
+		return fileStats{}
+	}
+	defer t.runlock()
+	return fileStats{
+		hits:        t.load(hHits),
+		misses:      t.load(hMisses),
+		expirations: t.load(hExpirations),
+		items:       t.load(hItems),
+		bytes:       t.load(hBytes),
+		rawBytes:    t.load(hRawBytes),
+	}
+}
+
+// count adds to a persisted counter. The add is atomic, so the shared flock
+// is enough.
+func (t *fileTier) count(field int) {
+	if t.rlock() != nil {
+		return
+	}
+	t.add(field, 1)
+	t.runlock()
+}
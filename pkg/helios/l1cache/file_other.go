@@ -0,0 +1,34 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux
+
+package l1cache
+
+import (
+	"errors"
+	"os"
+)
+
+// The file-backed tier is only implemented on Linux; New fails when
+// Config.File is set elsewhere.
+var errFileUnsupported = errors.New("l1cache: file-backed cache is only supported on Linux")
+
+func mapFile(f *os.File, size int) ([]byte, error) { return nil, errFileUnsupported }
+
+func unmapFile(b []byte) error { return nil }
+
+func lockFile(f *os.File, exclusive bool) error { return errFileUnsupported }
+
+func unlockFile(f *os.File) error { return nil }
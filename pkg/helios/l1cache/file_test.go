@@ -0,0 +1,234 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package l1cache_test
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/good-night-oppie/helios/pkg/helios/l1cache"
+)
+
+func openFileCache(t *testing.T, path string, fileBytes int64) l1cache.Cache {
+	t.Helper()
+	if runtime.GOOS != "linux" {
+		t.Skip("file-backed cache is Linux only")
+	}
+	c, err := l1cache.New(l1cache.Config{CapacityBytes: 1 << 20, File: path, FileBytes: fileBytes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func blobN(n, size int) []byte {
+	b := make([]byte, size)
+	rand.New(rand.NewSource(int64(n))).Read(b)
+	return b
+}
+
+func TestFile_SurvivesReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "l1")
+	c := openFileCache(t, path, 0)
+	for i := 0; i < 100; i++ {
+		c.Put(keyN(i), bytes.Repeat([]byte{byte(i)}, 1000))
+	}
+	c.Get(keyN(1))
+	c.Get(keyN(1000))
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	c = openFileCache(t, path, 0)
+	if st := c.Stats(); st.Hits != 1 || st.Misses != 1 || st.FileItems != 100 || st.Items != 0 {
+		t.Fatalf("stats after reopen: %+v", st)
+	}
+	for i := 0; i < 100; i++ {
+		got, ok := c.Get(keyN(i))
+		if !ok || !bytes.Equal(got, bytes.Repeat([]byte{byte(i)}, 1000)) {
+			t.Fatalf("entry %d lost across reopen", i)
+		}
+	}
+	st := c.Stats()
+	if st.Hits != 101 || st.Items != 100 || st.CompressionRatio < 10 {
+		t.Fatalf("stats: %+v", st)
+	}
+}
+
+func TestFile_RingKeepsNewest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "l1")
+	c := openFileCache(t, path, 64<<10)
+	for i := 0; i < 500; i++ {
+		c.Put(keyN(i), blobN(i, 1000+i%300))
+	}
+	c.Close()
+
+	c = openFileCache(t, path, 64<<10)
+	st := c.Stats()
+	if st.FileBytes > 64<<10 || st.FileItems < 40 {
+		t.Fatalf("stats: %+v", st)
+	}
+	present := 0
+	for i := 0; i < 500; i++ {
+		if !c.Contains(keyN(i)) {
+			continue
+		}
+		present++
+		if i < 400 {
+			t.Fatalf("old entry %d survived", i)
+		}
+		if got, _ := c.Get(keyN(i)); !bytes.Equal(got, blobN(i, 1000+i%300)) {
+			t.Fatalf("entry %d corrupted", i)
+		}
+	}
+	if uint64(present) != st.FileItems || !c.Contains(keyN(499)) {
+		t.Fatalf("%d entries present, FileItems %d", present, st.FileItems)
+	}
+}
+
+func TestFile_DeleteTTLAndResize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "l1")
+	c := openFileCache(t, path, 0)
+	c.Put(keyN(1), []byte("one"))
+	c.Put(keyN(2), []byte("two"))
+	c.PutTTL(keyN(3), []byte("three"), 20*time.Millisecond)
+	if !c.Delete(keyN(1)) {
+		t.Fatal("Delete reported false")
+	}
+	c.Close()
+	time.Sleep(40 * time.Millisecond)
+
+	c = openFileCache(t, path, 0)
+	if c.Contains(keyN(1)) || c.Contains(keyN(3)) || !c.Contains(keyN(2)) {
+		t.Fatal("deleted or expired entries came back")
+	}
+	if _, ok := c.Get(keyN(3)); ok {
+		t.Fatal("expired entry returned")
+	}
+	c.Close()
+
+	// A different size is refused rather than reformatted, since another
+	// process may have the file mapped.
+	if _, err := l1cache.New(l1cache.Config{CapacityBytes: 1 << 20, File: path, FileBytes: 1 << 20}); err == nil {
+		t.Fatal("opened a file of another size")
+	}
+	c = openFileCache(t, path, 0)
+	if !c.Contains(keyN(2)) {
+		t.Fatal("refused open damaged the file")
+	}
+
+	// So is a file that is not a cache at all.
+	other := filepath.Join(t.TempDir(), "other")
+	os.WriteFile(other, []byte("precious"), 0o644)
+	if _, err := l1cache.New(l1cache.Config{CapacityBytes: 1 << 20, File: other}); err == nil {
+		t.Fatal("formatted a foreign file")
+	}
+	if b, _ := os.ReadFile(other); string(b) != "precious" {
+		t.Fatalf("foreign file = %q", b)
+	}
+}
+
+func TestFile_RecoversFromInterruptedWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "l1")
+	c := openFileCache(t, path, 0)
+	c.Put(keyN(1), []byte("one"))
+	c.Close()
+
+	// Leave the file as a writer killed mid-update would: dirty flag set.
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteAt([]byte{1}, 16)
+	f.Close()
+
+	c = openFileCache(t, path, 0)
+	if c.Contains(keyN(1)) {
+		t.Fatal("read from an interrupted file")
+	}
+	c.Put(keyN(2), []byte("two"))
+	if got, ok := c.Get(keyN(2)); !ok || string(got) != "two" {
+		t.Fatal("file unusable after recovery")
+	}
+	if st := c.Stats(); st.FileItems != 1 {
+		t.Fatalf("FileItems = %d after reset", st.FileItems)
+	}
+	c.Close()
+
+	// A format torn before the magic was written is redone in place.
+	f, err = os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteAt(make([]byte, 8), 0)
+	f.Close()
+	c = openFileCache(t, path, 0)
+	if c.Contains(keyN(2)) {
+		t.Fatal("read from a torn file")
+	}
+	c.Put(keyN(3), []byte("three"))
+	if got, ok := c.Get(keyN(3)); !ok || string(got) != "three" {
+		t.Fatal("file unusable after reformat")
+	}
+}
+
+func TestFile_SharedByHandles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "l1")
+	w := openFileCache(t, path, 256<<10)
+	readers := []l1cache.Cache{openFileCache(t, path, 256<<10), openFileCache(t, path, 256<<10)}
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(done)
+		for i := 0; i < 2000; i++ {
+			w.Put(keyN(i), blobN(i, 500))
+		}
+	}()
+	for _, r := range readers {
+		for g := 0; g < 2; g++ {
+			wg.Add(1)
+			go func(r l1cache.Cache, g int) {
+				defer wg.Done()
+				rng := rand.New(rand.NewSource(int64(g)))
+				for n := 0; n < 500; n++ {
+					select {
+					case <-done:
+						return
+					default:
+					}
+					i := rng.Intn(2000)
+					if got, ok := r.Get(keyN(i)); ok && !bytes.Equal(got, blobN(i, 500)) {
+						t.Errorf("entry %d read torn", i)
+						return
+					}
+				}
+			}(r, g)
+		}
+	}
+	wg.Wait()
+	if got, ok := readers[0].Get(keyN(1999)); !ok || !bytes.Equal(got, blobN(1999, 500)) {
+		t.Fatal("reader missed the writer's last entry")
+	}
+}
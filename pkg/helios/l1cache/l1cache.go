@@ -12,11 +12,14 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-
 package l1cache
 
 import (
+	"container/list"
+	"math/bits"
+	"runtime"
 	"sync"
+	"time"
 
 	"github.com/good-night-oppie/helios/pkg/helios/types"
 	"github.com/klauspost/compress/zstd"
@@ -24,43 +27,108 @@ import (
 
 type Cache interface {
 	Put(hash types.Hash, raw []byte) (storedBytes int, compressed bool)
+	// PutTTL is Put with an entry that expires after ttl; ttl ≤ 0 never expires.
+	PutTTL(hash types.Hash, raw []byte, ttl time.Duration) (storedBytes int, compressed bool)
 	Get(hash types.Hash) (data []byte, ok bool)
+	// Contains reports whether hash is cached, without counting a hit or
+	// miss or refreshing the entry's position.
+	Contains(hash types.Hash) bool
+	// Delete removes hash, pinned or not, and reports whether it was cached.
+	Delete(hash types.Hash) bool
+	// Pin keeps a cached entry from being evicted until a matching Unpin;
+	// pins nest. It reports whether the entry was cached. Pinned entries
+	// still count against capacity and still expire.
+	Pin(hash types.Hash) bool
+	Unpin(hash types.Hash) bool
 	Stats() CacheStats
+	// Close releases the file of a file-backed cache; other caches need not
+	// be closed.
+	Close() error
 }
 
 type CacheStats struct {
-	Hits      uint64
-	Misses    uint64
-	Evictions uint64
-	SizeBytes uint64
-	Items     uint64
+	Hits        uint64
+	Misses      uint64
+	Evictions   uint64
+	SizeBytes   uint64
+	Items       uint64
+	Pinned      uint64 // entries currently pinned
+	Expirations uint64 // entries dropped because their TTL passed
+	// RawBytes is the uncompressed size of the cached entries, and
+	// CompressionRatio RawBytes/SizeBytes (0 when empty).
+	RawBytes         uint64
+	CompressionRatio float64
+	// FileItems and FileBytes describe the file of a file-backed cache. Hits
+	// and Misses then count every process that has used the file, and
+	// CompressionRatio is over the file's entries.
+	FileItems uint64
+	FileBytes uint64
 }
 
 type Config struct {
-	CapacityBytes        int64 // ≤0 means cache is disabled
-	CompressionThreshold int   // below threshold: do not compress; ≤0 means always try compress
+	CapacityBytes        int64  // ≤0 means cache is disabled
+	CompressionThreshold int    // below threshold: do not compress; ≤0 means always try compress
+	Policy               Policy // eviction policy; the zero value is ARC
+	// Shards splits the cache into independently locked parts, each with an
+	// equal share of the capacity, its own eviction state and its own
+	// encoders. Rounded up to a power of two; 0 picks one per core, but no
+	// more than keeps each shard at MinShardBytes.
+	Shards int
+	// Dicts are zstd dictionaries (see TrainDict). The first compresses new
+	// entries; all of them can decompress.
+	Dicts [][]byte
+	// File, if set, backs the cache with a memory-mapped file of FileBytes
+	// data (0 means DefaultFileBytes) that outlives the process and may be
+	// shared by several. Puts are written through to it, misses are served
+	// from it, and hit and miss counts accumulate in it. Linux only. New
+	// fails if File already holds a cache of a different FileBytes.
+	File      string
+	FileBytes int64
 }
 
+// MinShardBytes is the smallest shard New creates when Config.Shards is 0.
+// An entry larger than its shard is not cached.
+const MinShardBytes = 4 << 20
+
+// maxShards bounds Config.Shards
+const maxShards = 1024
+
 type entry struct {
 	k          string
 	data       []byte // may be compressed
 	rawSize    int
 	compressed bool
+
+	elem *list.Element // position in the evictor's list; nil while pinned
+	list int           // which list, for evictors with several
+
+	pins    int
+	expires int64 // UnixNano deadline, 0 for none
 }
 
+func (e *entry) expired(now int64) bool { return e.expires != 0 && now >= e.expires }
+
 type cache struct {
-	mu        sync.Mutex
-	capBytes  int64
-	sizeBytes int64
+	shards    []*shard
+	mask      uint64
+	threshold int
+	file      *fileTier // nil unless Config.File is set
+}
 
-	order   []string
-	entries map[string]*entry
+// shard is one lock stripe: a slice of the key space with its own capacity,
+// eviction order and zstd coders.
+type shard struct {
+	mu          sync.Mutex
+	capBytes    int64
+	sizeBytes   int64
+	pinnedBytes int64 // part of sizeBytes that cannot be evicted
 
-	enc       *zstd.Encoder
-	dec       *zstd.Decoder
-	threshold int
+	entries map[string]*entry
+	ev      evictor
+	stats   CacheStats
 
-	stats CacheStats
+	encoders sync.Pool // *zstd.Encoder
+	decoders sync.Pool // *zstd.Decoder
 }
 
 func New(cfg Config) (Cache, error) {
@@ -68,37 +136,103 @@ func New(cfg Config) (Cache, error) {
 		cfg.CapacityBytes = 0
 	}
 	// Note: capacity=0 is valid for a "disabled cache" that never stores anything
-	enc, err := zstd.NewWriter(nil)
+	n := shardCount(cfg)
+	c := &cache{
+		shards:    make([]*shard, n),
+		mask:      uint64(n - 1),
+		threshold: cfg.CompressionThreshold,
+	}
+	eopts := []zstd.EOption{zstd.WithEncoderConcurrency(1)}
+	dopts := []zstd.DOption{zstd.WithDecoderConcurrency(1)}
+	if len(cfg.Dicts) > 0 {
+		eopts = append(eopts, zstd.WithEncoderDict(cfg.Dicts[0]))
+		dopts = append(dopts, zstd.WithDecoderDicts(cfg.Dicts...))
+	}
+	// Validate the coder options once so pooled constructors cannot fail.
+	enc, err := zstd.NewWriter(nil, eopts...)
 	if err != nil {
 		return nil, err
 	}
-	dec, err := zstd.NewReader(nil)
+	dec, err := zstd.NewReader(nil, dopts...)
 	if err != nil {
 		return nil, err
 	}
-	return &cache{
-		capBytes:  cfg.CapacityBytes,
-		entries:   make(map[string]*entry),
-		order:     make([]string, 0, 128),
-		enc:       enc,
-		dec:       dec,
-		threshold: cfg.CompressionThreshold,
-	}, nil
+	for i := range c.shards {
+		ev, err := newEvictor(cfg.Policy, cfg.CapacityBytes/int64(n))
+		if err != nil {
+			return nil, err
+		}
+		s := &shard{
+			capBytes: cfg.CapacityBytes / int64(n),
+			entries:  make(map[string]*entry),
+			ev:       ev,
+		}
+		s.encoders.New = func() any {
+			e, _ := zstd.NewWriter(nil, eopts...)
+			return e
+		}
+		s.decoders.New = func() any {
+			d, _ := zstd.NewReader(nil, dopts...)
+			return d
+		}
+		c.shards[i] = s
+	}
+	c.shards[0].encoders.Put(enc)
+	c.shards[0].decoders.Put(dec)
+	if cfg.File != "" && cfg.CapacityBytes > 0 {
+		if c.file, err = openFileTier(cfg.File, cfg.FileBytes); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func shardCount(cfg Config) int {
+	n := cfg.Shards
+	if n <= 0 {
+		n = runtime.GOMAXPROCS(0)
+		for n > 1 && cfg.CapacityBytes/int64(n) < MinShardBytes {
+			n /= 2
+		}
+	}
+	n = min(max(n, 1), maxShards)
+	return 1 << bits.Len(uint(n-1))
 }
 
-func (c *cache) key(h types.Hash) string { return h.String() }
+// key identifies h within a shard; cheaper than the hex form of String.
+func key(h types.Hash) string { return string(h.Algorithm) + ":" + string(h.Digest) }
+
+func (c *cache) shard(h types.Hash) *shard {
+	if c.mask == 0 {
+		return c.shards[0]
+	}
+	// FNV-1a over the digest, so keys with a common prefix still spread.
+	x := uint64(14695981039346656037)
+	for _, b := range h.Digest {
+		x ^= uint64(b)
+		x *= 1099511628211
+	}
+	return c.shards[x&c.mask]
+}
 
 func (c *cache) Put(h types.Hash, raw []byte) (int, bool) {
-	if c.capBytes == 0 {
+	return c.PutTTL(h, raw, 0)
+}
+
+func (c *cache) PutTTL(h types.Hash, raw []byte, ttl time.Duration) (int, bool) {
+	s := c.shard(h)
+	if s.capBytes == 0 {
 		return 0, false
 	}
-	k := c.key(h)
+	k := key(h)
 	var store []byte
 	compressed := false
-	
+
 	// Compress data if appropriate
 	if c.threshold <= 0 || len(raw) >= c.threshold {
-		comp := c.enc.EncodeAll(raw, nil)
+		enc := s.encoders.Get().(*zstd.Encoder)
+		comp := enc.EncodeAll(raw, nil)
+		s.encoders.Put(enc)
 		if len(comp) < len(raw) {
 			store = comp
 			compressed = true
@@ -108,73 +242,118 @@ func (c *cache) Put(h types.Hash, raw []byte) (int, bool) {
 		store = make([]byte, len(raw))
 		copy(store, raw)
 	}
-	need := int64(len(store))
-	if need > c.capBytes {
-		return 0, false // skip if too large
+	ent := &entry{k: k, data: store, rawSize: len(raw), compressed: compressed}
+	if ttl > 0 {
+		ent.expires = time.Now().Add(ttl).UnixNano()
+	}
+
+	ok := s.insert(ent)
+	if c.file != nil && c.file.put(k, store, len(raw), compressed, ent.expires) {
+		ok = true
+	}
+	if !ok {
+		return 0, false
+	}
+	return len(store), compressed
+}
+
+// insert adds ent to the shard, evicting as needed, and reports whether it
+// fit.
+func (s *shard) insert(ent *entry) bool {
+	need := int64(len(ent.data))
+	if need > s.capBytes {
+		return false // skip if too large
 	}
 
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Pinned bytes cannot be evicted to make room; an existing entry that
+	// does not fit its replacement is kept.
+	old := s.entries[ent.k]
+	avail := s.capBytes - s.pinnedBytes
+	if old != nil && old.pins > 0 {
+		avail += int64(len(old.data))
+	}
+	if need > avail {
+		return false
+	}
 
-	// Clear existing entry
-	if old, ok := c.entries[k]; ok {
-		c.sizeBytes -= int64(len(old.data))
-		c.deleteFromOrder(k)
-		delete(c.entries, k)
-		c.stats.Items--
+	// Clear existing entry; a replacement keeps its pins
+	if old != nil {
+		ent.pins = old.pins
+		s.drop(old)
 	}
 
-	// FIFO eviction
-	for c.sizeBytes+need > c.capBytes && len(c.order) > 0 {
-		evictK := c.order[0]
-		c.order = c.order[1:]
-		if e := c.entries[evictK]; e != nil {
-			c.sizeBytes -= int64(len(e.data))
-			delete(c.entries, evictK)
-			c.stats.Evictions++
-			c.stats.Items--
+	s.ev.admit(ent.k, need)
+	for s.sizeBytes+need > s.capBytes {
+		v := s.ev.victim()
+		if v == nil {
+			break
 		}
+		s.sizeBytes -= int64(len(v.data))
+		delete(s.entries, v.k)
+		s.stats.Evictions++
+		s.stats.Items--
+		s.stats.RawBytes -= uint64(v.rawSize)
 	}
 
 	// Add new entry
-	ent := &entry{k: k, data: store, rawSize: len(raw), compressed: compressed}
-	c.entries[k] = ent
-	c.order = append(c.order, k)
-	c.sizeBytes += need
-	c.stats.Items++
-	c.stats.SizeBytes = uint64(c.sizeBytes)
-
-	return len(store), compressed
+	s.entries[ent.k] = ent
+	if ent.pins > 0 {
+		s.stats.Pinned++
+		s.pinnedBytes += need
+	} else {
+		s.ev.insert(ent)
+	}
+	s.sizeBytes += need
+	s.stats.Items++
+	s.stats.RawBytes += uint64(ent.rawSize)
+	return true
 }
 
 func (c *cache) Get(h types.Hash) ([]byte, bool) {
-	if c.capBytes == 0 {
+	s := c.shard(h)
+	if s.capBytes == 0 {
 		return nil, false
 	}
-	k := c.key(h)
+	k := key(h)
 
-	c.mu.Lock()
-	ent, ok := c.entries[k]
-	if !ok {
-		c.stats.Misses++
-		c.mu.Unlock()
-		return nil, false
+	s.mu.Lock()
+	ent := s.lookup(k)
+	if ent == nil {
+		s.mu.Unlock()
+		if ent = c.fromFile(k); ent == nil {
+			c.miss(s)
+			return nil, false
+		}
+		// Promote; the file already has it.
+		s.insert(ent)
+		s.mu.Lock()
+	} else if ent.pins == 0 {
+		s.ev.touch(ent)
 	}
-
-	// Copy entry data while locked
-	data := make([]byte, len(ent.data))
-	copy(data, ent.data)
+	// Stored bytes are never modified, so compressed data can be decoded
+	// after unlocking without a copy.
+	data := ent.data
 	compressed := ent.compressed
-	c.stats.Hits++ // Update hit counter while locked
-	c.mu.Unlock()
+	if !compressed {
+		data = make([]byte, len(ent.data))
+		copy(data, ent.data)
+	}
+	s.stats.Hits++ // Update hit counter while locked
+	s.mu.Unlock()
+	if c.file != nil {
+		c.file.count(hHits)
+	}
 
 	// Decompress if needed (outside lock)
 	if compressed {
-		dec, err := c.dec.DecodeAll(data, nil)
+		d := s.decoders.Get().(*zstd.Decoder)
+		dec, err := d.DecodeAll(data, nil)
+		s.decoders.Put(d)
 		if err != nil {
-			c.mu.Lock()
-			c.stats.Misses++ // Count decompression failure as miss
-			c.mu.Unlock()
+			c.miss(s) // Count decompression failure as miss
 			return nil, false
 		}
 		return dec, true
@@ -183,24 +362,160 @@ func (c *cache) Get(h types.Hash) ([]byte, bool) {
 	return data, true
 }
 
+// fromFile returns an entry for k read from the file-backed tier, if any.
+func (c *cache) fromFile(k string) *entry {
+	if c.file == nil {
+		return nil
+	}
+	r, ok := c.file.get(k, time.Now().UnixNano())
+	if !ok {
+		return nil
+	}
+	return &entry{k: k, data: r.data, rawSize: r.rawSize, compressed: r.compressed, expires: r.expires}
+}
+
+func (c *cache) miss(s *shard) {
+	s.mu.Lock()
+	s.stats.Misses++
+	s.mu.Unlock()
+	if c.file != nil {
+		c.file.count(hMisses)
+	}
+}
+
+func (c *cache) Contains(h types.Hash) bool {
+	s := c.shard(h)
+	k := key(h)
+	s.mu.Lock()
+	ok := s.lookup(k) != nil
+	s.mu.Unlock()
+	return ok || c.file != nil && c.file.contains(k, time.Now().UnixNano())
+}
+
+func (c *cache) Delete(h types.Hash) bool {
+	s := c.shard(h)
+	k := key(h)
+	s.mu.Lock()
+	ent := s.lookup(k)
+	if ent != nil {
+		s.drop(ent)
+	}
+	s.mu.Unlock()
+	ok := ent != nil
+	if c.file != nil && c.file.delete(k) {
+		ok = true
+	}
+	return ok
+}
+
+// Pin protects only the in-memory copy; an entry found only in the file is
+// loaded first.
+func (c *cache) Pin(h types.Hash) bool {
+	s := c.shard(h)
+	k := key(h)
+	s.mu.Lock()
+	ent := s.lookup(k)
+	if ent == nil {
+		s.mu.Unlock()
+		if ent = c.fromFile(k); ent == nil || !s.insert(ent) {
+			return false
+		}
+		s.mu.Lock()
+		// Re-check: the entry may have been replaced or evicted meanwhile.
+		if ent = s.lookup(k); ent == nil {
+			s.mu.Unlock()
+			return false
+		}
+	}
+	defer s.mu.Unlock()
+	if ent.pins == 0 {
+		s.ev.remove(ent)
+		s.stats.Pinned++
+		s.pinnedBytes += int64(len(ent.data))
+	}
+	ent.pins++
+	return true
+}
+
+func (c *cache) Unpin(h types.Hash) bool {
+	s := c.shard(h)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ent := s.lookup(key(h))
+	if ent == nil || ent.pins == 0 {
+		return false
+	}
+	ent.pins--
+	if ent.pins == 0 {
+		s.ev.admit(ent.k, int64(len(ent.data)))
+		s.ev.insert(ent)
+		s.stats.Pinned--
+		s.pinnedBytes -= int64(len(ent.data))
+	}
+	return true
+}
+
+// lookup returns the live entry for k, dropping it if it has expired.
+// Callers hold s.mu.
+func (s *shard) lookup(k string) *entry {
+	ent, ok := s.entries[k]
+	if !ok {
+		return nil
+	}
+	if ent.expired(time.Now().UnixNano()) {
+		s.drop(ent)
+		s.stats.Expirations++
+		return nil
+	}
+	return ent
+}
+
+// drop removes ent without recording an eviction. Callers hold s.mu.
+func (s *shard) drop(ent *entry) {
+	if ent.pins > 0 {
+		s.stats.Pinned--
+		s.pinnedBytes -= int64(len(ent.data))
+	} else {
+		s.ev.remove(ent)
+	}
+	s.sizeBytes -= int64(len(ent.data))
+	delete(s.entries, ent.k)
+	s.stats.Items--
+	s.stats.RawBytes -= uint64(ent.rawSize)
+}
+
 func (c *cache) Stats() CacheStats {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	return CacheStats{
-		Hits:      c.stats.Hits,
-		Misses:    c.stats.Misses,
-		Evictions: c.stats.Evictions,
-		SizeBytes: uint64(c.sizeBytes),
-		Items:     c.stats.Items,
-	}
-}
-
-func (c *cache) deleteFromOrder(k string) {
-	for i := range c.order {
-		if c.order[i] == k {
-			copy(c.order[i:], c.order[i+1:])
-			c.order = c.order[:len(c.order)-1]
-			return
+	var st CacheStats
+	for _, s := range c.shards {
+		s.mu.Lock()
+		st.Hits += s.stats.Hits
+		st.Misses += s.stats.Misses
+		st.Evictions += s.stats.Evictions
+		st.Items += s.stats.Items
+		st.Pinned += s.stats.Pinned
+		st.Expirations += s.stats.Expirations
+		st.SizeBytes += uint64(s.sizeBytes)
+		st.RawBytes += s.stats.RawBytes
+		s.mu.Unlock()
+	}
+	if st.SizeBytes > 0 {
+		st.CompressionRatio = float64(st.RawBytes) / float64(st.SizeBytes)
+	}
+	if c.file != nil {
+		fs := c.file.stats()
+		st.Hits, st.Misses = fs.hits, fs.misses
+		st.FileItems, st.FileBytes = fs.items, fs.bytes
+		st.CompressionRatio = 0
+		if fs.bytes > 0 {
+			st.CompressionRatio = float64(fs.rawBytes) / float64(fs.bytes)
 		}
 	}
+	return st
+}
+
+func (c *cache) Close() error {
+	if c.file == nil {
+		return nil
+	}
+	return c.file.close()
 }
@@ -0,0 +1,240 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package l1cache
+
+import (
+	"container/list"
+	"fmt"
+)
+
+// Policy selects how the cache picks entries to evict
+type Policy int
+
+const (
+	// ARC is the Adaptive Replacement Cache: entries seen once and entries
+	// seen again live in separate lists, and ghost lists of recent victims
+	// steer how much space each gets. A hot blob survives a burst of
+	// one-time reads that would flush it from an LRU. The default.
+	ARC Policy = iota
+	// LRU evicts the least recently used entry
+	LRU
+	// FIFO evicts in insertion order, ignoring hits
+	FIFO
+)
+
+func (p Policy) String() string {
+	switch p {
+	case ARC:
+		return "arc"
+	case LRU:
+		return "lru"
+	case FIFO:
+		return "fifo"
+	default:
+		return fmt.Sprintf("Policy(%d)", int(p))
+	}
+}
+
+// evictor orders resident entries and chooses victims. The cache calls it
+// with its lock held; every method is O(1).
+type evictor interface {
+	// admit is called before k is inserted, so the policy can adapt
+	admit(k string, size int64)
+	// insert places a new resident entry
+	insert(e *entry)
+	// touch records a hit on e
+	touch(e *entry)
+	// victim unlinks and returns the entry to evict next, or nil
+	victim() *entry
+	// remove unlinks e without treating it as evicted
+	remove(e *entry)
+}
+
+func newEvictor(p Policy, capBytes int64) (evictor, error) {
+	switch p {
+	case ARC:
+		return newARC(capBytes), nil
+	case LRU:
+		return &queue{l: list.New(), moveOnHit: true}, nil
+	case FIFO:
+		return &queue{l: list.New()}, nil
+	default:
+		return nil, fmt.Errorf("l1cache: unknown eviction policy %d", int(p))
+	}
+}
+
+// queue is LRU when hits move entries to the front, FIFO otherwise
+type queue struct {
+	l         *list.List
+	moveOnHit bool
+}
+
+func (q *queue) admit(string, int64) {}
+
+func (q *queue) insert(e *entry) { e.elem = q.l.PushFront(e) }
+
+func (q *queue) touch(e *entry) {
+	if q.moveOnHit {
+		q.l.MoveToFront(e.elem)
+	}
+}
+
+func (q *queue) victim() *entry {
+	back := q.l.Back()
+	if back == nil {
+		return nil
+	}
+	e := q.l.Remove(back).(*entry)
+	e.elem = nil
+	return e
+}
+
+func (q *queue) remove(e *entry) {
+	if e.elem != nil {
+		q.l.Remove(e.elem)
+		e.elem = nil
+	}
+}
+
+const (
+	t1 = iota // resident, seen once
+	t2        // resident, seen at least twice
+	b1        // ghost of a t1 victim
+	b2        // ghost of a t2 victim
+)
+
+type ghost struct {
+	k    string
+	size int64
+	list int
+}
+
+// arc is ARC (Megiddo & Modha) with sizes in bytes: list lengths and the
+// target p are measured in bytes, and ghosts keep the size of the entry
+// they stand for.
+type arc struct {
+	capBytes int64
+	p        int64 // target size of t1
+
+	lists  [4]*list.List
+	bytes  [4]int64
+	ghosts map[string]*list.Element
+
+	// set by admit for the victim and insert calls that follow it
+	next    int
+	favorT1 bool
+}
+
+func newARC(capBytes int64) *arc {
+	a := &arc{capBytes: capBytes, ghosts: make(map[string]*list.Element)}
+	for i := range a.lists {
+		a.lists[i] = list.New()
+	}
+	return a
+}
+
+func (a *arc) admit(k string, size int64) {
+	a.next, a.favorT1 = t1, false
+	el, ok := a.ghosts[k]
+	if !ok {
+		return
+	}
+	g := el.Value.(*ghost)
+	// A ghost hit means the list it was evicted from deserved more room.
+	if g.list == b1 {
+		a.p = min(a.capBytes, a.p+max(size, size*a.bytes[b2]/max(a.bytes[b1], 1)))
+	} else {
+		a.p = max(0, a.p-max(size, size*a.bytes[b1]/max(a.bytes[b2], 1)))
+		a.favorT1 = true
+	}
+	a.dropGhost(el)
+	a.next = t2
+}
+
+func (a *arc) insert(e *entry) {
+	e.list = a.next
+	e.elem = a.lists[a.next].PushFront(e)
+	a.bytes[a.next] += int64(len(e.data))
+	a.trimGhosts()
+}
+
+func (a *arc) touch(e *entry) {
+	if e.list == t2 {
+		a.lists[t2].MoveToFront(e.elem)
+		return
+	}
+	a.lists[e.list].Remove(e.elem)
+	a.bytes[e.list] -= int64(len(e.data))
+	e.list = t2
+	e.elem = a.lists[t2].PushFront(e)
+	a.bytes[t2] += int64(len(e.data))
+}
+
+func (a *arc) victim() *entry {
+	from := t2
+	if n := a.bytes[t1]; a.lists[t1].Len() > 0 && (n > a.p || (a.favorT1 && n >= a.p) || a.lists[t2].Len() == 0) {
+		from = t1
+	}
+	back := a.lists[from].Back()
+	if back == nil {
+		return nil
+	}
+	e := back.Value.(*entry)
+	a.unlink(e)
+	g := &ghost{k: e.k, size: int64(len(e.data)), list: b1}
+	if from == t2 {
+		g.list = b2
+	}
+	a.ghosts[e.k] = a.lists[g.list].PushFront(g)
+	a.bytes[g.list] += g.size
+	return e
+}
+
+func (a *arc) remove(e *entry) {
+	if e.elem != nil {
+		a.unlink(e)
+	}
+}
+
+func (a *arc) unlink(e *entry) {
+	a.lists[e.list].Remove(e.elem)
+	a.bytes[e.list] -= int64(len(e.data))
+	e.elem = nil
+}
+
+func (a *arc) dropGhost(el *list.Element) {
+	g := el.Value.(*ghost)
+	a.lists[g.list].Remove(el)
+	a.bytes[g.list] -= g.size
+	delete(a.ghosts, g.k)
+}
+
+// trimGhosts bounds history: t1+b1 to the capacity and all four lists to
+// twice the capacity, as in the original algorithm.
+func (a *arc) trimGhosts() {
+	for a.bytes[t1]+a.bytes[b1] > a.capBytes && a.lists[b1].Len() > 0 {
+		a.dropGhost(a.lists[b1].Back())
+	}
+	for a.bytes[t1]+a.bytes[t2]+a.bytes[b1]+a.bytes[b2] > 2*a.capBytes {
+		switch {
+		case a.lists[b2].Len() > 0:
+			a.dropGhost(a.lists[b2].Back())
+		case a.lists[b1].Len() > 0:
+			a.dropGhost(a.lists[b1].Back())
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package l1cache_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/good-night-oppie/helios/pkg/helios/l1cache"
+	"github.com/good-night-oppie/helios/pkg/helios/types"
+)
+
+func keyN(n int) types.Hash {
+	d := make([]byte, 8)
+	binary.BigEndian.PutUint64(d, uint64(n))
+	return types.Hash{Algorithm: types.BLAKE3, Digest: d}
+}
+
+// access reads n through the cache and fills it on a miss, as the tiered
+// store does for L2 reads.
+func access(c l1cache.Cache, n int) bool {
+	if _, ok := c.Get(keyN(n)); ok {
+		return true
+	}
+	c.Put(keyN(n), bytes.Repeat([]byte{byte(n)}, 100))
+	return false
+}
+
+func newPolicyCache(t *testing.T, p l1cache.Policy, capBytes int64) l1cache.Cache {
+	t.Helper()
+	c, err := l1cache.New(l1cache.Config{CapacityBytes: capBytes, CompressionThreshold: 1 << 20, Policy: p})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestPolicies_EvictWithinCapacity(t *testing.T) {
+	for _, p := range []l1cache.Policy{l1cache.ARC, l1cache.LRU, l1cache.FIFO} {
+		t.Run(p.String(), func(t *testing.T) {
+			c := newPolicyCache(t, p, 1000)
+			for i := 0; i < 500; i++ {
+				access(c, i%37)
+				access(c, 1000+i)
+				if st := c.Stats(); st.SizeBytes > 1000 || st.Items > 10 {
+					t.Fatalf("over capacity: %+v", st)
+				}
+			}
+			st := c.Stats()
+			if st.Items != 10 || st.Evictions == 0 {
+				t.Fatalf("stats: %+v", st)
+			}
+		})
+	}
+}
+
+func TestLRU_HitProtectsEntry(t *testing.T) {
+	for _, tc := range []struct {
+		p    l1cache.Policy
+		keep bool
+	}{{l1cache.LRU, true}, {l1cache.FIFO, false}} {
+		c := newPolicyCache(t, tc.p, 300)
+		access(c, 1)
+		access(c, 2)
+		access(c, 3)
+		access(c, 1) // hit
+		access(c, 4) // evicts 2 under LRU, 1 under FIFO
+		if _, ok := c.Get(keyN(1)); ok != tc.keep {
+			t.Fatalf("%v: entry 1 resident=%v, want %v", tc.p, ok, tc.keep)
+		}
+	}
+}
+
+// A hot set re-read on every rollout must survive a scan of one-time
+// reads larger than the cache.
+func TestARC_ScanResistance(t *testing.T) {
+	hits := map[l1cache.Policy]int{}
+	for _, p := range []l1cache.Policy{l1cache.ARC, l1cache.LRU, l1cache.FIFO} {
+		c := newPolicyCache(t, p, 100*100)
+		for round := 0; round < 5; round++ {
+			for k := 0; k < 60; k++ {
+				access(c, k)
+			}
+		}
+		for k := 0; k < 200; k++ {
+			access(c, 10000+k)
+		}
+		for k := 0; k < 60; k++ {
+			if access(c, k) {
+				hits[p]++
+			}
+		}
+	}
+	if hits[l1cache.ARC] < 50 {
+		t.Fatalf("ARC kept %d of 60 hot entries through a scan", hits[l1cache.ARC])
+	}
+	if hits[l1cache.ARC] <= hits[l1cache.LRU] || hits[l1cache.ARC] <= hits[l1cache.FIFO] {
+		t.Fatalf("ARC should beat LRU and FIFO: %v", hits)
+	}
+}
+
+func TestUnknownPolicy(t *testing.T) {
+	if _, err := l1cache.New(l1cache.Config{CapacityBytes: 1, Policy: l1cache.Policy(42)}); err == nil {
+		t.Fatal("expected error for unknown policy")
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package l1cache_test
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/good-night-oppie/helios/pkg/helios/l1cache"
+)
+
+func TestSharded_ConcurrentAndStats(t *testing.T) {
+	c, err := l1cache.New(l1cache.Config{CapacityBytes: 8 << 20, CompressionThreshold: 64, Shards: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				n := g*1000 + i
+				raw := bytes.Repeat([]byte(fmt.Sprint(n)), 40)
+				c.Put(keyN(n), raw)
+				if got, ok := c.Get(keyN(n)); !ok || !bytes.Equal(got, raw) {
+					t.Errorf("key %d: ok=%v", n, ok)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	st := c.Stats()
+	if st.Items != 1600 || st.Hits != 1600 || st.Evictions != 0 || st.SizeBytes == 0 {
+		t.Fatalf("aggregated stats: %+v", st)
+	}
+}
+
+func TestSharded_EntryLargerThanShard(t *testing.T) {
+	c, err := l1cache.New(l1cache.Config{CapacityBytes: 400, CompressionThreshold: 1 << 20, Shards: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored, _ := c.Put(keyN(1), make([]byte, 150)); stored != 0 {
+		t.Fatalf("entry larger than its 100-byte shard was cached")
+	}
+	if stored, _ := c.Put(keyN(2), make([]byte, 80)); stored != 80 {
+		t.Fatalf("small entry not cached: %d", stored)
+	}
+}
+
+func TestSharded_DefaultKeepsSmallCachesWhole(t *testing.T) {
+	// Below MinShardBytes per core the cache is not split, so any entry up
+	// to the full capacity still fits.
+	c, _ := l1cache.New(l1cache.Config{CapacityBytes: l1cache.MinShardBytes, CompressionThreshold: 1 << 30})
+	big := make([]byte, l1cache.MinShardBytes*3/4)
+	if stored, _ := c.Put(keyN(1), big); stored != len(big) {
+		t.Fatalf("stored=%d on %d cores", stored, runtime.GOMAXPROCS(0))
+	}
+}
+
+func BenchmarkCache_Parallel(b *testing.B) {
+	for _, shards := range []int{1, 0} {
+		name := "shards=1"
+		if shards == 0 {
+			name = fmt.Sprintf("shards=auto(%d cores)", runtime.GOMAXPROCS(0))
+		}
+		b.Run(name, func(b *testing.B) {
+			c, _ := l1cache.New(l1cache.Config{CapacityBytes: 256 << 20, CompressionThreshold: 512, Shards: shards})
+			raw := bytes.Repeat([]byte("state "), 200)
+			for i := 0; i < 4096; i++ {
+				c.Put(keyN(i), raw)
+			}
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					i++
+					if i%8 == 0 {
+						c.Put(keyN(i%8192), raw)
+					} else {
+						c.Get(keyN(i % 4096))
+					}
+				}
+			})
+		})
+	}
+}
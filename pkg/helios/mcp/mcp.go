@@ -0,0 +1,277 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package mcp serves a Helios engine to LLM agents over the Model Context
+// Protocol: JSON-RPC 2.0 messages, one per line, on a pair of streams
+// (normally stdin and stdout).
+//
+// The server implements initialize, ping, tools/list and tools/call; the
+// tools are listed in tools.go. A failing tool call is reported as a tool
+// result with isError set, so the agent can see and react to the message.
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"sync"
+
+	"github.com/good-night-oppie/helios/pkg/helios/types"
+	"github.com/good-night-oppie/helios/pkg/helios/vst"
+)
+
+// ProtocolVersion is the newest protocol revision the server speaks.
+const ProtocolVersion = "2025-06-18"
+
+// supportedVersions are the revisions a client may negotiate.
+var supportedVersions = map[string]bool{
+	"2024-11-05": true,
+	"2025-03-26": true,
+	"2025-06-18": true,
+}
+
+// MaxMessageBytes bounds the size of one incoming message.
+const MaxMessageBytes = 64 << 20
+
+// JSON-RPC error codes.
+const (
+	codeParse          = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+)
+
+// Engine is the engine surface the tools use; *vst.VST implements it.
+type Engine interface {
+	WriteFileMode(path string, content []byte, mode fs.FileMode) error
+	ReadFile(path string) ([]byte, error)
+	DeleteFile(path string)
+	Commit(msg string) (types.SnapshotID, types.CommitMetrics, error)
+	Restore(id types.SnapshotID) error
+	Diff(from, to types.SnapshotID) (types.DiffStats, error)
+	FS(id types.SnapshotID) (*vst.TreeFS, error)
+	WorkingFS() (*vst.TreeFS, error)
+}
+
+// Server serves one engine. Messages are handled one at a time.
+type Server struct {
+	eng     Engine
+	version string
+
+	mu sync.Mutex // guards w
+	w  io.Writer
+}
+
+// New returns a server for eng that reports version in its server info.
+func New(eng Engine, version string) *Server {
+	return &Server{eng: eng, version: version}
+}
+
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string { return e.Message }
+
+// Serve reads requests from r and writes responses to w until r is
+// exhausted or ctx is done.
+func (s *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	s.w = w
+	lines := make(chan []byte)
+	errc := make(chan error, 1)
+	go func() {
+		br := bufio.NewReaderSize(r, 64<<10)
+		for {
+			line, err := readLine(br)
+			if len(bytes.TrimSpace(line)) > 0 {
+				select {
+				case lines <- line:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if err != nil {
+				errc <- err
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-errc:
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		case line := <-lines:
+			if err := s.handle(line); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// readLine returns the next line without its terminator, failing on
+// lines longer than MaxMessageBytes.
+func readLine(br *bufio.Reader) ([]byte, error) {
+	var line []byte
+	for {
+		chunk, err := br.ReadSlice('\n')
+		line = append(line, chunk...)
+		if len(line) > MaxMessageBytes {
+			return nil, fmt.Errorf("mcp: message exceeds %d bytes", MaxMessageBytes)
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		return bytes.TrimRight(line, "\r\n"), err
+	}
+}
+
+// handle processes one message and writes its response, if any.
+func (s *Server) handle(line []byte) error {
+	var req request
+	if err := json.Unmarshal(line, &req); err != nil {
+		return s.reply(response{ID: json.RawMessage("null"), Error: &rpcError{codeParse, "parse error: " + err.Error()}})
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		id := req.ID
+		if id == nil {
+			id = json.RawMessage("null")
+		}
+		return s.reply(response{ID: id, Error: &rpcError{codeInvalidRequest, "invalid request"}})
+	}
+	result, err := s.dispatch(req)
+	if req.ID == nil {
+		// Notifications get no response.
+		return nil
+	}
+	resp := response{ID: req.ID, Result: result}
+	if err != nil {
+		var re *rpcError
+		if !errors.As(err, &re) {
+			re = &rpcError{codeInvalidParams, err.Error()}
+		}
+		resp.Result, resp.Error = nil, re
+	}
+	return s.reply(resp)
+}
+
+func (s *Server) dispatch(req request) (any, error) {
+	switch req.Method {
+	case "initialize":
+		var p struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		if err := unmarshalParams(req.Params, &p); err != nil {
+			return nil, err
+		}
+		v := ProtocolVersion
+		if supportedVersions[p.ProtocolVersion] {
+			v = p.ProtocolVersion
+		}
+		return map[string]any{
+			"protocolVersion": v,
+			"capabilities":    map[string]any{"tools": map[string]any{}},
+			"serverInfo":      map[string]any{"name": "helios", "version": s.version},
+		}, nil
+	case "ping":
+		return map[string]any{}, nil
+	case "tools/list":
+		return map[string]any{"tools": toolList}, nil
+	case "tools/call":
+		var p struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		}
+		if err := unmarshalParams(req.Params, &p); err != nil {
+			return nil, err
+		}
+		t, ok := toolsByName[p.Name]
+		if !ok {
+			return nil, &rpcError{codeInvalidParams, "unknown tool: " + p.Name}
+		}
+		return s.call(t, p.Arguments), nil
+	case "notifications/initialized", "notifications/cancelled":
+		return nil, nil
+	}
+	return nil, &rpcError{codeMethodNotFound, "method not found: " + req.Method}
+}
+
+func unmarshalParams(raw json.RawMessage, v any) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return &rpcError{codeInvalidParams, "invalid params: " + err.Error()}
+	}
+	return nil
+}
+
+type content struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type toolResult struct {
+	Content []content `json:"content"`
+	IsError bool      `json:"isError,omitempty"`
+}
+
+// call runs a tool and wraps its output or error as a tool result.
+func (s *Server) call(t *tool, args json.RawMessage) toolResult {
+	if len(args) == 0 || string(args) == "null" {
+		args = json.RawMessage("{}")
+	}
+	text, err := t.run(s.eng, args)
+	if err != nil {
+		return toolResult{Content: []content{{Type: "text", Text: err.Error()}}, IsError: true}
+	}
+	return toolResult{Content: []content{{Type: "text", Text: text}}}
+}
+
+func (s *Server) reply(resp response) error {
+	resp.JSONRPC = "2.0"
+	b, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(append(b, '\n'))
+	return err
+}
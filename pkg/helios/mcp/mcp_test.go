@@ -0,0 +1,195 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/good-night-oppie/helios/pkg/helios/vst"
+)
+
+type reply struct {
+	ID     json.RawMessage `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *rpcError       `json:"error"`
+}
+
+// session feeds lines to a server and returns its replies in order.
+func session(t *testing.T, s *Server, lines ...string) []reply {
+	t.Helper()
+	var out bytes.Buffer
+	if err := s.Serve(context.Background(), strings.NewReader(strings.Join(lines, "\n")+"\n"), &out); err != nil {
+		t.Fatalf("serve: %v", err)
+	}
+	var replies []reply
+	dec := json.NewDecoder(&out)
+	for dec.More() {
+		var r reply
+		if err := dec.Decode(&r); err != nil {
+			t.Fatalf("decode reply: %v", err)
+		}
+		replies = append(replies, r)
+	}
+	return replies
+}
+
+// callTool runs one tools/call and returns its text and error flag.
+func callTool(t *testing.T, s *Server, name string, args any) (string, bool) {
+	t.Helper()
+	b, _ := json.Marshal(map[string]any{
+		"jsonrpc": "2.0", "id": 1, "method": "tools/call",
+		"params": map[string]any{"name": name, "arguments": args},
+	})
+	rs := session(t, s, string(b))
+	if len(rs) != 1 || rs[0].Error != nil {
+		t.Fatalf("%s: replies %+v", name, rs)
+	}
+	var res toolResult
+	if err := json.Unmarshal(rs[0].Result, &res); err != nil || len(res.Content) != 1 {
+		t.Fatalf("%s: result %s: %v", name, rs[0].Result, err)
+	}
+	return res.Content[0].Text, res.IsError
+}
+
+func TestServer_Handshake(t *testing.T) {
+	s := New(vst.New(), "test")
+	rs := session(t, s,
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2024-11-05","capabilities":{},"clientInfo":{"name":"t","version":"0"}}}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`,
+		`{"jsonrpc":"2.0","id":"p","method":"ping"}`,
+		`{"jsonrpc":"2.0","id":3,"method":"resources/list"}`,
+		`{not json`,
+		`{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"nope"}}`,
+	)
+	if len(rs) != 6 {
+		t.Fatalf("got %d replies, want 6 (no reply to the notification)", len(rs))
+	}
+
+	var init struct {
+		ProtocolVersion string `json:"protocolVersion"`
+		ServerInfo      struct{ Name, Version string }
+	}
+	_ = json.Unmarshal(rs[0].Result, &init)
+	if init.ProtocolVersion != "2024-11-05" || init.ServerInfo.Version != "test" {
+		t.Fatalf("initialize = %s", rs[0].Result)
+	}
+
+	var list struct {
+		Tools []struct {
+			Name        string
+			InputSchema map[string]any
+		}
+	}
+	if err := json.Unmarshal(rs[1].Result, &list); err != nil {
+		t.Fatal(err)
+	}
+	names := map[string]bool{}
+	for _, tl := range list.Tools {
+		names[tl.Name] = true
+		if tl.InputSchema["type"] != "object" {
+			t.Errorf("%s: schema %v", tl.Name, tl.InputSchema)
+		}
+	}
+	for _, n := range []string{"snapshot_commit", "snapshot_restore", "snapshot_diff", "read_file_at", "list_files", "write_file"} {
+		if !names[n] {
+			t.Errorf("tool %s missing", n)
+		}
+	}
+
+	if string(rs[2].ID) != `"p"` || rs[2].Error != nil {
+		t.Fatalf("ping = %+v", rs[2])
+	}
+	if rs[3].Error == nil || rs[3].Error.Code != codeMethodNotFound {
+		t.Fatalf("unknown method = %+v", rs[3])
+	}
+	if rs[4].Error == nil || rs[4].Error.Code != codeParse || string(rs[4].ID) != "null" {
+		t.Fatalf("parse error = %+v", rs[4])
+	}
+	if rs[5].Error == nil || rs[5].Error.Code != codeInvalidParams {
+		t.Fatalf("unknown tool = %+v", rs[5])
+	}
+}
+
+func TestServer_Tools(t *testing.T) {
+	s := New(vst.New(), "test")
+
+	callTool(t, s, "write_file", map[string]any{"path": "src/main.go", "content": "package main\n"})
+	callTool(t, s, "write_file", map[string]any{"path": "bin/run", "content": "#!/bin/sh\n", "executable": true})
+	callTool(t, s, "write_file", map[string]any{"path": "blob", "content": "AP8=", "encoding": "base64"})
+	text, isErr := callTool(t, s, "snapshot_commit", map[string]any{"message": "one"})
+	var c1 struct {
+		SnapshotID string `json:"snapshot_id"`
+	}
+	if isErr || json.Unmarshal([]byte(text), &c1) != nil || c1.SnapshotID == "" {
+		t.Fatalf("commit = %s", text)
+	}
+
+	if text, _ := callTool(t, s, "read_file_at", map[string]any{"path": "blob"}); text != "base64:AP8=" {
+		t.Fatalf("read blob = %q", text)
+	}
+	callTool(t, s, "write_file", map[string]any{"path": "src/main.go", "content": "package main // v2\n"})
+	callTool(t, s, "write_file", map[string]any{"path": "src/util.go", "content": "package main\n"})
+	callTool(t, s, "delete_file", map[string]any{"path": "blob"})
+	text, _ = callTool(t, s, "snapshot_commit", nil)
+	var c2 struct {
+		SnapshotID string `json:"snapshot_id"`
+	}
+	_ = json.Unmarshal([]byte(text), &c2)
+
+	text, isErr = callTool(t, s, "snapshot_diff", map[string]any{"from": c1.SnapshotID, "to": c2.SnapshotID})
+	if isErr || text != `{"added":["src/util.go"],"changed":["src/main.go"],"deleted":["blob"]}` {
+		t.Fatalf("diff = %s", text)
+	}
+
+	if text, _ := callTool(t, s, "read_file_at", map[string]any{"path": "/src/main.go", "snapshot_id": c1.SnapshotID}); text != "package main\n" {
+		t.Fatalf("read at c1 = %q", text)
+	}
+	if text, _ := callTool(t, s, "read_file_at", map[string]any{"path": "src/main.go"}); text != "package main // v2\n" {
+		t.Fatalf("read working set = %q", text)
+	}
+	if text, _ := callTool(t, s, "list_files", map[string]any{"prefix": "src"}); text != `{"files":["src/main.go","src/util.go"]}` {
+		t.Fatalf("list src = %s", text)
+	}
+	if text, _ := callTool(t, s, "list_files", map[string]any{"snapshot_id": c1.SnapshotID}); text != `{"files":["bin/run","blob","src/main.go"]}` {
+		t.Fatalf("list c1 = %s", text)
+	}
+
+	callTool(t, s, "snapshot_restore", map[string]any{"snapshot_id": c1.SnapshotID})
+	if text, _ := callTool(t, s, "list_files", nil); text != `{"files":["bin/run","blob","src/main.go"]}` {
+		t.Fatalf("list after restore = %s", text)
+	}
+
+	for _, tc := range []struct {
+		name string
+		args map[string]any
+	}{
+		{"snapshot_restore", map[string]any{"snapshot_id": "nope"}},
+		{"snapshot_restore", map[string]any{}},
+		{"read_file_at", map[string]any{"path": "missing"}},
+		{"read_file_at", map[string]any{"path": "../etc/passwd"}},
+		{"write_file", map[string]any{"path": "a", "contents": "typo"}},
+		{"write_file", map[string]any{"path": "a", "content": "!", "encoding": "base64"}},
+		{"delete_file", map[string]any{"path": "missing"}},
+	} {
+		if text, isErr := callTool(t, s, tc.name, tc.args); !isErr || text == "" {
+			t.Errorf("%s %v: want a tool error, got %q", tc.name, tc.args, text)
+		}
+	}
+}
@@ -0,0 +1,342 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mcp
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/good-night-oppie/helios/pkg/helios/types"
+	"github.com/good-night-oppie/helios/pkg/helios/vst"
+)
+
+// tool is one MCP tool. run decodes its arguments and returns the text of
+// the result.
+type tool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	InputSchema json.RawMessage `json:"inputSchema"`
+	run         func(eng Engine, args json.RawMessage) (string, error)
+}
+
+var toolList = []*tool{
+	{
+		Name:        "snapshot_commit",
+		Description: "Commit the working set as an immutable snapshot and return its id. Committing unchanged content returns the same id.",
+		InputSchema: json.RawMessage(`{"type":"object","properties":{"message":{"type":"string","description":"Commit message"}},"additionalProperties":false}`),
+		run:         commitTool,
+	},
+	{
+		Name:        "snapshot_restore",
+		Description: "Replace the working set with the contents of a snapshot.",
+		InputSchema: json.RawMessage(`{"type":"object","properties":{"snapshot_id":{"type":"string"}},"required":["snapshot_id"],"additionalProperties":false}`),
+		run:         restoreTool,
+	},
+	{
+		Name:        "snapshot_diff",
+		Description: "List the files added, changed and deleted between two snapshots.",
+		InputSchema: json.RawMessage(`{"type":"object","properties":{"from":{"type":"string"},"to":{"type":"string"}},"required":["from","to"],"additionalProperties":false}`),
+		run:         diffTool,
+	},
+	{
+		Name:        "read_file_at",
+		Description: "Read a file from a snapshot, or from the working set if snapshot_id is omitted. Text is returned as is; other content as base64, prefixed with \"base64:\".",
+		InputSchema: json.RawMessage(`{"type":"object","properties":{"path":{"type":"string"},"snapshot_id":{"type":"string","description":"Snapshot to read from; the working set if omitted"}},"required":["path"],"additionalProperties":false}`),
+		run:         readFileTool,
+	},
+	{
+		Name:        "list_files",
+		Description: "List the file paths in a snapshot, or in the working set if snapshot_id is omitted.",
+		InputSchema: json.RawMessage(`{"type":"object","properties":{"snapshot_id":{"type":"string","description":"Snapshot to list; the working set if omitted"},"prefix":{"type":"string","description":"Only list paths under this directory"}},"additionalProperties":false}`),
+		run:         listFilesTool,
+	},
+	{
+		Name:        "write_file",
+		Description: "Create or replace a file in the working set. The change is kept once snapshot_commit is called.",
+		InputSchema: json.RawMessage(`{"type":"object","properties":{"path":{"type":"string"},"content":{"type":"string"},"encoding":{"type":"string","enum":["utf8","base64"],"default":"utf8"},"executable":{"type":"boolean","default":false}},"required":["path","content"],"additionalProperties":false}`),
+		run:         writeFileTool,
+	},
+	{
+		Name:        "delete_file",
+		Description: "Remove a file from the working set.",
+		InputSchema: json.RawMessage(`{"type":"object","properties":{"path":{"type":"string"}},"required":["path"],"additionalProperties":false}`),
+		run:         deleteFileTool,
+	},
+}
+
+var toolsByName = func() map[string]*tool {
+	m := make(map[string]*tool, len(toolList))
+	for _, t := range toolList {
+		m[t.Name] = t
+	}
+	return m
+}()
+
+// decodeArgs decodes tool arguments strictly, so that a misspelt argument
+// is reported rather than ignored.
+func decodeArgs(args json.RawMessage, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(args))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("invalid arguments: %w", err)
+	}
+	return nil
+}
+
+func jsonText(v any) (string, error) {
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+func commitTool(eng Engine, args json.RawMessage) (string, error) {
+	var a struct {
+		Message string `json:"message"`
+	}
+	if err := decodeArgs(args, &a); err != nil {
+		return "", err
+	}
+	id, m, err := eng.Commit(a.Message)
+	if err != nil {
+		return "", err
+	}
+	return jsonText(map[string]any{
+		"snapshot_id": id,
+		"new_objects": m.NewObjects,
+		"new_bytes":   m.NewBytes,
+		"latency_us":  m.CommitLatency.Microseconds(),
+	})
+}
+
+func restoreTool(eng Engine, args json.RawMessage) (string, error) {
+	var a struct {
+		SnapshotID types.SnapshotID `json:"snapshot_id"`
+	}
+	if err := decodeArgs(args, &a); err != nil {
+		return "", err
+	}
+	if a.SnapshotID == "" {
+		return "", errors.New("snapshot_id is required")
+	}
+	if err := eng.Restore(a.SnapshotID); err != nil {
+		return "", err
+	}
+	return jsonText(map[string]any{"restored": a.SnapshotID})
+}
+
+func diffTool(eng Engine, args json.RawMessage) (string, error) {
+	var a struct {
+		From types.SnapshotID `json:"from"`
+		To   types.SnapshotID `json:"to"`
+	}
+	if err := decodeArgs(args, &a); err != nil {
+		return "", err
+	}
+	if a.From == "" || a.To == "" {
+		return "", errors.New("from and to are required")
+	}
+	from, err := eng.FS(a.From)
+	if err != nil {
+		return "", err
+	}
+	to, err := eng.FS(a.To)
+	if err != nil {
+		return "", err
+	}
+	fromFiles, err := files(from, ".")
+	if err != nil {
+		return "", err
+	}
+	toFiles, err := files(to, ".")
+	if err != nil {
+		return "", err
+	}
+	inTo := make(map[string]bool, len(toFiles))
+	for _, p := range toFiles {
+		inTo[p] = true
+	}
+	added, changed, deleted := []string{}, []string{}, []string{}
+	inFrom := make(map[string]bool, len(fromFiles))
+	for _, p := range fromFiles {
+		inFrom[p] = true
+		if !inTo[p] {
+			deleted = append(deleted, p)
+			continue
+		}
+		same, err := from.SameFile(to, p)
+		if err != nil {
+			return "", err
+		}
+		if !same {
+			changed = append(changed, p)
+		}
+	}
+	for _, p := range toFiles {
+		if !inFrom[p] {
+			added = append(added, p)
+		}
+	}
+	return jsonText(map[string]any{"added": added, "changed": changed, "deleted": deleted})
+}
+
+// files lists the non-directory entries under root in lexical order.
+func files(fsys *vst.TreeFS, root string) ([]string, error) {
+	out := []string{}
+	err := fs.WalkDir(fsys, root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			out = append(out, p)
+		}
+		return nil
+	})
+	return out, err
+}
+
+// treeFor returns the snapshot's tree, or the working set's for an empty id.
+func treeFor(eng Engine, id types.SnapshotID) (*vst.TreeFS, error) {
+	if id == "" {
+		return eng.WorkingFS()
+	}
+	return eng.FS(id)
+}
+
+// cleanPath turns an agent-supplied path into an fs.FS name.
+func cleanPath(p string) (string, error) {
+	p = path.Clean(strings.TrimPrefix(p, "/"))
+	if !fs.ValidPath(p) {
+		return "", fmt.Errorf("invalid path %q", p)
+	}
+	return p, nil
+}
+
+func readFileTool(eng Engine, args json.RawMessage) (string, error) {
+	var a struct {
+		Path       string           `json:"path"`
+		SnapshotID types.SnapshotID `json:"snapshot_id"`
+	}
+	if err := decodeArgs(args, &a); err != nil {
+		return "", err
+	}
+	p, err := cleanPath(a.Path)
+	if err != nil || p == "." {
+		return "", fmt.Errorf("invalid path %q", a.Path)
+	}
+	fsys, err := treeFor(eng, a.SnapshotID)
+	if err != nil {
+		return "", err
+	}
+	b, err := fsys.ReadFile(p)
+	if err != nil {
+		return "", err
+	}
+	if utf8.Valid(b) {
+		return string(b), nil
+	}
+	return "base64:" + base64.StdEncoding.EncodeToString(b), nil
+}
+
+func listFilesTool(eng Engine, args json.RawMessage) (string, error) {
+	var a struct {
+		SnapshotID types.SnapshotID `json:"snapshot_id"`
+		Prefix     string           `json:"prefix"`
+	}
+	if err := decodeArgs(args, &a); err != nil {
+		return "", err
+	}
+	root, err := cleanPath(a.Prefix)
+	if err != nil {
+		return "", err
+	}
+	fsys, err := treeFor(eng, a.SnapshotID)
+	if err != nil {
+		return "", err
+	}
+	list, err := files(fsys, root)
+	if errors.Is(err, fs.ErrNotExist) {
+		list, err = []string{}, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return jsonText(map[string]any{"files": list})
+}
+
+func writeFileTool(eng Engine, args json.RawMessage) (string, error) {
+	var a struct {
+		Path       string  `json:"path"`
+		Content    *string `json:"content"`
+		Encoding   string  `json:"encoding"`
+		Executable bool    `json:"executable"`
+	}
+	if err := decodeArgs(args, &a); err != nil {
+		return "", err
+	}
+	p, err := cleanPath(a.Path)
+	if err != nil || p == "." {
+		return "", fmt.Errorf("invalid path %q", a.Path)
+	}
+	if a.Content == nil {
+		return "", errors.New("content is required")
+	}
+	var data []byte
+	switch a.Encoding {
+	case "", "utf8":
+		data = []byte(*a.Content)
+	case "base64":
+		if data, err = base64.StdEncoding.DecodeString(*a.Content); err != nil {
+			return "", fmt.Errorf("decode content: %w", err)
+		}
+	default:
+		return "", fmt.Errorf("unknown encoding %q", a.Encoding)
+	}
+	var mode fs.FileMode
+	if a.Executable {
+		mode = 0o755
+	}
+	if err := eng.WriteFileMode(p, data, mode); err != nil {
+		return "", err
+	}
+	return jsonText(map[string]any{"path": p, "bytes": len(data)})
+}
+
+func deleteFileTool(eng Engine, args json.RawMessage) (string, error) {
+	var a struct {
+		Path string `json:"path"`
+	}
+	if err := decodeArgs(args, &a); err != nil {
+		return "", err
+	}
+	p, err := cleanPath(a.Path)
+	if err != nil || p == "." {
+		return "", fmt.Errorf("invalid path %q", a.Path)
+	}
+	b, err := eng.ReadFile(p)
+	if err != nil {
+		return "", err
+	}
+	if b == nil {
+		return "", fmt.Errorf("%s: not in the working set", p)
+	}
+	eng.DeleteFile(p)
+	return jsonText(map[string]any{"deleted": p})
+}
@@ -0,0 +1,145 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package objstore_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/good-night-oppie/helios/pkg/helios/objstore"
+	"github.com/good-night-oppie/helios/pkg/helios/types"
+)
+
+var backends = map[string]func(t *testing.T) objstore.Store{
+	"pebble": func(t *testing.T) objstore.Store {
+		st, err := objstore.Open(filepath.Join(t.TempDir(), "rocks"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return st
+	},
+	"memory": func(t *testing.T) objstore.Store { return objstore.NewMemory() },
+	"loose": func(t *testing.T) objstore.Store {
+		st, err := objstore.OpenLoose(filepath.Join(t.TempDir(), "loose"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return st
+	},
+}
+
+func TestBackends_Contract(t *testing.T) {
+	for name, open := range backends {
+		t.Run(name, func(t *testing.T) {
+			st := open(t)
+			a, b := []byte("alpha"), []byte{}
+			ha, hb := hOf(t, a), hOf(t, b)
+			rec := types.Hash{Algorithm: types.BLAKE3, Digest: []byte("snapshot:123")}
+
+			if err := st.PutBatch([]objstore.BatchEntry{{Hash: ha, Value: a}, {Hash: hb, Value: b}, {Hash: rec, Value: []byte("{}")}}); err != nil {
+				t.Fatal(err)
+			}
+			a[0] = 'X' // the store must not alias the caller's buffer
+			if v, ok, err := st.Get(ha); err != nil || !ok || string(v) != "alpha" {
+				t.Fatalf("get a: %q %v %v", v, ok, err)
+			}
+			if v, ok, err := st.Get(hb); err != nil || !ok || len(v) != 0 {
+				t.Fatalf("get empty: %q %v %v", v, ok, err)
+			}
+			if _, ok, err := st.Get(hOf(t, []byte("missing"))); ok || err != nil {
+				t.Fatalf("missing: ok=%v err=%v", ok, err)
+			}
+
+			// Records are rewritten in place.
+			if err := st.PutBatch([]objstore.BatchEntry{{Hash: rec, Value: []byte(`{"a":1}`)}}); err != nil {
+				t.Fatal(err)
+			}
+			if v, _, _ := st.Get(rec); string(v) != `{"a":1}` {
+				t.Fatalf("overwrite: %q", v)
+			}
+
+			hc := hOf(t, []byte("gamma"))
+			if err := st.PutBatch([]objstore.BatchEntry{{Hash: hc, Value: []byte("gamma")}, {Hash: hOf(t, []byte("nil"))}}); err == nil {
+				t.Fatal("expected error on nil value")
+			}
+			if _, ok, _ := st.Get(hc); ok {
+				t.Fatal("preflight failure wrote an entry")
+			}
+			if err := st.Close(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestMemory_ClosedAndCopies(t *testing.T) {
+	st := objstore.NewMemory()
+	h := hOf(t, []byte("v"))
+	if err := st.PutBatch([]objstore.BatchEntry{{Hash: h, Value: []byte("v")}}); err != nil {
+		t.Fatal(err)
+	}
+	v, _, _ := st.Get(h)
+	v[0] = 'w'
+	if again, _, _ := st.Get(h); !bytes.Equal(again, []byte("v")) {
+		t.Fatalf("Get returned an aliased buffer: %q", again)
+	}
+	st.Close()
+	if _, _, err := st.Get(h); err != objstore.ErrClosed {
+		t.Fatalf("want ErrClosed, got %v", err)
+	}
+	if err := st.PutBatch([]objstore.BatchEntry{{Hash: h, Value: []byte("v")}}); err != objstore.ErrClosed {
+		t.Fatalf("want ErrClosed, got %v", err)
+	}
+}
+
+func TestLoose_LayoutAndReadOnly(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "loose")
+	st, err := objstore.OpenLoose(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := hOf(t, []byte("content"))
+	if err := st.PutBatch([]objstore.BatchEntry{{Hash: h, Value: []byte("content")}}); err != nil {
+		t.Fatal(err)
+	}
+	st.Close()
+
+	k := hex.EncodeToString(h.Digest)
+	if data, err := os.ReadFile(filepath.Join(dir, k[:2], k[2:])); err != nil || string(data) != "content" {
+		t.Fatalf("sharded file: %q %v", data, err)
+	}
+	tmps, _ := filepath.Glob(filepath.Join(dir, "*", ".tmp-*"))
+	if len(tmps) != 0 {
+		t.Fatalf("temporary files left behind: %v", tmps)
+	}
+
+	ro, err := objstore.OpenLoose(dir, &objstore.Options{ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ro.Close()
+	if v, ok, err := ro.Get(h); err != nil || !ok || string(v) != "content" {
+		t.Fatalf("read-only get: %q %v %v", v, ok, err)
+	}
+	if err := ro.PutBatch([]objstore.BatchEntry{{Hash: h, Value: []byte("x")}}); err == nil {
+		t.Fatal("read-only store accepted a write")
+	}
+	if _, err := objstore.OpenLoose(filepath.Join(dir, "absent"), &objstore.Options{ReadOnly: true}); err == nil {
+		t.Fatal("read-only open of a missing directory succeeded")
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package objstore
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/good-night-oppie/helios/pkg/helios/types"
+)
+
+type looseStore struct {
+	dir      string
+	readOnly bool
+	flat     bool
+	closed   atomic.Bool
+}
+
+// OpenLoose returns a Store keeping each value in its own file under dir,
+// named by the hex digest and sharded on its first byte (dir/ab/cdef...), or
+// kept directly in dir with Options.Flat.
+// Each file is replaced atomically, but a batch is not: a failed PutBatch
+// may leave some entries written.
+func OpenLoose(dir string, opts *Options) (Store, error) {
+	readOnly := opts != nil && opts.ReadOnly
+	if readOnly {
+		fi, err := os.Stat(dir)
+		if err != nil {
+			return nil, err
+		}
+		if !fi.IsDir() {
+			return nil, fmt.Errorf("objstore: %s is not a directory", dir)
+		}
+	} else if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &looseStore{dir: dir, readOnly: readOnly, flat: opts != nil && opts.Flat}, nil
+}
+
+func (s *looseStore) path(h types.Hash) string {
+	k := hex.EncodeToString(h.Digest)
+	if s.flat && k != "" {
+		return filepath.Join(s.dir, k)
+	}
+	if len(k) <= 2 {
+		return filepath.Join(s.dir, "_"+k)
+	}
+	return filepath.Join(s.dir, k[:2], k[2:])
+}
+
+// PutBatch writes each entry to a temporary file and renames it into place.
+// Preflight rejects any nil value.
+func (s *looseStore) PutBatch(batch []BatchEntry) error {
+	for _, entry := range batch {
+		if entry.Value == nil {
+			return errors.New("nil value in batch")
+		}
+	}
+	if s.closed.Load() {
+		return ErrClosed
+	}
+	if s.readOnly {
+		return errors.New("objstore: store is read-only")
+	}
+	for _, entry := range batch {
+		if err := s.put(s.path(entry.Hash), entry.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *looseStore) put(path string, value []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	_, err = f.Write(value)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// Get returns (value, ok, err). ok=false when key is missing.
+func (s *looseStore) Get(h types.Hash) ([]byte, bool, error) {
+	if s.closed.Load() {
+		return nil, false, ErrClosed
+	}
+	data, err := os.ReadFile(s.path(h))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+func (s *looseStore) Close() error {
+	s.closed.Store(true)
+	return nil
+}
@@ -0,0 +1,77 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package objstore
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/good-night-oppie/helios/pkg/helios/types"
+)
+
+// ErrClosed is returned by operations on a closed memory or loose store
+var ErrClosed = errors.New("objstore: store is closed")
+
+type memoryStore struct {
+	mu     sync.RWMutex
+	m      map[string][]byte
+	closed bool
+}
+
+// NewMemory returns a map-backed Store for tests and ephemeral runs. Values
+// are copied in and out, and PutBatch is atomic like the Pebble store's.
+func NewMemory() Store {
+	return &memoryStore{m: make(map[string][]byte)}
+}
+
+// PutBatch writes all entries atomically. Preflight rejects any nil value.
+func (s *memoryStore) PutBatch(batch []BatchEntry) error {
+	for _, entry := range batch {
+		if entry.Value == nil {
+			return errors.New("nil value in batch")
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+	for _, entry := range batch {
+		s.m[string(entry.Hash.Digest)] = append([]byte{}, entry.Value...)
+	}
+	return nil
+}
+
+// Get returns (value, ok, err). ok=false when key is missing.
+func (s *memoryStore) Get(h types.Hash) ([]byte, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return nil, false, ErrClosed
+	}
+	v, ok := s.m[string(h.Digest)]
+	if !ok {
+		return nil, false, nil
+	}
+	return append([]byte{}, v...), true, nil
+}
+
+func (s *memoryStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	s.m = nil
+	return nil
+}
@@ -24,6 +24,9 @@ import (
 
 type Options struct {
 	ReadOnly bool
+	// Flat keeps loose objects directly in the directory instead of sharding
+	// them by the first digest byte. Only OpenLoose uses it.
+	Flat bool
 }
 
 // BatchEntry represents a single key-value pair for batch operations
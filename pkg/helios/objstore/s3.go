@@ -0,0 +1,412 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package objstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/good-night-oppie/helios/pkg/helios/types"
+)
+
+const (
+	// minPartSize is the smallest part S3 accepts for all but the last part
+	minPartSize = 5 << 20
+	// DefaultS3PartSize is the multipart threshold and part size
+	DefaultS3PartSize = 16 << 20
+	// DefaultS3Concurrency bounds the requests in flight during PutBatch
+	DefaultS3Concurrency = 16
+	s3Retries            = 3
+)
+
+// S3Options configures an S3-API backed store. Any service speaking the S3
+// REST protocol with SigV4 works (AWS, MinIO, Ceph RGW, R2, ...).
+type S3Options struct {
+	// Endpoint is the service URL, e.g. https://s3.us-east-1.amazonaws.com
+	// or http://127.0.0.1:9000.
+	Endpoint string
+	Region   string // default us-east-1
+	Bucket   string
+	// Prefix is prepended to every object key, e.g. "ci/helios/"
+	Prefix string
+
+	// Credentials default to AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+	// AWS_SESSION_TOKEN. With no access key requests are sent unsigned.
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+
+	// PathStyle addresses the bucket as endpoint/bucket/key instead of
+	// bucket.endpoint/key; most self-hosted services need it.
+	PathStyle bool
+
+	// PartSize is the size at and above which values are sent as a multipart
+	// upload, and the size of each part. Minimum 5MB.
+	PartSize int64
+	// Concurrency bounds the uploads in flight during PutBatch
+	Concurrency int
+
+	HTTPClient *http.Client
+}
+
+// S3Error is a non-success reply from the service
+type S3Error struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func (e *S3Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("s3: status %d", e.Status)
+	}
+	return fmt.Sprintf("s3: %s: %s", e.Code, e.Message)
+}
+
+type s3Store struct {
+	opts   S3Options
+	base   *url.URL
+	signer *signer
+	client *http.Client
+}
+
+// OpenS3 returns a Store keeping each value as one object under
+// Prefix + hex(digest). Unlike the Pebble store, PutBatch is not atomic:
+// entries upload in parallel and a failed batch may leave some of them
+// written, which is harmless for content-addressed keys and retried records.
+func OpenS3(opts S3Options) (Store, error) {
+	if opts.Endpoint == "" || opts.Bucket == "" {
+		return nil, errors.New("s3: endpoint and bucket are required")
+	}
+	base, err := url.Parse(opts.Endpoint)
+	if err != nil || base.Host == "" || (base.Scheme != "http" && base.Scheme != "https") {
+		return nil, fmt.Errorf("s3: invalid endpoint %q", opts.Endpoint)
+	}
+	if opts.Region == "" {
+		opts.Region = "us-east-1"
+	}
+	if opts.AccessKey == "" {
+		opts.AccessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+		opts.SecretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		opts.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	}
+	if opts.PartSize == 0 {
+		opts.PartSize = DefaultS3PartSize
+	}
+	if opts.PartSize < minPartSize {
+		return nil, fmt.Errorf("s3: part size %d below the 5MB minimum", opts.PartSize)
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = DefaultS3Concurrency
+	}
+	client := opts.HTTPClient
+	if client == nil {
+		client = &http.Client{Transport: &http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			MaxIdleConnsPerHost: opts.Concurrency,
+			IdleConnTimeout:     90 * time.Second,
+		}}
+	}
+	s := &s3Store{opts: opts, base: base, client: client}
+	if opts.AccessKey != "" {
+		s.signer = &signer{
+			accessKey: opts.AccessKey,
+			secretKey: opts.SecretKey,
+			token:     opts.SessionToken,
+			region:    opts.Region,
+			service:   "s3",
+		}
+	}
+	return s, nil
+}
+
+// ParseS3URL reads options from s3://bucket/prefix?endpoint=URL&region=R&path_style=1.
+// Without an endpoint the regional AWS endpoint is used.
+func ParseS3URL(raw string) (S3Options, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return S3Options{}, err
+	}
+	if u.Scheme != "s3" || u.Host == "" {
+		return S3Options{}, fmt.Errorf("s3: want s3://bucket[/prefix], got %q", raw)
+	}
+	q := u.Query()
+	opts := S3Options{
+		Bucket:   u.Host,
+		Prefix:   strings.TrimPrefix(u.Path, "/"),
+		Endpoint: q.Get("endpoint"),
+		Region:   q.Get("region"),
+	}
+	if opts.Region == "" {
+		opts.Region = "us-east-1"
+	}
+	if opts.Endpoint == "" {
+		opts.Endpoint = "https://s3." + opts.Region + ".amazonaws.com"
+	}
+	if v := q.Get("path_style"); v != "" {
+		if opts.PathStyle, err = strconv.ParseBool(v); err != nil {
+			return S3Options{}, fmt.Errorf("s3: path_style: %w", err)
+		}
+	}
+	if v := q.Get("part_size"); v != "" {
+		if opts.PartSize, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return S3Options{}, fmt.Errorf("s3: part_size: %w", err)
+		}
+	}
+	if v := q.Get("concurrency"); v != "" {
+		if opts.Concurrency, err = strconv.Atoi(v); err != nil {
+			return S3Options{}, fmt.Errorf("s3: concurrency: %w", err)
+		}
+	}
+	if opts.Prefix != "" && !strings.HasSuffix(opts.Prefix, "/") {
+		opts.Prefix += "/"
+	}
+	return opts, nil
+}
+
+func (s *s3Store) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+// Get returns (value, ok, err). ok=false when the object does not exist.
+func (s *s3Store) Get(h types.Hash) ([]byte, bool, error) {
+	resp, err := s.do(context.Background(), http.MethodGet, s.key(h), nil, nil)
+	if err != nil {
+		var se *S3Error
+		if errors.As(err, &se) && se.Status == http.StatusNotFound && se.Code != "NoSuchBucket" {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+// PutBatch uploads all entries with up to Concurrency requests in flight and
+// returns once every one is stored or the first failure. Preflight rejects
+// any nil value.
+func (s *s3Store) PutBatch(batch []BatchEntry) error {
+	for _, entry := range batch {
+		if entry.Value == nil {
+			return errors.New("nil value in batch")
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	sem := make(chan struct{}, s.opts.Concurrency)
+	for _, entry := range batch {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(e BatchEntry) {
+			defer func() { <-sem; wg.Done() }()
+			if err := s.put(ctx, s.key(e.Hash), e.Value); err != nil {
+				once.Do(func() { firstErr = err; cancel() })
+			}
+		}(entry)
+	}
+	wg.Wait()
+	return firstErr
+}
+
+func (s *s3Store) put(ctx context.Context, key string, value []byte) error {
+	if int64(len(value)) >= s.opts.PartSize {
+		return s.putMultipart(ctx, key, value)
+	}
+	resp, err := s.do(ctx, http.MethodPut, key, nil, value)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+type completePart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+type completeUpload struct {
+	XMLName xml.Name       `xml:"CompleteMultipartUpload"`
+	Parts   []completePart `xml:"Part"`
+}
+
+// putMultipart sends value in PartSize pieces, aborting the upload on failure
+// so no orphaned parts are left billed against the bucket.
+func (s *s3Store) putMultipart(ctx context.Context, key string, value []byte) error {
+	resp, err := s.do(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, nil)
+	if err != nil {
+		return err
+	}
+	var initiated struct {
+		UploadID string `xml:"UploadId"`
+	}
+	err = xml.NewDecoder(resp.Body).Decode(&initiated)
+	resp.Body.Close()
+	if err != nil || initiated.UploadID == "" {
+		return fmt.Errorf("s3: initiate multipart upload for %s: %v", key, err)
+	}
+	uploadID := initiated.UploadID
+
+	abort := func(cause error) error {
+		if resp, err := s.do(context.Background(), http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil); err == nil {
+			resp.Body.Close()
+		}
+		return cause
+	}
+
+	var done completeUpload
+	for off, n := int64(0), 1; off < int64(len(value)); off, n = off+s.opts.PartSize, n+1 {
+		end := min(off+s.opts.PartSize, int64(len(value)))
+		q := url.Values{"partNumber": {strconv.Itoa(n)}, "uploadId": {uploadID}}
+		resp, err := s.do(ctx, http.MethodPut, key, q, value[off:end])
+		if err != nil {
+			return abort(err)
+		}
+		resp.Body.Close()
+		etag := resp.Header.Get("ETag")
+		if etag == "" {
+			return abort(fmt.Errorf("s3: part %d of %s: missing ETag", n, key))
+		}
+		done.Parts = append(done.Parts, completePart{PartNumber: n, ETag: etag})
+	}
+
+	body, err := xml.Marshal(done)
+	if err != nil {
+		return abort(err)
+	}
+	resp, err = s.do(ctx, http.MethodPost, key, url.Values{"uploadId": {uploadID}}, body)
+	if err != nil {
+		return abort(err)
+	}
+	defer resp.Body.Close()
+	// CompleteMultipartUpload can fail after the 200 status line, reporting
+	// the error in the body instead.
+	reply, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return abort(err)
+	}
+	if se := parseS3Error(resp.StatusCode, reply); se.Code != "" {
+		return abort(se)
+	}
+	return nil
+}
+
+// key maps a hash to its object name; digests may hold arbitrary bytes, so
+// they are hex encoded.
+func (s *s3Store) key(h types.Hash) string {
+	return s.opts.Prefix + hex.EncodeToString(h.Digest)
+}
+
+func (s *s3Store) objectURL(key string, q url.Values) *url.URL {
+	u := *s.base
+	path := strings.TrimSuffix(u.Path, "/")
+	if s.opts.PathStyle {
+		path += "/" + s.opts.Bucket
+	} else {
+		u.Host = s.opts.Bucket + "." + u.Host
+	}
+	u.Path = path + "/" + key
+	u.RawPath = ""
+	u.RawQuery = q.Encode()
+	return &u
+}
+
+// do sends one signed request, retrying transport errors and 5xx replies
+// with backoff. Non-2xx replies are returned as *S3Error.
+func (s *s3Store) do(ctx context.Context, method, key string, q url.Values, body []byte) (*http.Response, error) {
+	var lastErr error
+	for attempt := 0; attempt < s3Retries; attempt++ {
+		if attempt > 0 {
+			t := time.NewTimer(time.Duration(attempt*attempt) * 100 * time.Millisecond)
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return nil, ctx.Err()
+			case <-t.C:
+			}
+		}
+		req, err := http.NewRequestWithContext(ctx, method, s.objectURL(key, q).String(), bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.ContentLength = int64(len(body))
+		if body == nil {
+			req.Body = http.NoBody
+		}
+		if s.signer != nil {
+			s.signer.sign(req, body, time.Now())
+		}
+		resp, err := s.client.Do(req)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			lastErr = err
+			continue
+		}
+		if resp.StatusCode/100 == 2 {
+			return resp, nil
+		}
+		reply, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		resp.Body.Close()
+		lastErr = parseS3Error(resp.StatusCode, reply)
+		if resp.StatusCode < 500 {
+			return nil, lastErr
+		}
+	}
+	return nil, lastErr
+}
+
+func parseS3Error(status int, body []byte) *S3Error {
+	se := &S3Error{Status: status}
+	var e struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string   `xml:"Code"`
+		Message string   `xml:"Message"`
+	}
+	if len(body) > 0 && xml.Unmarshal(body, &e) == nil {
+		se.Code, se.Message = e.Code, e.Message
+	}
+	return se
+}
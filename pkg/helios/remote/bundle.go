@@ -0,0 +1,363 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/good-night-oppie/helios/pkg/helios/objstore"
+	"github.com/good-night-oppie/helios/pkg/helios/repo"
+	"github.com/good-night-oppie/helios/pkg/helios/types"
+	"github.com/good-night-oppie/helios/pkg/helios/vst"
+)
+
+// A bundle carries a snapshot closure in one file, for repositories that
+// cannot reach each other:
+//
+//	bundle = magic "HBUNDLE1" | zstd(record* end) | sha256 of all preceding bytes
+//	record = kind u8 | field*
+//	field  = uvarint length | bytes
+//
+// Records, in order: prerequisites ('P', snapshot id) the receiver must
+// already have; objects ('O', algorithm, digest, value) exactly as a
+// Transfer would put them, blobs first and snapshot records ancestors
+// first; the tip ('T', snapshot id); and the end marker ('E').
+
+const bundleMagic = "HBUNDLE1"
+
+const (
+	kindPrereq = 'P'
+	kindObject = 'O'
+	kindTip    = 'T'
+	kindEnd    = 'E'
+)
+
+// ErrBadBundle is returned for a bundle that is truncated, corrupt or not a
+// bundle at all.
+var ErrBadBundle = errors.New("bad bundle")
+
+// BundleStats summarises a bundle.
+type BundleStats struct {
+	Tip       types.SnapshotID `json:"tip"`
+	Since     types.SnapshotID `json:"since,omitempty"`
+	Snapshots int              `json:"snapshots"`
+	Blobs     int              `json:"blobs"`
+	Bytes     int64            `json:"bytes"`
+}
+
+// WriteBundle writes the closure of id in src to w. With a base, the bundle
+// leaves out base, its ancestors and the blobs base references, and the
+// receiver must have base.
+func WriteBundle(w io.Writer, src Endpoint, id, base types.SnapshotID) (BundleStats, error) {
+	st := BundleStats{Tip: id, Since: base}
+	sum := sha256.New()
+	mw := io.MultiWriter(w, sum)
+	if _, err := io.WriteString(mw, bundleMagic); err != nil {
+		return st, err
+	}
+	zw, err := zstd.NewWriter(mw)
+	if err != nil {
+		return st, err
+	}
+	bw := &bundleWriter{w: bufio.NewWriterSize(zw, 1<<20), have: map[string]bool{}}
+	if base != "" {
+		if err := bw.assume(src, base); err != nil {
+			zw.Close()
+			return st, err
+		}
+		bw.record(kindPrereq, []byte(base))
+	}
+
+	res, err := Transfer(src, bw, map[string]types.SnapshotID{repo.Head: id}, Options{Force: true})
+	if err == nil && bw.err != nil {
+		err = bw.err
+	}
+	if err != nil {
+		zw.Close()
+		return st, err
+	}
+	bw.record(kindTip, []byte(id))
+	bw.record(kindEnd)
+	if err := bw.w.Flush(); err != nil {
+		zw.Close()
+		return st, err
+	}
+	if bw.err != nil {
+		zw.Close()
+		return st, bw.err
+	}
+	if err := zw.Close(); err != nil {
+		return st, err
+	}
+	if _, err := w.Write(sum.Sum(nil)); err != nil {
+		return st, err
+	}
+	st.Snapshots, st.Blobs, st.Bytes = res.Snapshots, res.Blobs, res.Bytes
+	return st, nil
+}
+
+// bundleWriter is the receiving Endpoint of the Transfer that fills a
+// bundle. It claims to have what the receiver is assumed to have.
+type bundleWriter struct {
+	w    *bufio.Writer
+	have map[string]bool // keys the receiver has
+	err  error
+}
+
+// assume marks base, its ancestors and base's blobs as held by the receiver.
+func (b *bundleWriter) assume(src Endpoint, base types.SnapshotID) error {
+	recs, err := readRecords(src, []types.SnapshotID{base})
+	if err != nil {
+		return err
+	}
+	hashes, err := manifestBlobs(recs)
+	if err != nil {
+		return err
+	}
+	for _, h := range hashes {
+		b.have[string(h.Digest)] = true
+	}
+	seen := map[types.SnapshotID]bool{}
+	level := []types.SnapshotID{base}
+	for len(level) > 0 {
+		var next []types.SnapshotID
+		keys := make([]types.Hash, 0, len(level))
+		for _, id := range level {
+			if !seen[id] {
+				seen[id] = true
+				b.have[string(vst.ManifestKey(id).Digest)] = true
+				keys = append(keys, vst.ParentsKey(id))
+			}
+		}
+		vals, err := getAll(src, keys)
+		if err != nil {
+			return err
+		}
+		for _, v := range vals {
+			ps, err := decodeParents(v)
+			if err != nil {
+				return err
+			}
+			next = append(next, ps...)
+		}
+		level = next
+	}
+	return nil
+}
+
+func (b *bundleWriter) record(kind byte, fields ...[]byte) {
+	if b.err != nil {
+		return
+	}
+	var scratch [binary.MaxVarintLen64]byte
+	b.w.WriteByte(kind)
+	for _, f := range fields {
+		b.w.Write(binary.AppendUvarint(scratch[:0], uint64(len(f))))
+		if _, err := b.w.Write(f); err != nil {
+			b.err = err
+			return
+		}
+	}
+}
+
+func (b *bundleWriter) Refs() (map[string]types.SnapshotID, error) {
+	return map[string]types.SnapshotID{}, nil
+}
+
+func (b *bundleWriter) UpdateRefs([]repo.RefUpdate) error { return b.err }
+
+func (b *bundleWriter) Has(keys []types.Hash) ([]bool, error) {
+	out := make([]bool, len(keys))
+	for i, k := range keys {
+		out[i] = b.have[string(k.Digest)]
+	}
+	return out, nil
+}
+
+func (b *bundleWriter) Get(keys []types.Hash) ([][]byte, error) {
+	return nil, errors.New("bundle: not readable while writing")
+}
+
+func (b *bundleWriter) Put(entries []objstore.BatchEntry) error {
+	for _, e := range entries {
+		b.record(kindObject, []byte(e.Hash.Algorithm), e.Hash.Digest, e.Value)
+	}
+	return b.err
+}
+
+func (b *bundleWriter) Close() error { return nil }
+
+// ReadBundle verifies the checksum of the bundle in r, then stores its
+// objects in dst. It fails before storing anything if the bundle is
+// corrupt or dst lacks a prerequisite snapshot. Refs are left alone; the
+// caller may point one at the returned Tip.
+func ReadBundle(r io.ReadSeeker, dst Endpoint) (BundleStats, error) {
+	var st BundleStats
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return st, err
+	}
+	if size < int64(len(bundleMagic)+sha256.Size) {
+		return st, fmt.Errorf("%w: too short", ErrBadBundle)
+	}
+	body := size - sha256.Size
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return st, err
+	}
+	sum := sha256.New()
+	if _, err := io.CopyN(sum, r, body); err != nil {
+		return st, err
+	}
+	want := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(r, want); err != nil {
+		return st, err
+	}
+	if !bytes.Equal(sum.Sum(nil), want) {
+		return st, fmt.Errorf("%w: checksum mismatch", ErrBadBundle)
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return st, err
+	}
+	br := bufio.NewReader(io.LimitReader(r, body))
+	magic := make([]byte, len(bundleMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != bundleMagic {
+		return st, fmt.Errorf("%w: not a helios bundle", ErrBadBundle)
+	}
+	zr, err := zstd.NewReader(br)
+	if err != nil {
+		return st, err
+	}
+	defer zr.Close()
+	return applyBundle(bufio.NewReader(zr), dst)
+}
+
+// maxBatchBytes bounds the objects ReadBundle buffers before storing them,
+// and the blobs a Transfer sends in one Put.
+const maxBatchBytes = 8 << 20
+
+func applyBundle(r *bufio.Reader, dst Endpoint) (BundleStats, error) {
+	var st BundleStats
+	var batch []objstore.BatchEntry
+	var batchBytes int
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		keys := make([]types.Hash, len(batch))
+		for i, e := range batch {
+			keys[i] = e.Hash
+		}
+		have, err := dst.Has(keys)
+		if err != nil {
+			return err
+		}
+		var put []objstore.BatchEntry
+		for i, e := range batch {
+			if !have[i] {
+				put = append(put, e)
+			}
+		}
+		batch, batchBytes = nil, 0
+		return dst.Put(put)
+	}
+
+	for {
+		kind, err := r.ReadByte()
+		if err != nil {
+			return st, fmt.Errorf("%w: %v", ErrBadBundle, err)
+		}
+		switch kind {
+		case kindPrereq:
+			id, err := readField(r)
+			if err != nil {
+				return st, err
+			}
+			st.Since = types.SnapshotID(id)
+			have, err := dst.Has([]types.Hash{vst.ManifestKey(st.Since)})
+			if err != nil {
+				return st, err
+			}
+			if !have[0] {
+				return st, fmt.Errorf("bundle requires snapshot %s, which this repository lacks", st.Since)
+			}
+		case kindObject:
+			var fs [3][]byte
+			for i := range fs {
+				if fs[i], err = readField(r); err != nil {
+					return st, err
+				}
+			}
+			e := Entry{Key: types.Hash{Algorithm: types.HashAlgorithm(fs[0]), Digest: fs[1]}, Value: fs[2]}
+			if err := verify(e); err != nil {
+				return st, fmt.Errorf("%w: %v", ErrBadBundle, err)
+			}
+			switch key := string(e.Key.Digest); {
+			case strings.HasPrefix(key, "snapshot:"):
+				st.Snapshots++
+			case isRecordKey(key):
+			default:
+				st.Blobs++
+				st.Bytes += int64(len(e.Value))
+			}
+			batch = append(batch, objstore.BatchEntry{Hash: e.Key, Value: e.Value})
+			if batchBytes += len(e.Value); batchBytes >= maxBatchBytes || len(batch) >= batchKeys {
+				if err := flush(); err != nil {
+					return st, err
+				}
+			}
+		case kindTip:
+			id, err := readField(r)
+			if err != nil {
+				return st, err
+			}
+			st.Tip = types.SnapshotID(id)
+		case kindEnd:
+			if err := flush(); err != nil {
+				return st, err
+			}
+			if st.Tip == "" {
+				return st, fmt.Errorf("%w: no tip", ErrBadBundle)
+			}
+			return st, nil
+		default:
+			return st, fmt.Errorf("%w: unknown record %q", ErrBadBundle, kind)
+		}
+	}
+}
+
+func readField(r *bufio.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadBundle, err)
+	}
+	if n > 1<<34 {
+		return nil, fmt.Errorf("%w: field of %d bytes", ErrBadBundle, n)
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadBundle, err)
+	}
+	return b, nil
+}
@@ -0,0 +1,106 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/good-night-oppie/helios/pkg/helios/types"
+	"github.com/good-night-oppie/helios/pkg/helios/vst"
+)
+
+func TestBundle_RoundTrip(t *testing.T) {
+	src, dst, other := newSide(t), newSide(t), newSide(t)
+	c1 := src.commit(t, map[string]string{"a.txt": "alpha", "b.txt": "beta"})
+	c2 := src.commit(t, map[string]string{"a.txt": "ALPHA"}, c1)
+
+	var full bytes.Buffer
+	st, err := WriteBundle(&full, src, c2, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Snapshots != 2 || st.Blobs != 3 {
+		t.Fatalf("write stats = %+v", st)
+	}
+	got, err := ReadBundle(bytes.NewReader(full.Bytes()), dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Tip != c2 || got.Snapshots != 2 || got.Blobs != 3 || got.Bytes != st.Bytes {
+		t.Fatalf("read stats = %+v, wrote %+v", got, st)
+	}
+	if s := readAt(t, dst, c1, "a.txt"); s != "alpha" {
+		t.Fatalf("c1 a.txt = %q", s)
+	}
+	if ps, _ := dst.eng.Parents(c2); len(ps) != 1 || ps[0] != c1 {
+		t.Fatalf("lineage = %v", ps)
+	}
+
+	// An incremental bundle leaves out the base and what it references.
+	c3 := src.commit(t, map[string]string{"c.txt": "gamma"}, c2)
+	var inc bytes.Buffer
+	st, err = WriteBundle(&inc, src, c3, c2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Snapshots != 1 || st.Blobs != 1 || inc.Len() >= full.Len() {
+		t.Fatalf("incremental stats = %+v (%d bytes, full %d)", st, inc.Len(), full.Len())
+	}
+	if _, err := ReadBundle(bytes.NewReader(inc.Bytes()), other); err == nil {
+		t.Fatal("a repository without the base accepted an incremental bundle")
+	}
+	if has, _ := other.Has([]types.Hash{vst.ManifestKey(c3)}); has[0] {
+		t.Fatal("a rejected bundle stored objects")
+	}
+	if _, err := ReadBundle(bytes.NewReader(inc.Bytes()), dst); err != nil {
+		t.Fatal(err)
+	}
+	if s := readAt(t, dst, c3, "c.txt"); s != "gamma" {
+		t.Fatalf("c3 c.txt = %q", s)
+	}
+
+	// Pointing a ref at the tip goes through the usual fast-forward check.
+	if _, err := Transfer(dst, dst, map[string]types.SnapshotID{"HEAD": c3}, Options{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBundle_Corrupt(t *testing.T) {
+	src, dst := newSide(t), newSide(t)
+	c1 := src.commit(t, map[string]string{"a.txt": "alpha"})
+	var b bytes.Buffer
+	if _, err := WriteBundle(&b, src, c1, ""); err != nil {
+		t.Fatal(err)
+	}
+	data := b.Bytes()
+
+	flipped := append([]byte(nil), data...)
+	flipped[len(flipped)/2] ^= 0xff
+	for name, in := range map[string][]byte{
+		"flipped":   flipped,
+		"truncated": data[:len(data)-1],
+		"empty":     nil,
+		"not":       append([]byte("NOTABNDL"), data[8:]...),
+	} {
+		if _, err := ReadBundle(bytes.NewReader(in), dst); !errors.Is(err, ErrBadBundle) {
+			t.Errorf("%s: err = %v, want ErrBadBundle", name, err)
+		}
+	}
+	if _, err := WriteBundle(&b, src, "blake3:missing", ""); err == nil {
+		t.Fatal("bundling an unknown snapshot should fail")
+	}
+}
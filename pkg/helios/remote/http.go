@@ -0,0 +1,406 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/good-night-oppie/helios/internal/util"
+	"github.com/good-night-oppie/helios/pkg/helios/client"
+	"github.com/good-night-oppie/helios/pkg/helios/objstore"
+	"github.com/good-night-oppie/helios/pkg/helios/repo"
+	"github.com/good-night-oppie/helios/pkg/helios/server"
+	"github.com/good-night-oppie/helios/pkg/helios/types"
+	"github.com/good-night-oppie/helios/pkg/helios/vst"
+)
+
+// Wire types of the sync API that Handler serves:
+//
+//	GET  /v1/sync/refs                      -> RefsResponse
+//	POST /v1/sync/refs  UpdateRefsRequest   -> {} (409 on a ref conflict)
+//	POST /v1/sync/has   KeysRequest         -> HasResponse
+//	POST /v1/sync/get   KeysRequest         -> GetResponse
+//	POST /v1/sync/put   PutRequest          -> {}
+
+// RefsResponse lists a repository's refs.
+type RefsResponse struct {
+	Refs map[string]types.SnapshotID `json:"refs"`
+}
+
+// UpdateRefsRequest moves refs atomically.
+type UpdateRefsRequest struct {
+	Updates []repo.RefUpdate `json:"updates"`
+}
+
+// KeysRequest names objects.
+type KeysRequest struct {
+	Keys []types.Hash `json:"keys"`
+}
+
+// HasResponse reports which requested keys are present.
+type HasResponse struct {
+	Have []bool `json:"have"`
+}
+
+// GetResponse carries the requested values, null for missing keys.
+type GetResponse struct {
+	Values [][]byte `json:"values"`
+}
+
+// Entry is one stored object.
+type Entry struct {
+	Key   types.Hash `json:"key"`
+	Value []byte     `json:"value"`
+}
+
+// PutRequest stores objects.
+type PutRequest struct {
+	Entries []Entry `json:"entries"`
+}
+
+// Handler serves e's sync API, for mounting next to a server.Server.
+// Incoming blobs are checked against their keys and snapshot records
+// against their ids, so a client cannot plant content under a wrong
+// address or rewrite a snapshot; see checkPut.
+func Handler(e Endpoint) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/sync/refs", func(w http.ResponseWriter, r *http.Request) {
+		refs, err := e.Refs()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, RefsResponse{Refs: refs})
+	})
+	mux.HandleFunc("POST /v1/sync/refs", func(w http.ResponseWriter, r *http.Request) {
+		var req UpdateRefsRequest
+		if !decode(w, r, &req) {
+			return
+		}
+		if err := e.UpdateRefs(req.Updates); err != nil {
+			status := http.StatusUnprocessableEntity
+			if errors.Is(err, repo.ErrRefConflict) {
+				status = http.StatusConflict
+			}
+			writeError(w, status, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, struct{}{})
+	})
+	mux.HandleFunc("POST /v1/sync/has", func(w http.ResponseWriter, r *http.Request) {
+		var req KeysRequest
+		if !decode(w, r, &req) {
+			return
+		}
+		have, err := e.Has(req.Keys)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, HasResponse{Have: have})
+	})
+	mux.HandleFunc("POST /v1/sync/get", func(w http.ResponseWriter, r *http.Request) {
+		var req KeysRequest
+		if !decode(w, r, &req) {
+			return
+		}
+		vals, err := e.Get(req.Keys)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, GetResponse{Values: vals})
+	})
+	// Puts read existing records before writing, so apply them one at a time.
+	var putMu sync.Mutex
+	mux.HandleFunc("POST /v1/sync/put", func(w http.ResponseWriter, r *http.Request) {
+		var req PutRequest
+		if !decode(w, r, &req) {
+			return
+		}
+		putMu.Lock()
+		defer putMu.Unlock()
+		batch, err := checkPut(e, req.Entries)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, errInvalidEntry) {
+				status = http.StatusBadRequest
+			}
+			writeError(w, status, err)
+			return
+		}
+		if err := e.Put(batch); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, struct{}{})
+	})
+	return mux
+}
+
+// recordPrefixes are the key prefixes of snapshot records; see vst.ManifestKey.
+var recordPrefixes = []string{"snapshot:", "snapkinds:", "parents:"}
+
+func isRecordKey(key string) bool {
+	for _, p := range recordPrefixes {
+		if strings.HasPrefix(key, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// errInvalidEntry marks entries a put rejects.
+var errInvalidEntry = errors.New("invalid entry")
+
+func invalid(format string, a ...any) error {
+	return fmt.Errorf("%w: %s", errInvalidEntry, fmt.Sprintf(format, a...))
+}
+
+// checkPut returns what e should store for entries. Blobs must hash to
+// their keys. A snapshot manifest must arrive with its kinds record, if
+// any, and the two must rebuild the snapshot named by the key; records of
+// a snapshot e already has are kept as they are. Parents are merged into
+// the recorded lineage, as vst.VST.SetParents does.
+func checkPut(e Endpoint, entries []Entry) ([]objstore.BatchEntry, error) {
+	var batch []objstore.BatchEntry
+	manifests := map[types.SnapshotID][]byte{}
+	kinds := map[types.SnapshotID][]byte{}
+	parents := map[types.SnapshotID][]types.SnapshotID{}
+	for _, en := range entries {
+		if err := verify(en); err != nil {
+			return nil, err
+		}
+		key := string(en.Key.Digest)
+		if id, ok := strings.CutPrefix(key, "snapshot:"); ok {
+			manifests[types.SnapshotID(id)] = en.Value
+			continue
+		}
+		if id, ok := strings.CutPrefix(key, "snapkinds:"); ok {
+			kinds[types.SnapshotID(id)] = en.Value
+			continue
+		}
+		if id, ok := strings.CutPrefix(key, "parents:"); ok {
+			ps, err := decodeParents(en.Value)
+			if err != nil {
+				return nil, invalid("%s: %v", id, err)
+			}
+			parents[types.SnapshotID(id)] = append(parents[types.SnapshotID(id)], ps...)
+			continue
+		}
+		batch = append(batch, objstore.BatchEntry{Hash: en.Key, Value: en.Value})
+	}
+
+	for id := range kinds {
+		if _, ok := manifests[id]; !ok {
+			return nil, invalid("snapshot %s: kinds without a manifest", id)
+		}
+	}
+	ids := sortedIDs(manifests)
+	have, err := hasAll(e, manifestKeys(ids))
+	if err != nil {
+		return nil, err
+	}
+	for i, id := range ids {
+		if err := vst.CheckRecords(id, manifests[id], kinds[id]); err != nil {
+			return nil, invalid("%v", err)
+		}
+		if have[i] {
+			continue
+		}
+		if kinds[id] != nil {
+			batch = append(batch, objstore.BatchEntry{Hash: vst.KindsKey(id), Value: kinds[id]})
+		}
+		batch = append(batch, objstore.BatchEntry{Hash: vst.ManifestKey(id), Value: manifests[id]})
+	}
+
+	ids = sortedIDs(parents)
+	keys := make([]types.Hash, len(ids))
+	for i, id := range ids {
+		keys[i] = vst.ParentsKey(id)
+	}
+	cur, err := getAll(e, keys)
+	if err != nil {
+		return nil, err
+	}
+	for i, id := range ids {
+		old, err := decodeParents(cur[i])
+		if err != nil {
+			return nil, err
+		}
+		merged := append([]types.SnapshotID(nil), old...)
+		for _, p := range parents[id] {
+			if p != id && !slices.Contains(merged, p) {
+				merged = append(merged, p)
+			}
+		}
+		if len(merged) == len(old) {
+			continue
+		}
+		b, err := json.Marshal(merged)
+		if err != nil {
+			return nil, err
+		}
+		batch = append(batch, objstore.BatchEntry{Hash: vst.ParentsKey(id), Value: b})
+	}
+	return batch, nil
+}
+
+func sortedIDs[V any](m map[types.SnapshotID]V) []types.SnapshotID {
+	ids := make([]types.SnapshotID, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// verify checks that a blob is stored under its own hash and that a
+// snapshot record is JSON.
+func verify(en Entry) error {
+	if en.Value == nil {
+		return invalid("%s: missing value", en.Key)
+	}
+	if isRecordKey(string(en.Key.Digest)) {
+		if !json.Valid(en.Value) {
+			return invalid("%s: record is not JSON", en.Key.Digest)
+		}
+		return nil
+	}
+	h, err := util.HashBlob(en.Value)
+	if err != nil {
+		return err
+	}
+	if h.Algorithm != en.Key.Algorithm || !bytes.Equal(h.Digest, en.Key.Digest) {
+		return invalid("blob does not match its key %s", en.Key)
+	}
+	return nil
+}
+
+func decode(w http.ResponseWriter, r *http.Request, v any) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, server.MaxBodyBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("bad request: %w", err))
+		return false
+	}
+	return true
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, server.Error{Error: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// HTTP is a repository served by `helios serve`.
+type HTTP struct {
+	c *client.Client
+}
+
+// OpenHTTP returns an endpoint for the server at addr, in any form
+// client.New accepts.
+func OpenHTTP(addr string) (*HTTP, error) {
+	c, err := client.New(addr, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &HTTP{c: c}, nil
+}
+
+// Refs implements Endpoint.
+func (h *HTTP) Refs() (map[string]types.SnapshotID, error) {
+	var resp RefsResponse
+	if err := h.c.Do(context.Background(), "GET", "/v1/sync/refs", nil, &resp, true); err != nil {
+		return nil, err
+	}
+	if resp.Refs == nil {
+		resp.Refs = map[string]types.SnapshotID{}
+	}
+	return resp.Refs, nil
+}
+
+// UpdateRefs implements Endpoint. It is not retried: an update whose
+// response was lost may have been applied.
+func (h *HTTP) UpdateRefs(updates []repo.RefUpdate) error {
+	err := h.c.Do(context.Background(), "POST", "/v1/sync/refs", UpdateRefsRequest{Updates: updates}, nil, false)
+	var ce *client.Error
+	if errors.As(err, &ce) && ce.Status == http.StatusConflict {
+		return fmt.Errorf("%w: %s", repo.ErrRefConflict, ce.Message)
+	}
+	return err
+}
+
+// Has implements Endpoint.
+func (h *HTTP) Has(keys []types.Hash) ([]bool, error) {
+	var resp HasResponse
+	if err := h.c.Do(context.Background(), "POST", "/v1/sync/has", KeysRequest{Keys: keys}, &resp, true); err != nil {
+		return nil, err
+	}
+	if len(resp.Have) != len(keys) {
+		return nil, fmt.Errorf("sync: asked about %d keys, got %d answers", len(keys), len(resp.Have))
+	}
+	return resp.Have, nil
+}
+
+// Get implements Endpoint.
+func (h *HTTP) Get(keys []types.Hash) ([][]byte, error) {
+	var resp GetResponse
+	if err := h.c.Do(context.Background(), "POST", "/v1/sync/get", KeysRequest{Keys: keys}, &resp, true); err != nil {
+		return nil, err
+	}
+	if len(resp.Values) != len(keys) {
+		return nil, fmt.Errorf("sync: asked for %d keys, got %d values", len(keys), len(resp.Values))
+	}
+	return resp.Values, nil
+}
+
+// Put implements Endpoint. Objects are content addressed, so it is retried.
+func (h *HTTP) Put(entries []objstore.BatchEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	req := PutRequest{Entries: make([]Entry, len(entries))}
+	for i, e := range entries {
+		req.Entries[i] = Entry{Key: e.Hash, Value: e.Value}
+	}
+	return h.c.Do(context.Background(), "POST", "/v1/sync/put", req, nil, true)
+}
+
+// Close implements Endpoint.
+func (h *HTTP) Close() error { return h.c.Close() }
+
+// Open returns the endpoint for a remote given as a URL (http://, https://
+// or unix://) or a local path.
+func Open(spec string) (Endpoint, error) {
+	for _, p := range []string{"http://", "https://", "unix://"} {
+		if strings.HasPrefix(spec, p) {
+			return OpenHTTP(spec)
+		}
+	}
+	return OpenLocal(spec)
+}
@@ -0,0 +1,114 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/good-night-oppie/helios/pkg/helios/objstore"
+	"github.com/good-night-oppie/helios/pkg/helios/repo"
+	"github.com/good-night-oppie/helios/pkg/helios/types"
+)
+
+// Local is a repository on the local filesystem.
+type Local struct {
+	Repo  repo.Repo
+	Store objstore.Store
+
+	owned bool // Close closes Store
+}
+
+// NewLocal returns an endpoint for r whose objects are in st. Closing it
+// leaves st open.
+func NewLocal(r repo.Repo, st objstore.Store) *Local {
+	return &Local{Repo: r, Store: st}
+}
+
+// OpenLocal opens the repository at path: a working directory holding a
+// .helios repository, or a store directory as used with HELIOS_STORE_DIR.
+func OpenLocal(path string) (*Local, error) {
+	r := repo.Repo{Dir: filepath.Join(path, ".helios"), ObjectsDir: filepath.Join(path, ".helios", "objects")}
+	if fi, err := os.Stat(r.Dir); err != nil || !fi.IsDir() {
+		r = repo.Repo{Dir: path, ObjectsDir: path}
+	}
+	d, err := r.Load()
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("no helios repository at %s", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := repo.Check(d); err != nil {
+		return nil, err
+	}
+	st, err := objstore.Open(r.ObjectsDir, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Local{Repo: r, Store: st, owned: true}, nil
+}
+
+// Refs implements Endpoint.
+func (l *Local) Refs() (map[string]types.SnapshotID, error) { return l.Repo.Refs() }
+
+// UpdateRefs implements Endpoint.
+func (l *Local) UpdateRefs(updates []repo.RefUpdate) error { return l.Repo.UpdateRefs(updates) }
+
+// Has implements Endpoint.
+func (l *Local) Has(keys []types.Hash) ([]bool, error) {
+	out := make([]bool, len(keys))
+	for i, k := range keys {
+		_, ok, err := l.Store.Get(k)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = ok
+	}
+	return out, nil
+}
+
+// Get implements Endpoint.
+func (l *Local) Get(keys []types.Hash) ([][]byte, error) {
+	out := make([][]byte, len(keys))
+	for i, k := range keys {
+		v, ok, err := l.Store.Get(k)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			out[i] = v
+		}
+	}
+	return out, nil
+}
+
+// Put implements Endpoint.
+func (l *Local) Put(entries []objstore.BatchEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	return l.Store.PutBatch(entries)
+}
+
+// Close closes the store if OpenLocal opened it.
+func (l *Local) Close() error {
+	if l.owned {
+		return l.Store.Close()
+	}
+	return nil
+}
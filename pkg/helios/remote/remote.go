@@ -0,0 +1,430 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package remote copies snapshots and refs between Helios repositories.
+//
+// Both sides are Endpoints: a repository on the local filesystem or one
+// served over HTTP by `helios serve`. Transfer negotiates in two rounds so
+// that only what the destination lacks crosses the wire: first it asks
+// which snapshot manifests the destination has ("have"), walking lineage
+// from the requested snapshots until it meets them, then which of the
+// blobs named by the missing manifests it has. It sends the wanted blobs,
+// then the snapshot records, and finally moves the destination refs in one
+// compare-and-swap, so a ref never names a snapshot that is not fully
+// present and concurrent pushes cannot silently overwrite each other.
+//
+// A bundle (see WriteBundle) carries the objects of such a transfer in a
+// single file, for repositories that cannot reach each other.
+package remote
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/good-night-oppie/helios/pkg/helios/objstore"
+	"github.com/good-night-oppie/helios/pkg/helios/repo"
+	"github.com/good-night-oppie/helios/pkg/helios/types"
+	"github.com/good-night-oppie/helios/pkg/helios/vst"
+)
+
+// Endpoint is one side of a transfer: a repository's refs and the object
+// store holding its blobs and snapshot records.
+type Endpoint interface {
+	// Refs returns every ref.
+	Refs() (map[string]types.SnapshotID, error)
+	// UpdateRefs applies updates atomically; see repo.Repo.UpdateRefs.
+	UpdateRefs(updates []repo.RefUpdate) error
+	// Has reports which keys are present.
+	Has(keys []types.Hash) ([]bool, error)
+	// Get returns the value of each key, or nil if it is missing.
+	Get(keys []types.Hash) ([][]byte, error)
+	// Put stores entries.
+	Put(entries []objstore.BatchEntry) error
+	Close() error
+}
+
+// ErrNonFastForward is returned when a ref would move to a snapshot that
+// does not descend from its current one, and Options.Force is not set.
+var ErrNonFastForward = errors.New("non-fast-forward ref update")
+
+// batchKeys bounds the keys sent in one Has or Get request.
+const batchKeys = 256
+
+// Options tunes a Transfer.
+type Options struct {
+	// Force moves refs even when the update is not a fast-forward.
+	Force bool
+}
+
+// RefResult describes one ref moved by a Transfer.
+type RefResult struct {
+	Old types.SnapshotID `json:"old,omitempty"`
+	New types.SnapshotID `json:"new"`
+}
+
+// Result summarises a Transfer.
+type Result struct {
+	Snapshots int                  `json:"snapshots"`
+	Blobs     int                  `json:"blobs"`
+	Bytes     int64                `json:"bytes"`
+	Refs      map[string]RefResult `json:"refs"`
+}
+
+// record holds the L2 records of one snapshot.
+type record struct {
+	id       types.SnapshotID
+	manifest []byte
+	kinds    []byte
+	parents  []byte
+}
+
+// Transfer copies the snapshots named by refs (destination ref name ->
+// source snapshot), with their ancestry and blobs, from src to dst, then
+// points the destination refs at them.
+func Transfer(src, dst Endpoint, refs map[string]types.SnapshotID, opts Options) (Result, error) {
+	res := Result{Refs: map[string]RefResult{}}
+	dstRefs, err := dst.Refs()
+	if err != nil {
+		return res, err
+	}
+
+	names := make([]string, 0, len(refs))
+	for name := range refs {
+		if !repo.ValidRefName(name) {
+			return res, fmt.Errorf("invalid ref name %q", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var updates []repo.RefUpdate
+	var tips []types.SnapshotID
+	for _, name := range names {
+		old, id := dstRefs[name], refs[name]
+		if old == id {
+			continue
+		}
+		if old != "" && !opts.Force {
+			ok, err := isAncestor(src, old, id)
+			if err != nil {
+				return res, err
+			}
+			if !ok {
+				// A ref that already contains id is up to date.
+				behind, err := isAncestor(dst, id, old)
+				if err != nil {
+					return res, err
+				}
+				if behind {
+					continue
+				}
+				return res, fmt.Errorf("%w: %s is at %s, which %s does not descend from", ErrNonFastForward, name, old, id)
+			}
+		}
+		updates = append(updates, repo.RefUpdate{Name: name, Old: old, New: id})
+		tips = append(tips, id)
+	}
+
+	missing, err := missingSnapshots(src, dst, tips)
+	if err != nil {
+		return res, err
+	}
+	if err := sendBlobs(src, dst, missing, &res); err != nil {
+		return res, err
+	}
+	// Ancestors first, so that a present manifest always implies present
+	// ancestry, which the next negotiation relies on.
+	ordered, err := ancestorsFirst(missing)
+	if err != nil {
+		return res, err
+	}
+	for _, r := range ordered {
+		batch := []objstore.BatchEntry{}
+		if r.kinds != nil {
+			batch = append(batch, objstore.BatchEntry{Hash: vst.KindsKey(r.id), Value: r.kinds})
+		}
+		if r.parents != nil {
+			batch = append(batch, objstore.BatchEntry{Hash: vst.ParentsKey(r.id), Value: r.parents})
+		}
+		batch = append(batch, objstore.BatchEntry{Hash: vst.ManifestKey(r.id), Value: r.manifest})
+		if err := dst.Put(batch); err != nil {
+			return res, err
+		}
+		res.Snapshots++
+	}
+
+	if len(updates) == 0 {
+		return res, nil
+	}
+	if err := dst.UpdateRefs(updates); err != nil {
+		return res, err
+	}
+	for _, u := range updates {
+		res.Refs[u.Name] = RefResult{Old: u.Old, New: u.New}
+	}
+	return res, nil
+}
+
+// missingSnapshots walks lineage from tips breadth-first, returning the
+// records of every snapshot dst lacks, descendants before ancestors. The
+// walk stops at snapshots dst has.
+func missingSnapshots(src, dst Endpoint, tips []types.SnapshotID) ([]record, error) {
+	var out []record
+	seen := map[types.SnapshotID]bool{}
+	level := tips
+	for len(level) > 0 {
+		var ids []types.SnapshotID
+		for _, id := range level {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+		have, err := hasAll(dst, manifestKeys(ids))
+		if err != nil {
+			return nil, err
+		}
+		var want []types.SnapshotID
+		for i, id := range ids {
+			if !have[i] {
+				want = append(want, id)
+			}
+		}
+		recs, err := readRecords(src, want)
+		if err != nil {
+			return nil, err
+		}
+		level = nil
+		for _, r := range recs {
+			out = append(out, r)
+			ps, err := decodeParents(r.parents)
+			if err != nil {
+				return nil, err
+			}
+			level = append(level, ps...)
+		}
+	}
+	return out, nil
+}
+
+// ancestorsFirst orders recs so that each follows its parents among recs.
+// Content addressing allows lineage cycles (a tree reverted to an earlier
+// state); those are broken arbitrarily.
+func ancestorsFirst(recs []record) ([]record, error) {
+	byID := make(map[types.SnapshotID]record, len(recs))
+	for _, r := range recs {
+		byID[r.id] = r
+	}
+	out := make([]record, 0, len(recs))
+	visited := map[types.SnapshotID]bool{}
+	var visit func(r record) error
+	visit = func(r record) error {
+		visited[r.id] = true
+		ps, err := decodeParents(r.parents)
+		if err != nil {
+			return err
+		}
+		for _, p := range ps {
+			if pr, ok := byID[p]; ok && !visited[p] {
+				if err := visit(pr); err != nil {
+					return err
+				}
+			}
+		}
+		out = append(out, r)
+		return nil
+	}
+	for _, r := range recs {
+		if !visited[r.id] {
+			if err := visit(r); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return out, nil
+}
+
+// readRecords fetches the records of ids from src.
+func readRecords(src Endpoint, ids []types.SnapshotID) ([]record, error) {
+	keys := make([]types.Hash, 0, 3*len(ids))
+	for _, id := range ids {
+		keys = append(keys, vst.ManifestKey(id), vst.KindsKey(id), vst.ParentsKey(id))
+	}
+	vals, err := getAll(src, keys)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]record, len(ids))
+	for i, id := range ids {
+		if vals[3*i] == nil {
+			return nil, fmt.Errorf("snapshot %s is not in the source repository", id)
+		}
+		out[i] = record{id: id, manifest: vals[3*i], kinds: vals[3*i+1], parents: vals[3*i+2]}
+	}
+	return out, nil
+}
+
+// sendBlobs copies the blobs named by recs that dst lacks.
+func sendBlobs(src, dst Endpoint, recs []record, res *Result) error {
+	blobs, err := manifestBlobs(recs)
+	if err != nil {
+		return err
+	}
+	have, err := hasAll(dst, blobs)
+	if err != nil {
+		return err
+	}
+	var want []types.Hash
+	for i, h := range blobs {
+		if !have[i] {
+			want = append(want, h)
+		}
+	}
+	for start := 0; start < len(want); start += batchKeys {
+		keys := want[start:min(start+batchKeys, len(want))]
+		vals, err := src.Get(keys)
+		if err != nil {
+			return err
+		}
+		// Bound each Put by size too: over HTTP the blobs travel base64
+		// encoded in one body, which the server caps at server.MaxBodyBytes.
+		// A blob at least maxBatchBytes long goes on its own.
+		var batch []objstore.BatchEntry
+		batchBytes := 0
+		for i, h := range keys {
+			if vals[i] == nil {
+				return fmt.Errorf("blob %s is missing from the source repository", h)
+			}
+			if len(batch) > 0 && batchBytes+len(vals[i]) > maxBatchBytes {
+				if err := dst.Put(batch); err != nil {
+					return err
+				}
+				res.Blobs += len(batch)
+				batch, batchBytes = nil, 0
+			}
+			batch = append(batch, objstore.BatchEntry{Hash: h, Value: vals[i]})
+			batchBytes += len(vals[i])
+			res.Bytes += int64(len(vals[i]))
+		}
+		if err := dst.Put(batch); err != nil {
+			return err
+		}
+		res.Blobs += len(batch)
+	}
+	return nil
+}
+
+// manifestBlobs returns the distinct blobs named by the manifests of recs,
+// ordered by digest.
+func manifestBlobs(recs []record) ([]types.Hash, error) {
+	seen := map[string]bool{}
+	var blobs []types.Hash
+	for _, r := range recs {
+		var manifest map[string]types.Hash
+		if err := json.Unmarshal(r.manifest, &manifest); err != nil {
+			return nil, fmt.Errorf("snapshot %s: bad manifest: %w", r.id, err)
+		}
+		for _, h := range manifest {
+			if k := string(h.Digest); !seen[k] {
+				seen[k] = true
+				blobs = append(blobs, h)
+			}
+		}
+	}
+	sort.Slice(blobs, func(i, j int) bool { return string(blobs[i].Digest) < string(blobs[j].Digest) })
+	return blobs, nil
+}
+
+// isAncestor reports whether anc is id or reachable from it through the
+// lineage recorded in e.
+func isAncestor(e Endpoint, anc, id types.SnapshotID) (bool, error) {
+	seen := map[types.SnapshotID]bool{}
+	level := []types.SnapshotID{id}
+	for len(level) > 0 {
+		var ids []types.SnapshotID
+		for _, x := range level {
+			if x == anc {
+				return true, nil
+			}
+			if !seen[x] {
+				seen[x] = true
+				ids = append(ids, x)
+			}
+		}
+		keys := make([]types.Hash, len(ids))
+		for i, x := range ids {
+			keys[i] = vst.ParentsKey(x)
+		}
+		vals, err := getAll(e, keys)
+		if err != nil {
+			return false, err
+		}
+		level = nil
+		for _, b := range vals {
+			ps, err := decodeParents(b)
+			if err != nil {
+				return false, err
+			}
+			level = append(level, ps...)
+		}
+	}
+	return false, nil
+}
+
+func decodeParents(b []byte) ([]types.SnapshotID, error) {
+	if b == nil {
+		return nil, nil
+	}
+	var ps []types.SnapshotID
+	if err := json.Unmarshal(b, &ps); err != nil {
+		return nil, fmt.Errorf("bad snapshot parents: %w", err)
+	}
+	return ps, nil
+}
+
+func manifestKeys(ids []types.SnapshotID) []types.Hash {
+	keys := make([]types.Hash, len(ids))
+	for i, id := range ids {
+		keys[i] = vst.ManifestKey(id)
+	}
+	return keys
+}
+
+// hasAll is Has in batches of batchKeys.
+func hasAll(e Endpoint, keys []types.Hash) ([]bool, error) {
+	out := make([]bool, 0, len(keys))
+	for start := 0; start < len(keys); start += batchKeys {
+		have, err := e.Has(keys[start:min(start+batchKeys, len(keys))])
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, have...)
+	}
+	return out, nil
+}
+
+// getAll is Get in batches of batchKeys.
+func getAll(e Endpoint, keys []types.Hash) ([][]byte, error) {
+	out := make([][]byte, 0, len(keys))
+	for start := 0; start < len(keys); start += batchKeys {
+		vals, err := e.Get(keys[start:min(start+batchKeys, len(keys))])
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, vals...)
+	}
+	return out, nil
+}
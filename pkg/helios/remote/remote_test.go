@@ -0,0 +1,330 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/good-night-oppie/helios/pkg/helios/objstore"
+	"github.com/good-night-oppie/helios/pkg/helios/repo"
+	"github.com/good-night-oppie/helios/pkg/helios/types"
+	"github.com/good-night-oppie/helios/pkg/helios/vst"
+)
+
+// side is a repository with an engine on its store.
+type side struct {
+	*Local
+	eng *vst.VST
+}
+
+func newSide(t *testing.T) side {
+	t.Helper()
+	dir := t.TempDir()
+	r := repo.Repo{Dir: filepath.Join(dir, ".helios"), ObjectsDir: filepath.Join(dir, ".helios", "objects")}
+	if _, err := r.Init(); err != nil {
+		t.Fatal(err)
+	}
+	st, err := objstore.Open(r.ObjectsDir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { st.Close() })
+	eng := vst.New()
+	eng.AttachStores(nil, st)
+	return side{Local: NewLocal(r, st), eng: eng}
+}
+
+// commit writes files over the working set and commits with the given parents.
+func (s side) commit(t *testing.T, files map[string]string, parents ...types.SnapshotID) types.SnapshotID {
+	t.Helper()
+	for p, c := range files {
+		if err := s.eng.WriteFile(p, []byte(c)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	id, _, err := s.eng.Commit("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.eng.SetParents(id, parents); err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func readAt(t *testing.T, s side, id types.SnapshotID, name string) string {
+	t.Helper()
+	fsys, err := s.eng.FS(id)
+	if err != nil {
+		t.Fatalf("fs %s: %v", id, err)
+	}
+	b, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		t.Fatalf("read %s: %v", name, err)
+	}
+	return string(b)
+}
+
+func TestTransfer_SendsOnlyMissing(t *testing.T) {
+	src, dst := newSide(t), newSide(t)
+	c1 := src.commit(t, map[string]string{"a.txt": "alpha", "b.txt": "beta"})
+	c2 := src.commit(t, map[string]string{"a.txt": "ALPHA"}, c1)
+
+	res, err := Transfer(src, dst, map[string]types.SnapshotID{"HEAD": c2}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Snapshots != 2 || res.Blobs != 3 || res.Refs["HEAD"].New != c2 {
+		t.Fatalf("first push = %+v", res)
+	}
+	if got := readAt(t, dst, c1, "a.txt"); got != "alpha" {
+		t.Fatalf("c1 a.txt = %q", got)
+	}
+	if ps, _ := dst.eng.Parents(c2); len(ps) != 1 || ps[0] != c1 {
+		t.Fatalf("lineage not copied: %v", ps)
+	}
+
+	c3 := src.commit(t, map[string]string{"c.txt": "gamma"}, c2)
+	res, err = Transfer(src, dst, map[string]types.SnapshotID{"HEAD": c3}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Snapshots != 1 || res.Blobs != 1 || res.Refs["HEAD"] != (RefResult{Old: c2, New: c3}) {
+		t.Fatalf("incremental push = %+v", res)
+	}
+
+	res, err = Transfer(src, dst, map[string]types.SnapshotID{"HEAD": c3}, Options{})
+	if err != nil || res.Snapshots != 0 || res.Blobs != 0 || len(res.Refs) != 0 {
+		t.Fatalf("repeated push = %+v, %v", res, err)
+	}
+}
+
+func TestTransfer_NonFastForward(t *testing.T) {
+	src, dst := newSide(t), newSide(t)
+	c1 := src.commit(t, map[string]string{"a.txt": "1"})
+	c2 := src.commit(t, map[string]string{"a.txt": "2"}, c1)
+	if _, err := Transfer(src, dst, map[string]types.SnapshotID{"HEAD": c2}, Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	src.eng.Reset()
+	other := src.commit(t, map[string]string{"a.txt": "other"}, c1)
+	_, err := Transfer(src, dst, map[string]types.SnapshotID{"HEAD": other}, Options{})
+	if !errors.Is(err, ErrNonFastForward) {
+		t.Fatalf("err = %v, want ErrNonFastForward", err)
+	}
+	if refs, _ := dst.Refs(); refs["HEAD"] != c2 {
+		t.Fatalf("HEAD moved: %v", refs)
+	}
+	if _, err := Transfer(src, dst, map[string]types.SnapshotID{"HEAD": other}, Options{Force: true}); err != nil {
+		t.Fatalf("forced push: %v", err)
+	}
+	// A ref already ahead of the pushed snapshot stays where it is.
+	res, err := Transfer(src, dst, map[string]types.SnapshotID{"HEAD": c1}, Options{})
+	if err != nil || len(res.Refs) != 0 {
+		t.Fatalf("push of an ancestor = %+v, %v", res, err)
+	}
+	if refs, _ := dst.Refs(); refs["HEAD"] != other {
+		t.Fatalf("HEAD moved back: %v", refs)
+	}
+	// Pushing under another name never conflicts.
+	if _, err := Transfer(src, dst, map[string]types.SnapshotID{"ci/worker-1": c1}, Options{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// racingEndpoint moves a ref just before the transfer's own update.
+type racingEndpoint struct {
+	Endpoint
+	race repo.RefUpdate
+}
+
+func (r racingEndpoint) UpdateRefs(u []repo.RefUpdate) error {
+	if err := r.Endpoint.UpdateRefs([]repo.RefUpdate{r.race}); err != nil {
+		return err
+	}
+	return r.Endpoint.UpdateRefs(u)
+}
+
+func TestTransfer_ConcurrentRefUpdate(t *testing.T) {
+	src, dst := newSide(t), newSide(t)
+	c1 := src.commit(t, map[string]string{"a.txt": "1"})
+	racer := racingEndpoint{Endpoint: dst, race: repo.RefUpdate{Name: "HEAD", New: "someone-else"}}
+	_, err := Transfer(src, racer, map[string]types.SnapshotID{"HEAD": c1}, Options{})
+	if !errors.Is(err, repo.ErrRefConflict) {
+		t.Fatalf("err = %v, want ErrRefConflict", err)
+	}
+}
+
+// sizingEndpoint records the bytes of each Put.
+type sizingEndpoint struct {
+	Endpoint
+	puts *[]int
+}
+
+func (s sizingEndpoint) Put(entries []objstore.BatchEntry) error {
+	n := 0
+	for _, e := range entries {
+		n += len(e.Value)
+	}
+	*s.puts = append(*s.puts, n)
+	return s.Endpoint.Put(entries)
+}
+
+func TestTransfer_BoundsBatchBytes(t *testing.T) {
+	src, dst := newSide(t), newSide(t)
+	half := maxBatchBytes/2 + 1
+	c1 := src.commit(t, map[string]string{
+		"a": strings.Repeat("a", half),
+		"b": strings.Repeat("b", half),
+		"c": strings.Repeat("c", half),
+		"d": strings.Repeat("d", maxBatchBytes+1),
+	})
+	var puts []int
+	res, err := Transfer(src, sizingEndpoint{Endpoint: dst, puts: &puts}, map[string]types.SnapshotID{"HEAD": c1}, Options{})
+	if err != nil || res.Blobs != 4 {
+		t.Fatalf("transfer = %+v, %v", res, err)
+	}
+	// Four blob puts, each alone, then the snapshot record.
+	if len(puts) != 5 {
+		t.Fatalf("puts = %v", puts)
+	}
+	for _, n := range puts[:4] {
+		if n > maxBatchBytes+1 {
+			t.Fatalf("put of %d bytes; puts = %v", n, puts)
+		}
+	}
+	if got := readAt(t, dst, c1, "d"); len(got) != maxBatchBytes+1 {
+		t.Fatalf("d has %d bytes", len(got))
+	}
+}
+
+func TestTransfer_OverHTTP(t *testing.T) {
+	src, central, other := newSide(t), newSide(t), newSide(t)
+	srv := httptest.NewServer(Handler(central))
+	defer srv.Close()
+	remote, err := Open(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer remote.Close()
+
+	c1 := src.commit(t, map[string]string{"a.txt": "alpha", "bin/x": "x"})
+	if _, err := Transfer(src, remote, map[string]types.SnapshotID{"ci/w1": c1}, Options{}); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+	refs, err := remote.Refs()
+	if err != nil || refs["ci/w1"] != c1 {
+		t.Fatalf("remote refs = %v, %v", refs, err)
+	}
+
+	// Pull into a third repository.
+	res, err := Transfer(remote, other, refs, Options{})
+	if err != nil || res.Snapshots != 1 || res.Blobs != 2 {
+		t.Fatalf("pull = %+v, %v", res, err)
+	}
+	if got := readAt(t, other, c1, "bin/x"); got != "x" {
+		t.Fatalf("pulled bin/x = %q", got)
+	}
+
+	// A stale ref update is reported as a conflict.
+	err = remote.UpdateRefs([]repo.RefUpdate{{Name: "ci/w1", Old: "stale", New: c1}})
+	if !errors.Is(err, repo.ErrRefConflict) {
+		t.Fatalf("err = %v, want ErrRefConflict", err)
+	}
+}
+
+func TestHandler_RejectsMismatchedBlob(t *testing.T) {
+	dst := newSide(t)
+	srv := httptest.NewServer(Handler(dst))
+	defer srv.Close()
+	h, _ := OpenHTTP(srv.URL)
+	defer h.Close()
+
+	key := types.Hash{Algorithm: types.BLAKE3, Digest: make([]byte, 32)}
+	err := h.Put([]objstore.BatchEntry{{Hash: key, Value: []byte("not that")}})
+	if err == nil {
+		t.Fatal("mismatched blob accepted")
+	}
+	err = h.Put([]objstore.BatchEntry{{Hash: vst.ManifestKey("x"), Value: []byte("{oops")}})
+	if err == nil {
+		t.Fatal("malformed manifest accepted")
+	}
+	if have, _ := h.Has([]types.Hash{key}); have[0] {
+		t.Fatal("rejected blob was stored")
+	}
+	resp, err := http.Get(srv.URL + "/v1/sync/nope")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+}
+
+func TestHandler_GuardsSnapshotRecords(t *testing.T) {
+	src, dst := newSide(t), newSide(t)
+	srv := httptest.NewServer(Handler(dst))
+	defer srv.Close()
+	h, _ := OpenHTTP(srv.URL)
+	defer h.Close()
+
+	c1 := src.commit(t, map[string]string{"a.txt": "alpha"})
+	c2 := src.commit(t, map[string]string{"a.txt": "beta"}, c1)
+	if _, err := Transfer(src, h, map[string]types.SnapshotID{"main": c2}, Options{}); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+	vals, err := src.Get([]types.Hash{vst.ManifestKey(c1), vst.ManifestKey(c2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m1, m2 := vals[0], vals[1]
+
+	// A manifest must rebuild the snapshot its key names.
+	for _, id := range []types.SnapshotID{c1, "blake3:0000"} {
+		if err := h.Put([]objstore.BatchEntry{{Hash: vst.ManifestKey(id), Value: m2}}); err == nil {
+			t.Fatalf("manifest of %s accepted under %s", c2, id)
+		}
+	}
+	if err := h.Put([]objstore.BatchEntry{{Hash: vst.KindsKey(c1), Value: []byte(`{"a.txt":"symlink"}`)}}); err == nil {
+		t.Fatal("kinds without a manifest accepted")
+	}
+	// Resending a genuine record is harmless.
+	if err := h.Put([]objstore.BatchEntry{{Hash: vst.ManifestKey(c1), Value: m1}}); err != nil {
+		t.Fatalf("resend: %v", err)
+	}
+	if got := readAt(t, dst, c1, "a.txt"); got != "alpha" {
+		t.Fatalf("c1 a.txt = %q", got)
+	}
+
+	// Parents are merged, never replaced.
+	if err := h.Put([]objstore.BatchEntry{{Hash: vst.ParentsKey(c2), Value: []byte(`["other", "` + string(c2) + `"]`)}}); err != nil {
+		t.Fatalf("put parents: %v", err)
+	}
+	if err := h.Put([]objstore.BatchEntry{{Hash: vst.ParentsKey(c2), Value: []byte(`[]`)}}); err != nil {
+		t.Fatalf("put parents: %v", err)
+	}
+	vals, _ = dst.Get([]types.Hash{vst.ParentsKey(c2)})
+	if ps, _ := decodeParents(vals[0]); len(ps) != 2 || ps[0] != c1 || ps[1] != "other" {
+		t.Fatalf("parents of c2 = %v", ps)
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repo
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DictsDir holds trained compression dictionaries inside Repo.Dir, one
+	// file per dictionary named by its hexadecimal ID.
+	DictsDir = "dicts"
+
+	// FirstDictID is the ID of a repository's first dictionary. zstd reserves
+	// lower IDs for registered dictionaries.
+	FirstDictID = 1 << 15
+
+	dictExt = ".dict"
+)
+
+// Dict is a stored compression dictionary.
+type Dict struct {
+	ID   uint32
+	Data []byte
+}
+
+// Dicts returns the repository's dictionaries, newest first. A repository
+// without dictionaries returns none.
+func (r Repo) Dicts() ([]Dict, error) {
+	dir := filepath.Join(r.Dir, DictsDir)
+	ents, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var out []Dict
+	for _, e := range ents {
+		id, ok := parseDictName(e.Name())
+		if !ok || !e.Type().IsRegular() {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, Dict{ID: id, Data: b})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID > out[j].ID })
+	return out, nil
+}
+
+// NextDictID returns the ID for the repository's next dictionary.
+func (r Repo) NextDictID() (uint32, error) {
+	ds, err := r.Dicts()
+	if err != nil {
+		return 0, err
+	}
+	if len(ds) == 0 {
+		return FirstDictID, nil
+	}
+	return ds[0].ID + 1, nil
+}
+
+// WriteDict stores dictionary data under id. Existing dictionaries are never
+// replaced, since data compressed with them must stay readable.
+func (r Repo) WriteDict(id uint32, data []byte) error {
+	dir := filepath.Join(r.Dir, DictsDir)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	// Link rather than rename so an existing dictionary is not overwritten.
+	err = os.Link(tmp.Name(), filepath.Join(dir, dictName(id)))
+	if errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("dictionary %d already exists", id)
+	}
+	return err
+}
+
+func dictName(id uint32) string { return fmt.Sprintf("%08x", id) + dictExt }
+
+func parseDictName(name string) (uint32, bool) {
+	s, ok := strings.CutSuffix(name, dictExt)
+	if !ok {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(s, 16, 32)
+	return uint32(id), err == nil && id != 0
+}
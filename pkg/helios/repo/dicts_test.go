@@ -0,0 +1,55 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repo
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDicts_WriteAndList(t *testing.T) {
+	r := newRepo(t)
+	if ds, err := r.Dicts(); err != nil || len(ds) != 0 {
+		t.Fatalf("fresh dicts = %v, %v", ds, err)
+	}
+	id, err := r.NextDictID()
+	if err != nil || id != FirstDictID {
+		t.Fatalf("NextDictID = %d, %v", id, err)
+	}
+	if err := r.WriteDict(id, []byte("one")); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.WriteDict(id, []byte("clobber")); err == nil {
+		t.Fatal("existing dictionary overwritten")
+	}
+	next, _ := r.NextDictID()
+	if next != id+1 {
+		t.Fatalf("NextDictID = %d, want %d", next, id+1)
+	}
+	if err := r.WriteDict(next, []byte("two")); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(r.Dir, DictsDir, "notes.txt"), []byte("x"), 0o644)
+
+	ds, err := r.Dicts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ds) != 2 || ds[0].ID != next || !bytes.Equal(ds[0].Data, []byte("two")) || !bytes.Equal(ds[1].Data, []byte("one")) {
+		t.Fatalf("dicts = %+v", ds)
+	}
+}
@@ -0,0 +1,212 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repo
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Migration upgrades a repository from format From to From+1.
+// Apply runs with the object store closed and may rewrite any file under
+// r.Dir or r.ObjectsDir; it edits d in place to reflect the new format.
+type Migration struct {
+	From        int
+	Description string
+	Apply       func(r Repo, d *Descriptor) error
+}
+
+// migrations must cover every version from 0 to CurrentVersion-1, in order.
+var migrations = []Migration{
+	{
+		From:        0,
+		Description: "record format descriptor for stores created before versioning",
+		Apply:       func(Repo, *Descriptor) error { return nil },
+	},
+	{
+		// Snapshot manifests are keyed by ID, so snapshots committed under
+		// format 1 stay addressable by their old IDs; only new commits change.
+		From:        1,
+		Description: "compute snapshot IDs with the canonical tree encoding",
+		Apply:       func(Repo, *Descriptor) error { return nil },
+	},
+}
+
+// MigrateOptions controls Repo.Migrate.
+type MigrateOptions struct {
+	// NoBackup skips copying the repository before applying migrations.
+	NoBackup bool
+}
+
+// MigrateResult describes what Repo.Migrate did.
+type MigrateResult struct {
+	From    int      `json:"from"`
+	To      int      `json:"to"`
+	Applied []string `json:"applied"`
+	Backup  string   `json:"backup,omitempty"`
+}
+
+// Migrate upgrades the repository to CurrentVersion. The descriptor is
+// rewritten after each step, so an interrupted run resumes where it stopped.
+// Unless opts.NoBackup is set, the repository is copied into
+// Dir/backups/<timestamp>-v<from> before the first step runs.
+func (r Repo) Migrate(opts MigrateOptions) (MigrateResult, error) {
+	d, err := r.Load()
+	if errors.Is(err, os.ErrNotExist) {
+		d, err = r.Init()
+		return MigrateResult{From: d.FormatVersion, To: d.FormatVersion}, err
+	}
+	if err != nil {
+		return MigrateResult{}, err
+	}
+	res := MigrateResult{From: d.FormatVersion, To: d.FormatVersion}
+	if d.FormatVersion > CurrentVersion {
+		return res, Check(d)
+	}
+	if d.FormatVersion == CurrentVersion {
+		return res, nil
+	}
+
+	unlock, err := r.lock()
+	if err != nil {
+		return res, err
+	}
+	defer unlock()
+
+	if !opts.NoBackup {
+		if res.Backup, err = r.Backup(fmt.Sprintf("v%d", d.FormatVersion)); err != nil {
+			return res, fmt.Errorf("backup before migration: %w", err)
+		}
+	}
+
+	for d.FormatVersion < CurrentVersion {
+		m, ok := migrationFrom(d.FormatVersion)
+		if !ok {
+			return res, fmt.Errorf("no migration from format %d", d.FormatVersion)
+		}
+		if err := m.Apply(r, &d); err != nil {
+			return res, fmt.Errorf("migrate format %d -> %d: %w", m.From, m.From+1, err)
+		}
+		d.FormatVersion = m.From + 1
+		if err := r.write(d); err != nil {
+			return res, err
+		}
+		res.To = d.FormatVersion
+		res.Applied = append(res.Applied, m.Description)
+	}
+	return res, nil
+}
+
+func migrationFrom(v int) (Migration, bool) {
+	for _, m := range migrations {
+		if m.From == v {
+			return m, true
+		}
+	}
+	return Migration{}, false
+}
+
+// lock takes an exclusive, process-wide migration lock on the repository.
+func (r Repo) lock() (func(), error) {
+	if err := os.MkdirAll(r.Dir, 0o755); err != nil {
+		return nil, err
+	}
+	p := filepath.Join(r.Dir, lockFile)
+	f, err := os.OpenFile(p, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if errors.Is(err, os.ErrExist) {
+		return nil, fmt.Errorf("migration already in progress (remove %s if it is stale)", p)
+	}
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(f, "%d\n", os.Getpid())
+	f.Close()
+	return func() { os.Remove(p) }, nil
+}
+
+// Backup copies the repository into Dir/backups and returns the backup path.
+// The object store is copied too when it lives outside Dir.
+func (r Repo) Backup(label string) (string, error) {
+	dst := filepath.Join(r.Dir, BackupsDir, time.Now().UTC().Format("20060102T150405Z")+"-"+label)
+	if err := copyTree(r.Dir, dst); err != nil {
+		return "", err
+	}
+	if !within(r.ObjectsDir, r.Dir) {
+		if err := copyTree(r.ObjectsDir, filepath.Join(dst, "objects")); err != nil {
+			return "", err
+		}
+	}
+	return dst, nil
+}
+
+func within(p, dir string) bool {
+	rel, err := filepath.Rel(dir, p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// copyTree copies src into dst, skipping src's backups directory, lock file
+// and L1 cache.
+func copyTree(src, dst string) error {
+	return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		if rel == BackupsDir || rel == lockFile || rel == L1CacheFile {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		target := filepath.Join(dst, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0o755)
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		return copyFile(p, target)
+	})
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
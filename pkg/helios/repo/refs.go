@@ -0,0 +1,168 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/good-night-oppie/helios/pkg/helios/types"
+)
+
+const (
+	// RefsFile holds the repository's named snapshots inside Repo.Dir.
+	RefsFile = "refs"
+
+	// Head is the ref commit advances.
+	Head = "HEAD"
+
+	refsLock = "refs.lock"
+)
+
+// ErrRefConflict is returned when a ref no longer has the value an update
+// expected, because another writer moved it first.
+var ErrRefConflict = errors.New("ref was updated concurrently")
+
+// refsLockWait bounds how long UpdateRefs waits for another writer.
+var refsLockWait = 10 * time.Second
+
+// RefUpdate moves ref Name from Old to New. An empty Old means the ref must
+// not exist yet; an empty New deletes it.
+type RefUpdate struct {
+	Name string           `json:"name"`
+	Old  types.SnapshotID `json:"old,omitempty"`
+	New  types.SnapshotID `json:"new,omitempty"`
+}
+
+// ValidRefName reports whether name can be used as a ref: non-empty, and
+// slash-separated components that are neither empty nor "." or "..", with
+// no whitespace or control characters.
+func ValidRefName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range strings.Split(name, "/") {
+		if c == "" || c == "." || c == ".." {
+			return false
+		}
+	}
+	for _, r := range name {
+		if r <= ' ' || r == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// Refs returns every ref of the repository. A repository without refs
+// returns an empty map.
+func (r Repo) Refs() (map[string]types.SnapshotID, error) {
+	b, err := os.ReadFile(filepath.Join(r.Dir, RefsFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]types.SnapshotID{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	refs := map[string]types.SnapshotID{}
+	if err := json.Unmarshal(b, &refs); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", RefsFile, err)
+	}
+	return refs, nil
+}
+
+// UpdateRefs applies updates atomically: either every ref still has its
+// expected Old value and all move, or none does and the error wraps
+// ErrRefConflict. Writers in other processes are serialised by a lock file.
+func (r Repo) UpdateRefs(updates []RefUpdate) error {
+	for _, u := range updates {
+		if !ValidRefName(u.Name) {
+			return fmt.Errorf("invalid ref name %q", u.Name)
+		}
+	}
+	unlock, err := r.lockRefs()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	refs, err := r.Refs()
+	if err != nil {
+		return err
+	}
+	for _, u := range updates {
+		if refs[u.Name] != u.Old {
+			return fmt.Errorf("%w: %s is %q, expected %q", ErrRefConflict, u.Name, refs[u.Name], u.Old)
+		}
+	}
+	for _, u := range updates {
+		if u.New == "" {
+			delete(refs, u.Name)
+		} else {
+			refs[u.Name] = u.New
+		}
+	}
+
+	b, err := json.MarshalIndent(refs, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(r.Dir, RefsFile+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(b, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(r.Dir, RefsFile))
+}
+
+// lockRefs takes the refs lock, waiting up to refsLockWait for its holder.
+func (r Repo) lockRefs() (func(), error) {
+	if err := os.MkdirAll(r.Dir, 0o755); err != nil {
+		return nil, err
+	}
+	p := filepath.Join(r.Dir, refsLock)
+	deadline := time.Now().Add(refsLockWait)
+	for {
+		f, err := os.OpenFile(p, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			fmt.Fprintf(f, "%d\n", os.Getpid())
+			f.Close()
+			return func() { os.Remove(p) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("refs are locked (remove %s if it is stale)", p)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
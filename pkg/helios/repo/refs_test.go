@@ -0,0 +1,108 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repo
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/good-night-oppie/helios/pkg/helios/types"
+)
+
+func TestUpdateRefs_CompareAndSwap(t *testing.T) {
+	r := newRepo(t)
+	if refs, err := r.Refs(); err != nil || len(refs) != 0 {
+		t.Fatalf("fresh refs = %v, %v", refs, err)
+	}
+	if err := r.UpdateRefs([]RefUpdate{{Name: Head, New: "a"}, {Name: "ci/w1", New: "b"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// One stale expectation rejects the whole update.
+	err := r.UpdateRefs([]RefUpdate{{Name: Head, Old: "a", New: "c"}, {Name: "ci/w1", Old: "x", New: "d"}})
+	if !errors.Is(err, ErrRefConflict) {
+		t.Fatalf("err = %v, want ErrRefConflict", err)
+	}
+	if err := r.UpdateRefs([]RefUpdate{{Name: "ci/w1", New: "e"}}); !errors.Is(err, ErrRefConflict) {
+		t.Fatalf("creating an existing ref: err = %v", err)
+	}
+	refs, _ := r.Refs()
+	if refs[Head] != "a" || refs["ci/w1"] != "b" {
+		t.Fatalf("refs changed by a failed update: %v", refs)
+	}
+
+	if err := r.UpdateRefs([]RefUpdate{{Name: Head, Old: "a", New: "c"}, {Name: "ci/w1", Old: "b"}}); err != nil {
+		t.Fatal(err)
+	}
+	refs, _ = r.Refs()
+	if len(refs) != 1 || refs[Head] != "c" {
+		t.Fatalf("refs = %v", refs)
+	}
+	if err := r.UpdateRefs([]RefUpdate{{Name: "../x", New: "a"}}); err == nil {
+		t.Fatal("invalid ref name accepted")
+	}
+}
+
+func TestUpdateRefs_Concurrent(t *testing.T) {
+	r := newRepo(t)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	won := 0
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := r.UpdateRefs([]RefUpdate{{Name: Head, New: types.SnapshotID(rune('a' + i))}})
+			if err == nil {
+				mu.Lock()
+				won++
+				mu.Unlock()
+			} else if !errors.Is(err, ErrRefConflict) {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if won != 1 {
+		t.Fatalf("%d writers created HEAD, want 1", won)
+	}
+}
+
+func TestUpdateRefs_StaleLock(t *testing.T) {
+	r := newRepo(t)
+	defer func(d time.Duration) { refsLockWait = d }(refsLockWait)
+	refsLockWait = 50 * time.Millisecond
+	if err := os.WriteFile(filepath.Join(r.Dir, refsLock), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.UpdateRefs([]RefUpdate{{Name: Head, New: "a"}}); err == nil {
+		t.Fatal("update should time out on a held lock")
+	}
+}
+
+func TestLoad_RefsAloneAreNotObjects(t *testing.T) {
+	dir := t.TempDir()
+	r := Repo{Dir: dir, ObjectsDir: dir}
+	if err := r.UpdateRefs([]RefUpdate{{Name: Head, New: "a"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Load(); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("a store holding only refs should be fresh, got %v", err)
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package repo manages the on-disk format descriptor of a Helios repository
+// and upgrades older repository layouts in place.
+package repo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const (
+	// DescriptorFile is the name of the format descriptor inside Repo.Dir.
+	DescriptorFile = "format.json"
+
+	// CurrentVersion is the repository format version written by this binary.
+	CurrentVersion = 2
+
+	// BackupsDir holds pre-migration copies of the repository.
+	BackupsDir = "backups"
+
+	// L1CacheFile is the persistent L1 cache inside Repo.Dir. It is not
+	// repository data: it is never backed up and may be deleted at any time.
+	L1CacheFile = "l1cache"
+
+	lockFile = "migrate.lock"
+)
+
+var (
+	// ErrTooNew is returned when the repository was written by a newer binary.
+	ErrTooNew = errors.New("repository format is newer than this binary supports")
+	// ErrNeedsMigration is returned when the repository must be upgraded first.
+	ErrNeedsMigration = errors.New("repository format is outdated")
+	// ErrUnsupportedFeature is returned when the repository requires a feature this binary lacks.
+	ErrUnsupportedFeature = errors.New("repository requires an unsupported feature")
+)
+
+// Descriptor is the persisted repository format marker.
+type Descriptor struct {
+	FormatVersion int      `json:"format_version"`
+	Features      []string `json:"features,omitempty"`
+}
+
+// HasFeature reports whether the descriptor enables the named feature.
+func (d Descriptor) HasFeature(name string) bool {
+	for _, f := range d.Features {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+// supportedFeatures lists every feature flag this binary understands.
+// A repository that enables any other feature is refused.
+var supportedFeatures = map[string]struct{}{}
+
+// defaultFeatures are enabled on freshly initialised repositories.
+var defaultFeatures []string
+
+// Repo describes where a repository keeps its metadata and objects.
+// ObjectsDir may equal Dir when the object store is the repository root.
+type Repo struct {
+	Dir        string
+	ObjectsDir string
+}
+
+// Load reads the descriptor. A repository that has objects but no descriptor
+// predates format versioning and is reported as version 0. A repository with
+// neither returns an error satisfying errors.Is(err, os.ErrNotExist).
+func (r Repo) Load() (Descriptor, error) {
+	b, err := os.ReadFile(filepath.Join(r.Dir, DescriptorFile))
+	if err == nil {
+		var d Descriptor
+		if err := json.Unmarshal(b, &d); err != nil {
+			return Descriptor{}, fmt.Errorf("parse %s: %w", DescriptorFile, err)
+		}
+		return d, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return Descriptor{}, err
+	}
+	legacy, lerr := r.hasObjects()
+	if lerr != nil {
+		return Descriptor{}, lerr
+	}
+	if legacy {
+		return Descriptor{FormatVersion: 0}, nil
+	}
+	return Descriptor{}, fmt.Errorf("no helios repository at %s: %w", r.Dir, os.ErrNotExist)
+}
+
+// Init writes a descriptor for a fresh repository at the current version.
+func (r Repo) Init() (Descriptor, error) {
+	d := Descriptor{FormatVersion: CurrentVersion, Features: append([]string(nil), defaultFeatures...)}
+	if err := r.write(d); err != nil {
+		return Descriptor{}, err
+	}
+	return d, nil
+}
+
+// Open loads the descriptor, initialising a fresh repository if none exists,
+// and verifies this binary can read it.
+func (r Repo) Open() (Descriptor, error) {
+	d, err := r.Load()
+	if errors.Is(err, os.ErrNotExist) {
+		return r.Init()
+	}
+	if err != nil {
+		return Descriptor{}, err
+	}
+	return d, Check(d)
+}
+
+// Check reports whether this binary can operate on a repository with descriptor d.
+func Check(d Descriptor) error {
+	if d.FormatVersion > CurrentVersion {
+		return fmt.Errorf("%w: repository is format %d, this binary supports up to %d; upgrade helios",
+			ErrTooNew, d.FormatVersion, CurrentVersion)
+	}
+	for _, f := range d.Features {
+		if _, ok := supportedFeatures[f]; !ok {
+			return fmt.Errorf("%w: %q; upgrade helios", ErrUnsupportedFeature, f)
+		}
+	}
+	if d.FormatVersion < CurrentVersion {
+		return fmt.Errorf("%w: repository is format %d, current is %d; run 'helios migrate'",
+			ErrNeedsMigration, d.FormatVersion, CurrentVersion)
+	}
+	return nil
+}
+
+func (r Repo) write(d Descriptor) error {
+	if err := os.MkdirAll(r.Dir, 0o755); err != nil {
+		return err
+	}
+	sort.Strings(d.Features)
+	b, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(r.Dir, DescriptorFile+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(b, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(r.Dir, DescriptorFile))
+}
+
+// hasObjects reports whether the object store directory holds any data.
+func (r Repo) hasObjects() (bool, error) {
+	ents, err := os.ReadDir(r.ObjectsDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	for _, e := range ents {
+		switch e.Name() {
+		case DescriptorFile, BackupsDir, lockFile, RefsFile, refsLock, DictsDir, L1CacheFile:
+			continue
+		}
+		return true, nil
+	}
+	return false, nil
+}
@@ -0,0 +1,153 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repo
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newRepo(t *testing.T) Repo {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), ".helios")
+	objs := filepath.Join(dir, "objects")
+	if err := os.MkdirAll(objs, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return Repo{Dir: dir, ObjectsDir: objs}
+}
+
+func writeDescriptor(t *testing.T, r Repo, d Descriptor) {
+	t.Helper()
+	b, _ := json.Marshal(d)
+	if err := os.WriteFile(filepath.Join(r.Dir, DescriptorFile), b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpen_FreshRepoIsInitialised(t *testing.T) {
+	r := newRepo(t)
+	d, err := r.Open()
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if d.FormatVersion != CurrentVersion {
+		t.Fatalf("want version %d, got %d", CurrentVersion, d.FormatVersion)
+	}
+	got, err := r.Load()
+	if err != nil || got.FormatVersion != CurrentVersion {
+		t.Fatalf("descriptor not persisted: %+v err=%v", got, err)
+	}
+}
+
+func TestOpen_LegacyStoreNeedsMigration(t *testing.T) {
+	r := newRepo(t)
+	if err := os.WriteFile(filepath.Join(r.ObjectsDir, "000001.log"), []byte("data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Open(); !errors.Is(err, ErrNeedsMigration) {
+		t.Fatalf("want ErrNeedsMigration, got %v", err)
+	}
+}
+
+func TestOpen_TooNew(t *testing.T) {
+	r := newRepo(t)
+	writeDescriptor(t, r, Descriptor{FormatVersion: CurrentVersion + 1})
+	if _, err := r.Open(); !errors.Is(err, ErrTooNew) {
+		t.Fatalf("want ErrTooNew, got %v", err)
+	}
+}
+
+func TestOpen_UnknownFeature(t *testing.T) {
+	r := newRepo(t)
+	writeDescriptor(t, r, Descriptor{FormatVersion: CurrentVersion, Features: []string{"from-the-future"}})
+	if _, err := r.Open(); !errors.Is(err, ErrUnsupportedFeature) {
+		t.Fatalf("want ErrUnsupportedFeature, got %v", err)
+	}
+}
+
+func TestMigrate_LegacyWithBackup(t *testing.T) {
+	r := newRepo(t)
+	obj := filepath.Join(r.ObjectsDir, "000001.log")
+	if err := os.WriteFile(obj, []byte("data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := r.Migrate(MigrateOptions{})
+	if err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if res.From != 0 || res.To != CurrentVersion || len(res.Applied) != CurrentVersion {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+	b, err := os.ReadFile(filepath.Join(res.Backup, "objects", "000001.log"))
+	if err != nil || string(b) != "data" {
+		t.Fatalf("backup missing object file: %q err=%v", b, err)
+	}
+	if _, err := r.Open(); err != nil {
+		t.Fatalf("open after migrate: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(r.Dir, lockFile)); !os.IsNotExist(err) {
+		t.Fatalf("migration lock not released")
+	}
+
+	// A second run is a no-op and takes no backup.
+	res, err = r.Migrate(MigrateOptions{})
+	if err != nil || len(res.Applied) != 0 || res.Backup != "" {
+		t.Fatalf("second migrate should be a no-op: %+v err=%v", res, err)
+	}
+}
+
+func TestMigrate_RefusesConcurrentRun(t *testing.T) {
+	r := newRepo(t)
+	writeDescriptor(t, r, Descriptor{FormatVersion: 0})
+	if err := os.WriteFile(filepath.Join(r.Dir, lockFile), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Migrate(MigrateOptions{NoBackup: true}); err == nil {
+		t.Fatal("expected error while lock is held")
+	}
+}
+
+func TestMigrate_TooNew(t *testing.T) {
+	r := newRepo(t)
+	writeDescriptor(t, r, Descriptor{FormatVersion: CurrentVersion + 1})
+	if _, err := r.Migrate(MigrateOptions{}); !errors.Is(err, ErrTooNew) {
+		t.Fatalf("want ErrTooNew, got %v", err)
+	}
+}
+
+func TestBackup_ObjectsOutsideRepoDir(t *testing.T) {
+	root := t.TempDir()
+	r := Repo{Dir: filepath.Join(root, "meta"), ObjectsDir: filepath.Join(root, "objs")}
+	for _, d := range []string{r.Dir, r.ObjectsDir} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(r.ObjectsDir, "CURRENT"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	dst, err := r.Backup("test")
+	if err != nil {
+		t.Fatalf("backup: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "objects", "CURRENT")); err != nil {
+		t.Fatalf("objects not copied: %v", err)
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"io/fs"
+	"time"
+
+	"github.com/good-night-oppie/helios/internal/metrics"
+	"github.com/good-night-oppie/helios/pkg/helios/l1cache"
+	"github.com/good-night-oppie/helios/pkg/helios/types"
+)
+
+// Wire types of the v1 API. Byte slices travel as base64 strings.
+
+// Error is the body of every non-2xx response.
+type Error struct {
+	Error string `json:"error"`
+}
+
+// CommitRequest is the body of POST /v1/commit.
+type CommitRequest struct {
+	Message string `json:"message,omitempty"`
+}
+
+// CommitResponse answers POST /v1/commit.
+type CommitResponse struct {
+	SnapshotID types.SnapshotID `json:"snapshot_id"`
+	Metrics    Metrics          `json:"metrics"`
+}
+
+// Metrics mirrors types.CommitMetrics.
+type Metrics struct {
+	LatencyMicros int64 `json:"latency_us"`
+	NewObjects    int64 `json:"new_objects"`
+	NewBytes      int64 `json:"new_bytes"`
+}
+
+// MetricsOf converts engine metrics to their wire form.
+func MetricsOf(m types.CommitMetrics) Metrics {
+	return Metrics{LatencyMicros: m.CommitLatency.Microseconds(), NewObjects: m.NewObjects, NewBytes: m.NewBytes}
+}
+
+// CommitMetrics converts wire metrics back to engine metrics.
+func (m Metrics) CommitMetrics() types.CommitMetrics {
+	return types.CommitMetrics{CommitLatency: time.Duration(m.LatencyMicros) * time.Microsecond, NewObjects: m.NewObjects, NewBytes: m.NewBytes}
+}
+
+// RestoreRequest is the body of POST /v1/restore.
+type RestoreRequest struct {
+	SnapshotID types.SnapshotID `json:"snapshot_id"`
+}
+
+// DiffRequest is the body of POST /v1/diff.
+type DiffRequest struct {
+	From types.SnapshotID `json:"from"`
+	To   types.SnapshotID `json:"to"`
+}
+
+// DiffResponse answers POST /v1/diff.
+type DiffResponse struct {
+	Added   int `json:"added"`
+	Changed int `json:"changed"`
+	Deleted int `json:"deleted"`
+}
+
+// MaterializeRequest is the body of POST /v1/materialize. Out is a path on
+// the server's filesystem.
+type MaterializeRequest struct {
+	SnapshotID types.SnapshotID `json:"snapshot_id"`
+	Out        string           `json:"out"`
+	Include    []string         `json:"include,omitempty"`
+	Exclude    []string         `json:"exclude,omitempty"`
+	Sync       bool             `json:"sync,omitempty"`
+	Prune      bool             `json:"prune,omitempty"`
+	BlobCache  string           `json:"blob_cache,omitempty"`
+	ReadOnly   bool             `json:"readonly,omitempty"`
+}
+
+// MaterializeResponse answers POST /v1/materialize.
+type MaterializeResponse struct {
+	Materialized types.SnapshotID `json:"materialized"`
+	Metrics      Metrics          `json:"metrics"`
+}
+
+// FileRequest is the body of POST /v1/files/read, /v1/files/write and
+// /v1/files/delete. Mode, when non-zero on a write, gives the entry kind:
+// the executable bit or fs.ModeSymlink.
+type FileRequest struct {
+	Path    string      `json:"path"`
+	Content []byte      `json:"content,omitempty"`
+	Mode    fs.FileMode `json:"mode,omitempty"`
+}
+
+// ReadFileResponse answers POST /v1/files/read.
+type ReadFileResponse struct {
+	Path    string `json:"path"`
+	Found   bool   `json:"found"`
+	Content []byte `json:"content,omitempty"`
+}
+
+// ParentsRequest is the body of POST /v1/parents.
+type ParentsRequest struct {
+	SnapshotID types.SnapshotID   `json:"snapshot_id"`
+	Parents    []types.SnapshotID `json:"parents"`
+}
+
+// ExportRequest is the body of POST /v1/export. Format is one of the
+// archive formats ("tar", "tar.zst", "zip"); empty means tar.
+type ExportRequest struct {
+	SnapshotID types.SnapshotID `json:"snapshot_id"`
+	Format     string           `json:"format,omitempty"`
+}
+
+// StatsResponse answers GET /v1/stats, in the shape of `helios stats`.
+type StatsResponse struct {
+	L1     L1Stats          `json:"l1"`
+	Engine metrics.Snapshot `json:"engine"`
+}
+
+// L1Stats mirrors l1cache.CacheStats.
+type L1Stats struct {
+	Hits      uint64  `json:"hits"`
+	Misses    uint64  `json:"misses"`
+	Evictions uint64  `json:"evictions"`
+	Size      uint64  `json:"size"`
+	Items     uint64  `json:"items"`
+	RawSize   uint64  `json:"raw_size"`
+	Ratio     float64 `json:"ratio"`
+	FileItems uint64  `json:"file_items"`
+	FileSize  uint64  `json:"file_size"`
+}
+
+// L1StatsOf converts cache statistics to their wire form.
+func L1StatsOf(s l1cache.CacheStats) L1Stats {
+	return L1Stats{
+		Hits: s.Hits, Misses: s.Misses, Evictions: s.Evictions, Size: s.SizeBytes, Items: s.Items,
+		RawSize: s.RawBytes, Ratio: s.CompressionRatio, FileItems: s.FileItems, FileSize: s.FileBytes,
+	}
+}
+
+// CacheStats converts wire statistics back to cache statistics.
+func (s L1Stats) CacheStats() l1cache.CacheStats {
+	return l1cache.CacheStats{
+		Hits: s.Hits, Misses: s.Misses, Evictions: s.Evictions, SizeBytes: s.Size, Items: s.Items,
+		RawBytes: s.RawSize, CompressionRatio: s.Ratio, FileItems: s.FileItems, FileBytes: s.FileSize,
+	}
+}
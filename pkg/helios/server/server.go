@@ -0,0 +1,305 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package server exposes a resident Helios engine over HTTP/JSON, so that
+// clients avoid process startup and store opening on every call.
+//
+// All endpoints live under /v1 and exchange JSON; see api.go for the bodies:
+//
+//	POST /v1/commit        CommitRequest      -> CommitResponse
+//	POST /v1/restore       RestoreRequest     -> RestoreRequest
+//	POST /v1/diff          DiffRequest        -> DiffResponse
+//	POST /v1/materialize   MaterializeRequest -> MaterializeResponse
+//	POST /v1/files/read    FileRequest        -> ReadFileResponse
+//	POST /v1/files/write   FileRequest        -> FileRequest (path only)
+//	POST /v1/files/delete  FileRequest        -> FileRequest (path only)
+//	POST /v1/reset         {}                 -> {}
+//	POST /v1/parents       ParentsRequest     -> ParentsRequest
+//	POST /v1/export        ExportRequest      -> archive bytes
+//	GET  /v1/stats                            -> StatsResponse
+//	GET  /v1/health                           -> {"ok": true}
+//
+// Malformed requests get 400 and requests the engine rejects get 422, both
+// with an Error body. Behind RequireToken, requests without the token get 401.
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"sync"
+
+	"github.com/good-night-oppie/helios/internal/metrics"
+	"github.com/good-night-oppie/helios/pkg/helios/archive"
+	"github.com/good-night-oppie/helios/pkg/helios/l1cache"
+	"github.com/good-night-oppie/helios/pkg/helios/types"
+	"github.com/good-night-oppie/helios/pkg/helios/vst"
+)
+
+// MaxBodyBytes bounds the size of a request body.
+const MaxBodyBytes = 512 << 20
+
+// Engine is the engine surface the server exposes; *vst.VST implements it.
+type Engine interface {
+	WriteFile(path string, content []byte) error
+	WriteFileMode(path string, content []byte, mode fs.FileMode) error
+	ReadFile(path string) ([]byte, error)
+	DeleteFile(path string)
+	Reset()
+	Commit(msg string) (types.SnapshotID, types.CommitMetrics, error)
+	Restore(id types.SnapshotID) error
+	Diff(from, to types.SnapshotID) (types.DiffStats, error)
+	Materialize(id types.SnapshotID, outDir string, opts types.MatOpts) (types.CommitMetrics, error)
+	FS(id types.SnapshotID) (*vst.TreeFS, error)
+	SetParents(id types.SnapshotID, parents []types.SnapshotID) error
+	L1Stats() l1cache.CacheStats
+	EngineMetricsSnapshot() metrics.Snapshot
+}
+
+// Server serves one engine. Requests are applied one at a time, since the
+// engine is not safe for concurrent use.
+type Server struct {
+	mu  sync.Mutex
+	eng Engine
+	mux *http.ServeMux
+}
+
+// New returns a server for eng.
+func New(eng Engine) *Server {
+	s := &Server{eng: eng, mux: http.NewServeMux()}
+	s.mux.HandleFunc("POST /v1/commit", handle(s.commit))
+	s.mux.HandleFunc("POST /v1/restore", handle(s.restore))
+	s.mux.HandleFunc("POST /v1/diff", handle(s.diff))
+	s.mux.HandleFunc("POST /v1/materialize", handle(s.materialize))
+	s.mux.HandleFunc("POST /v1/files/read", handle(s.readFile))
+	s.mux.HandleFunc("POST /v1/files/write", handle(s.writeFile))
+	s.mux.HandleFunc("POST /v1/files/delete", handle(s.deleteFile))
+	s.mux.HandleFunc("POST /v1/reset", handle(s.reset))
+	s.mux.HandleFunc("POST /v1/parents", handle(s.setParents))
+	s.mux.HandleFunc("POST /v1/export", s.export)
+	s.mux.HandleFunc("GET /v1/stats", handle(s.stats))
+	s.mux.HandleFunc("GET /v1/health", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]bool{"ok": true})
+	})
+	return s
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// RequireToken wraps h so that only requests carrying "Authorization:
+// Bearer <token>" reach it. Listeners that other local users can connect
+// to, such as TCP ones, need it: the API writes and deletes files as the
+// server's user.
+func RequireToken(h http.Handler, token string) http.Handler {
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := []byte(r.Header.Get("Authorization"))
+		if token == "" || subtle.ConstantTimeCompare(got, want) != 1 {
+			writeJSON(w, http.StatusUnauthorized, Error{Error: "missing or wrong token"})
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// errBadRequest marks errors in the request itself.
+var errBadRequest = errors.New("bad request")
+
+func badRequest(format string, a ...any) error {
+	return fmt.Errorf("%w: %s", errBadRequest, fmt.Sprintf(format, a...))
+}
+
+// handle adapts a typed handler: it decodes the JSON body of non-GET
+// requests into Req and encodes the result or error.
+func handle[Req, Resp any](fn func(Req) (Resp, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req Req
+		if r.Method != http.MethodGet {
+			dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxBodyBytes))
+			dec.DisallowUnknownFields()
+			if err := dec.Decode(&req); err != nil {
+				writeJSON(w, http.StatusBadRequest, Error{Error: "decode request: " + err.Error()})
+				return
+			}
+		}
+		resp, err := fn(req)
+		switch {
+		case errors.Is(err, errBadRequest):
+			writeJSON(w, http.StatusBadRequest, Error{Error: err.Error()})
+		case err != nil:
+			writeJSON(w, http.StatusUnprocessableEntity, Error{Error: err.Error()})
+		default:
+			writeJSON(w, http.StatusOK, resp)
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func (s *Server) commit(req CommitRequest) (CommitResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id, m, err := s.eng.Commit(req.Message)
+	if err != nil {
+		return CommitResponse{}, err
+	}
+	return CommitResponse{SnapshotID: id, Metrics: MetricsOf(m)}, nil
+}
+
+func (s *Server) restore(req RestoreRequest) (RestoreRequest, error) {
+	if req.SnapshotID == "" {
+		return req, badRequest("snapshot_id is required")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return req, s.eng.Restore(req.SnapshotID)
+}
+
+func (s *Server) diff(req DiffRequest) (DiffResponse, error) {
+	if req.From == "" || req.To == "" {
+		return DiffResponse{}, badRequest("from and to are required")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, err := s.eng.Diff(req.From, req.To)
+	return DiffResponse{Added: st.Added, Changed: st.Changed, Deleted: st.Deleted}, err
+}
+
+func (s *Server) materialize(req MaterializeRequest) (MaterializeResponse, error) {
+	if req.SnapshotID == "" || req.Out == "" {
+		return MaterializeResponse{}, badRequest("snapshot_id and out are required")
+	}
+	opts := types.MatOpts{
+		Include:   req.Include,
+		Exclude:   req.Exclude,
+		Sync:      req.Sync,
+		Prune:     req.Prune,
+		BlobCache: req.BlobCache,
+		ReadOnly:  req.ReadOnly,
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, err := s.eng.Materialize(req.SnapshotID, req.Out, opts)
+	if err != nil {
+		return MaterializeResponse{}, err
+	}
+	return MaterializeResponse{Materialized: req.SnapshotID, Metrics: MetricsOf(m)}, nil
+}
+
+func (s *Server) readFile(req FileRequest) (ReadFileResponse, error) {
+	if req.Path == "" {
+		return ReadFileResponse{}, badRequest("path is required")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, err := s.eng.ReadFile(req.Path)
+	if err != nil {
+		return ReadFileResponse{}, err
+	}
+	// The engine reports a missing file as nil content.
+	return ReadFileResponse{Path: req.Path, Found: b != nil, Content: b}, nil
+}
+
+func (s *Server) writeFile(req FileRequest) (FileRequest, error) {
+	if req.Path == "" {
+		return FileRequest{}, badRequest("path is required")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var err error
+	if req.Mode != 0 {
+		err = s.eng.WriteFileMode(req.Path, req.Content, req.Mode)
+	} else {
+		err = s.eng.WriteFile(req.Path, req.Content)
+	}
+	return FileRequest{Path: req.Path}, err
+}
+
+func (s *Server) deleteFile(req FileRequest) (FileRequest, error) {
+	if req.Path == "" {
+		return FileRequest{}, badRequest("path is required")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.eng.DeleteFile(req.Path)
+	return FileRequest{Path: req.Path}, nil
+}
+
+func (s *Server) reset(struct{}) (struct{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.eng.Reset()
+	return struct{}{}, nil
+}
+
+func (s *Server) setParents(req ParentsRequest) (ParentsRequest, error) {
+	if req.SnapshotID == "" {
+		return req, badRequest("snapshot_id is required")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return req, s.eng.SetParents(req.SnapshotID, req.Parents)
+}
+
+// export streams a snapshot as an archive. Failures after the first byte
+// abort the connection, so clients see a truncated transfer, not a bad archive.
+func (s *Server) export(w http.ResponseWriter, r *http.Request) {
+	var req ExportRequest
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxBodyBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, Error{Error: "decode request: " + err.Error()})
+		return
+	}
+	if req.SnapshotID == "" {
+		writeJSON(w, http.StatusBadRequest, Error{Error: "snapshot_id is required"})
+		return
+	}
+	format := archive.Tar
+	if req.Format != "" {
+		var err error
+		if format, err = archive.ParseFormat(req.Format); err != nil {
+			writeJSON(w, http.StatusBadRequest, Error{Error: err.Error()})
+			return
+		}
+	}
+	s.mu.Lock()
+	fsys, err := s.eng.FS(req.SnapshotID)
+	s.mu.Unlock()
+	if err != nil {
+		writeJSON(w, http.StatusUnprocessableEntity, Error{Error: err.Error()})
+		return
+	}
+	// The TreeFS is a frozen view, so it is safe to stream without the lock.
+	w.Header().Set("Content-Type", "application/octet-stream")
+	if err := archive.Write(w, fsys, format); err != nil {
+		panic(http.ErrAbortHandler)
+	}
+}
+
+func (s *Server) stats(struct{}) (StatsResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return StatsResponse{L1: L1StatsOf(s.eng.L1Stats()), Engine: s.eng.EngineMetricsSnapshot()}, nil
+}
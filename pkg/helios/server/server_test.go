@@ -0,0 +1,198 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/good-night-oppie/helios/pkg/helios/archive"
+	"github.com/good-night-oppie/helios/pkg/helios/l1cache"
+	"github.com/good-night-oppie/helios/pkg/helios/types"
+	"github.com/good-night-oppie/helios/pkg/helios/vst"
+)
+
+func call(t *testing.T, srv *httptest.Server, method, path string, body any, wantStatus int, out any) {
+	t.Helper()
+	var rd *bytes.Reader
+	if s, ok := body.(string); ok {
+		rd = bytes.NewReader([]byte(s))
+	} else {
+		b, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rd = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, srv.URL+path, rd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != wantStatus {
+		var e Error
+		_ = json.NewDecoder(resp.Body).Decode(&e)
+		t.Fatalf("%s %s: status %d (%s), want %d", method, path, resp.StatusCode, e.Error, wantStatus)
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("%s %s: decode: %v", method, path, err)
+		}
+	}
+}
+
+func TestServer_Workflow(t *testing.T) {
+	srv := httptest.NewServer(New(vst.New()))
+	defer srv.Close()
+
+	call(t, srv, "POST", "/v1/files/write", FileRequest{Path: "a.txt", Content: []byte("alpha")}, 200, nil)
+	call(t, srv, "POST", "/v1/files/write", FileRequest{Path: "bin/run", Content: []byte("#!/bin/sh\n"), Mode: 0o755}, 200, nil)
+	var c1 CommitResponse
+	call(t, srv, "POST", "/v1/commit", CommitRequest{Message: "one"}, 200, &c1)
+	if c1.SnapshotID == "" || c1.Metrics.NewObjects != 2 {
+		t.Fatalf("commit = %+v", c1)
+	}
+
+	call(t, srv, "POST", "/v1/files/write", FileRequest{Path: "a.txt", Content: []byte("ALPHA")}, 200, nil)
+	call(t, srv, "POST", "/v1/files/delete", FileRequest{Path: "bin/run"}, 200, nil)
+	call(t, srv, "POST", "/v1/files/write", FileRequest{Path: "c.txt", Content: []byte("gamma")}, 200, nil)
+	var c2 CommitResponse
+	call(t, srv, "POST", "/v1/commit", CommitRequest{}, 200, &c2)
+
+	var d DiffResponse
+	call(t, srv, "POST", "/v1/diff", DiffRequest{From: c1.SnapshotID, To: c2.SnapshotID}, 200, &d)
+	if d != (DiffResponse{Added: 1, Changed: 1, Deleted: 1}) {
+		t.Fatalf("diff = %+v", d)
+	}
+
+	call(t, srv, "POST", "/v1/restore", RestoreRequest{SnapshotID: c1.SnapshotID}, 200, nil)
+	var rf ReadFileResponse
+	call(t, srv, "POST", "/v1/files/read", FileRequest{Path: "a.txt"}, 200, &rf)
+	if !rf.Found || string(rf.Content) != "alpha" {
+		t.Fatalf("read a.txt = %+v", rf)
+	}
+	call(t, srv, "POST", "/v1/files/read", FileRequest{Path: "c.txt"}, 200, &rf)
+	if rf.Found {
+		t.Fatalf("c.txt found after restore: %+v", rf)
+	}
+
+	out := filepath.Join(t.TempDir(), "out")
+	var m MaterializeResponse
+	call(t, srv, "POST", "/v1/materialize", MaterializeRequest{SnapshotID: c1.SnapshotID, Out: out}, 200, &m)
+	if fi, err := os.Stat(filepath.Join(out, "bin", "run")); err != nil || fi.Mode()&0o111 == 0 {
+		t.Fatalf("materialized bin/run: %v, %v", fi, err)
+	}
+
+	var st StatsResponse
+	call(t, srv, "GET", "/v1/stats", nil, 200, &st)
+	if st.Engine.NewObjects == 0 {
+		t.Fatalf("stats = %+v", st)
+	}
+	call(t, srv, "GET", "/v1/health", nil, 200, nil)
+}
+
+func TestServer_Errors(t *testing.T) {
+	srv := httptest.NewServer(New(vst.New()))
+	defer srv.Close()
+
+	call(t, srv, "POST", "/v1/commit", "{not json", 400, nil)
+	call(t, srv, "POST", "/v1/commit", `{"unknown":1}`, 400, nil)
+	call(t, srv, "POST", "/v1/restore", RestoreRequest{}, 400, nil)
+	call(t, srv, "POST", "/v1/diff", DiffRequest{From: "x"}, 400, nil)
+	call(t, srv, "POST", "/v1/materialize", MaterializeRequest{SnapshotID: "x"}, 400, nil)
+	call(t, srv, "POST", "/v1/files/write", FileRequest{}, 400, nil)
+	var e Error
+	call(t, srv, "POST", "/v1/restore", RestoreRequest{SnapshotID: "nope"}, 422, &e)
+	if e.Error == "" {
+		t.Fatal("422 without an error message")
+	}
+	call(t, srv, "GET", "/v1/commit", nil, 405, nil)
+	call(t, srv, "GET", "/v1/nope", nil, 404, nil)
+}
+
+func TestServer_ResetParentsExport(t *testing.T) {
+	eng := vst.New()
+	srv := httptest.NewServer(New(eng))
+	defer srv.Close()
+
+	call(t, srv, "POST", "/v1/files/write", FileRequest{Path: "a.txt", Content: []byte("alpha")}, 200, nil)
+	var c1 CommitResponse
+	call(t, srv, "POST", "/v1/commit", CommitRequest{}, 200, &c1)
+	call(t, srv, "POST", "/v1/reset", struct{}{}, 200, nil)
+	var rf ReadFileResponse
+	call(t, srv, "POST", "/v1/files/read", FileRequest{Path: "a.txt"}, 200, &rf)
+	if rf.Found {
+		t.Fatal("a.txt survived reset")
+	}
+	call(t, srv, "POST", "/v1/files/write", FileRequest{Path: "b.txt", Content: []byte("beta")}, 200, nil)
+	var c2 CommitResponse
+	call(t, srv, "POST", "/v1/commit", CommitRequest{}, 200, &c2)
+
+	call(t, srv, "POST", "/v1/parents", ParentsRequest{SnapshotID: c2.SnapshotID, Parents: []types.SnapshotID{c1.SnapshotID}}, 200, nil)
+	if ps, err := eng.Parents(c2.SnapshotID); err != nil || len(ps) != 1 || ps[0] != c1.SnapshotID {
+		t.Fatalf("parents = %v, %v", ps, err)
+	}
+	call(t, srv, "POST", "/v1/parents", ParentsRequest{}, 400, nil)
+
+	b, _ := json.Marshal(ExportRequest{SnapshotID: c2.SnapshotID})
+	resp, err := srv.Client().Post(srv.URL+"/v1/export", "application/json", bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("export status %d", resp.StatusCode)
+	}
+	files := map[string]string{}
+	if err := archive.Read(resp.Body, func(name string, data []byte, _ fs.FileMode) error {
+		files[name] = string(data)
+		return nil
+	}); err != nil {
+		t.Fatalf("read export: %v", err)
+	}
+	if len(files) != 1 || files["b.txt"] != "beta" {
+		t.Fatalf("export = %v", files)
+	}
+	call(t, srv, "POST", "/v1/export", ExportRequest{SnapshotID: c2.SnapshotID, Format: "rar"}, 400, nil)
+	call(t, srv, "POST", "/v1/export", ExportRequest{SnapshotID: "nope"}, 422, nil)
+}
+
+func TestL1Stats_RoundTrip(t *testing.T) {
+	cs := l1cache.CacheStats{
+		Hits: 1, Misses: 2, Evictions: 3, SizeBytes: 100, Items: 4,
+		RawBytes: 250, CompressionRatio: 2.5, FileItems: 6, FileBytes: 700,
+	}
+	b, err := json.Marshal(L1StatsOf(cs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var w L1Stats
+	if err := json.Unmarshal(b, &w); err != nil {
+		t.Fatal(err)
+	}
+	if got := w.CacheStats(); got != cs {
+		t.Fatalf("round trip = %+v, want %+v", got, cs)
+	}
+}
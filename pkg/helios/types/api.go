@@ -23,6 +23,7 @@ type CommitMetrics struct {
 	CommitLatency time.Duration
 	NewObjects    int64
 	NewBytes      int64
+	Phases        map[string]time.Duration // per-phase timings, when the operation reports them
 }
 
 type DiffStats struct {
@@ -34,6 +35,20 @@ type DiffStats struct {
 type MatOpts struct {
 	Include []string
 	Exclude []string
+	Workers int  // parallel file writers; ≤0 means GOMAXPROCS
+	Sync    bool // update an existing outDir in place, writing only changed files and deleting extras
+	// Prune lets Sync delete every selected file the snapshot lacks, not
+	// just those an earlier sync wrote, as recorded in outDir/.helios. .git
+	// and .helios directories are never touched either way.
+	Prune bool
+
+	// BlobCache is a directory of checked-out blobs, filled on demand. When
+	// set, files are placed from the cache by reflink (FICLONE) where the
+	// filesystem supports it, falling back to a copy.
+	BlobCache string
+	// ReadOnly lets files be hardlinked to the cache instead. The output is
+	// then read-only (0444) and must not be modified in place.
+	ReadOnly bool
 }
 
 type StateManager interface {
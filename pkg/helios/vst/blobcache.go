@@ -0,0 +1,131 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vst
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/good-night-oppie/helios/pkg/helios/types"
+)
+
+// errReflinkUnsupported is returned by reflink where cloning is unavailable.
+var errReflinkUnsupported = errors.New("reflink not supported")
+
+// blobCache is a directory of checked-out blobs laid out as
+// <dir>/<algorithm>/<hex[:2]>/<hex[2:]>, with executable copies under an
+// extra ".x" suffix. Entries are written once, are read-only (0444 or 0555),
+// and are never modified, so output files may share their storage through
+// reflinks or, for read-only output, hardlinks.
+type blobCache struct {
+	dir      string
+	readOnly bool
+}
+
+func (c blobCache) path(h types.Hash, exec bool) string {
+	x := hex.EncodeToString(h.Digest)
+	if exec {
+		x += ".x"
+	}
+	if len(x) < 3 {
+		return filepath.Join(c.dir, string(h.Algorithm), x)
+	}
+	return filepath.Join(c.dir, string(h.Algorithm), x[:2], x[2:])
+}
+
+// ensure returns the cache path of h for files of the given mode, calling
+// load to fill it on a miss. Concurrent fills of the same blob are harmless:
+// the last rename wins and every writer produces identical content.
+func (c blobCache) ensure(h types.Hash, mode os.FileMode, load func() ([]byte, error)) (string, error) {
+	if len(h.Digest) == 0 {
+		return "", fmt.Errorf("blob cache: empty digest")
+	}
+	exec := mode&0o111 != 0
+	cacheMode := os.FileMode(0o444)
+	if exec {
+		cacheMode = 0o555
+	}
+	p := c.path(h, exec)
+	if _, err := os.Stat(p); err == nil {
+		return p, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+	data, err := load()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".tmp-*")
+	if err != nil {
+		return "", err
+	}
+	_, werr := tmp.Write(data)
+	cerr := tmp.Close()
+	if err := errors.Join(werr, cerr, os.Chmod(tmp.Name(), cacheMode)); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return p, nil
+}
+
+// place creates dst with the given mode from the cached blob at src: a
+// hardlink for read-only output, otherwise a reflink where supported and a
+// plain copy elsewhere. dst must not exist.
+func (c blobCache) place(src, dst string, mode os.FileMode) error {
+	if c.readOnly {
+		if err := os.Link(src, dst); err == nil {
+			return nil
+		}
+		// Cross-device or unsupported: fall through to an independent file.
+	}
+	if err := reflink(src, dst); err == nil {
+		return os.Chmod(dst, mode)
+	}
+	return copyFile(src, dst, mode)
+}
+
+// copyFile copies src to a new file dst with the given mode.
+func copyFile(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return os.Chmod(dst, mode)
+}
@@ -16,39 +16,44 @@
 package vst
 
 import (
-	"fmt"
-
 	"github.com/good-night-oppie/helios/pkg/helios/types"
 )
 
 // Diff compares two snapshots and returns Added/Changed/Deleted counts.
+// Snapshots not held in memory are compared by the blob hashes of their L2
+// manifests.
 func (v *VST) Diff(from, to types.SnapshotID) (types.DiffStats, error) {
-	fromSnap, ok := v.snaps[from]
-	if !ok {
-		return types.DiffStats{}, fmt.Errorf("unknown snapshot: %s", from)
+	fromSnap, err := v.openSnapshot(from)
+	if err != nil {
+		return types.DiffStats{}, err
 	}
-
-	toSnap, ok := v.snaps[to]
-	if !ok {
-		return types.DiffStats{}, fmt.Errorf("unknown snapshot: %s", to)
+	toSnap, err := v.openSnapshot(to)
+	if err != nil {
+		return types.DiffStats{}, err
 	}
 
 	var stats types.DiffStats
 
 	// Check for deleted and changed files
-	for path, fromContent := range fromSnap {
-		if toContent, exists := toSnap[path]; !exists {
+	for _, path := range fromSnap.paths() {
+		if !toSnap.has(path) {
 			// File exists in 'from' but not in 'to' → Deleted
 			stats.Deleted++
-		} else if !bytesEqual(fromContent, toContent) {
-			// File exists in both but content differs → Changed
+			continue
+		}
+		same, err := sameEntry(fromSnap, path, toSnap, path)
+		if err != nil {
+			return types.DiffStats{}, err
+		}
+		if !same {
+			// File exists in both but content or mode differs → Changed
 			stats.Changed++
 		}
 	}
 
 	// Check for added files
-	for path := range toSnap {
-		if _, exists := fromSnap[path]; !exists {
+	for _, path := range toSnap.paths() {
+		if !fromSnap.has(path) {
 			// File exists in 'to' but not in 'from' → Added
 			stats.Added++
 		}
@@ -56,3 +61,25 @@ func (v *VST) Diff(from, to types.SnapshotID) (types.DiffStats, error) {
 
 	return stats, nil
 }
+
+// sameEntry reports whether ap in a and bp in b have the same kind and
+// content.
+func sameEntry(a *snapSource, ap string, b *snapSource, bp string) (bool, error) {
+	if a.kind(ap) != b.kind(bp) {
+		return false, nil
+	}
+	ac, aok := a.content[ap]
+	bc, bok := b.content[bp]
+	if aok && bok {
+		return bytesEqual(ac, bc), nil
+	}
+	ah, err := a.hash(ap)
+	if err != nil {
+		return false, err
+	}
+	bh, err := b.hash(bp)
+	if err != nil {
+		return false, err
+	}
+	return ah.Algorithm == bh.Algorithm && bytesEqual(ah.Digest, bh.Digest), nil
+}
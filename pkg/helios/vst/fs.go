@@ -0,0 +1,430 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vst
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/good-night-oppie/helios/internal/util"
+	"github.com/good-night-oppie/helios/pkg/helios/types"
+)
+
+// TreeFS is a read-only io/fs view of a snapshot or of the working set as it
+// was when the view was taken. It implements fs.ReadDirFS, fs.ReadFileFS and
+// fs.StatFS, plus ReadLink and Lstat for symlinks. Paths are normalised the
+// same way as for tree hashing, so "./a//b" in the working set appears as
+// "a/b". Open and Stat follow symlinks that stay inside the tree. Files have
+// the zero modification time and are read-only (0444, or 0555 when
+// executable); contents held only in L2 are loaded on first read.
+type TreeFS struct {
+	src   *snapSource
+	files map[string]string   // fs path -> source path
+	dirs  map[string][]string // fs path ("." for the root) -> sorted child names
+}
+
+var (
+	_ fs.ReadDirFS  = (*TreeFS)(nil)
+	_ fs.ReadFileFS = (*TreeFS)(nil)
+	_ fs.StatFS     = (*TreeFS)(nil)
+)
+
+// maxSymlinkHops bounds symlink resolution, like the kernel's ELOOP limit.
+const maxSymlinkHops = 40
+
+var (
+	errIsDir       = errors.New("is a directory")
+	errNotDir      = errors.New("not a directory")
+	errNotSymlink  = errors.New("not a symbolic link")
+	errSymlinkLoop = errors.New("too many levels of symbolic links")
+)
+
+// FS returns a read-only file system view of snapshot id.
+func (v *VST) FS(id types.SnapshotID) (*TreeFS, error) {
+	src, err := v.openSnapshot(id)
+	if err != nil {
+		return nil, err
+	}
+	return newTreeFS(src)
+}
+
+// WorkingFS returns a read-only file system view of the current working set.
+// Later writes to the VST do not show through the returned view.
+func (v *VST) WorkingFS() (*TreeFS, error) {
+	// WriteFile always stores a fresh slice, so copying the maps is enough
+	// to freeze the current contents.
+	content := make(map[string][]byte, len(v.cur))
+	for p, b := range v.cur {
+		content[p] = b
+	}
+	hashes := make(map[string]types.Hash, len(v.pathToHash))
+	for p, h := range v.pathToHash {
+		if _, ok := v.cur[p]; !ok {
+			hashes[p] = h
+		}
+	}
+	return newTreeFS(&snapSource{v: v, content: content, hashes: hashes, kinds: copyKinds(v.kinds)})
+}
+
+func newTreeFS(src *snapSource) (*TreeFS, error) {
+	t := &TreeFS{
+		src:   src,
+		files: make(map[string]string),
+		dirs:  map[string][]string{".": nil},
+	}
+	for _, p := range src.paths() {
+		parts := treePath(p)
+		name := strings.Join(parts, "/")
+		if !fs.ValidPath(name) || name == "." {
+			return nil, fmt.Errorf("path %q cannot be represented in a file system view", p)
+		}
+		if prev, ok := t.files[name]; ok {
+			return nil, fmt.Errorf("paths %q and %q name the same file", prev, p)
+		}
+		t.files[name] = p
+		for dir, i := ".", 0; i < len(parts)-1; i++ {
+			sub := path.Join(dir, parts[i])
+			if _, ok := t.dirs[sub]; !ok {
+				t.dirs[sub] = nil
+				t.dirs[dir] = append(t.dirs[dir], parts[i])
+			}
+			dir = sub
+		}
+		parent := path.Dir(name)
+		t.dirs[parent] = append(t.dirs[parent], parts[len(parts)-1])
+	}
+	for name := range t.files {
+		if _, ok := t.dirs[name]; ok {
+			return nil, fmt.Errorf("%q is both a file and a directory", name)
+		}
+	}
+	for _, names := range t.dirs {
+		sort.Strings(names)
+	}
+	return t, nil
+}
+
+// Open implements fs.FS.
+func (t *TreeFS) Open(name string) (fs.File, error) {
+	r, err := t.resolve("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if names, ok := t.dirs[r]; ok {
+		return &treeDir{info: dirInfo(name), fsys: t, path: name, r: r, names: names}, nil
+	}
+	data, err := t.read("open", name, r)
+	if err != nil {
+		return nil, err
+	}
+	info := t.fileInfo(name, r, int64(len(data)))
+	return &treeFile{info: info, r: bytes.NewReader(data)}, nil
+}
+
+// ReadFile implements fs.ReadFileFS. The caller may modify the returned slice.
+func (t *TreeFS) ReadFile(name string) ([]byte, error) {
+	r, err := t.resolve("readfile", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := t.dirs[r]; ok {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: errIsDir}
+	}
+	data, err := t.read("readfile", name, r)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.Clone(data), nil
+}
+
+// ReadDir implements fs.ReadDirFS.
+func (t *TreeFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	r, err := t.resolve("readdir", name, true)
+	if err != nil {
+		return nil, err
+	}
+	names, ok := t.dirs[r]
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errNotDir}
+	}
+	return t.entries(name, r, names), nil
+}
+
+// Stat implements fs.StatFS.
+func (t *TreeFS) Stat(name string) (fs.FileInfo, error) {
+	r, err := t.resolve("stat", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return t.stat("stat", name, r)
+}
+
+// Lstat is like Stat but describes a symlink itself rather than its target.
+func (t *TreeFS) Lstat(name string) (fs.FileInfo, error) {
+	r, err := t.resolve("lstat", name, false)
+	if err != nil {
+		return nil, err
+	}
+	return t.stat("lstat", name, r)
+}
+
+// ReadLink returns the target of the symlink name.
+func (t *TreeFS) ReadLink(name string) (string, error) {
+	r, err := t.resolve("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+	if t.kind(r) != util.KindSymlink {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: errNotSymlink}
+	}
+	target, err := t.read("readlink", name, r)
+	if err != nil {
+		return "", err
+	}
+	return string(target), nil
+}
+
+// SameFile reports whether name is the same entry in t and u: the same kind
+// (regular, executable or symlink) and content. Contents held only in L2 are
+// compared by blob hash without being loaded. name is not resolved through
+// symlinks and must name a file in both views.
+func (t *TreeFS) SameFile(u *TreeFS, name string) (bool, error) {
+	ap, ok := t.files[name]
+	if !ok {
+		return false, &fs.PathError{Op: "samefile", Path: name, Err: fs.ErrNotExist}
+	}
+	bp, ok := u.files[name]
+	if !ok {
+		return false, &fs.PathError{Op: "samefile", Path: name, Err: fs.ErrNotExist}
+	}
+	return sameEntry(t.src, ap, u.src, bp)
+}
+
+// resolve maps name onto the tree entry it refers to, following symlinks in
+// its directory components and, if follow is set, in its last component.
+// Links that are absolute or climb out of the tree resolve to nothing.
+func (t *TreeFS) resolve(op, name string, follow bool) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	hops := 0
+	var walk func(p string, follow bool) (string, error)
+	walk = func(p string, follow bool) (string, error) {
+		if p == "." {
+			return ".", nil
+		}
+		cur := "."
+		parts := strings.Split(p, "/")
+		for i, part := range parts {
+			next := path.Join(cur, part)
+			last := i == len(parts)-1
+			if _, ok := t.dirs[next]; ok {
+				cur = next
+				continue
+			}
+			if _, ok := t.files[next]; !ok {
+				return "", fs.ErrNotExist
+			}
+			if t.kind(next) != util.KindSymlink || (last && !follow) {
+				if !last {
+					return "", errNotDir
+				}
+				return next, nil
+			}
+			if hops++; hops > maxSymlinkHops {
+				return "", errSymlinkLoop
+			}
+			target, err := t.src.data(t.files[next])
+			if err != nil {
+				return "", err
+			}
+			joined := path.Join(cur, string(target))
+			if path.IsAbs(string(target)) || !fs.ValidPath(joined) {
+				return "", fs.ErrNotExist
+			}
+			r, err := walk(joined, true)
+			if err != nil {
+				return "", err
+			}
+			if !last {
+				if _, ok := t.dirs[r]; !ok {
+					return "", errNotDir
+				}
+			}
+			cur = r
+		}
+		return cur, nil
+	}
+	r, err := walk(name, follow)
+	if err != nil {
+		return "", &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	return r, nil
+}
+
+func (t *TreeFS) kind(r string) util.EntryKind {
+	return t.src.kind(t.files[r])
+}
+
+// stat describes the resolved entry r under the name it was looked up by.
+// A file held only in L2 is not loaded until its size is asked for, so
+// walks that look at names and modes never fetch blobs.
+func (t *TreeFS) stat(op, name, r string) (fs.FileInfo, error) {
+	if _, ok := t.dirs[r]; ok {
+		return dirInfo(name), nil
+	}
+	if n, ok := t.src.size(t.files[r]); ok {
+		return t.fileInfo(name, r, n), nil
+	}
+	info := t.fileInfo(name, r, 0)
+	info.lazy = &lazySize{load: func() int64 {
+		data, err := t.read(op, name, r)
+		if err != nil {
+			return 0 // like a file that vanished after its stat
+		}
+		return int64(len(data))
+	}}
+	return info, nil
+}
+
+func (t *TreeFS) fileInfo(name, r string, size int64) fileInfo {
+	mode := modeOf(t.kind(r))
+	if mode.Type() == 0 {
+		mode &^= 0o222
+	}
+	return fileInfo{name: path.Base(name), size: size, mode: mode}
+}
+
+// read returns the shared content of the resolved file r.
+func (t *TreeFS) read(op, name, r string) ([]byte, error) {
+	data, err := t.src.data(t.files[r])
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	return data, nil
+}
+
+func (t *TreeFS) entries(dir, r string, names []string) []fs.DirEntry {
+	out := make([]fs.DirEntry, len(names))
+	for i, n := range names {
+		out[i] = dirEntry{fsys: t, name: path.Join(dir, n), r: path.Join(r, n)}
+	}
+	return out
+}
+
+// fileInfo describes a snapshot file or directory.
+type fileInfo struct {
+	name string
+	size int64
+	mode fs.FileMode
+	lazy *lazySize // set when size is only known by loading the blob
+}
+
+// lazySize loads a file's size once, on first use.
+type lazySize struct {
+	once sync.Once
+	load func() int64
+	n    int64
+}
+
+func (l *lazySize) get() int64 {
+	l.once.Do(func() { l.n = l.load() })
+	return l.n
+}
+
+func dirInfo(name string) fileInfo {
+	return fileInfo{name: path.Base(name), mode: fs.ModeDir | 0o555}
+}
+
+func (i fileInfo) Name() string       { return i.name }
+func (i fileInfo) Mode() fs.FileMode  { return i.mode }
+func (i fileInfo) ModTime() time.Time { return time.Time{} }
+func (i fileInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i fileInfo) Sys() any           { return nil }
+
+func (i fileInfo) Size() int64 {
+	if i.lazy != nil {
+		return i.lazy.get()
+	}
+	return i.size
+}
+
+// dirEntry loads its FileInfo lazily, so listing a directory never fetches
+// blobs. Like os.ReadDir, entries describe symlinks rather than their targets.
+type dirEntry struct {
+	fsys *TreeFS
+	name string // path the entry was listed under
+	r    string // the entry in the tree
+}
+
+func (e dirEntry) Name() string { return path.Base(e.name) }
+func (e dirEntry) IsDir() bool  { return e.Type().IsDir() }
+func (e dirEntry) Type() fs.FileMode {
+	if _, ok := e.fsys.dirs[e.r]; ok {
+		return fs.ModeDir
+	}
+	return modeOf(e.fsys.kind(e.r)).Type()
+}
+func (e dirEntry) Info() (fs.FileInfo, error) { return e.fsys.stat("lstat", e.name, e.r) }
+func (e dirEntry) String() string             { return fs.FormatDirEntry(e) }
+
+// treeFile is an open regular file.
+type treeFile struct {
+	info fileInfo
+	r    *bytes.Reader
+}
+
+func (f *treeFile) Stat() (fs.FileInfo, error)                { return f.info, nil }
+func (f *treeFile) Read(b []byte) (int, error)                { return f.r.Read(b) }
+func (f *treeFile) ReadAt(b []byte, off int64) (int, error)   { return f.r.ReadAt(b, off) }
+func (f *treeFile) Seek(off int64, whence int) (int64, error) { return f.r.Seek(off, whence) }
+func (f *treeFile) Close() error                              { return nil }
+
+// treeDir is an open directory.
+type treeDir struct {
+	info  fileInfo
+	fsys  *TreeFS
+	path  string // name the directory was opened as
+	r     string // the directory in the tree
+	names []string
+	off   int
+}
+
+func (d *treeDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *treeDir) Close() error               { return nil }
+func (d *treeDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.path, Err: errIsDir}
+}
+
+// ReadDir implements fs.ReadDirFile.
+func (d *treeDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	rest := d.names[d.off:]
+	if n > 0 && len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if n > 0 && n < len(rest) {
+		rest = rest[:n]
+	}
+	d.off += len(rest)
+	return d.fsys.entries(d.path, d.r, rest), nil
+}
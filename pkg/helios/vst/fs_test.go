@@ -0,0 +1,275 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vst
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/good-night-oppie/helios/pkg/helios/objstore"
+	"github.com/good-night-oppie/helios/pkg/helios/types"
+)
+
+func TestVST_FS_Snapshot(t *testing.T) {
+	v := New()
+	_ = v.WriteFile("README.md", []byte("# hi\n"))
+	_ = v.WriteFile("src/main.go", []byte("package main\n"))
+	_ = v.WriteFile("src/lib/util.go", []byte("package lib\n"))
+	_ = v.WriteFile("empty.txt", nil)
+	id, _, err := v.Commit("c1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Later edits must not leak into the snapshot view.
+	_ = v.WriteFile("src/main.go", []byte("changed"))
+
+	fsys, err := v.FS(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fstest.TestFS(fsys, "README.md", "empty.txt", "src/main.go", "src/lib/util.go"); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := fs.ReadFile(fsys, "src/main.go"); string(b) != "package main\n" {
+		t.Fatalf("src/main.go = %q", b)
+	}
+}
+
+func TestVST_FS_SnapshotFromL2(t *testing.T) {
+	l2, err := objstore.Open(filepath.Join(t.TempDir(), "rocks"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l2.Close()
+
+	v1 := New()
+	v1.AttachStores(nil, l2)
+	_ = v1.WriteFile("a/b/c.txt", []byte("deep"))
+	_ = v1.WriteFile("top.txt", []byte("top"))
+	id, _, err := v1.Commit("c1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v2 := New()
+	v2.AttachStores(nil, l2)
+	fsys, err := v2.FS(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fstest.TestFS(fsys, "a/b/c.txt", "top.txt"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// countingStore counts the blobs read from it, leaving out snapshot records.
+type countingStore struct {
+	objstore.Store
+	blobs int
+}
+
+func (c *countingStore) Get(h types.Hash) ([]byte, bool, error) {
+	if !strings.Contains(string(h.Digest), ":") {
+		c.blobs++
+	}
+	return c.Store.Get(h)
+}
+
+func TestVST_FS_StatLoadsNoBlobs(t *testing.T) {
+	l2, err := objstore.Open(filepath.Join(t.TempDir(), "rocks"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l2.Close()
+	v1 := New()
+	v1.AttachStores(nil, l2)
+	_ = v1.WriteFile("a/b.txt", []byte("bee"))
+	_ = v1.WriteFileMode("run", []byte("#!/bin/sh\n"), 0o755)
+	id, _, err := v1.Commit("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cs := &countingStore{Store: l2}
+	v2 := New()
+	v2.AttachStores(nil, cs)
+	fsys, err := v2.FS(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var infos []fs.FileInfo
+	err = fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		infos = append(infos, info)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, err := fsys.Stat("run"); err != nil || info.Mode() != 0o555 {
+		t.Fatalf("Stat(run) = %v, %v", info, err)
+	}
+	if cs.blobs != 0 {
+		t.Fatalf("walk and stat read %d blobs", cs.blobs)
+	}
+	if infos[0].Size() != 3 || cs.blobs != 1 {
+		t.Fatalf("size %d after %d blob reads", infos[0].Size(), cs.blobs)
+	}
+}
+
+func TestTreeFS_SameFile(t *testing.T) {
+	l2, err := objstore.Open(filepath.Join(t.TempDir(), "rocks"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l2.Close()
+
+	v1 := New()
+	v1.AttachStores(nil, l2)
+	_ = v1.WriteFile("a.txt", []byte("1"))
+	_ = v1.WriteFile("b.txt", []byte("same"))
+	_ = v1.WriteFileMode("run", []byte("#!/bin/sh\n"), 0o755)
+	c1, _, _ := v1.Commit("c1")
+	_ = v1.WriteFile("a.txt", []byte("2"))
+	_ = v1.WriteFile("run", []byte("#!/bin/sh\n"))
+	c2, _, _ := v1.Commit("c2")
+
+	// A fresh engine holds only the manifests, so files compare by hash.
+	v2 := New()
+	v2.AttachStores(nil, l2)
+	f1, err := v2.FS(c1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f2, err := v2.FS(c2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]bool{"a.txt": false, "b.txt": true, "run": false} {
+		if same, err := f1.SameFile(f2, name); err != nil || same != want {
+			t.Errorf("SameFile(%s) = %v, %v; want %v", name, same, err, want)
+		}
+	}
+	if _, err := f1.SameFile(f2, "nope"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("SameFile(nope) = %v", err)
+	}
+
+	// In-memory content compares against hash-only entries.
+	_ = v2.WriteFile("b.txt", []byte("same"))
+	w, err := v2.WorkingFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if same, err := w.SameFile(f1, "b.txt"); err != nil || !same {
+		t.Errorf("working b.txt vs c1 = %v, %v", same, err)
+	}
+}
+
+func TestVST_WorkingFS(t *testing.T) {
+	l2, err := objstore.Open(filepath.Join(t.TempDir(), "rocks"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l2.Close()
+
+	v1 := New()
+	v1.AttachStores(nil, l2)
+	_ = v1.WriteFile("lazy.txt", []byte("from l2"))
+	_ = v1.WriteFile("gone.txt", []byte("x"))
+	id, _, _ := v1.Commit("c1")
+
+	// After an L2 restore the working set only knows hashes; mix in local edits.
+	v2 := New()
+	v2.AttachStores(nil, l2)
+	if err := v2.Restore(id); err != nil {
+		t.Fatal(err)
+	}
+	_ = v2.WriteFile("./dir//new.txt", []byte("local"))
+	v2.DeleteFile("gone.txt")
+
+	fsys, err := v2.WorkingFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = v2.WriteFile("later.txt", []byte("not in the view"))
+
+	if err := fstest.TestFS(fsys, "lazy.txt", "dir/new.txt"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"gone.txt", "later.txt"} {
+		if _, err := fsys.Stat(name); !errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("%s: want ErrNotExist, got %v", name, err)
+		}
+	}
+}
+
+func TestVST_WorkingFS_RejectsFileDirConflict(t *testing.T) {
+	v := New()
+	_ = v.WriteFile("x", []byte("file"))
+	_ = v.WriteFile("x/y", []byte("nested"))
+	if _, err := v.WorkingFS(); err == nil {
+		t.Fatal("expected an error for a path that is both a file and a directory")
+	}
+}
+
+func TestVST_FS_Symlinks(t *testing.T) {
+	v := New()
+	_ = v.WriteFile("pkg/a.go", []byte("package pkg\n"))
+	_ = v.WriteFileMode("tools/gen", []byte("#!/bin/sh\n"), 0o755)
+	_ = v.WriteFileMode("current", []byte("pkg"), fs.ModeSymlink|0o777)
+	_ = v.WriteFileMode("pkg/self.go", []byte("a.go"), fs.ModeSymlink|0o777)
+	id, _, err := v.Commit("links")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys, err := v.FS(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fstest.TestFS(fsys, "pkg/a.go", "tools/gen", "current", "pkg/self.go"); err != nil {
+		t.Fatal(err)
+	}
+
+	if b, err := fsys.ReadFile("current/self.go"); err != nil || string(b) != "package pkg\n" {
+		t.Fatalf("current/self.go = %q, %v", b, err)
+	}
+	if info, err := fsys.Lstat("current"); err != nil || info.Mode().Type() != fs.ModeSymlink {
+		t.Fatalf("Lstat(current) = %v, %v", info, err)
+	}
+	if info, err := fsys.Stat("current"); err != nil || !info.IsDir() {
+		t.Fatalf("Stat(current) = %v, %v", info, err)
+	}
+	if info, err := fsys.Stat("tools/gen"); err != nil || info.Mode().Perm() != 0o555 {
+		t.Fatalf("Stat(tools/gen) = %v, %v", info, err)
+	}
+	_ = v.WriteFileMode("escape", []byte("../outside"), fs.ModeSymlink|0o777)
+	work, err := v.WorkingFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := work.Stat("escape"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("link out of the tree should not resolve, got %v", err)
+	}
+	if _, err := fsys.ReadLink("pkg/a.go"); err == nil {
+		t.Fatal("ReadLink on a regular file should fail")
+	}
+}
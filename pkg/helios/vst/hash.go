@@ -0,0 +1,88 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vst
+
+import (
+	"runtime"
+	"sync"
+
+	"github.com/good-night-oppie/helios/internal/util"
+	"github.com/good-night-oppie/helios/pkg/helios/types"
+)
+
+// Working sets below these sizes hash faster on one goroutine than the
+// fan-out costs.
+const (
+	parallelHashMinFiles = 64
+	parallelHashMinBytes = 1 << 20
+)
+
+// hashBlobs returns the blob hash of every file in files, spreading the work
+// over GOMAXPROCS goroutines when the set is large enough to benefit.
+func hashBlobs(files map[string][]byte) (map[string]types.Hash, error) {
+	var total int
+	for _, b := range files {
+		total += len(b)
+	}
+	if len(files) < parallelHashMinFiles && total < parallelHashMinBytes {
+		return hashBlobsN(files, 1)
+	}
+	return hashBlobsN(files, runtime.GOMAXPROCS(0))
+}
+
+// hashBlobsN hashes files on the given number of goroutines.
+func hashBlobsN(files map[string][]byte, workers int) (map[string]types.Hash, error) {
+	out := make(map[string]types.Hash, len(files))
+	if workers <= 1 {
+		for p, b := range files {
+			h, err := util.HashBlob(b)
+			if err != nil {
+				return nil, err
+			}
+			out[p] = h
+		}
+		return out, nil
+	}
+
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	hashes := make([]types.Hash, len(paths))
+	errs := make([]error, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			// Interleaved stripes keep large and small files spread out.
+			for i := w; i < len(paths); i += workers {
+				if hashes[i], errs[w] = util.HashBlob(files[paths[i]]); errs[w] != nil {
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	for i, p := range paths {
+		out[p] = hashes[i]
+	}
+	return out, nil
+}
@@ -0,0 +1,41 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vst
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestHashBlobsN_MatchesSequential(t *testing.T) {
+	files := make(map[string][]byte)
+	for i := 0; i < 300; i++ {
+		files[fmt.Sprintf("d%d/f%d", i%5, i)] = []byte(fmt.Sprintf("content %d", i%50))
+	}
+	want, err := hashBlobsN(files, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, workers := range []int{2, 7, 64} {
+		got, err := hashBlobsN(files, workers)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("workers=%d: hashes differ from sequential", workers)
+		}
+	}
+}
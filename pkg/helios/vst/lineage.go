@@ -0,0 +1,93 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vst
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/good-night-oppie/helios/pkg/helios/objstore"
+	"github.com/good-night-oppie/helios/pkg/helios/types"
+)
+
+// Lineage records which snapshots a snapshot was derived from, e.g. the
+// parents of an imported git commit. Snapshot IDs address content, so two
+// commits with identical trees share a snapshot and their parents are merged.
+
+func parentsKey(id types.SnapshotID) types.Hash {
+	return types.Hash{Algorithm: types.BLAKE3, Digest: []byte("parents:" + string(id))}
+}
+
+// SetParents adds parents to the recorded lineage of id, persisting it in L2
+// when attached. Self-references are ignored.
+func (v *VST) SetParents(id types.SnapshotID, parents []types.SnapshotID) error {
+	cur, err := v.Parents(id)
+	if err != nil {
+		return err
+	}
+	merged := append([]types.SnapshotID(nil), cur...)
+	for _, p := range parents {
+		if p == id || containsSnapshot(merged, p) {
+			continue
+		}
+		merged = append(merged, p)
+	}
+	if len(merged) == len(cur) {
+		return nil
+	}
+
+	if v.store != nil {
+		b, err := json.Marshal(merged)
+		if err != nil {
+			return fmt.Errorf("failed to marshal snapshot parents: %w", err)
+		}
+		if err := v.store.PutBatch([]objstore.BatchEntry{{Hash: parentsKey(id), Value: b}}); err != nil {
+			return fmt.Errorf("failed to store snapshot parents: %w", err)
+		}
+	}
+	if v.parents == nil {
+		v.parents = make(map[types.SnapshotID][]types.SnapshotID)
+	}
+	v.parents[id] = merged
+	return nil
+}
+
+// Parents returns the recorded parents of id, oldest link first.
+func (v *VST) Parents(id types.SnapshotID) ([]types.SnapshotID, error) {
+	if p, ok := v.parents[id]; ok {
+		return p, nil
+	}
+	if v.store == nil {
+		return nil, nil
+	}
+	b, ok, err := v.store.Get(parentsKey(id))
+	if err != nil || !ok {
+		return nil, err
+	}
+	var parents []types.SnapshotID
+	if err := json.Unmarshal(b, &parents); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal snapshot parents: %w", err)
+	}
+	return parents, nil
+}
+
+func containsSnapshot(ids []types.SnapshotID, id types.SnapshotID) bool {
+	for _, x := range ids {
+		if x == id {
+			return true
+		}
+	}
+	return false
+}
@@ -16,84 +16,192 @@
 package vst
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/good-night-oppie/helios/pkg/helios/types"
 )
 
+// ErrOutDirNotEmpty is returned when Materialize targets an existing, non-empty directory.
+var ErrOutDirNotEmpty = errors.New("output directory exists and is not empty")
+
 // Materialize writes the files from a snapshot to a real directory on disk.
+// Files are written by a bounded worker pool into a staging directory next to
+// outDir, which is renamed into place only once every file has been written;
+// on failure outDir is left untouched. outDir must not exist or be empty,
+// unless opts.Sync is set, in which case an existing outDir is updated in
+// place with only the files that differ from the snapshot. With
+// opts.BlobCache set, files are reflinked (or, with opts.ReadOnly, hardlinked)
+// from the cache instead of written.
 func (v *VST) Materialize(id types.SnapshotID, outDir string, opts types.MatOpts) (types.CommitMetrics, error) {
 	start := time.Now()
-	// First try to get snapshot from memory
-	snap, ok := v.snaps[id]
-
-	// If not in memory, try L2
-	if !ok && v.l2 != nil {
-		// Get snapshot metadata
-		snapshotKey := string("snapshot:" + id)
-		dprintf("materialize: trying to get metadata with key %s", snapshotKey)
-		metadataHash := types.Hash{Algorithm: types.BLAKE3, Digest: []byte(snapshotKey)}
-		metadataBytes, ok, err := v.l2.Get(metadataHash)
-		if err != nil {
-			return types.CommitMetrics{}, err
-		}
-		if !ok {
-			return types.CommitMetrics{}, fmt.Errorf("unknown snapshot in L2: %s", id)
-		}
+	phases := make(map[string]time.Duration, 3)
 
-		// Unmarshal metadata
-		var snapshotData map[string]types.Hash
-		if err := json.Unmarshal(metadataBytes, &snapshotData); err != nil {
-			return types.CommitMetrics{}, fmt.Errorf("failed to unmarshal snapshot metadata: %w", err)
-		}
-
-		// Restore files from L2
-		snap = make(map[string][]byte)
-		for path, hash := range snapshotData {
-			data, ok, err := v.l2.Get(hash)
-			if err != nil {
-				return types.CommitMetrics{}, fmt.Errorf("failed to get file %s: %w", path, err)
-			}
-			if !ok {
-				return types.CommitMetrics{}, fmt.Errorf("missing file data for %s", path)
-			}
-			snap[path] = data
-		}
-	} else if !ok {
-		return types.CommitMetrics{}, fmt.Errorf("unknown snapshot: %s", id)
+	src, err := v.openSnapshot(id)
+	if err != nil {
+		return types.CommitMetrics{}, err
 	}
 
-	var bytesTotal int64
-	var filesWritten int64
-
-	for path, content := range snap {
+	all := src.paths()
+	paths := make([]string, 0, len(all))
+	for _, path := range all {
 		// Check if file should be included/excluded based on options
 		if !shouldMaterialize(path, opts) {
 			continue
 		}
-
-		dst := filepath.Join(outDir, path)
-		if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
-			return types.CommitMetrics{}, err
+		if !filepath.IsLocal(filepath.FromSlash(path)) {
+			return types.CommitMetrics{}, fmt.Errorf("refusing to materialize %q outside the output directory", path)
 		}
-		if err := os.WriteFile(dst, content, 0o644); err != nil {
-			return types.CommitMetrics{}, err
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	phases["resolve"] = time.Since(start)
+
+	if opts.Sync {
+		return v.materializeSync(src, paths, outDir, opts, start, phases)
+	}
+
+	if err := checkOutDir(outDir); err != nil {
+		return types.CommitMetrics{}, err
+	}
+	parent := filepath.Dir(filepath.Clean(outDir))
+	if err := os.MkdirAll(parent, 0o755); err != nil {
+		return types.CommitMetrics{}, err
+	}
+	stage, err := os.MkdirTemp(parent, "."+filepath.Base(outDir)+".helios-stage-*")
+	if err != nil {
+		return types.CommitMetrics{}, err
+	}
+	published := false
+	defer func() {
+		if !published {
+			os.RemoveAll(stage)
 		}
-		bytesTotal += int64(len(content))
-		filesWritten++
+	}()
+
+	t := time.Now()
+	bytesTotal, err := writeFiles(stage, paths, src, opts)
+	if err != nil {
+		return types.CommitMetrics{}, err
+	}
+	phases["write"] = time.Since(t)
+
+	t = time.Now()
+	if err := publish(stage, outDir); err != nil {
+		return types.CommitMetrics{}, err
 	}
+	published = true
+	phases["publish"] = time.Since(t)
 
 	return types.CommitMetrics{
 		CommitLatency: time.Since(start),
-		NewObjects:    filesWritten,
+		NewObjects:    int64(len(paths)),
 		NewBytes:      bytesTotal,
+		Phases:        phases,
 	}, nil
 }
 
+func checkOutDir(outDir string) error {
+	f, err := os.Open(outDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Readdirnames(1); err == io.EOF {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: %s", ErrOutDirNotEmpty, outDir)
+}
+
+// writeFiles writes paths into root using up to opts.Workers goroutines.
+// Directories are created up front so workers never race on MkdirAll.
+func writeFiles(root string, paths []string, src *snapSource, opts types.MatOpts) (int64, error) {
+	dirs := make(map[string]struct{})
+	for _, p := range paths {
+		dirs[filepath.Dir(filepath.FromSlash(p))] = struct{}{}
+	}
+	for d := range dirs {
+		if err := os.MkdirAll(filepath.Join(root, d), 0o755); err != nil {
+			return 0, err
+		}
+	}
+
+	var total atomic.Int64
+	err := forEachParallel(len(paths), opts.Workers, func(i int) error {
+		n, err := src.writeTo(paths[i], filepath.Join(root, filepath.FromSlash(paths[i])), opts)
+		total.Add(n)
+		return err
+	})
+	return total.Load(), err
+}
+
+// forEachParallel calls fn for 0..n-1 on a bounded pool of workers
+// (≤0 means GOMAXPROCS). It stops handing out work after the first error
+// and returns that error once all in-flight calls have finished.
+func forEachParallel(n, workers int, fn func(i int) error) error {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > n {
+		workers = n
+	}
+
+	var (
+		wg       sync.WaitGroup
+		failed   atomic.Bool
+		errOnce  sync.Once
+		firstErr error
+	)
+	jobs := make(chan int, workers)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if failed.Load() {
+					continue
+				}
+				if err := fn(i); err != nil {
+					errOnce.Do(func() { firstErr = err })
+					failed.Store(true)
+				}
+			}
+		}()
+	}
+	for i := 0; i < n && !failed.Load(); i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return firstErr
+}
+
+// publish moves the fully written staging directory to outDir.
+func publish(stage, outDir string) error {
+	if err := os.Chmod(stage, 0o755); err != nil {
+		return err
+	}
+	// os.Rename refuses to replace a directory, so drop the (empty) target
+	// first; Remove fails if something was written there in the meantime.
+	if err := os.Remove(outDir); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return os.Rename(stage, outDir)
+}
+
 // shouldMaterialize checks if a file path should be materialized based on include/exclude patterns
 func shouldMaterialize(path string, opts types.MatOpts) bool {
 	// If Include patterns are specified, the path must match at least one
@@ -0,0 +1,136 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vst
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+
+	"github.com/good-night-oppie/helios/internal/util"
+	"github.com/good-night-oppie/helios/pkg/helios/objstore"
+	"github.com/good-night-oppie/helios/pkg/helios/types"
+)
+
+// Like git, a file's mode is recorded as its entry kind only: regular (0644),
+// executable (0755) or symlink, whose content is the link target.
+
+// kindOf maps a file mode onto the entry kind recorded for it.
+func kindOf(mode fs.FileMode) (util.EntryKind, error) {
+	switch {
+	case mode.Type() == fs.ModeSymlink:
+		return util.KindSymlink, nil
+	case !mode.IsRegular():
+		return 0, fmt.Errorf("unsupported file type %v", mode.Type())
+	case mode.Perm()&0o111 != 0:
+		return util.KindExec, nil
+	default:
+		return util.KindBlob, nil
+	}
+}
+
+// modeOf returns the file mode an entry kind is materialized with.
+func modeOf(k util.EntryKind) fs.FileMode {
+	switch k {
+	case util.KindExec:
+		return 0o755
+	case util.KindSymlink:
+		return fs.ModeSymlink | 0o777
+	default:
+		return 0o644
+	}
+}
+
+// WriteFileMode writes a file with the given mode into the working set. Only
+// the executable bits are kept. With fs.ModeSymlink set the file is a symlink
+// and content is its target.
+func (v *VST) WriteFileMode(path string, content []byte, mode fs.FileMode) error {
+	kind, err := kindOf(mode)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if err := v.WriteFile(path, content); err != nil {
+		return err
+	}
+	if kind != util.KindBlob {
+		if v.kinds == nil {
+			v.kinds = make(map[string]util.EntryKind)
+		}
+		v.kinds[path] = kind
+	}
+	return nil
+}
+
+// committedKinds returns the kinds of the non-regular files in snap.
+func (v *VST) committedKinds(snap map[string]types.Hash) map[string]util.EntryKind {
+	var out map[string]util.EntryKind
+	for p, k := range v.kinds {
+		if _, ok := snap[p]; !ok {
+			continue
+		}
+		if out == nil {
+			out = make(map[string]util.EntryKind)
+		}
+		out[p] = k
+	}
+	return out
+}
+
+func copyKinds(kinds map[string]util.EntryKind) map[string]util.EntryKind {
+	if len(kinds) == 0 {
+		return nil
+	}
+	out := make(map[string]util.EntryKind, len(kinds))
+	for p, k := range kinds {
+		out[p] = k
+	}
+	return out
+}
+
+func kindsKey(id types.SnapshotID) types.Hash {
+	return types.Hash{Algorithm: types.BLAKE3, Digest: []byte("snapkinds:" + string(id))}
+}
+
+// kindsEntry returns the L2 record of a snapshot's non-regular entries.
+// Snapshots made only of regular files have no record.
+func kindsEntry(id types.SnapshotID, kinds map[string]util.EntryKind) ([]objstore.BatchEntry, error) {
+	if len(kinds) == 0 {
+		return nil, nil
+	}
+	b, err := json.Marshal(kinds)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal snapshot kinds: %w", err)
+	}
+	return []objstore.BatchEntry{{Hash: kindsKey(id), Value: b}}, nil
+}
+
+// loadKinds returns the non-regular entries of snapshot id.
+func (v *VST) loadKinds(id types.SnapshotID) (map[string]util.EntryKind, error) {
+	if k, ok := v.snapKinds[id]; ok {
+		return k, nil
+	}
+	if v.store == nil {
+		return nil, nil
+	}
+	b, ok, err := v.store.Get(kindsKey(id))
+	if err != nil || !ok {
+		return nil, err
+	}
+	var kinds map[string]util.EntryKind
+	if err := json.Unmarshal(b, &kinds); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal snapshot kinds: %w", err)
+	}
+	return kinds, nil
+}
@@ -0,0 +1,144 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vst
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/good-night-oppie/helios/pkg/helios/objstore"
+	"github.com/good-night-oppie/helios/pkg/helios/types"
+)
+
+func writeModes(t *testing.T, v *VST) {
+	t.Helper()
+	if err := v.WriteFileMode("bin/run.sh", []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.WriteFileMode("latest", []byte("bin/run.sh"), fs.ModeSymlink|0o777); err != nil {
+		t.Fatal(err)
+	}
+	_ = v.WriteFile("data.txt", []byte("plain"))
+}
+
+func TestVST_Modes_AffectSnapshotID(t *testing.T) {
+	plain := New()
+	_ = plain.WriteFile("run.sh", []byte("#!/bin/sh\n"))
+	idPlain, _, _ := plain.Commit("plain")
+
+	exec := New()
+	_ = exec.WriteFileMode("run.sh", []byte("#!/bin/sh\n"), 0o755)
+	idExec, _, _ := exec.Commit("exec")
+	if idPlain == idExec {
+		t.Fatal("executable bit must change the snapshot ID")
+	}
+
+	// Rewriting with WriteFile drops the mode again.
+	_ = exec.WriteFile("run.sh", []byte("#!/bin/sh\n"))
+	if id, _, _ := exec.Commit("plain again"); id != idPlain {
+		t.Fatalf("WriteFile should reset the mode: %s != %s", id, idPlain)
+	}
+	if d, _ := exec.Diff(idPlain, idExec); d.Changed != 1 {
+		t.Fatalf("mode-only change should count as changed: %+v", d)
+	}
+
+	if err := exec.WriteFileMode("dev", nil, fs.ModeDevice); err == nil {
+		t.Fatal("device files are not supported")
+	}
+}
+
+func TestVST_Modes_MaterializeAndSync(t *testing.T) {
+	v := New()
+	writeModes(t, v)
+	id, _, err := v.Commit("modes")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(t.TempDir(), "out")
+	if _, err := v.Materialize(id, out, types.MatOpts{}); err != nil {
+		t.Fatal(err)
+	}
+	assertModes(t, out)
+
+	// Sync repairs a lost exec bit and a retargeted link.
+	if err := os.Chmod(filepath.Join(out, "bin", "run.sh"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(out, "latest")
+	if err := os.Remove(link); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("data.txt", link); err != nil {
+		t.Fatal(err)
+	}
+	m, err := v.Materialize(id, out, types.MatOpts{Sync: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.NewObjects != 2 {
+		t.Fatalf("sync should rewrite 2 entries, wrote %d", m.NewObjects)
+	}
+	assertModes(t, out)
+}
+
+func TestVST_Modes_SurviveL2AndBlobCache(t *testing.T) {
+	l2 := objstore.NewMemory()
+	defer l2.Close()
+
+	v1 := New()
+	v1.AttachStores(nil, l2)
+	writeModes(t, v1)
+	id, _, err := v1.Commit("modes")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v2 := New()
+	v2.AttachStores(nil, l2)
+	out := filepath.Join(t.TempDir(), "out")
+	if _, err := v2.Materialize(id, out, types.MatOpts{BlobCache: t.TempDir(), ReadOnly: true}); err != nil {
+		t.Fatal(err)
+	}
+	assertModes(t, out)
+
+	// Restoring from L2 and recommitting yields the same snapshot.
+	if err := v2.Restore(id); err != nil {
+		t.Fatal(err)
+	}
+	fsys, err := v2.WorkingFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target, err := fsys.ReadLink("latest"); err != nil || target != "bin/run.sh" {
+		t.Fatalf("ReadLink = %q, %v", target, err)
+	}
+}
+
+func assertModes(t *testing.T, out string) {
+	t.Helper()
+	info, err := os.Stat(filepath.Join(out, "bin", "run.sh"))
+	if err != nil || info.Mode().Perm()&0o111 == 0 {
+		t.Fatalf("bin/run.sh should be executable: %v %v", info, err)
+	}
+	if target, err := os.Readlink(filepath.Join(out, "latest")); err != nil || target != "bin/run.sh" {
+		t.Fatalf("latest -> %q, %v", target, err)
+	}
+	if info, err := os.Stat(filepath.Join(out, "data.txt")); err != nil || info.Mode().Perm()&0o111 != 0 {
+		t.Fatalf("data.txt should not be executable: %v %v", info, err)
+	}
+}
@@ -0,0 +1,252 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vst
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/good-night-oppie/helios/internal/util"
+	"github.com/good-night-oppie/helios/pkg/helios/types"
+)
+
+// snapSource gives read access to one snapshot. In-memory snapshots carry
+// their content; snapshots restored from L2 carry only the manifest and load
+// blobs on demand through L1/L2. The working set may have both, with content
+// taking precedence. Methods are safe for concurrent use.
+type snapSource struct {
+	v       *VST
+	content map[string][]byte         // file contents, or nil
+	hashes  map[string]types.Hash     // hash-only entries loaded on demand, or nil
+	kinds   map[string]util.EntryKind // entries that are not regular files
+}
+
+// openSnapshot locates a snapshot in memory or, failing that, in L2.
+func (v *VST) openSnapshot(id types.SnapshotID) (*snapSource, error) {
+	if snap, ok := v.snaps[id]; ok {
+		return &snapSource{v: v, content: snap, kinds: v.snapKinds[id]}, nil
+	}
+	if v.store == nil {
+		return nil, fmt.Errorf("unknown snapshot: %s", id)
+	}
+	manifest, err := v.loadManifest(id)
+	if err != nil {
+		return nil, err
+	}
+	kinds, err := v.loadKinds(id)
+	if err != nil {
+		return nil, err
+	}
+	return &snapSource{v: v, hashes: manifest, kinds: kinds}, nil
+}
+
+// ManifestKey, KindsKey and ParentsKey return the L2 keys of a snapshot's
+// records: its path -> blob hash manifest (JSON), its non-regular entry
+// kinds and its lineage. Only the manifest is always present. Tools that
+// copy snapshots between stores copy these records and the blobs the
+// manifest names.
+func ManifestKey(id types.SnapshotID) types.Hash {
+	return types.Hash{Algorithm: types.BLAKE3, Digest: []byte("snapshot:" + string(id))}
+}
+
+// KindsKey returns the L2 key of a snapshot's entry kinds; see ManifestKey.
+func KindsKey(id types.SnapshotID) types.Hash { return kindsKey(id) }
+
+// ParentsKey returns the L2 key of a snapshot's lineage; see ManifestKey.
+func ParentsKey(id types.SnapshotID) types.Hash { return parentsKey(id) }
+
+// CheckRecords returns an error unless a manifest record and a kinds record
+// (nil for a snapshot of regular files only) describe the tree whose hash is
+// id. Stores accepting records from untrusted peers use it, since the keys
+// alone do not bind the records to their content.
+func CheckRecords(id types.SnapshotID, manifest, kinds []byte) error {
+	var hashes map[string]types.Hash
+	if err := json.Unmarshal(manifest, &hashes); err != nil {
+		return fmt.Errorf("snapshot %s: bad manifest: %w", id, err)
+	}
+	var k map[string]util.EntryKind
+	if kinds != nil {
+		if err := json.Unmarshal(kinds, &k); err != nil {
+			return fmt.Errorf("snapshot %s: bad kinds: %w", id, err)
+		}
+	}
+	for p := range k {
+		if _, ok := hashes[p]; !ok {
+			return fmt.Errorf("snapshot %s: kinds name %q, which the manifest lacks", id, p)
+		}
+	}
+	root, err := buildTree(hashes, k)
+	if err != nil {
+		return fmt.Errorf("snapshot %s: %w", id, err)
+	}
+	if types.SnapshotID(root.String()) != id {
+		return fmt.Errorf("snapshot %s: records describe snapshot %s", id, root)
+	}
+	return nil
+}
+
+// loadManifest reads the path -> blob hash metadata Commit stores in L2.
+func (v *VST) loadManifest(id types.SnapshotID) (map[string]types.Hash, error) {
+	dprintf("snapshot: trying to get metadata with key snapshot:%s", id)
+	metadataBytes, ok, err := v.store.Get(ManifestKey(id))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown snapshot in L2: %s", id)
+	}
+
+	var snapshotData map[string]types.Hash
+	if err := json.Unmarshal(metadataBytes, &snapshotData); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal snapshot metadata: %w", err)
+	}
+	return snapshotData, nil
+}
+
+// paths returns every path in the snapshot, in no particular order.
+func (s *snapSource) paths() []string {
+	out := make([]string, 0, len(s.content)+len(s.hashes))
+	for p := range s.content {
+		out = append(out, p)
+	}
+	for p := range s.hashes {
+		if _, ok := s.content[p]; !ok {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// has reports whether path is in the snapshot.
+func (s *snapSource) has(p string) bool {
+	if _, ok := s.content[p]; ok {
+		return true
+	}
+	_, ok := s.hashes[p]
+	return ok
+}
+
+// kind returns the entry kind of path.
+func (s *snapSource) kind(p string) util.EntryKind {
+	if k, ok := s.kinds[p]; ok {
+		return k
+	}
+	return util.KindBlob
+}
+
+// hash returns the blob hash of path.
+func (s *snapSource) hash(p string) (types.Hash, error) {
+	if b, ok := s.content[p]; ok {
+		return util.HashBlob(b)
+	}
+	h, ok := s.hashes[p]
+	if !ok {
+		return types.Hash{}, fmt.Errorf("no such file in snapshot: %s", p)
+	}
+	return h, nil
+}
+
+// data returns the content of path. The slice must not be modified.
+func (s *snapSource) data(p string) ([]byte, error) {
+	if b, ok := s.content[p]; ok {
+		return b, nil
+	}
+	h, ok := s.hashes[p]
+	if !ok {
+		return nil, fmt.Errorf("no such file in snapshot: %s", p)
+	}
+	b, found, err := s.v.getBlob(h)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file %s: %w", p, err)
+	}
+	if !found {
+		return nil, fmt.Errorf("missing file data for %s", p)
+	}
+	return b, nil
+}
+
+// getBlob fetches a blob from L1, falling back to L2 and promoting hits into L1.
+func (v *VST) getBlob(h types.Hash) ([]byte, bool, error) {
+	if v.store == nil {
+		if v.l1 != nil {
+			if b, ok := v.l1.Get(h); ok {
+				return b, true, nil
+			}
+		}
+		return nil, false, nil
+	}
+	return v.store.GetBlob(h)
+}
+
+// size returns the length of path when it is known without loading the blob.
+func (s *snapSource) size(p string) (int64, bool) {
+	b, ok := s.content[p]
+	return int64(len(b)), ok
+}
+
+// writeTo creates the file dst (which must not exist) with the content and
+// mode of path and returns the number of bytes it holds. With opts.BlobCache
+// set the file is placed from the cache, and the blob is only loaded on a
+// cache miss. Symlinks are always created directly.
+func (s *snapSource) writeTo(p, dst string, opts types.MatOpts) (int64, error) {
+	kind := s.kind(p)
+	if kind == util.KindSymlink {
+		target, err := s.data(p)
+		if err != nil {
+			return 0, err
+		}
+		return int64(len(target)), os.Symlink(string(target), dst)
+	}
+	mode := modeOf(kind)
+	if opts.ReadOnly {
+		mode &^= 0o222
+	}
+	if opts.BlobCache == "" {
+		b, err := s.data(p)
+		if err != nil {
+			return 0, err
+		}
+		f, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+		if err != nil {
+			return 0, err
+		}
+		_, werr := f.Write(b)
+		if err := errors.Join(werr, f.Close()); err != nil {
+			return 0, err
+		}
+		// The umask may have narrowed the mode given to OpenFile.
+		return int64(len(b)), os.Chmod(dst, mode)
+	}
+
+	h, err := s.hash(p)
+	if err != nil {
+		return 0, err
+	}
+	c := blobCache{dir: opts.BlobCache, readOnly: opts.ReadOnly}
+	cached, err := c.ensure(h, mode, func() ([]byte, error) { return s.data(p) })
+	if err != nil {
+		return 0, err
+	}
+	if err := c.place(cached, dst, mode); err != nil {
+		return 0, err
+	}
+	info, err := os.Lstat(dst)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
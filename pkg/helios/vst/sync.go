@@ -0,0 +1,324 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vst
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/good-night-oppie/helios/internal/util"
+	"github.com/good-night-oppie/helios/pkg/helios/types"
+)
+
+// syncEntry remembers what a previous sync wrote, so an unchanged file can be
+// recognised from its size and mtime alone without rehashing it.
+type syncEntry struct {
+	Size  int64     `json:"size"`
+	Mtime time.Time `json:"mtime"`
+	Hash  []byte    `json:"hash"`
+}
+
+// syncRecord is the per-directory state kept between syncs. It is stored in
+// syncRecordFile under the synced directory, so a later process syncing the
+// same directory can use it too.
+type syncRecord struct {
+	At    time.Time            `json:"at"` // when entries were recorded
+	Files map[string]syncEntry `json:"files"`
+}
+
+// syncRecordFile is where a sync keeps its record, relative to outDir. It
+// lives under .helios, which syncs neither scan nor delete from and commits
+// never ingest.
+const syncRecordFile = ".helios/sync.json"
+
+// loadSyncRecord reads the record of the last sync of abs, or returns nil if
+// there is none or it cannot be read; a sync then just hashes every file and
+// deletes nothing it cannot prove it wrote.
+func loadSyncRecord(abs string) *syncRecord {
+	data, err := os.ReadFile(filepath.Join(abs, filepath.FromSlash(syncRecordFile)))
+	if err != nil {
+		return nil
+	}
+	var rec syncRecord
+	if err := json.Unmarshal(data, &rec); err != nil || rec.Files == nil {
+		return nil
+	}
+	return &rec
+}
+
+// isRacy reports whether mtime is too close to the time it was recorded to
+// prove the file was not rewritten afterwards within timestamp granularity.
+func isRacy(mtime, recordedAt time.Time) bool {
+	return !mtime.Before(recordedAt.Truncate(time.Second))
+}
+
+// materializeSync brings an existing outDir in line with the selected snapshot
+// paths: only missing or changed files are written (each via temp file and
+// rename), and files that match the selectors but are not in the snapshot are
+// deleted if an earlier sync of outDir wrote them, or any such file with
+// opts.Prune. Files outside the selectors are left alone, and .git and
+// .helios directories are neither scanned nor deleted from.
+func (v *VST) materializeSync(src *snapSource, paths []string, outDir string, opts types.MatOpts, start time.Time, phases map[string]time.Duration) (types.CommitMetrics, error) {
+	abs, err := filepath.Abs(outDir)
+	if err != nil {
+		return types.CommitMetrics{}, err
+	}
+	if err := os.MkdirAll(abs, 0o755); err != nil {
+		return types.CommitMetrics{}, err
+	}
+
+	prev := loadSyncRecord(abs)
+
+	// Scan: find what is on disk and which wanted files differ from it.
+	t := time.Now()
+	onDisk := make(map[string]fs.FileInfo)
+	err = filepath.WalkDir(abs, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if p != abs && protectedDirs[d.Name()] {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(abs, p)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		onDisk[filepath.ToSlash(rel)] = info
+		return nil
+	})
+	if err != nil {
+		return types.CommitMetrics{}, err
+	}
+
+	wanted := make(map[string]struct{}, len(paths))
+	for _, p := range paths {
+		wanted[p] = struct{}{}
+	}
+	changed := make([]bool, len(paths))
+	hashes := make([][]byte, len(paths))
+	err = forEachParallel(len(paths), opts.Workers, func(i int) error {
+		p := paths[i]
+		info, ok := onDisk[p]
+		kind := src.kind(p)
+		if kind == util.KindSymlink {
+			changed[i] = true
+			if ok && info.Mode().Type() == fs.ModeSymlink {
+				target, err := src.data(p)
+				if err != nil {
+					return err
+				}
+				disk, err := os.Readlink(filepath.Join(abs, filepath.FromSlash(p)))
+				changed[i] = err != nil || disk != string(target)
+			}
+			return nil
+		}
+		if !ok || !info.Mode().IsRegular() || (info.Mode().Perm()&0o100 != 0) != (kind == util.KindExec) {
+			changed[i] = true
+			return nil
+		}
+		if n, known := src.size(p); known && info.Size() != n {
+			changed[i] = true
+			return nil
+		}
+		h, err := src.hash(p)
+		if err != nil {
+			return err
+		}
+		hashes[i] = h.Digest
+		if prev != nil {
+			if e, ok := prev.Files[p]; ok && e.Size == info.Size() && e.Mtime.Equal(info.ModTime()) && !isRacy(e.Mtime, prev.At) {
+				changed[i] = !bytes.Equal(e.Hash, h.Digest)
+				return nil
+			}
+		}
+		disk, err := os.ReadFile(filepath.Join(abs, filepath.FromSlash(p)))
+		if err != nil {
+			return err
+		}
+		dh, err := util.HashBlob(disk)
+		if err != nil {
+			return err
+		}
+		changed[i] = !bytes.Equal(dh.Digest, h.Digest)
+		return nil
+	})
+	if err != nil {
+		return types.CommitMetrics{}, err
+	}
+	phases["scan"] = time.Since(t)
+
+	// Delete: remove selected extras and any directories left empty. This runs
+	// before writing so a stale file never blocks creating a directory.
+	t = time.Now()
+	var extras []string
+	for p := range onDisk {
+		if _, ok := wanted[p]; ok || !shouldMaterialize(p, opts) {
+			continue
+		}
+		if !opts.Prune {
+			if prev == nil {
+				continue
+			}
+			if _, wrote := prev.Files[p]; !wrote {
+				continue
+			}
+		}
+		extras = append(extras, p)
+	}
+	sort.Strings(extras)
+	for _, p := range extras {
+		full := filepath.Join(abs, filepath.FromSlash(p))
+		if err := os.Remove(full); err != nil && !os.IsNotExist(err) {
+			return types.CommitMetrics{}, err
+		}
+		for dir := filepath.Dir(full); dir != abs; dir = filepath.Dir(dir) {
+			if os.Remove(dir) != nil {
+				break // not empty (or already gone)
+			}
+		}
+	}
+	phases["delete"] = time.Since(t)
+
+	// Write: replace changed files atomically, one by one.
+	t = time.Now()
+	var toWrite []int
+	for i := range paths {
+		if changed[i] {
+			toWrite = append(toWrite, i)
+		}
+	}
+	var written atomic.Int64
+	err = forEachParallel(len(toWrite), opts.Workers, func(j int) error {
+		n, err := replaceFile(abs, paths[toWrite[j]], src, opts)
+		written.Add(n)
+		return err
+	})
+	if err != nil {
+		return types.CommitMetrics{}, err
+	}
+	phases["write"] = time.Since(t)
+
+	if err := recordSync(abs, paths, hashes, src); err != nil {
+		return types.CommitMetrics{}, err
+	}
+
+	return types.CommitMetrics{
+		CommitLatency: time.Since(start),
+		NewObjects:    int64(len(toWrite)),
+		NewBytes:      written.Load(),
+		Phases:        phases,
+	}, nil
+}
+
+// protectedDirs are never scanned or deleted from by a sync: they hold
+// repositories, possibly the very store being materialized from.
+var protectedDirs = map[string]bool{".git": true, ".helios": true}
+
+// replaceFile writes root/p from the snapshot through a temp file in the
+// same directory and returns the number of bytes written.
+func replaceFile(root, p string, src *snapSource, opts types.MatOpts) (int64, error) {
+	dst := filepath.Join(root, filepath.FromSlash(p))
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return 0, err
+	}
+	if info, err := os.Lstat(dst); err == nil && info.IsDir() {
+		if err := os.RemoveAll(dst); err != nil {
+			return 0, err
+		}
+	}
+	// Reserve a unique name, then let writeTo create it afresh: links and
+	// clones need a path that does not exist yet.
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".helios-sync-*")
+	if err != nil {
+		return 0, err
+	}
+	name := tmp.Name()
+	tmp.Close()
+	if err := os.Remove(name); err != nil {
+		return 0, err
+	}
+	n, err := src.writeTo(p, name, opts)
+	if err != nil {
+		os.Remove(name)
+		return 0, err
+	}
+	if err := os.Rename(name, dst); err != nil {
+		os.Remove(name)
+		return 0, err
+	}
+	return n, nil
+}
+
+// recordSync stats the synced files and stores the record under abs, so the
+// next sync of abs can skip hashing them and knows which files it wrote.
+func recordSync(abs string, paths []string, hashes [][]byte, src *snapSource) error {
+	rec := syncRecord{Files: make(map[string]syncEntry, len(paths))}
+	for i, p := range paths {
+		info, err := os.Lstat(filepath.Join(abs, filepath.FromSlash(p)))
+		if err != nil {
+			continue
+		}
+		h := hashes[i]
+		if h == nil {
+			sum, err := src.hash(p)
+			if err != nil {
+				continue
+			}
+			h = sum.Digest
+		}
+		rec.Files[p] = syncEntry{Size: info.Size(), Mtime: info.ModTime(), Hash: h}
+	}
+	rec.At = time.Now()
+
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	dst := filepath.Join(abs, filepath.FromSlash(syncRecordFile))
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".sync-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
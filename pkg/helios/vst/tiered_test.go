@@ -0,0 +1,72 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vst
+
+import (
+	"testing"
+
+	"github.com/good-night-oppie/helios/pkg/helios/cas"
+	"github.com/good-night-oppie/helios/pkg/helios/l1cache"
+	"github.com/good-night-oppie/helios/pkg/helios/objstore"
+)
+
+func TestVST_WriteBackTier(t *testing.T) {
+	l2 := objstore.NewMemory()
+	defer l2.Close()
+	l1, _ := l1cache.New(l1cache.Config{CapacityBytes: 1 << 20})
+	tier, err := cas.NewTiered(cas.Config{L1: l1, L2: l2, Policy: cas.WriteBack})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := New()
+	v.AttachTiered(tier)
+	if err := v.WriteFile("a.txt", []byte("alpha")); err != nil {
+		t.Fatal(err)
+	}
+	id, _, err := v.Commit("wb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.SetParents(id, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Pending writes are visible through the engine but not yet in L2.
+	if _, ok, _ := l2.Get(ManifestKey(id)); ok {
+		t.Fatal("manifest reached L2 before Flush")
+	}
+	if _, ok, err := v.L2().Get(ManifestKey(id)); err != nil || !ok {
+		t.Fatalf("pending manifest not readable: ok=%v err=%v", ok, err)
+	}
+	if err := v.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if st := tier.Stats(); st.DirtyEntries != 0 || st.Flushes != 1 {
+		t.Fatalf("after flush: %+v", st)
+	}
+
+	v2 := New()
+	v2.AttachStores(nil, l2)
+	if err := v2.Restore(id); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := v2.ReadFile("a.txt"); err != nil || string(b) != "alpha" {
+		t.Fatalf("ReadFile = %q, %v", b, err)
+	}
+	if v.L1Stats() != l1.Stats() {
+		t.Fatal("L1Stats does not report the tier's cache")
+	}
+}
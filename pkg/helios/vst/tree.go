@@ -0,0 +1,102 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vst
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/good-night-oppie/helios/internal/util"
+	"github.com/good-night-oppie/helios/pkg/helios/types"
+)
+
+// treePath splits a slash-separated working-set path into tree components.
+// Empty and "." components are dropped, so "./a//b" and "a/b" name the same entry.
+func treePath(p string) []string {
+	parts := strings.Split(p, "/")
+	out := parts[:0]
+	for _, s := range parts {
+		if s == "" || s == "." {
+			continue
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+type dirNode struct {
+	files map[string]util.TreeEntry
+	dirs  map[string]*dirNode
+}
+
+func newDirNode() *dirNode {
+	return &dirNode{files: map[string]util.TreeEntry{}, dirs: map[string]*dirNode{}}
+}
+
+func (n *dirNode) child(name string) *dirNode {
+	c, ok := n.dirs[name]
+	if !ok {
+		c = newDirNode()
+		n.dirs[name] = c
+	}
+	return c
+}
+
+// hash folds the directory bottom-up into its canonical tree hash.
+func (n *dirNode) hash() (types.Hash, error) {
+	entries := make([]util.TreeEntry, 0, len(n.files)+len(n.dirs))
+	for _, e := range n.files {
+		entries = append(entries, e)
+	}
+	for name, c := range n.dirs {
+		h, err := c.hash()
+		if err != nil {
+			return types.Hash{}, err
+		}
+		entries = append(entries, util.TreeEntry{Name: name, Kind: util.KindTree, Hash: h})
+	}
+	return util.HashTreeEntries(entries)
+}
+
+// buildTree computes the root tree hash (the SnapshotID) for a set of
+// path -> blob hash mappings using the canonical tree encoding. Paths missing
+// from kinds are regular files.
+func buildTree(blobHashByPath map[string]types.Hash, kinds map[string]util.EntryKind) (types.Hash, error) {
+	root := newDirNode()
+	seen := make(map[string]string, len(blobHashByPath))
+	for p, h := range blobHashByPath {
+		parts := treePath(p)
+		if len(parts) == 0 {
+			return types.Hash{}, fmt.Errorf("invalid path %q", p)
+		}
+		norm := strings.Join(parts, "/")
+		if prev, dup := seen[norm]; dup {
+			return types.Hash{}, fmt.Errorf("paths %q and %q refer to the same file", prev, p)
+		}
+		seen[norm] = p
+
+		n := root
+		for _, d := range parts[:len(parts)-1] {
+			n = n.child(d)
+		}
+		kind := util.KindBlob
+		if k, ok := kinds[p]; ok {
+			kind = k
+		}
+		name := parts[len(parts)-1]
+		n.files[name] = util.TreeEntry{Name: name, Kind: kind, Hash: h}
+	}
+	return root.hash()
+}
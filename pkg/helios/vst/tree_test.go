@@ -0,0 +1,117 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vst
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "update golden files")
+
+const snapshotVectorsPath = "../../../spec/golden/tree/snapshot_ids.golden.json"
+
+type snapshotVector struct {
+	Name  string            `json:"name"`
+	Files map[string]string `json:"files"`
+	ID    string            `json:"id"`
+}
+
+func snapshotInputs() []snapshotVector {
+	return []snapshotVector{
+		{Name: "empty", Files: map[string]string{}},
+		{Name: "flat", Files: map[string]string{"hello.txt": "hi", "b.txt": "B"}},
+		{Name: "nested", Files: map[string]string{"hello.txt": "hi", "dir/a.txt": "A", "dir/sub/deep.txt": "deep"}},
+		{Name: "colon-and-newline-names", Files: map[string]string{"a:blob:x": "1", "line\nbreak": "2"}},
+	}
+}
+
+func commitFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	v := New()
+	for p, c := range files {
+		_ = v.WriteFile(p, []byte(c))
+	}
+	id, _, err := v.Commit("vector")
+	if err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	return string(id)
+}
+
+func TestSnapshotID_GoldenVectors(t *testing.T) {
+	if *updateGolden {
+		vecs := snapshotInputs()
+		for i := range vecs {
+			vecs[i].ID = commitFiles(t, vecs[i].Files)
+		}
+		b, _ := json.MarshalIndent(vecs, "", "  ")
+		if err := os.WriteFile(snapshotVectorsPath, append(b, '\n'), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	b, err := os.ReadFile(snapshotVectorsPath)
+	if err != nil {
+		t.Fatalf("read vectors: %v", err)
+	}
+	var vecs []snapshotVector
+	if err := json.Unmarshal(b, &vecs); err != nil {
+		t.Fatalf("parse vectors: %v", err)
+	}
+	for _, vec := range vecs {
+		t.Run(vec.Name, func(t *testing.T) {
+			if got := commitFiles(t, vec.Files); got != vec.ID {
+				t.Fatalf("snapshot ID mismatch: got=%s want=%s", got, vec.ID)
+			}
+		})
+	}
+}
+
+func TestCommit_OptimizedMatchesCanonicalID(t *testing.T) {
+	files := map[string]string{"hello.txt": "hi", "dir/a.txt": "A", "dir/sub/deep.txt": "deep"}
+	v := New()
+	for p, c := range files {
+		_ = v.WriteFile(p, []byte(c))
+	}
+	id, _, err := v.CommitOptimized("opt")
+	if err != nil {
+		t.Fatalf("commit optimized: %v", err)
+	}
+	if want := commitFiles(t, files); string(id) != want {
+		t.Fatalf("CommitOptimized id %s != Commit id %s", id, want)
+	}
+}
+
+func TestCommit_EquivalentPathSpellingsCollide(t *testing.T) {
+	v := New()
+	_ = v.WriteFile("dir/a.txt", []byte("1"))
+	_ = v.WriteFile("./dir//a.txt", []byte("2"))
+	if _, _, err := v.Commit("dup"); err == nil {
+		t.Fatal("expected error for two spellings of the same path")
+	}
+}
+
+func TestCommit_FileAndDirectoryConflict(t *testing.T) {
+	v := New()
+	_ = v.WriteFile("a", []byte("file"))
+	_ = v.WriteFile("a/b", []byte("child"))
+	if _, _, err := v.Commit("conflict"); err == nil {
+		t.Fatal("expected error when a path is both a file and a directory")
+	}
+}
@@ -19,13 +19,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
-	"path/filepath"
-	"sort"
-	"strings"
 	"time"
 
 	"github.com/good-night-oppie/helios/internal/metrics"
 	"github.com/good-night-oppie/helios/internal/util"
+	"github.com/good-night-oppie/helios/pkg/helios/cas"
 	"github.com/good-night-oppie/helios/pkg/helios/l1cache"
 	"github.com/good-night-oppie/helios/pkg/helios/objstore"
 	"github.com/good-night-oppie/helios/pkg/helios/types"
@@ -46,8 +44,11 @@ var _ types.StateManager = (*VST)(nil)
 type VST struct {
 	cur        map[string][]byte                      // current working set
 	snaps      map[types.SnapshotID]map[string][]byte // snapshot store
+	kinds      map[string]util.EntryKind              // working-set entries that are not regular files
+	snapKinds  map[types.SnapshotID]map[string]util.EntryKind // snapshot -> its entries that are not regular files
+	parents    map[types.SnapshotID][]types.SnapshotID         // lineage, see SetParents
 	l1         l1cache.Cache                          // L1 cache (hot data)
-	l2         objstore.Store                         // L2 persistent store
+	store      *cas.Tiered                            // L1+L2 storage path, nil without L2
 	pathToHash map[string]types.Hash                  // path -> content hash mapping for L1/L2 retrieval
 	em         *metrics.EngineMetrics                 // engine metrics collector
 }
@@ -57,31 +58,97 @@ func New() *VST {
 	return &VST{
 		cur:        make(map[string][]byte),
 		snaps:      make(map[types.SnapshotID]map[string][]byte),
+		snapKinds:  make(map[types.SnapshotID]map[string]util.EntryKind),
 		pathToHash: make(map[string]types.Hash),
 		em:         metrics.NewEngineMetrics(),
 	}
 }
 
-// AttachStores attaches L1 cache and L2 object store to the VST.
+// AttachStores attaches L1 cache and L2 object store to the VST. Writes go
+// through to L2 before Commit returns.
 func (v *VST) AttachStores(l1 l1cache.Cache, l2 objstore.Store) {
 	v.l1 = l1
-	v.l2 = l2
+	v.store = nil
+	if l2 != nil {
+		// A write-through store never fails to construct.
+		v.store, _ = cas.NewTiered(cas.Config{L1: l1, L2: l2, Policy: cas.WriteThrough})
+	}
 	if l1 != nil {
 		dprintf("attached L1 cache: %+v", l1.Stats())
 	}
 }
 
+// AttachTiered attaches a tiered store, e.g. one with the write-back policy.
+// Call Flush before handing snapshot IDs to another engine.
+func (v *VST) AttachTiered(t *cas.Tiered) {
+	v.store = t
+	v.l1 = nil
+	if t != nil {
+		v.l1 = t.L1()
+	}
+}
+
+// Flush persists writes held by a write-back store.
+func (v *VST) Flush() error {
+	if v.store == nil {
+		return nil
+	}
+	return v.store.Flush()
+}
+
+// L2 returns the attached object store, or nil. Reads through it see
+// writes a write-back store has not flushed yet.
+func (v *VST) L2() objstore.Store {
+	if v.store == nil {
+		return nil
+	}
+	return v.store
+}
+
 // WriteFile writes/overwrites a file in the current working set (in memory).
 func (v *VST) WriteFile(path string, content []byte) error {
 	cp := make([]byte, len(content))
 	copy(cp, content)
 	v.cur[path] = cp
+	delete(v.kinds, path)
 	return nil
 }
 
 // DeleteFile removes a file from the current working set.
 func (v *VST) DeleteFile(path string) {
 	delete(v.cur, path)
+	delete(v.pathToHash, path)
+	delete(v.kinds, path)
+}
+
+// WriteFileHash adds path to the current working set by the hash of content
+// already held in the attached stores, without supplying the bytes. Callers
+// that can prove a file is unchanged (e.g. from a stat cache) use it to skip
+// reading and rehashing it; Commit relies on the blob being in L2.
+func (v *VST) WriteFileHash(path string, h types.Hash) error {
+	if v.store == nil {
+		return fmt.Errorf("write %s by hash: no L2 store attached", path)
+	}
+	delete(v.cur, path)
+	delete(v.kinds, path)
+	v.pathToHash[path] = h
+	return nil
+}
+
+// StoreBlobs writes content-addressed blobs straight to L2, for callers that
+// then add the files with WriteFileHash.
+func (v *VST) StoreBlobs(batch []objstore.BatchEntry) error {
+	if v.store == nil {
+		return fmt.Errorf("store blobs: no L2 store attached")
+	}
+	return v.store.PutBatch(batch)
+}
+
+// Reset empties the current working set.
+func (v *VST) Reset() {
+	v.cur = make(map[string][]byte)
+	v.pathToHash = make(map[string]types.Hash)
+	v.kinds = nil
 }
 
 // ReadFile reads a file from the current working set (copy returned).
@@ -101,32 +168,8 @@ func (v *VST) ReadFile(path string) ([]byte, error) {
 		return nil, nil // File doesn't exist
 	}
 
-	// Always try L1 first to ensure miss is recorded
-	l1Hit := false
-	var l1Data []byte
-	if v.l1 != nil {
-		l1Data, l1Hit = v.l1.Get(hash)
-	}
-	if l1Hit {
-		return l1Data, nil
-	}
-
-	// On L1 miss, try L2 store
-	if v.l2 != nil {
-		data, ok, err := v.l2.Get(hash)
-		if err != nil {
-			return nil, err // Return L2 errors without affecting cache stats
-		}
-		if ok {
-			// Found in L2, promote to L1 if available
-			if v.l1 != nil {
-				v.l1.Put(hash, data)
-			}
-			return data, nil
-		}
-	}
-
-	return nil, nil // Not found anywhere
+	data, _, err := v.getBlob(hash)
+	return data, err
 }
 
 // Commit creates a snapshot and returns a content-addressed SnapshotID (Merkle root).
@@ -146,21 +189,21 @@ func (v *VST) Commit(msg string) (types.SnapshotID, types.CommitMetrics, error)
 	// Compute Merkle root over the current working set.
 	// Algorithm:
 	//  1) For each file path -> hash blob(content)
-	//  2) Aggregate bottom-up by directory: "name:type:childHash"
-	//  3) The root (".") tree hash becomes SnapshotID
-	blobHashByPath := make(map[string]types.Hash, len(v.cur))
+	//  2) Aggregate bottom-up by directory using the canonical tree encoding
+	//     (spec/tree-encoding.md)
+	//  3) The root tree hash becomes SnapshotID
+	blobHashByPath, err := hashBlobs(v.cur)
+	if err != nil {
+		return "", types.CommitMetrics{}, err
+	}
 	blobsToStore := make([]objstore.BatchEntry, 0, len(v.cur))
 	for path, content := range v.cur {
-		h, err := util.HashBlob(content)
-		if err != nil {
-			return "", types.CommitMetrics{}, err
-		}
-		blobHashByPath[path] = h
+		h := blobHashByPath[path]
 		// Store path->hash mapping for L1/L2 retrieval
 		v.pathToHash[path] = h
 
 		// Prepare for L2 storage if attached
-		if v.l2 != nil {
+		if v.store != nil {
 			blobsToStore = append(blobsToStore, objstore.BatchEntry{
 				Hash:  h,
 				Value: content,
@@ -168,120 +211,46 @@ func (v *VST) Commit(msg string) (types.SnapshotID, types.CommitMetrics, error)
 		}
 	}
 
+	// With L2 attached, entries known only by hash (WriteFileHash, or a
+	// restore from L2) are part of the working set too; their blobs are
+	// already stored.
+	var hashOnly int
+	if v.store != nil {
+		for path, h := range v.pathToHash {
+			if _, ok := v.cur[path]; ok {
+				continue
+			}
+			blobHashByPath[path] = h
+			hashOnly++
+		}
+	}
+
 	// Store blobs in L2 if attached
-	dprintf("commit: l2-attached=%v, blobsToStore=%d", v.l2 != nil, len(blobsToStore))
+	dprintf("commit: l2-attached=%v, blobsToStore=%d", v.store != nil, len(blobsToStore))
 	if heliosDebug && len(blobsToStore) > 0 {
 		// Print first few blobs for debugging
 		for i := 0; i < len(blobsToStore) && i < 5; i++ {
 			dprintf("commit: blob[%d]=%s size=%d", i, blobsToStore[i].Hash.String(), len(blobsToStore[i].Value))
 		}
 	}
-	if v.l2 != nil && len(blobsToStore) > 0 {
+	if v.store != nil && len(blobsToStore) > 0 {
 		// Store all blobs first
-		if err := v.l2.PutBatch(blobsToStore); err != nil {
+		if err := v.store.PutBatch(blobsToStore); err != nil {
 			return "", types.CommitMetrics{}, fmt.Errorf("failed to store blobs in L2: %w", err)
 		}
 	}
 
-	// Build directory -> entries list
-	dirEntries := map[string][]string{} // dir -> []"name:type:childHex"
-	addEntry := func(dir, name, typ string, child types.Hash) {
-		dirEntries[dir] = append(dirEntries[dir], fmt.Sprintf("%s:%s:%x", name, typ, child.Digest))
-	}
-
-	// For every file, register at its parent dir
-	for path, h := range blobHashByPath {
-		dir := filepath.Dir(path)
-		if dir == "." || dir == "/" {
-			dir = "."
-		}
-		name := filepath.Base(path)
-		addEntry(dir, name, "blob", h)
-
-		// Ensure all ancestor dirs exist in the map
-		anc := dir
-		for anc != "." {
-			addEntry(anc, "", ".__ensure__", types.Hash{}) // placeholder to ensure key
-			anc = filepath.Dir(anc)
-			if anc == "" || anc == "/" {
-				anc = "."
-			}
-		}
-		// Also ensure root exists
-		_ = dirEntries["."]
-	}
-
-	// Topologically fold directories bottom-up to compute tree hashes.
-	// We do this by sorting all dirs by depth (deepest first).
-	allDirs := make([]string, 0, len(dirEntries))
-	for d := range dirEntries {
-		allDirs = append(allDirs, d)
-	}
-	sort.Slice(allDirs, func(i, j int) bool {
-		di, dj := depth(allDirs[i]), depth(allDirs[j])
-		if di == dj {
-			return allDirs[i] > allDirs[j] // stable
-		}
-		return di > dj // deeper first
-	})
-
-	treeHash := map[string]types.Hash{}
-	for _, d := range allDirs {
-		// Collect children entries: files we already have; dirs we must reference if present.
-		var entries []string
-
-		// Rebuild entries: include file entries already accumulated,
-		// and if directory has subdirectories, we will add them when their hash becomes available.
-		// The map currently holds only "file" entries and placeholders.
-		for _, raw := range dirEntries[d] {
-			// filter out ensure placeholders
-			if strings.Contains(raw, ":.__ensure__:") {
-				continue
-			}
-			entries = append(entries, raw)
-		}
-
-		// Add child directories that have this dir as parent
-		// (We detect by scanning all paths that start with d + "/something")
-		// Simpler: derive child dirs by scanning allDirs again.
-		for _, maybe := range allDirs {
-			if maybe == d {
-				continue
-			}
-			// parent detection: filepath.Dir(maybe) == d
-			if filepath.Dir(maybe) == d {
-				if h, ok := treeHash[maybe]; ok {
-					name := filepath.Base(maybe)
-					if d == "." && name == "." {
-						continue
-					}
-					entries = append(entries, fmt.Sprintf("%s:%s:%x", name, "tree", h.Digest))
-				}
-			}
-		}
-
-		// Deterministic hash for this directory
-		h, err := util.HashTree(entries)
-		if err != nil {
-			return "", types.CommitMetrics{}, err
-		}
-		treeHash[d] = h
-	}
-
-	root, hasRoot := treeHash["."]
-	if !hasRoot || len(root.Digest) == 0 {
-		// Empty tree: define as hash of empty entries
-		h, err := util.HashTree(nil)
-		if err != nil {
-			return "", types.CommitMetrics{}, err
-		}
-		root = h
+	// Fold blob hashes into the canonical Merkle tree; its root is the SnapshotID.
+	kinds := v.committedKinds(blobHashByPath)
+	root, err := buildTree(blobHashByPath, kinds)
+	if err != nil {
+		return "", types.CommitMetrics{}, err
 	}
 
 	id := types.SnapshotID(root.String())
 
 	// Store snapshot metadata in L2 before keeping in memory
-	if v.l2 != nil {
+	if v.store != nil {
 		// Store snapshot metadata (file list and hashes) alongside the blobs
 		snapshotData := make(map[string]types.Hash)
 		for path, hash := range blobHashByPath {
@@ -301,14 +270,25 @@ func (v *VST) Commit(msg string) (types.SnapshotID, types.CommitMetrics, error)
 			Hash: types.Hash{Algorithm: types.BLAKE3, Digest: []byte(snapshotKey)},
 			Value: metadataBytes,
 		}}
+		kindsMetadata, err := kindsEntry(id, kinds)
+		if err != nil {
+			return "", types.CommitMetrics{}, err
+		}
+		snapshotMetadata = append(snapshotMetadata, kindsMetadata...)
 		
-		if err := v.l2.PutBatch(snapshotMetadata); err != nil {
+		if err := v.store.PutBatch(snapshotMetadata); err != nil {
 			return "", types.CommitMetrics{}, fmt.Errorf("failed to store snapshot metadata: %w", err)
 		}
 	}
 
-	// Store the snapshot by content (keeps your existing restore/materialize/diff working)
-	v.snaps[id] = snap
+	// Store the snapshot by content (keeps your existing restore/materialize/diff working).
+	// A snapshot with hash-only entries is read back from its L2 manifest instead.
+	if hashOnly == 0 {
+		v.snaps[id] = snap
+		if kinds != nil {
+			v.snapKinds[id] = kinds
+		}
+	}
 
 	commitMetrics := types.CommitMetrics{
 		CommitLatency: time.Since(start),
@@ -326,32 +306,25 @@ func (v *VST) Commit(msg string) (types.SnapshotID, types.CommitMetrics, error)
 	return id, commitMetrics, nil
 }
 
-func depth(p string) int {
-	if p == "." || p == "" || p == "/" {
-		return 0
-	}
-	return strings.Count(filepath.Clean(p), string(os.PathSeparator))
-}
-
 // Restore replaces the current working set with the files from the given snapshot.
 func (v *VST) Restore(id types.SnapshotID) error {
 	dprintf("starting restore of snapshot %s (in-memory snapshots=%+v)", id, v.snaps)
 	base, ok := v.snaps[id]
-	if !ok && v.l2 == nil {
+	if !ok && v.store == nil {
 		return fmt.Errorf("unknown snapshot: %s", id)
 	}
 	
 	// If snapshot is not in memory but L2 is available, try to restore from L2
 	if !ok {
 		// Try to get snapshot metadata from L2
-		if v.l2 != nil {
+		if v.store != nil {
 			dprintf("restore: trying L2 restore for %s", id)
 			
 			// Get snapshot metadata
 			snapshotKey := string("snapshot:" + id)
 			dprintf("restore: trying to get metadata with key %s", snapshotKey)
 			metadataHash := types.Hash{Algorithm: types.BLAKE3, Digest: []byte(snapshotKey)}
-			metadataBytes, ok, err := v.l2.Get(metadataHash)
+			metadataBytes, ok, err := v.store.Get(metadataHash)
 			if err != nil {
 				return err
 			}
@@ -366,13 +339,20 @@ func (v *VST) Restore(id types.SnapshotID) error {
 			}
 			dprintf("restore: got snapshot metadata with %d files", len(snapshotData))
 			
+			kinds, err := v.loadKinds(id)
+			if err != nil {
+				return err
+			}
+
 			// Reset working state and use snapshot metadata as path→hash mapping
 			v.cur = make(map[string][]byte)
 			v.pathToHash = snapshotData
+			v.kinds = copyKinds(kinds)
 		}
 	}
-	// Copy in-memory snapshot to working set if not restoring from L2
-	if len(base) > 0 {
+	// Copy in-memory snapshot to working set if not restoring from L2. An
+	// empty snapshot still replaces the working set.
+	if ok {
 		next := make(map[string][]byte, len(base))
 		pathHashes := make(map[string]types.Hash, len(base))
 		for k, val := range base {
@@ -389,6 +369,7 @@ func (v *VST) Restore(id types.SnapshotID) error {
 		}
 		v.cur = next
 		v.pathToHash = pathHashes
+		v.kinds = copyKinds(v.snapKinds[id])
 	}
 	return nil
 }
@@ -0,0 +1,85 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vst
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/good-night-oppie/helios/internal/util"
+	"github.com/good-night-oppie/helios/pkg/helios/objstore"
+	"github.com/good-night-oppie/helios/pkg/helios/types"
+)
+
+func TestVST_WriteFileHash(t *testing.T) {
+	if err := New().WriteFileHash("a", types.Hash{}); err == nil {
+		t.Fatal("WriteFileHash without L2 should fail")
+	}
+
+	l2, err := objstore.Open(filepath.Join(t.TempDir(), "rocks"), nil)
+	if err != nil {
+		t.Fatalf("open l2: %v", err)
+	}
+	defer l2.Close()
+
+	v1 := New()
+	v1.AttachStores(nil, l2)
+	_ = v1.WriteFile("a.txt", []byte("alpha"))
+	_ = v1.WriteFile("dir/b.txt", []byte("beta"))
+	want, _, err := v1.Commit("full")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A fresh engine adds a.txt by hash only and rewrites dir/b.txt.
+	v2 := New()
+	v2.AttachStores(nil, l2)
+	ha, _ := util.HashBlob([]byte("alpha"))
+	if err := v2.WriteFileHash("a.txt", ha); err != nil {
+		t.Fatal(err)
+	}
+	_ = v2.WriteFile("dir/b.txt", []byte("beta"))
+	got, _, err := v2.Commit("by hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Fatalf("snapshot id %s, want %s", got, want)
+	}
+	if b, err := v2.ReadFile("a.txt"); err != nil || string(b) != "alpha" {
+		t.Fatalf("ReadFile(a.txt) = %q, %v", b, err)
+	}
+
+	_ = v2.WriteFile("dir/b.txt", []byte("BETA"))
+	_ = v2.WriteFile("c.txt", []byte("gamma"))
+	next, _, err := v2.Commit("change")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The snapshots with hash-only entries live only in L2; Diff reads their manifests.
+	stats, err := v2.Diff(got, next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats != (types.DiffStats{Added: 1, Changed: 1}) {
+		t.Fatalf("diff = %+v", stats)
+	}
+	if err := v2.Restore(got); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := v2.ReadFile("dir/b.txt"); string(b) != "beta" {
+		t.Fatalf("restored dir/b.txt = %q", b)
+	}
+}
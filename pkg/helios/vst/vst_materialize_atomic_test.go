@@ -0,0 +1,109 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vst
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/good-night-oppie/helios/pkg/helios/types"
+)
+
+func TestVST_Materialize_ParallelWritesAllFiles(t *testing.T) {
+	v := New()
+	for i := 0; i < 300; i++ {
+		_ = v.WriteFile(fmt.Sprintf("d%d/f%d.txt", i%7, i), []byte(fmt.Sprintf("content-%d", i)))
+	}
+	id, _, err := v.Commit("many")
+	if err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+
+	out := filepath.Join(t.TempDir(), "nested", "out")
+	m, err := v.Materialize(id, out, types.MatOpts{Workers: 4})
+	if err != nil {
+		t.Fatalf("materialize: %v", err)
+	}
+	if m.NewObjects != 300 {
+		t.Fatalf("want 300 files written, got %d", m.NewObjects)
+	}
+	for _, phase := range []string{"resolve", "write", "publish"} {
+		if _, ok := m.Phases[phase]; !ok {
+			t.Fatalf("missing %q phase timing: %v", phase, m.Phases)
+		}
+	}
+	for i := 0; i < 300; i += 37 {
+		b, err := os.ReadFile(filepath.Join(out, fmt.Sprintf("d%d/f%d.txt", i%7, i)))
+		if err != nil || string(b) != fmt.Sprintf("content-%d", i) {
+			t.Fatalf("file %d: %q err=%v", i, b, err)
+		}
+	}
+	assertNoStagingDirs(t, filepath.Dir(out))
+}
+
+func TestVST_Materialize_RefusesNonEmptyOutDir(t *testing.T) {
+	v := New()
+	_ = v.WriteFile("a.txt", []byte("a"))
+	id, _, _ := v.Commit("one")
+
+	out := t.TempDir()
+	keep := filepath.Join(out, "keep.txt")
+	if err := os.WriteFile(keep, []byte("mine"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.Materialize(id, out, types.MatOpts{}); !errors.Is(err, ErrOutDirNotEmpty) {
+		t.Fatalf("want ErrOutDirNotEmpty, got %v", err)
+	}
+	if b, _ := os.ReadFile(keep); string(b) != "mine" {
+		t.Fatal("existing file was modified")
+	}
+	if _, err := os.Stat(filepath.Join(out, "a.txt")); !os.IsNotExist(err) {
+		t.Fatal("no snapshot file should appear in a refused outDir")
+	}
+}
+
+func TestVST_Materialize_FailureLeavesNoPartialTree(t *testing.T) {
+	v := New()
+	_ = v.WriteFile("ok.txt", []byte("ok"))
+	_ = v.WriteFile("../escape.txt", []byte("bad"))
+	id, _, err := v.Commit("escape")
+	if err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+
+	parent := t.TempDir()
+	out := filepath.Join(parent, "out")
+	if _, err := v.Materialize(id, out, types.MatOpts{}); err == nil {
+		t.Fatal("expected error for a path escaping outDir")
+	}
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Fatal("outDir must not exist after a failed materialize")
+	}
+	if _, err := os.Stat(filepath.Join(parent, "escape.txt")); !os.IsNotExist(err) {
+		t.Fatal("escaping file was written")
+	}
+	assertNoStagingDirs(t, parent)
+}
+
+func assertNoStagingDirs(t *testing.T, dir string) {
+	t.Helper()
+	leftovers, _ := filepath.Glob(filepath.Join(dir, ".*.helios-stage-*"))
+	if len(leftovers) > 0 {
+		t.Fatalf("staging directories left behind: %v", leftovers)
+	}
+}
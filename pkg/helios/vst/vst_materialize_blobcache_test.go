@@ -0,0 +1,153 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vst
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/good-night-oppie/helios/pkg/helios/objstore"
+	"github.com/good-night-oppie/helios/pkg/helios/types"
+)
+
+func commitSample(t *testing.T, v *VST) types.SnapshotID {
+	t.Helper()
+	_ = v.WriteFile("a.txt", []byte("alpha"))
+	_ = v.WriteFile("dir/b.txt", []byte("beta"))
+	_ = v.WriteFile("dir/dup.txt", []byte("alpha"))
+	id, _, err := v.Commit("sample")
+	if err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	return id
+}
+
+func countCacheBlobs(t *testing.T, dir string) int {
+	t.Helper()
+	n := 0
+	_ = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			n++
+		}
+		return err
+	})
+	return n
+}
+
+func TestVST_Materialize_BlobCacheReadOnlyHardlinks(t *testing.T) {
+	v := New()
+	id := commitSample(t, v)
+	cache := t.TempDir()
+	out := filepath.Join(t.TempDir(), "out")
+
+	m, err := v.Materialize(id, out, types.MatOpts{BlobCache: cache, ReadOnly: true})
+	if err != nil {
+		t.Fatalf("materialize: %v", err)
+	}
+	if m.NewObjects != 3 || m.NewBytes != 14 {
+		t.Fatalf("metrics: %+v", m)
+	}
+	if n := countCacheBlobs(t, cache); n != 2 {
+		t.Fatalf("identical files should share one cache blob, got %d blobs", n)
+	}
+
+	a, _ := os.Stat(filepath.Join(out, "a.txt"))
+	dup, _ := os.Stat(filepath.Join(out, "dir", "dup.txt"))
+	if !os.SameFile(a, dup) {
+		t.Fatal("read-only output should hardlink identical files to the same cache blob")
+	}
+	if a.Mode().Perm()&0o222 != 0 {
+		t.Fatalf("read-only output is writable: %v", a.Mode())
+	}
+	if b, _ := os.ReadFile(filepath.Join(out, "dir", "b.txt")); string(b) != "beta" {
+		t.Fatalf("dir/b.txt = %q", b)
+	}
+}
+
+func TestVST_Materialize_BlobCacheWritableOutputIsIndependent(t *testing.T) {
+	v := New()
+	id := commitSample(t, v)
+	cache := t.TempDir()
+	out := filepath.Join(t.TempDir(), "out")
+
+	if _, err := v.Materialize(id, out, types.MatOpts{BlobCache: cache}); err != nil {
+		t.Fatalf("materialize: %v", err)
+	}
+	p := filepath.Join(out, "a.txt")
+	info, err := os.Stat(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o644 {
+		t.Fatalf("mode = %v, want 0644", info.Mode().Perm())
+	}
+	if err := os.WriteFile(p, []byte("changed"), 0o644); err != nil {
+		t.Fatalf("output should be writable: %v", err)
+	}
+
+	// The cache blob is untouched, so a second checkout still sees the original.
+	out2 := filepath.Join(t.TempDir(), "out2")
+	if _, err := v.Materialize(id, out2, types.MatOpts{BlobCache: cache, Workers: 1}); err != nil {
+		t.Fatalf("second materialize: %v", err)
+	}
+	for _, f := range []string{"a.txt", "dir/dup.txt"} {
+		if b, _ := os.ReadFile(filepath.Join(out2, f)); string(b) != "alpha" {
+			t.Fatalf("%s = %q, cache was modified through the output", f, b)
+		}
+	}
+}
+
+func TestVST_Materialize_BlobCacheFromL2(t *testing.T) {
+	l2, err := objstore.Open(filepath.Join(t.TempDir(), "rocks"), nil)
+	if err != nil {
+		t.Fatalf("open l2: %v", err)
+	}
+	defer l2.Close()
+
+	v1 := New()
+	v1.AttachStores(nil, l2)
+	id := commitSample(t, v1)
+
+	// A fresh engine only knows the snapshot through its L2 manifest.
+	v2 := New()
+	v2.AttachStores(nil, l2)
+	cache := t.TempDir()
+	out := filepath.Join(t.TempDir(), "out")
+	if _, err := v2.Materialize(id, out, types.MatOpts{BlobCache: cache, ReadOnly: true}); err != nil {
+		t.Fatalf("materialize: %v", err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(out, "dir", "dup.txt")); string(b) != "alpha" {
+		t.Fatalf("dir/dup.txt = %q", b)
+	}
+
+	// Sync reuses the cache for the files it rewrites.
+	if err := os.Remove(filepath.Join(out, "a.txt")); err != nil {
+		t.Fatal(err)
+	}
+	m, err := v2.Materialize(id, out, types.MatOpts{BlobCache: cache, ReadOnly: true, Sync: true})
+	if err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if m.NewObjects != 1 {
+		t.Fatalf("sync should restore only a.txt, wrote %d", m.NewObjects)
+	}
+	a, _ := os.Stat(filepath.Join(out, "a.txt"))
+	dup, _ := os.Stat(filepath.Join(out, "dir", "dup.txt"))
+	if !os.SameFile(a, dup) {
+		t.Fatal("synced file should be hardlinked from the cache")
+	}
+}
@@ -0,0 +1,257 @@
+// Copyright 2025 Oppie Thunder Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vst
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/good-night-oppie/helios/pkg/helios/types"
+)
+
+func TestVST_MaterializeSync_WritesOnlyDiff(t *testing.T) {
+	v := New()
+	_ = v.WriteFile("keep.txt", []byte("same"))
+	_ = v.WriteFile("edit.txt", []byte("old"))
+	_ = v.WriteFile("gone/old.txt", []byte("bye"))
+	idA, _, _ := v.Commit("A")
+
+	v.DeleteFile("gone/old.txt")
+	_ = v.WriteFile("edit.txt", []byte("new!"))
+	_ = v.WriteFile("add/new.txt", []byte("hi"))
+	idB, _, _ := v.Commit("B")
+
+	out := filepath.Join(t.TempDir(), "work")
+	m, err := v.Materialize(idA, out, types.MatOpts{Sync: true})
+	if err != nil {
+		t.Fatalf("sync A: %v", err)
+	}
+	if m.NewObjects != 3 {
+		t.Fatalf("first sync should write 3 files, wrote %d", m.NewObjects)
+	}
+
+	// Age keep.txt so we can tell whether it gets rewritten.
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	keep := filepath.Join(out, "keep.txt")
+	if err := os.Chtimes(keep, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err = v.Materialize(idB, out, types.MatOpts{Sync: true})
+	if err != nil {
+		t.Fatalf("sync B: %v", err)
+	}
+	if m.NewObjects != 2 {
+		t.Fatalf("want 2 files written (edit + add), got %d", m.NewObjects)
+	}
+	for _, phase := range []string{"resolve", "scan", "write", "delete"} {
+		if _, ok := m.Phases[phase]; !ok {
+			t.Fatalf("missing %q phase timing: %v", phase, m.Phases)
+		}
+	}
+	if info, _ := os.Stat(keep); !info.ModTime().Equal(old) {
+		t.Fatal("unchanged file was rewritten")
+	}
+	if b, _ := os.ReadFile(filepath.Join(out, "edit.txt")); string(b) != "new!" {
+		t.Fatalf("edit.txt = %q", b)
+	}
+	if _, err := os.Stat(filepath.Join(out, "gone")); !os.IsNotExist(err) {
+		t.Fatal("deleted file's now-empty directory should be removed")
+	}
+
+	// A repeat sync has nothing to do.
+	m, err = v.Materialize(idB, out, types.MatOpts{Sync: true})
+	if err != nil || m.NewObjects != 0 {
+		t.Fatalf("repeat sync wrote %d files, err=%v", m.NewObjects, err)
+	}
+}
+
+func TestVST_MaterializeSync_DetectsSameSizeEdits(t *testing.T) {
+	v := New()
+	_ = v.WriteFile("a.txt", []byte("aaaa"))
+	id, _, _ := v.Commit("A")
+
+	out := t.TempDir()
+	if _, err := v.Materialize(id, out, types.MatOpts{Sync: true}); err != nil {
+		t.Fatal(err)
+	}
+	// Same size, different content, and an mtime that matches nothing recorded.
+	p := filepath.Join(out, "a.txt")
+	if err := os.WriteFile(p, []byte("bbbb"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := v.Materialize(id, out, types.MatOpts{Sync: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.NewObjects != 1 {
+		t.Fatalf("tampered file should be rewritten, wrote %d", m.NewObjects)
+	}
+	if b, _ := os.ReadFile(p); string(b) != "aaaa" {
+		t.Fatalf("a.txt = %q", b)
+	}
+}
+
+func TestVST_MaterializeSync_LeavesUnselectedFiles(t *testing.T) {
+	v := New()
+	_ = v.WriteFile("src/a.go", []byte("a"))
+	id, _, _ := v.Commit("A")
+
+	out := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(out, "docs"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	notes := filepath.Join(out, "docs", "notes.md")
+	if err := os.WriteFile(notes, []byte("mine"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	stale := filepath.Join(out, "src", "stale.go")
+	if err := os.MkdirAll(filepath.Dir(stale), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(stale, []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := v.Materialize(id, out, types.MatOpts{Include: []string{"src/**"}, Sync: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(notes); err != nil {
+		t.Fatal("file outside the selectors must be left alone")
+	}
+	if _, err := os.Stat(stale); err != nil {
+		t.Fatal("selected extra no sync wrote must be kept without Prune")
+	}
+
+	if _, err := v.Materialize(id, out, types.MatOpts{Include: []string{"src/**"}, Sync: true, Prune: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Fatal("selected extra should be deleted with Prune")
+	}
+	if _, err := os.Stat(notes); err != nil {
+		t.Fatal("Prune must still leave files outside the selectors")
+	}
+}
+
+func TestVST_MaterializeSync_RecordOutlivesVST(t *testing.T) {
+	v := New()
+	_ = v.WriteFile("a.txt", []byte("a"))
+	_ = v.WriteFile("old/b.txt", []byte("b"))
+	idA, _, _ := v.Commit("A")
+
+	out := t.TempDir()
+	if _, err := v.Materialize(idA, out, types.MatOpts{Sync: true}); err != nil {
+		t.Fatal(err)
+	}
+	mine := filepath.Join(out, "mine.txt")
+	if err := os.WriteFile(mine, []byte("mine"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A separate VST, as in a later CLI process, still knows what was written.
+	w := New()
+	_ = w.WriteFile("a.txt", []byte("a"))
+	idB, _, _ := w.Commit("B")
+	m, err := w.Materialize(idB, out, types.MatOpts{Sync: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.NewObjects != 0 {
+		t.Fatalf("unchanged file was rewritten: wrote %d", m.NewObjects)
+	}
+	if _, err := os.Stat(filepath.Join(out, "old")); !os.IsNotExist(err) {
+		t.Fatal("file an earlier sync wrote should be deleted without Prune")
+	}
+	if _, err := os.Stat(mine); err != nil {
+		t.Fatal("file no sync wrote must be kept without Prune")
+	}
+	if _, err := os.Stat(filepath.Join(out, filepath.FromSlash(syncRecordFile))); err != nil {
+		t.Fatalf("sync record: %v", err)
+	}
+}
+
+func TestVST_MaterializeSync_SparesRepositories(t *testing.T) {
+	v := New()
+	_ = v.WriteFile("main.go", []byte("package main"))
+	id, _, _ := v.Commit("A")
+
+	// Sync into a working tree that holds a git repository and a Helios store.
+	out := t.TempDir()
+	mine := filepath.Join(out, "notes.txt")
+	keep := []string{
+		filepath.Join(out, ".git", "HEAD"),
+		filepath.Join(out, ".git", "objects", "ab", "cdef"),
+		filepath.Join(out, ".helios", "format.json"),
+		filepath.Join(out, ".helios", "objects", "CURRENT"),
+		filepath.Join(out, "vendor", "lib", ".git", "config"),
+		mine,
+	}
+	for _, p := range keep {
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := v.Materialize(id, out, types.MatOpts{Sync: true}); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range keep {
+		if _, err := os.Stat(p); err != nil {
+			t.Fatalf("%s removed by sync: %v", p, err)
+		}
+	}
+
+	// Prune deletes the untracked file but still spares the repositories.
+	if _, err := v.Materialize(id, out, types.MatOpts{Sync: true, Prune: true}); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range keep[:5] {
+		if _, err := os.Stat(p); err != nil {
+			t.Fatalf("%s removed by pruning sync: %v", p, err)
+		}
+	}
+	if _, err := os.Stat(mine); !os.IsNotExist(err) {
+		t.Fatal("Prune should delete a selected extra")
+	}
+	if b, _ := os.ReadFile(filepath.Join(out, "main.go")); string(b) != "package main" {
+		t.Fatalf("main.go = %q", b)
+	}
+}
+
+func TestVST_MaterializeSync_FileReplacedByDirectory(t *testing.T) {
+	v := New()
+	_ = v.WriteFile("x", []byte("file"))
+	idA, _, _ := v.Commit("A")
+	v.DeleteFile("x")
+	_ = v.WriteFile("x/y", []byte("nested"))
+	idB, _, _ := v.Commit("B")
+
+	out := t.TempDir()
+	if _, err := v.Materialize(idA, out, types.MatOpts{Sync: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.Materialize(idB, out, types.MatOpts{Sync: true}); err != nil {
+		t.Fatalf("sync B: %v", err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(out, "x", "y")); string(b) != "nested" {
+		t.Fatalf("x/y = %q", b)
+	}
+}
@@ -16,12 +16,8 @@ package vst
 import (
 	"encoding/json"
 	"fmt"
-	"path/filepath"
-	"sort"
-	"strings"
 	"time"
 
-	"github.com/good-night-oppie/helios/internal/util"
 	"github.com/good-night-oppie/helios/pkg/helios/objstore"
 	"github.com/good-night-oppie/helios/pkg/helios/types"
 )
@@ -45,18 +41,17 @@ func (v *VST) CommitOptimized(msg string) (types.SnapshotID, types.CommitMetrics
 	}
 
 	// OPTIMIZATION 2: Batch compute all blob hashes
-	blobHashByPath := make(map[string]types.Hash, len(snap))
+	blobHashByPath, err := hashBlobs(snap)
+	if err != nil {
+		return "", types.CommitMetrics{}, err
+	}
 	blobsToStore := make([]objstore.BatchEntry, 0, len(snap))
 	
 	for path, content := range snap {
-		h, err := util.HashBlob(content)
-		if err != nil {
-			return "", types.CommitMetrics{}, err
-		}
-		blobHashByPath[path] = h
+		h := blobHashByPath[path]
 		v.pathToHash[path] = h
 
-		if v.l2 != nil {
+		if v.store != nil {
 			blobsToStore = append(blobsToStore, objstore.BatchEntry{
 				Hash:  h,
 				Value: content,
@@ -65,14 +60,16 @@ func (v *VST) CommitOptimized(msg string) (types.SnapshotID, types.CommitMetrics
 	}
 
 	// Store blobs in L2 if attached
-	if v.l2 != nil && len(blobsToStore) > 0 {
-		if err := v.l2.PutBatch(blobsToStore); err != nil {
+	if v.store != nil && len(blobsToStore) > 0 {
+		if err := v.store.PutBatch(blobsToStore); err != nil {
 			return "", types.CommitMetrics{}, fmt.Errorf("failed to store blobs in L2: %w", err)
 		}
 	}
 
-	// OPTIMIZATION 3: Efficient O(n) directory tree building
-	root, err := v.buildDirectoryTreeOptimized(blobHashByPath)
+	// OPTIMIZATION 3: Single-pass directory tree building
+	kinds := v.committedKinds(blobHashByPath)
+	v.kinds = nil
+	root, err := buildTree(blobHashByPath, kinds)
 	if err != nil {
 		return "", types.CommitMetrics{}, err
 	}
@@ -80,7 +77,7 @@ func (v *VST) CommitOptimized(msg string) (types.SnapshotID, types.CommitMetrics
 	id := types.SnapshotID(root.String())
 
 	// Store snapshot metadata in L2
-	if v.l2 != nil {
+	if v.store != nil {
 		metadataBytes, err := json.Marshal(blobHashByPath)
 		if err != nil {
 			return "", types.CommitMetrics{}, fmt.Errorf("failed to marshal snapshot metadata: %w", err)
@@ -91,14 +88,22 @@ func (v *VST) CommitOptimized(msg string) (types.SnapshotID, types.CommitMetrics
 			Hash: types.Hash{Algorithm: types.BLAKE3, Digest: []byte(snapshotKey)},
 			Value: metadataBytes,
 		}}
+		kindsMetadata, err := kindsEntry(id, kinds)
+		if err != nil {
+			return "", types.CommitMetrics{}, err
+		}
+		snapshotMetadata = append(snapshotMetadata, kindsMetadata...)
 		
-		if err := v.l2.PutBatch(snapshotMetadata); err != nil {
+		if err := v.store.PutBatch(snapshotMetadata); err != nil {
 			return "", types.CommitMetrics{}, fmt.Errorf("failed to store snapshot metadata: %w", err)
 		}
 	}
 
 	// Store snapshot using COW reference
 	v.snaps[id] = snap
+	if kinds != nil {
+		v.snapKinds[id] = kinds
+	}
 
 	commitMetrics := types.CommitMetrics{
 		CommitLatency: time.Since(start),
@@ -115,121 +120,3 @@ func (v *VST) CommitOptimized(msg string) (types.SnapshotID, types.CommitMetrics
 
 	return id, commitMetrics, nil
 }
-
-// buildDirectoryTreeOptimized builds directory Merkle tree in O(n) time
-// Key optimization: Single-pass parent-child mapping instead of nested loops
-func (v *VST) buildDirectoryTreeOptimized(blobHashByPath map[string]types.Hash) (types.Hash, error) {
-	if len(blobHashByPath) == 0 {
-		// Empty tree
-		return util.HashTree(nil)
-	}
-
-	// OPTIMIZATION: Build parent-child relationship map in single pass O(n)
-	type DirInfo struct {
-		children map[string]types.Hash  // child name -> hash
-		depth    int
-	}
-	
-	dirMap := make(map[string]*DirInfo)
-	
-	// Initialize all directories
-	ensureDir := func(dir string) *DirInfo {
-		if info, exists := dirMap[dir]; exists {
-			return info
-		}
-		
-		info := &DirInfo{
-			children: make(map[string]types.Hash),
-			depth:    strings.Count(dir, "/"),
-		}
-		if dir == "." {
-			info.depth = 0
-		}
-		dirMap[dir] = info
-		return info
-	}
-
-	// Single pass: register all files and their parent directories
-	for path, hash := range blobHashByPath {
-		dir := filepath.Dir(path)
-		if dir == "/" || dir == "" {
-			dir = "."
-		}
-		
-		// Ensure this directory exists
-		dirInfo := ensureDir(dir)
-		
-		// Register file in parent directory
-		fileName := filepath.Base(path)
-		dirInfo.children[fileName] = hash
-		
-		// Ensure all ancestor directories exist
-		ancestor := dir
-		for ancestor != "." {
-			parent := filepath.Dir(ancestor)
-			if parent == "/" || parent == "" || parent == ancestor {
-				parent = "."
-			}
-			ensureDir(parent)
-			ancestor = parent
-		}
-		ensureDir(".") // Ensure root exists
-	}
-
-	// OPTIMIZATION: Sort directories by depth (deepest first) in O(n log n)
-	var dirs []string
-	for dir := range dirMap {
-		dirs = append(dirs, dir)
-	}
-	
-	sort.Slice(dirs, func(i, j int) bool {
-		depthI, depthJ := dirMap[dirs[i]].depth, dirMap[dirs[j]].depth
-		if depthI == depthJ {
-			return dirs[i] > dirs[j] // Stable sort
-		}
-		return depthI > depthJ // Deeper directories first
-	})
-
-	// Compute directory hashes bottom-up in O(n) time
-	dirHashes := make(map[string]types.Hash)
-	
-	for _, dir := range dirs {
-		dirInfo := dirMap[dir]
-		
-		// Collect entries for this directory
-		var entries []string
-		
-		// Add file entries (blobs)
-		for childName, childHash := range dirInfo.children {
-			entries = append(entries, fmt.Sprintf("%s:blob:%x", childName, childHash.Digest))
-		}
-		
-		// Add subdirectory entries (trees) - O(1) lookup instead of O(n) scan
-		for _, potentialChild := range dirs {
-			if potentialChild == dir {
-				continue
-			}
-			if filepath.Dir(potentialChild) == dir {
-				if childHash, exists := dirHashes[potentialChild]; exists {
-					childName := filepath.Base(potentialChild)
-					entries = append(entries, fmt.Sprintf("%s:tree:%x", childName, childHash.Digest))
-				}
-			}
-		}
-
-		// Compute deterministic hash for this directory
-		hash, err := util.HashTree(entries)
-		if err != nil {
-			return types.Hash{}, err
-		}
-		dirHashes[dir] = hash
-	}
-
-	// Return root directory hash
-	if rootHash, exists := dirHashes["."]; exists {
-		return rootHash, nil
-	}
-	
-	// Empty tree fallback
-	return util.HashTree(nil)
-}
\ No newline at end of file
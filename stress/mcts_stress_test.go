@@ -118,6 +118,69 @@ func BenchmarkMuZeroDynamics(b *testing.B) {
 	b.ReportMetric(float64(b.N*LookaheadDepth*ParallelEnvs), "state_updates")
 }
 
+// mctsRollouts replays the node reads of an MCTS search: every rollout
+// descends from the root, mostly along the current best child and sometimes
+// exploring, so nodes near the root are read on every rollout while deep
+// nodes are read once or twice.
+func mctsRollouts(rng *rand.Rand, rollouts int, visit func(node uint64)) {
+	const (
+		branching = 8
+		maxDepth  = 14
+		exploit   = 0.7
+	)
+	for r := 0; r < rollouts; r++ {
+		node := uint64(0)
+		for depth := 0; depth < maxDepth; depth++ {
+			visit(node)
+			child := uint64(0)
+			if rng.Float64() >= exploit {
+				child = uint64(rng.Intn(branching))
+			}
+			node = node*branching + child + 1
+		}
+	}
+}
+
+// BenchmarkMCTSCacheHitRatio compares L1 eviction policies on the node reads
+// of an MCTS search, with an L1 holding about a tenth of the nodes touched.
+// Each read that misses fills the cache, as a read through L2 does.
+func BenchmarkMCTSCacheHitRatio(b *testing.B) {
+	const (
+		rollouts  = 20000
+		stateSize = 1024
+	)
+	for _, policy := range []l1cache.Policy{l1cache.FIFO, l1cache.LRU, l1cache.ARC} {
+		b.Run(policy.String(), func(b *testing.B) {
+			state := make([]byte, stateSize)
+			var hits, reads uint64
+			for i := 0; i < b.N; i++ {
+				l1, err := l1cache.New(l1cache.Config{
+					CapacityBytes:        4000 * stateSize,
+					CompressionThreshold: 1 << 20,
+					Policy:               policy,
+				})
+				if err != nil {
+					b.Fatal(err)
+				}
+				digest := make([]byte, 8)
+				mctsRollouts(rand.New(rand.NewSource(1)), rollouts, func(node uint64) {
+					for j := range digest {
+						digest[j] = byte(node >> (8 * j))
+					}
+					h := types.Hash{Algorithm: types.BLAKE3, Digest: digest}
+					if _, ok := l1.Get(h); !ok {
+						l1.Put(h, state)
+					}
+				})
+				st := l1.Stats()
+				hits += st.Hits
+				reads += st.Hits + st.Misses
+			}
+			b.ReportMetric(100*float64(hits)/float64(reads), "hit%")
+		})
+	}
+}
+
 // TestConcurrentMCTS tests massive parallel tree operations
 // Target: 1,000+ concurrent MCTS agents, zero lock contention
 func TestConcurrentMCTS(t *testing.T) {
@@ -16,6 +16,7 @@ package benchmark
 import (
 	"bytes"
 	"math/rand"
+	"path/filepath"
 	"strconv"
 	"testing"
 	"time"
@@ -162,11 +163,12 @@ func BenchmarkMaterialize(b *testing.B) {
 				_ = eng.WriteFile("mat/"+strconv.Itoa(i/100)+"/file_"+strconv.Itoa(i), buf)
 			}
 			snapID, _, _ := eng.Commit("benchmark snapshot")
-			out := b.TempDir()
+			base := b.TempDir()
 			
 			b.ResetTimer()
 			for i := 0; i < b.N; i++ {
-				// Materialize full tree
+				// Materialize full tree into a fresh directory each iteration
+				out := filepath.Join(base, strconv.Itoa(i))
 				_, err := eng.Materialize(snapID, out, types.MatOpts{})
 				if err != nil {
 					b.Fatal(err)